@@ -2,8 +2,6 @@ package handlers
 
 import (
 	"context"
-	"crypto/rsa"
-	"encoding/json"
 	"errors"
 	"time"
 
@@ -18,21 +16,27 @@ import (
 )
 
 type RMQHandlers interface {
-	Login(ctx context.Context, body []byte) ([]byte, error)
-	Refresh(ctx context.Context, body []byte) ([]byte, error)
-	Revoke(ctx context.Context, body []byte) ([]byte, error)
-	CreateAccount(ctx context.Context, body []byte) ([]byte, error)
-	ActivateAccount(ctx context.Context, body []byte) ([]byte, error)
-	GetSession(ctx context.Context, body []byte) ([]byte, error)
-	RefreshSession(ctx context.Context, body []byte) ([]byte, error)
-	DeleteSession(ctx context.Context, body []byte) ([]byte, error)
+	Login(ctx context.Context, request *auth.LoginRequest) (*auth.TokenResponse, error)
+	Refresh(ctx context.Context, request *auth.RefreshRequest) (*auth.RefreshResponse, error)
+	Revoke(ctx context.Context, request *struct{}) (*struct{}, error)
+	CreateAccount(ctx context.Context, request *auth.AccountCreationRequest) (*auth.AccountCreationResponse, error)
+	ActivateAccount(ctx context.Context, request *auth.ActivateAccountRequest) (*auth.ActivateAccountResponse, error)
+	GetSession(ctx context.Context, request *auth.GetSessionRequest) (*auth.SessionResponse, error)
+	RefreshSession(ctx context.Context, request *auth.RefreshSessionRequest) (*auth.SessionResponse, error)
+	DeleteSession(ctx context.Context, request *auth.DeleteSessionRequest) (*auth.DeleteSessionResponse, error)
+}
+
+// Keys gives the keys tokens are signed and verified with, such as a
+// config.KeyRing.
+type Keys interface {
+	middleware.KeySet
+	SigningKey() (*config.SigningKey, error)
 }
 
 type rmqHanders struct {
 	accountsManager managers.AccountsManager
 	tokenExp        time.Duration
-	privKey         *rsa.PrivateKey
-	pubKey          *rsa.PublicKey
+	keys            Keys
 	signer          jwt.SigningMethod
 	sessionsManager managers.SessionsManager
 }
@@ -41,23 +45,30 @@ func NewRMQHandlers(
 	accountsManager managers.AccountsManager,
 	sessionsManager managers.SessionsManager,
 	tokenExp time.Duration,
-	keys *config.Keys,
+	keys Keys,
 ) RMQHandlers {
 	return &rmqHanders{
 		accountsManager: accountsManager,
 		sessionsManager: sessionsManager,
 		tokenExp:        tokenExp,
-		privKey:         keys.Private,
-		pubKey:          keys.Public,
+		keys:            keys,
 		signer:          jwt.GetSigningMethod("RS256"),
 	}
 }
 
-func (h *rmqHanders) Login(ctx context.Context, body []byte) ([]byte, error) {
-	request := &auth.LoginRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		return nil, auth.ErrInvalidRequest
+// sign signs claims with the current signing key, naming it in the kid
+// header so verifiers pick the matching public key.
+func (h *rmqHanders) sign(claims *middleware.Claims) (string, error) {
+	key, err := h.keys.SigningKey()
+	if err != nil {
+		return "", err
 	}
+	token := jwt.NewWithClaims(h.signer, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
+}
+
+func (h *rmqHanders) Login(ctx context.Context, request *auth.LoginRequest) (*auth.TokenResponse, error) {
 	creds := request.Credentials
 	// get account info and check if the passwords match
 	account, err := h.accountsManager.GetAccountByUsername(ctx, creds.Username)
@@ -92,26 +103,17 @@ func (h *rmqHanders) Login(ctx context.Context, body []byte) ([]byte, error) {
 			ExpiresAt: expirationTime.Unix(), // In JWT, the expiry time is expressed as unix milliseconds
 		},
 	}
-	token := jwt.NewWithClaims(h.signer, clms)
-	signedToken, err := token.SignedString(h.privKey)
+	signedToken, err := h.sign(clms)
 	if err != nil {
 		return nil, auth.ErrTokenSignatureFailed
 	}
-	bts, err := json.Marshal(auth.TokenResponse{
+	return &auth.TokenResponse{
 		Token: signedToken,
-	})
-	if err != nil {
-		return nil, auth.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) Refresh(ctx context.Context, body []byte) ([]byte, error) {
-	request := &auth.RefreshRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		return nil, auth.ErrInvalidRequest
-	}
-	claims, err := middleware.ValidateToken(request.Token, h.pubKey)
+func (h *rmqHanders) Refresh(ctx context.Context, request *auth.RefreshRequest) (*auth.RefreshResponse, error) {
+	claims, err := middleware.ValidateToken(request.Token, h.keys)
 	if err != nil {
 		return nil, auth.ErrUnauthorized
 	}
@@ -123,32 +125,23 @@ func (h *rmqHanders) Refresh(ctx context.Context, body []byte) ([]byte, error) {
 		return nil, auth.ErrSessionCreationFailed
 	}
 
-	token := jwt.NewWithClaims(h.signer, claims)
-	signedToken, err := token.SignedString(h.privKey)
+	signedToken, err := h.sign(claims)
 	if err != nil {
 		return nil, auth.ErrTokenSignatureFailed
 	}
-	bts, err := json.Marshal(auth.RefreshResponse{
+	return &auth.RefreshResponse{
 		Token: signedToken,
-	})
-	if err != nil {
-		return nil, auth.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) Revoke(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) Revoke(ctx context.Context, request *struct{}) (*struct{}, error) {
 	logger := rmq.GetLogger(ctx)
 	logger.Debug("not implemented")
-	return []byte{}, nil
+	return &struct{}{}, nil
 }
 
-func (h *rmqHanders) CreateAccount(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) CreateAccount(ctx context.Context, request *auth.AccountCreationRequest) (*auth.AccountCreationResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &auth.AccountCreationRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		return nil, auth.ErrInvalidRequest
-	}
 	account, err := h.accountsManager.CreateAccount(ctx, request.Username, request.Email, request.Password, []auth.Role{
 		auth.UserRole,
 	})
@@ -163,59 +156,35 @@ func (h *rmqHanders) CreateAccount(ctx context.Context, body []byte) ([]byte, er
 			"accountID": account.ID,
 		}).
 		Info("account created")
-	bts, err := json.Marshal(auth.AccountCreationResponse{
+	return &auth.AccountCreationResponse{
 		AccountID: account.ID,
-	})
-	if err != nil {
-		return nil, auth.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
-func (h *rmqHanders) ActivateAccount(ctx context.Context, body []byte) ([]byte, error) {
-	request := &auth.ActivateAccountRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		return nil, auth.ErrInvalidRequest
-	}
+func (h *rmqHanders) ActivateAccount(ctx context.Context, request *auth.ActivateAccountRequest) (*auth.ActivateAccountResponse, error) {
 	accountID := request.AccountID
 	if err := h.accountsManager.ActivateAccount(ctx, accountID); err != nil {
 		return nil, auth.ErrAccountActivationFailed
 	}
-	bts, err := json.Marshal(auth.ActivateAccountResponse{
+	return &auth.ActivateAccountResponse{
 		AccountID: accountID,
-	})
-	if err != nil {
-		return nil, auth.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) GetSession(ctx context.Context, body []byte) ([]byte, error) {
-	request := &auth.GetSessionRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		return nil, auth.ErrInvalidRequest
-	}
+func (h *rmqHanders) GetSession(ctx context.Context, request *auth.GetSessionRequest) (*auth.SessionResponse, error) {
 	sessionID := request.SessionID
 	session, err := h.sessionsManager.Get(ctx, sessionID)
 	if err != nil {
 		return nil, auth.ErrNoSessionFound
 	}
-	bts, err := json.Marshal(auth.SessionResponse{
+	return &auth.SessionResponse{
 		SessionID: session.SessionID,
 		UserID:    session.UserID,
 		Username:  session.Username,
 		Roles:     session.Roles,
-	})
-	if err != nil {
-		return nil, auth.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) RefreshSession(ctx context.Context, body []byte) ([]byte, error) {
-	request := &auth.RefreshSessionRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		return nil, auth.ErrInvalidRequest
-	}
+func (h *rmqHanders) RefreshSession(ctx context.Context, request *auth.RefreshSessionRequest) (*auth.SessionResponse, error) {
 	sessionID := request.SessionID
 	if err := h.sessionsManager.Refresh(ctx, sessionID, h.tokenExp); err != nil {
 		return nil, auth.ErrSessionExtensionFailed
@@ -224,32 +193,20 @@ func (h *rmqHanders) RefreshSession(ctx context.Context, body []byte) ([]byte, e
 	if err != nil {
 		return nil, auth.ErrNoSessionFound
 	}
-	bts, err := json.Marshal(auth.SessionResponse{
+	return &auth.SessionResponse{
 		SessionID: session.SessionID,
 		UserID:    session.UserID,
 		Username:  session.Username,
 		Roles:     session.Roles,
-	})
-	if err != nil {
-		return nil, auth.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) DeleteSession(ctx context.Context, body []byte) ([]byte, error) {
-	request := &auth.DeleteSessionRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		return nil, auth.ErrInvalidRequest
-	}
+func (h *rmqHanders) DeleteSession(ctx context.Context, request *auth.DeleteSessionRequest) (*auth.DeleteSessionResponse, error) {
 	sessionID := request.SessionID
 	if err := h.sessionsManager.Delete(ctx, sessionID); err != nil {
 		return nil, auth.ErrSessionDeletionFailed
 	}
-	bts, err := json.Marshal(auth.DeleteSessionResponse{
+	return &auth.DeleteSessionResponse{
 		SessionID: sessionID,
-	})
-	if err != nil {
-		return nil, auth.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
@@ -9,11 +9,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/mercury/cmd/auth/lib/hash"
 	"github.com/mercury/cmd/auth/lib/handlers"
 	"github.com/mercury/cmd/auth/lib/managers"
 	"github.com/mercury/pkg/clients/auth"
 	"github.com/mercury/pkg/config"
+	"github.com/mercury/pkg/middleware"
+	"github.com/mercury/pkg/rmq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -59,7 +62,19 @@ func (m *mockSessionsManager) Delete(_ context.Context, _ string) error {
 // Helpers
 // ---------------------------------------------------------------------------
 
-func newTestHandler(t *testing.T, accounts managers.AccountsManager, sessions managers.SessionsManager) handlers.RMQHandlers {
+// routedHandlers serves the handlers through their routes so the tests cover
+// decoding the way the consumer runs them.
+type routedHandlers struct {
+	Login rmq.Handler
+}
+
+func routed(h handlers.RMQHandlers) routedHandlers {
+	return routedHandlers{
+		Login: auth.LoginRoute.Handle(h.Login),
+	}
+}
+
+func newTestHandler(t *testing.T, accounts managers.AccountsManager, sessions managers.SessionsManager) routedHandlers {
 	t.Helper()
 	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	require.NoError(t, err)
@@ -67,7 +82,7 @@ func newTestHandler(t *testing.T, accounts managers.AccountsManager, sessions ma
 		Private: privKey,
 		Public:  &privKey.PublicKey,
 	}
-	return handlers.NewRMQHandlers(accounts, sessions, time.Hour, keys)
+	return routed(handlers.NewRMQHandlers(accounts, sessions, time.Hour, keys))
 }
 
 func loginBody(t *testing.T, username, password string) []byte {
@@ -165,3 +180,26 @@ func TestLogin_Success(t *testing.T) {
 	require.NoError(t, json.Unmarshal(resp, &tokenResp))
 	assert.NotEmpty(t, tokenResp.Token)
 }
+
+func TestLogin_TokenCarriesKeyID(t *testing.T) {
+	account := makeAccount(t, "password")
+	accounts := &mockAccountsManager{account: account}
+	sessions := &mockSessionsManager{
+		session: &managers.Session{SessionID: "test-session-id", UserID: account.ID},
+	}
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	h := routed(handlers.NewRMQHandlers(accounts, sessions, time.Hour, &config.Keys{Private: privKey, Public: &privKey.PublicKey}))
+
+	resp, err := h.Login(context.Background(), loginBody(t, "testuser", "password"))
+	require.NoError(t, err)
+
+	var tokenResp auth.TokenResponse
+	require.NoError(t, json.Unmarshal(resp, &tokenResp))
+	kid := config.KeyID(&privKey.PublicKey)
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenResp.Token, &middleware.Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, kid, token.Header["kid"])
+	_, err = middleware.ValidateToken(tokenResp.Token, config.PublicKeys{kid: &privKey.PublicKey})
+	require.NoError(t, err)
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/mercury/cmd/auth/lib/hash"
 	"github.com/mercury/pkg/clients/auth"
 	"github.com/mercury/pkg/instrumentation"
-	"github.com/smira/go-statsd"
+	"github.com/mercury/pkg/instrumentation/metrics"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -84,7 +84,7 @@ func NewAccountsManager(mongoAddr string) (AccountsManager, error) {
 
 // GetUser finds a account by username.
 func (u *accountsManager) GetAccountByUsername(ctx context.Context, username string) (_ *AccountInformation, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "usrmgr.dur", statsd.StringTag("op", "get_user_by_un"))
+	t := instrumentation.NewMetricsTimer(ctx, "usrmgr.dur", metrics.StringTag("op", "get_user_by_un"))
 	defer func() { t.Done(err) }()
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
@@ -118,7 +118,7 @@ func (u *accountsManager) GetAccountByUsername(ctx context.Context, username str
 func (u *accountsManager) CreateAccount(
 	ctx context.Context, username, email, password string, roles []auth.Role) (_ *AccountInformation, err error) {
 
-	t := instrumentation.NewMetricsTimer(ctx, "usrmgr.dur", statsd.StringTag("op", "activate_user"))
+	t := instrumentation.NewMetricsTimer(ctx, "usrmgr.dur", metrics.StringTag("op", "activate_user"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
@@ -165,7 +165,7 @@ func (u *accountsManager) CreateAccount(
 
 // ActivateAccount activates a newly created account
 func (u *accountsManager) ActivateAccount(ctx context.Context, accountID string) (err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "usrmgr.dur", statsd.StringTag("op", "activate_user"))
+	t := instrumentation.NewMetricsTimer(ctx, "usrmgr.dur", metrics.StringTag("op", "activate_user"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
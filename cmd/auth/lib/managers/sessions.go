@@ -9,8 +9,8 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/mercury/pkg/instrumentation"
+	"github.com/mercury/pkg/instrumentation/metrics"
 	"github.com/redis/go-redis/v9"
-	"github.com/smira/go-statsd"
 )
 
 var ErrSessionNotFound = errors.New("session not found or expired")
@@ -48,7 +48,7 @@ func sessionKey(sessionID string) string {
 }
 
 func (m *sessionsManager) Create(ctx context.Context, userID, username string, roles []string, ttl time.Duration) (_ *Session, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "sessionmgr.dur", statsd.StringTag("op", "create"))
+	t := instrumentation.NewMetricsTimer(ctx, "sessionmgr.dur", metrics.StringTag("op", "create"))
 	defer func() { t.Done(err) }()
 
 	sessionID := uuid.New().String()
@@ -75,7 +75,7 @@ func (m *sessionsManager) Create(ctx context.Context, userID, username string, r
 }
 
 func (m *sessionsManager) Get(ctx context.Context, sessionID string) (_ *Session, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "sessionmgr.dur", statsd.StringTag("op", "get"))
+	t := instrumentation.NewMetricsTimer(ctx, "sessionmgr.dur", metrics.StringTag("op", "get"))
 	defer func() { t.Done(err) }()
 
 	data, err := m.redis.Get(ctx, sessionKey(sessionID)).Bytes()
@@ -100,7 +100,7 @@ func (m *sessionsManager) Get(ctx context.Context, sessionID string) (_ *Session
 }
 
 func (m *sessionsManager) Refresh(ctx context.Context, sessionID string, ttl time.Duration) (err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "sessionmgr.dur", statsd.StringTag("op", "refresh"))
+	t := instrumentation.NewMetricsTimer(ctx, "sessionmgr.dur", metrics.StringTag("op", "refresh"))
 	defer func() { t.Done(err) }()
 
 	ok, err := m.redis.Expire(ctx, sessionKey(sessionID), ttl).Result()
@@ -114,7 +114,7 @@ func (m *sessionsManager) Refresh(ctx context.Context, sessionID string, ttl tim
 }
 
 func (m *sessionsManager) Delete(ctx context.Context, sessionID string) (err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "sessionmgr.dur", statsd.StringTag("op", "delete"))
+	t := instrumentation.NewMetricsTimer(ctx, "sessionmgr.dur", metrics.StringTag("op", "delete"))
 	defer func() { t.Done(err) }()
 
 	if err := m.redis.Del(ctx, sessionKey(sessionID)).Err(); err != nil {
@@ -2,17 +2,16 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/mercury/cmd/entitlements/lib/managers"
 	"github.com/mercury/pkg/clients/entitlements"
 )
 
 type CatalogHandlers interface {
-	AddItems(ctx context.Context, body []byte) ([]byte, error)
-	UpdateItems(ctx context.Context, body []byte) ([]byte, error)
-	GetItems(ctx context.Context, body []byte) ([]byte, error)
-	ArchiveItems(ctx context.Context, body []byte) ([]byte, error)
+	AddItems(ctx context.Context, request *entitlements.CreateItemRequest) (*entitlements.CreateItemResponse, error)
+	UpdateItems(ctx context.Context, request *struct{}) (*struct{}, error)
+	GetItems(ctx context.Context, request *struct{}) (*struct{}, error)
+	ArchiveItems(ctx context.Context, request *struct{}) (*struct{}, error)
 }
 
 type catalogHandlers struct {
@@ -26,11 +25,7 @@ func NewCatalogHandlers(catalogManager managers.CatalogManager) CatalogHandlers
 }
 
 // AddItem adds an item to the catalog
-func (h *catalogHandlers) AddItems(ctx context.Context, body []byte) ([]byte, error) {
-	request := &entitlements.CreateItemRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		return nil, entitlements.ErrInvalidRequest
-	}
+func (h *catalogHandlers) AddItems(ctx context.Context, request *entitlements.CreateItemRequest) (*entitlements.CreateItemResponse, error) {
 	grantResults := make([]managers.CatalogGrantResult, len(request.Item.GrantResults))
 	for i, gr := range request.Item.GrantResults {
 		grantResults[i] = managers.CatalogGrantResult{
@@ -61,28 +56,24 @@ func (h *catalogHandlers) AddItems(ctx context.Context, body []byte) ([]byte, er
 	if err != nil {
 		return nil, entitlements.ErrFailedToCreateEntitlement
 	}
-	bts, err := json.Marshal(entitlements.CreateItemResponse{
+	return &entitlements.CreateItemResponse{
 		Version:  entitlement.Version,
 		CommitID: entitlement.CommitID,
 		Item:     request.Item,
-	})
-	if err != nil {
-		return nil, entitlements.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
 // AddItem adds an item to the catalog
-func (h *catalogHandlers) UpdateItems(ctx context.Context, body []byte) ([]byte, error) {
+func (h *catalogHandlers) UpdateItems(ctx context.Context, request *struct{}) (*struct{}, error) {
 	return nil, nil
 }
 
 // RetrieveItems gets catalog items
-func (h *catalogHandlers) GetItems(ctx context.Context, body []byte) ([]byte, error) {
+func (h *catalogHandlers) GetItems(ctx context.Context, request *struct{}) (*struct{}, error) {
 	return nil, nil
 }
 
 // ArchiveItems removes an item from current catalog
-func (h *catalogHandlers) ArchiveItems(ctx context.Context, body []byte) ([]byte, error) {
+func (h *catalogHandlers) ArchiveItems(ctx context.Context, request *struct{}) (*struct{}, error) {
 	return nil, nil
 }
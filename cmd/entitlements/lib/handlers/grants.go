@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 
 	"github.com/mercury/cmd/entitlements/lib/managers"
@@ -10,14 +9,13 @@ import (
 	"github.com/mercury/pkg/clients/inventory"
 	"github.com/mercury/pkg/clients/trade"
 	"github.com/mercury/pkg/clients/wallet"
-	"github.com/mercury/pkg/ids"
 	"github.com/mercury/pkg/rmq"
 )
 
 type GrantHandlers interface {
-	Check(ctx context.Context, body []byte) ([]byte, error)
-	Grant(ctx context.Context, body []byte) ([]byte, error)
-	Revoke(ctx context.Context, body []byte) ([]byte, error)
+	Check(ctx context.Context, request *struct{}) (*struct{}, error)
+	Grant(ctx context.Context, request *entitlements.GrantRequest) (*entitlements.GrantResponse, error)
+	Revoke(ctx context.Context, request *struct{}) (*struct{}, error)
 }
 
 type grantHandlers struct {
@@ -54,27 +52,13 @@ func catalogGrantTypeToTradeGrantType(t entitlements.CatalogGrantType) (trade.Gr
 	}
 }
 
-func (h *grantHandlers) Check(ctx context.Context, body []byte) ([]byte, error) {
+func (h *grantHandlers) Check(ctx context.Context, request *struct{}) (*struct{}, error) {
 	return nil, nil
 }
 
-func (h *grantHandlers) Grant(ctx context.Context, body []byte) ([]byte, error) {
+func (h *grantHandlers) Grant(ctx context.Context, request *entitlements.GrantRequest) (*entitlements.GrantResponse, error) {
 	logger := rmq.GetLogger(ctx)
 
-	request := &entitlements.GrantRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to parse grant request")
-		return nil, entitlements.ErrInvalidRequest
-	}
-	if request.ServerID == "" {
-		logger.Error("server_id must be a valid server id")
-		return nil, entitlements.ErrInvalidRequest
-	}
-	if !ids.ValidateOrderID(request.OrderID) {
-		logger.WithField("order_id", request.OrderID).Error("order_id must be a valid ULID")
-		return nil, entitlements.ErrInvalidRequest
-	}
-
 	entitlement, err := h.catalogManager.GetEntitlement(ctx, request.EntitlementID, request.Version)
 	if err != nil {
 		if errors.Is(err, managers.ErrEntitlementNotFound) {
@@ -111,16 +95,12 @@ func (h *grantHandlers) Grant(ctx context.Context, body []byte) ([]byte, error)
 		return nil, entitlements.ErrFailedToGrantEntitlement
 	}
 
-	bts, err := json.Marshal(entitlements.GrantResponse{
+	return &entitlements.GrantResponse{
 		OrderID: tradeResp.OrderID,
 		GrantID: grant.ID,
-	})
-	if err != nil {
-		return nil, entitlements.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *grantHandlers) Revoke(ctx context.Context, body []byte) ([]byte, error) {
+func (h *grantHandlers) Revoke(ctx context.Context, request *struct{}) (*struct{}, error) {
 	return nil, nil
 }
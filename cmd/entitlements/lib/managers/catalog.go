@@ -8,7 +8,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/mercury/pkg/clients/entitlements"
 	"github.com/mercury/pkg/instrumentation"
-	"github.com/smira/go-statsd"
+	"github.com/mercury/pkg/instrumentation/metrics"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -121,7 +121,7 @@ func (u *catalogManager) CreateEntitlement(
 	requirements []string,
 ) (_ *Entitlement, err error) {
 
-	t := instrumentation.NewMetricsTimer(ctx, "entmgr.dur", statsd.StringTag("op", "create_entitlement"))
+	t := instrumentation.NewMetricsTimer(ctx, "entmgr.dur", metrics.StringTag("op", "create_entitlement"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -172,7 +172,7 @@ func (u *catalogManager) CreateEntitlement(
 
 func (u *catalogManager) GetEntitlement(ctx context.Context, entitlementID string, version int) (_ *Entitlement, err error) {
 
-	t := instrumentation.NewMetricsTimer(ctx, "entmgr.dur", statsd.StringTag("op", "get_entitlement"))
+	t := instrumentation.NewMetricsTimer(ctx, "entmgr.dur", metrics.StringTag("op", "get_entitlement"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -7,7 +7,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/mercury/pkg/instrumentation"
-	"github.com/smira/go-statsd"
+	"github.com/mercury/pkg/instrumentation/metrics"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -65,7 +65,7 @@ func (u *grantsManager) CreateGrant(
 	entVersion int,
 ) (_ *Grant, err error) {
 
-	t := instrumentation.NewMetricsTimer(ctx, "grntmgr.dur", statsd.StringTag("op", "grant"))
+	t := instrumentation.NewMetricsTimer(ctx, "grntmgr.dur", metrics.StringTag("op", "grant"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -95,7 +95,7 @@ func (u *grantsManager) CreateGrant(
 }
 
 func (u *grantsManager) Update(ctx context.Context, accountID string, entitlementID string) (_ *Grant, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "grntmgr.dur", statsd.StringTag("op", "update"))
+	t := instrumentation.NewMetricsTimer(ctx, "grntmgr.dur", metrics.StringTag("op", "update"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -105,7 +105,7 @@ func (u *grantsManager) Update(ctx context.Context, accountID string, entitlemen
 }
 
 func (u *grantsManager) Check(ctx context.Context, accountID string, entitlementID string) (_ *Grant, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "grntmgr.dur", statsd.StringTag("op", "check"))
+	t := instrumentation.NewMetricsTimer(ctx, "grntmgr.dur", metrics.StringTag("op", "check"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -115,7 +115,7 @@ func (u *grantsManager) Check(ctx context.Context, accountID string, entitlement
 }
 
 func (u *grantsManager) Revoke(ctx context.Context, accountID string, entitlementID string) (_ *Grant, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "grntmgr.dur", statsd.StringTag("op", "revoke"))
+	t := instrumentation.NewMetricsTimer(ctx, "grntmgr.dur", metrics.StringTag("op", "revoke"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -2,19 +2,17 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 
 	"github.com/mercury/cmd/inventory/lib/managers"
 	"github.com/mercury/pkg/clients/inventory"
-	"github.com/mercury/pkg/rmq"
 )
 
 type RMQHandlers interface {
-	CreateInventory(ctx context.Context, body []byte) ([]byte, error)
-	GetInventory(ctx context.Context, body []byte) ([]byte, error)
-	AddItem(ctx context.Context, body []byte) ([]byte, error)
-	AddItemToSlot(ctx context.Context, body []byte) ([]byte, error)
+	CreateInventory(ctx context.Context, request *inventory.GetInventoryRequest) (*inventory.GetInventoryResponse, error)
+	GetInventory(ctx context.Context, request *inventory.GetInventoryRequest) (*inventory.GetInventoryResponse, error)
+	AddItem(ctx context.Context, request *inventory.AddItemRequest) (*inventory.GetInventoryResponse, error)
+	AddItemToSlot(ctx context.Context, request *inventory.AddItemToSlotRequest) (*inventory.GetInventoryResponse, error)
 }
 
 type rmqHanders struct {
@@ -37,37 +35,19 @@ func slotsToItems(inv *managers.Inventory) []inventory.Item {
 	return items
 }
 
-func (h *rmqHanders) CreateInventory(ctx context.Context, body []byte) ([]byte, error) {
-	logger := rmq.GetLogger(ctx)
-	request := &inventory.GetInventoryRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to parse create inventory request")
-		return nil, inventory.ErrInvalidRequest
-	}
-
+func (h *rmqHanders) CreateInventory(ctx context.Context, request *inventory.GetInventoryRequest) (*inventory.GetInventoryResponse, error) {
 	inv, err := h.inventoryManager.CreateInventory(ctx, request.PlayerID)
 	if err != nil {
 		return nil, inventory.ErrFailedToGetInventory
 	}
 
-	bts, err := json.Marshal(inventory.GetInventoryResponse{
+	return &inventory.GetInventoryResponse{
 		PlayerID:  inv.PlayerID,
 		Inventory: slotsToItems(inv),
-	})
-	if err != nil {
-		return nil, inventory.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) GetInventory(ctx context.Context, body []byte) ([]byte, error) {
-	logger := rmq.GetLogger(ctx)
-	request := &inventory.GetInventoryRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to parse get inventory request")
-		return nil, inventory.ErrInvalidRequest
-	}
-
+func (h *rmqHanders) GetInventory(ctx context.Context, request *inventory.GetInventoryRequest) (*inventory.GetInventoryResponse, error) {
 	inv, err := h.inventoryManager.GetInventory(ctx, request.PlayerID)
 	if err != nil {
 		if errors.Is(err, managers.ErrInventoryNotFound) {
@@ -76,24 +56,13 @@ func (h *rmqHanders) GetInventory(ctx context.Context, body []byte) ([]byte, err
 		return nil, inventory.ErrFailedToGetInventory
 	}
 
-	bts, err := json.Marshal(inventory.GetInventoryResponse{
+	return &inventory.GetInventoryResponse{
 		PlayerID:  inv.PlayerID,
 		Inventory: slotsToItems(inv),
-	})
-	if err != nil {
-		return nil, inventory.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) AddItem(ctx context.Context, body []byte) ([]byte, error) {
-	logger := rmq.GetLogger(ctx)
-	request := &inventory.AddItemRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to parse add item request")
-		return nil, inventory.ErrInvalidRequest
-	}
-
+func (h *rmqHanders) AddItem(ctx context.Context, request *inventory.AddItemRequest) (*inventory.GetInventoryResponse, error) {
 	inv, err := h.inventoryManager.AddItem(ctx, request.PlayerID, request.ItemID, request.OrderID, request.Amount, request.MaxStack)
 	if err != nil {
 		if errors.Is(err, managers.ErrInventoryNotFound) {
@@ -105,24 +74,13 @@ func (h *rmqHanders) AddItem(ctx context.Context, body []byte) ([]byte, error) {
 		return nil, inventory.ErrFailedToAddItem
 	}
 
-	bts, err := json.Marshal(inventory.GetInventoryResponse{
+	return &inventory.GetInventoryResponse{
 		PlayerID:  inv.PlayerID,
 		Inventory: slotsToItems(inv),
-	})
-	if err != nil {
-		return nil, inventory.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) AddItemToSlot(ctx context.Context, body []byte) ([]byte, error) {
-	logger := rmq.GetLogger(ctx)
-	request := &inventory.AddItemToSlotRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to parse add item to slot request")
-		return nil, inventory.ErrInvalidRequest
-	}
-
+func (h *rmqHanders) AddItemToSlot(ctx context.Context, request *inventory.AddItemToSlotRequest) (*inventory.GetInventoryResponse, error) {
 	inv, err := h.inventoryManager.AddItemToSlot(ctx, request.PlayerID, request.ItemID, request.OrderID, request.SlotID, request.Amount, request.MaxStack)
 	if err != nil {
 		if errors.Is(err, managers.ErrSlotNotAvailable) {
@@ -131,12 +89,8 @@ func (h *rmqHanders) AddItemToSlot(ctx context.Context, body []byte) ([]byte, er
 		return nil, inventory.ErrFailedToAddItem
 	}
 
-	bts, err := json.Marshal(inventory.GetInventoryResponse{
+	return &inventory.GetInventoryResponse{
 		PlayerID:  inv.PlayerID,
 		Inventory: slotsToItems(inv),
-	})
-	if err != nil {
-		return nil, inventory.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
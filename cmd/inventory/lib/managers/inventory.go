@@ -6,7 +6,7 @@ import (
 	"time"
 
 	"github.com/mercury/pkg/instrumentation"
-	"github.com/smira/go-statsd"
+	"github.com/mercury/pkg/instrumentation/metrics"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -49,10 +49,10 @@ type inventoryManager struct {
 	client          *mongo.Client
 	inventory       *mongo.Collection
 	processedOrders *mongo.Collection
-	statsdClient    *statsd.Client
+	metrics         metrics.Metrics
 }
 
-func NewInventoryManager(mongoAddr string, statsdClient *statsd.Client) (InventoryManager, error) {
+func NewInventoryManager(mongoAddr string, m metrics.Metrics) (InventoryManager, error) {
 	client, err := mongo.Connect(options.Client().ApplyURI(mongoAddr))
 	if err != nil {
 		return nil, err
@@ -62,7 +62,7 @@ func NewInventoryManager(mongoAddr string, statsdClient *statsd.Client) (Invento
 		client:          client,
 		inventory:       db.Collection("inventory"),
 		processedOrders: db.Collection("processed_orders"),
-		statsdClient:    statsdClient,
+		metrics:         m,
 	}, nil
 }
 
@@ -75,7 +75,7 @@ func initialSlots(count int) []InventorySlot {
 }
 
 func (s *inventoryManager) GetInventory(ctx context.Context, playerID string) (_ *Inventory, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", statsd.StringTag("op", "get_inventory"))
+	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", metrics.StringTag("op", "get_inventory"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -92,7 +92,7 @@ func (s *inventoryManager) GetInventory(ctx context.Context, playerID string) (_
 }
 
 func (s *inventoryManager) CreateInventory(ctx context.Context, playerID string) (_ *Inventory, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", statsd.StringTag("op", "create_inventory"))
+	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", metrics.StringTag("op", "create_inventory"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -117,7 +117,7 @@ func (s *inventoryManager) CreateInventory(ctx context.Context, playerID string)
 }
 
 func (s *inventoryManager) AddItem(ctx context.Context, playerID, itemID, orderID string, amount, maxStack int) (_ *Inventory, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", statsd.StringTag("op", "add_item"))
+	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", metrics.StringTag("op", "add_item"))
 	defer func() { t.Done(err) }()
 
 	session, err := s.client.StartSession()
@@ -210,7 +210,7 @@ func (s *inventoryManager) AddItem(ctx context.Context, playerID, itemID, orderI
 }
 
 func (s *inventoryManager) AddItemToSlot(ctx context.Context, playerID, itemID, orderID string, slotID, amount, maxStack int) (_ *Inventory, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", statsd.StringTag("op", "add_item_to_slot"))
+	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", metrics.StringTag("op", "add_item_to_slot"))
 	defer func() { t.Done(err) }()
 
 	session, err := s.client.StartSession()
@@ -283,7 +283,7 @@ func (s *inventoryManager) AddItemToSlot(ctx context.Context, playerID, itemID,
 }
 
 func (s *inventoryManager) UnlockSlots(ctx context.Context, playerID string, count int) (_ *Inventory, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", statsd.StringTag("op", "unlock_slots"))
+	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", metrics.StringTag("op", "unlock_slots"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
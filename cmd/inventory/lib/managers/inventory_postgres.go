@@ -9,7 +9,7 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mercury/pkg/instrumentation"
-	"github.com/smira/go-statsd"
+	"github.com/mercury/pkg/instrumentation/metrics"
 )
 
 // querier is satisfied by both *pgxpool.Pool and pgx.Tx.
@@ -20,16 +20,16 @@ type querier interface {
 }
 
 type postgresInventoryManager struct {
-	pool         *pgxpool.Pool
-	statsdClient *statsd.Client
+	pool    *pgxpool.Pool
+	metrics metrics.Metrics
 }
 
-func NewPostgresInventoryManager(dsn string, statsdClient *statsd.Client) (InventoryManager, error) {
+func NewPostgresInventoryManager(dsn string, m metrics.Metrics) (InventoryManager, error) {
 	pool, err := pgxpool.New(context.Background(), dsn)
 	if err != nil {
 		return nil, err
 	}
-	return &postgresInventoryManager{pool: pool, statsdClient: statsdClient}, nil
+	return &postgresInventoryManager{pool: pool, metrics: m}, nil
 }
 
 func scanInventory(ctx context.Context, q querier, playerID string) (*Inventory, error) {
@@ -66,14 +66,14 @@ func scanInventory(ctx context.Context, q querier, playerID string) (*Inventory,
 }
 
 func (s *postgresInventoryManager) GetInventory(ctx context.Context, playerID string) (_ *Inventory, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", statsd.StringTag("op", "get_inventory"))
+	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", metrics.StringTag("op", "get_inventory"))
 	defer func() { t.Done(err) }()
 
 	return scanInventory(ctx, s.pool, playerID)
 }
 
 func (s *postgresInventoryManager) CreateInventory(ctx context.Context, playerID string) (_ *Inventory, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", statsd.StringTag("op", "create_inventory"))
+	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", metrics.StringTag("op", "create_inventory"))
 	defer func() { t.Done(err) }()
 
 	tx, err := s.pool.Begin(ctx)
@@ -111,7 +111,7 @@ func (s *postgresInventoryManager) CreateInventory(ctx context.Context, playerID
 }
 
 func (s *postgresInventoryManager) AddItem(ctx context.Context, playerID, itemID, orderID string, amount, maxStack int) (_ *Inventory, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", statsd.StringTag("op", "add_item"))
+	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", metrics.StringTag("op", "add_item"))
 	defer func() { t.Done(err) }()
 
 	tx, err := s.pool.Begin(ctx)
@@ -188,7 +188,7 @@ func (s *postgresInventoryManager) AddItem(ctx context.Context, playerID, itemID
 }
 
 func (s *postgresInventoryManager) AddItemToSlot(ctx context.Context, playerID, itemID, orderID string, slotID, amount, maxStack int) (_ *Inventory, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", statsd.StringTag("op", "add_item_to_slot"))
+	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", metrics.StringTag("op", "add_item_to_slot"))
 	defer func() { t.Done(err) }()
 
 	tx, err := s.pool.Begin(ctx)
@@ -245,7 +245,7 @@ func (s *postgresInventoryManager) AddItemToSlot(ctx context.Context, playerID,
 }
 
 func (s *postgresInventoryManager) UnlockSlots(ctx context.Context, playerID string, count int) (_ *Inventory, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", statsd.StringTag("op", "unlock_slots"))
+	t := instrumentation.NewMetricsTimer(ctx, "invmgr.dur", metrics.StringTag("op", "unlock_slots"))
 	defer func() { t.Done(err) }()
 
 	if count == 0 {
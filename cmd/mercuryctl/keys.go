@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/mercury/pkg/config"
+)
+
+// keysFlags are the flags of every keys command. The defaults match the
+// services' pub_key_ssm_param, priv_key_ssm_param and
+// jwt_key_refresh_interval.
+type keysFlags struct {
+	fs            *flag.FlagSet
+	publicParam   string
+	privateParam  string
+	region        string
+	endpoint      string
+	refresh       time.Duration
+	tokenLifetime time.Duration
+	bits          int
+	kid           string
+	force         bool
+}
+
+func newKeysFlags(name string) *keysFlags {
+	f := &keysFlags{fs: flag.NewFlagSet("keys "+name, flag.ContinueOnError)}
+	f.fs.StringVar(&f.publicParam, "public-param", "/mercury/jwt-public-key", "SSM parameter holding the public keys")
+	f.fs.StringVar(&f.privateParam, "private-param", "/mercury/jwt-private-key", "SSM parameter holding the signing key")
+	f.fs.StringVar(&f.region, "aws-region", envOr("AWS_REGION", "us-west-1"), "AWS region")
+	f.fs.StringVar(&f.endpoint, "aws-endpoint", os.Getenv("AWS_ENDPOINT"), "AWS endpoint override (e.g. LocalStack)")
+	switch name {
+	case "publish":
+		f.fs.IntVar(&f.bits, "bits", 4096, "size of the new RSA key")
+	case "activate":
+		f.fs.DurationVar(&f.refresh, "refresh-interval", time.Minute, "how often services re-read the keys; the new public key must be published at least this long")
+		f.fs.BoolVar(&f.force, "force", false, "activate even if services may not have the new public key yet")
+	case "retire":
+		f.fs.StringVar(&f.kid, "kid", "", "ID of the public key to retire")
+		f.fs.DurationVar(&f.refresh, "refresh-interval", time.Minute, "how often services re-read the keys")
+		f.fs.DurationVar(&f.tokenLifetime, "token-lifetime", time.Hour, "longest lifetime of a token")
+		f.fs.BoolVar(&f.force, "force", false, "retire even if tokens signed with the key may still be valid")
+	}
+	return f
+}
+
+// nextParam holds a published key's private half until it is activated.
+func (f *keysFlags) nextParam() string {
+	return f.privateParam + ".next"
+}
+
+func (f *keysFlags) client(ctx context.Context) *ssm.Client {
+	return config.NewSSMClient(ctx, config.AWSConfig{
+		AccessKey: envOr("AWS_ACCESS_KEY", "test"),
+		SecretKey: envOr("AWS_SECRET_KEY", "test"),
+		Region:    f.region,
+		Endpoint:  f.endpoint,
+	})
+}
+
+// runKeys parses args for the keys command name and runs fn with an SSM
+// client.
+func runKeys(name string, args []string, fn func(ctx context.Context, f *keysFlags, client *ssm.Client) error) error {
+	f := newKeysFlags(name)
+	if err := f.fs.Parse(args); err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return fn(ctx, f, f.client(ctx))
+}
+
+// parameter is an SSM parameter's value and when it last changed.
+type parameter struct {
+	value    string
+	modified time.Time
+}
+
+// getParameter returns the parameter, or nil when it doesn't exist.
+func getParameter(ctx context.Context, client *ssm.Client, name string) (*parameter, error) {
+	out, err := client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(name), WithDecryption: aws.Bool(true)})
+	var notFound *types.ParameterNotFound
+	if errors.As(err, &notFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &parameter{value: aws.ToString(out.Parameter.Value), modified: aws.ToTime(out.Parameter.LastModifiedDate)}, nil
+}
+
+func putParameter(ctx context.Context, client *ssm.Client, name, value string) error {
+	_, err := client.PutParameter(ctx, &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(value),
+		Type:      types.ParameterTypeSecureString,
+		Overwrite: aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// keyState is what the key parameters hold.
+type keyState struct {
+	public    config.PublicKeys
+	publicAt  time.Time
+	signing   *config.SigningKey
+	signingAt time.Time
+	next      *config.SigningKey
+	nextPEM   string
+}
+
+func readKeyState(ctx context.Context, f *keysFlags, client *ssm.Client) (*keyState, error) {
+	s := &keyState{public: config.PublicKeys{}}
+	pub, err := getParameter(ctx, client, f.publicParam)
+	if err != nil {
+		return nil, err
+	}
+	if pub != nil {
+		if s.public, err = config.ParsePublicKeys(pub.value); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.publicParam, err)
+		}
+		s.publicAt = pub.modified
+	}
+	priv, err := getParameter(ctx, client, f.privateParam)
+	if err != nil {
+		return nil, err
+	}
+	if priv != nil {
+		if s.signing, err = config.ParseSigningKey(priv.value); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.privateParam, err)
+		}
+		s.signingAt = priv.modified
+	}
+	next, err := getParameter(ctx, client, f.nextParam())
+	if err != nil {
+		return nil, err
+	}
+	if next != nil {
+		if s.next, err = config.ParseSigningKey(next.value); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.nextParam(), err)
+		}
+		s.nextPEM = next.value
+	}
+	return s, nil
+}
+
+func keysList(args []string) error {
+	return runKeys("list", args, func(ctx context.Context, f *keysFlags, client *ssm.Client) error {
+		s, err := readKeyState(ctx, f, client)
+		if err != nil {
+			return err
+		}
+		for _, id := range s.public.IDs() {
+			status := "verifies"
+			switch {
+			case s.signing != nil && s.signing.ID == id:
+				status = fmt.Sprintf("signs since %s", s.signingAt.Format(time.RFC3339))
+			case s.next != nil && s.next.ID == id:
+				status = "published, waiting for keys activate"
+			}
+			fmt.Printf("%s  %s\n", id, status)
+		}
+		if s.signing != nil {
+			if _, ok := s.public[s.signing.ID]; !ok {
+				fmt.Printf("%s  signs but is NOT published; tokens can't be verified\n", s.signing.ID)
+			}
+		}
+		fmt.Printf("public keys last changed %s\n", s.publicAt.Format(time.RFC3339))
+		return nil
+	})
+}
+
+// keysPublish generates a key pair, adds its public half to the public
+// keys, and keeps its private half aside until keys activate.
+func keysPublish(args []string) error {
+	return runKeys("publish", args, func(ctx context.Context, f *keysFlags, client *ssm.Client) error {
+		s, err := readKeyState(ctx, f, client)
+		if err != nil {
+			return err
+		}
+		if s.next != nil {
+			return fmt.Errorf("key %s is already published and waiting for keys activate", s.next.ID)
+		}
+		priv, err := rsa.GenerateKey(rand.Reader, f.bits)
+		if err != nil {
+			return err
+		}
+		privPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+		// Private half first: a public key without it could never sign.
+		if err := putParameter(ctx, client, f.nextParam(), string(privPEM)); err != nil {
+			return err
+		}
+		kid := config.KeyID(&priv.PublicKey)
+		s.public[kid] = &priv.PublicKey
+		bundle, err := s.public.PEM()
+		if err != nil {
+			return err
+		}
+		if err := putParameter(ctx, client, f.publicParam, bundle); err != nil {
+			return err
+		}
+		fmt.Printf("published %s; run keys activate once every service has refreshed its keys\n", kid)
+		return nil
+	})
+}
+
+// keysActivate makes the published key the signing key.
+func keysActivate(args []string) error {
+	return runKeys("activate", args, func(ctx context.Context, f *keysFlags, client *ssm.Client) error {
+		s, err := readKeyState(ctx, f, client)
+		if err != nil {
+			return err
+		}
+		if s.next == nil {
+			return errors.New("no published key to activate; run keys publish first")
+		}
+		if _, ok := s.public[s.next.ID]; !ok {
+			return fmt.Errorf("key %s is not among the public keys; run keys publish again", s.next.ID)
+		}
+		if wait := time.Until(s.publicAt.Add(f.refresh)); wait > 0 && !f.force {
+			return fmt.Errorf("public keys changed %s ago; services may not verify the new key for another %s", time.Since(s.publicAt).Round(time.Second), wait.Round(time.Second))
+		}
+		if err := putParameter(ctx, client, f.privateParam, s.nextPEM); err != nil {
+			return err
+		}
+		if _, err := client.DeleteParameter(ctx, &ssm.DeleteParameterInput{Name: aws.String(f.nextParam())}); err != nil {
+			return fmt.Errorf("%s: %w", f.nextParam(), err)
+		}
+		fmt.Printf("%s now signs", s.next.ID)
+		if s.signing != nil {
+			fmt.Printf("; retire %s with keys retire once its tokens have expired", s.signing.ID)
+		}
+		fmt.Println()
+		return nil
+	})
+}
+
+// keysRetire removes a public key once no valid token can be signed with
+// it.
+func keysRetire(args []string) error {
+	return runKeys("retire", args, func(ctx context.Context, f *keysFlags, client *ssm.Client) error {
+		if f.kid == "" {
+			return errors.New("set -kid")
+		}
+		s, err := readKeyState(ctx, f, client)
+		if err != nil {
+			return err
+		}
+		if _, ok := s.public[f.kid]; !ok {
+			return fmt.Errorf("key %s is not among the public keys", f.kid)
+		}
+		if s.signing != nil && s.signing.ID == f.kid {
+			return fmt.Errorf("key %s is the signing key; publish and activate a new one first", f.kid)
+		}
+		if s.next != nil && s.next.ID == f.kid {
+			return fmt.Errorf("key %s is published and waiting for keys activate", f.kid)
+		}
+		// Auth may have signed with the old key until it read the switch.
+		safe := s.signingAt.Add(f.refresh + f.tokenLifetime)
+		if wait := time.Until(safe); wait > 0 && !f.force {
+			return fmt.Errorf("tokens signed with %s may be valid for another %s", f.kid, wait.Round(time.Second))
+		}
+		delete(s.public, f.kid)
+		bundle, err := s.public.PEM()
+		if err != nil {
+			return err
+		}
+		if err := putParameter(ctx, client, f.publicParam, bundle); err != nil {
+			return err
+		}
+		fmt.Printf("retired %s\n", f.kid)
+		return nil
+	})
+}
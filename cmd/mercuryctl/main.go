@@ -0,0 +1,59 @@
+// Command mercuryctl is the operator's toolbox for a running mercury
+// deployment.
+//
+// Usage:
+//
+//	mercuryctl dlq list   [flags]
+//	mercuryctl dlq replay [flags]
+//	mercuryctl keys list|publish|activate|retire [flags]
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const usage = `usage: mercuryctl <command> [arguments]
+
+commands:
+  dlq list     show dead-lettered messages of a Kafka topic or RabbitMQ queue
+  dlq replay   send dead-lettered messages back to where they failed
+
+  keys list      show the JWT keys and which one signs
+  keys publish   generate a JWT key and publish its public half
+  keys activate  sign with the published key
+  keys retire    remove a public key whose tokens have expired
+
+Rotating the JWT key is publish, activate, then retire of the old key.
+Run "mercuryctl <command> <subcommand> -h" for the flags of a command.
+`
+
+var commands = map[string]map[string]func(args []string) error{
+	"dlq": {
+		"list":   dlqList,
+		"replay": dlqReplay,
+	},
+	"keys": {
+		"list":     keysList,
+		"publish":  keysPublish,
+		"activate": keysActivate,
+		"retire":   keysRetire,
+	},
+}
+
+func main() {
+	if len(os.Args) < 3 || commands[os.Args[1]][os.Args[2]] == nil {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	err := commands[os.Args[1]][os.Args[2]](os.Args[3:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "mercuryctl:", err)
+		os.Exit(1)
+	}
+}
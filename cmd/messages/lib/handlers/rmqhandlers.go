@@ -3,52 +3,44 @@ package handlers
 import (
 	"context"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/mercury/cmd/messages/lib/managers"
 	"github.com/mercury/pkg/clients/messages"
 	"github.com/mercury/pkg/clients/publisher"
 	"github.com/mercury/pkg/clients/worker"
+	"github.com/mercury/pkg/ratelimit"
 	"github.com/mercury/pkg/rmq"
-	"github.com/mercury/pkg/server"
-	"github.com/redis/go-redis/v9"
 )
 
 type RMQHandlers interface {
-	GetMessages(ctx context.Context, body []byte) ([]byte, error)
-	SendMessage(ctx context.Context, body []byte) ([]byte, error)
-	RefreshMessages(ctx context.Context, body []byte) ([]byte, error)
+	GetMessages(ctx context.Context, request *messages.GetMessagesRequest) (*messages.GetMessagesResponse, error)
+	SendMessage(ctx context.Context, request *messages.SendMessageRequest) (*messages.SendMessageResponse, error)
+	RefreshMessages(ctx context.Context, request *messages.RefreshMessagesRequest) (*messages.RefreshMessagesResponse, error)
 }
 type rmqHanders struct {
 	cassandraClient managers.CassandraClient
 	publisherClient publisher.RMQClient
 	workerClient    worker.WorkerClient
-	redisClient     *redis.Client
+	sendLimiter     ratelimit.Limiter
 }
 
 func NewRMQHandlers(
 	cassandraClient managers.CassandraClient,
 	publisherClient publisher.RMQClient,
 	workerClient worker.WorkerClient,
-	redisClient *redis.Client,
+	sendLimiter ratelimit.Limiter,
 ) RMQHandlers {
 	return &rmqHanders{
 		cassandraClient: cassandraClient,
 		publisherClient: publisherClient,
 		workerClient:    workerClient,
-		redisClient:     redisClient,
+		sendLimiter:     sendLimiter,
 	}
 }
 
-func (h *rmqHanders) GetMessages(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) GetMessages(ctx context.Context, request *messages.GetMessagesRequest) (*messages.GetMessagesResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &messages.GetMessagesRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to unmarshal get messages request")
-		return nil, messages.ErrInvalidRequest
-	}
 	pagingState := []byte(nil)
 	nextToken := request.NextToken
 	if nextToken != "" {
@@ -78,32 +70,18 @@ func (h *rmqHanders) GetMessages(ctx context.Context, body []byte) ([]byte, erro
 	if len(msgHistory.Next) > 0 {
 		respNextToken = base64.StdEncoding.EncodeToString(msgHistory.Next)
 	}
-	bts, err := json.Marshal(messages.GetMessagesResponse{
+	return &messages.GetMessagesResponse{
 		Messages:  msgs,
 		NextToken: respNextToken,
-	})
-	if err != nil {
-		return nil, messages.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) SendMessage(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) SendMessage(ctx context.Context, request *messages.SendMessageRequest) (*messages.SendMessageResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &messages.SendMessageRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to unmarshal send message request")
-		return nil, messages.ErrInvalidRequest
-	}
 	user := request.User
-	if !server.Limit(
-		h.redisClient,
-		ctx,
-		200,
-		time.Hour,
-		user,
-		request.ConversationID,
-	) {
+	// The limiter only fails if all its backends do; let the message through then.
+	limit, err := h.sendLimiter.Allow(ctx, fmt.Sprintf("ratelimit:%s:%s", user, request.ConversationID))
+	if err == nil && !limit.Allowed {
 		return nil, messages.ErrTooManyMessages
 	}
 	// if direct message this tells the recievers to subscribe to the
@@ -123,23 +101,14 @@ func (h *rmqHanders) SendMessage(ctx context.Context, body []byte) ([]byte, erro
 		logger.WithError(err).Error("failed to send chat message")
 		return nil, messages.ErrFailedToSendMessage
 	}
-	bts, err := json.Marshal(messages.SendMessageResponse{
+	return &messages.SendMessageResponse{
 		Status:    "queued",
 		MessageID: msgID,
-	})
-	if err != nil {
-		return nil, messages.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) RefreshMessages(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) RefreshMessages(ctx context.Context, request *messages.RefreshMessagesRequest) (*messages.RefreshMessagesResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &messages.RefreshMessagesRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to unmarshal refresh messages request")
-		return nil, messages.ErrInvalidRequest
-	}
 	msgHistory, err := h.cassandraClient.RefreshMessages(request.ConversationID, request.MessageID)
 	if err != nil {
 		logger.WithError(err).Error("get messages failed")
@@ -156,11 +125,7 @@ func (h *rmqHanders) RefreshMessages(ctx context.Context, body []byte) ([]byte,
 		}
 	}
 
-	bts, err := json.Marshal(messages.RefreshMessagesResponse{
+	return &messages.RefreshMessagesResponse{
 		Messages: msgs,
-	})
-	if err != nil {
-		return nil, messages.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
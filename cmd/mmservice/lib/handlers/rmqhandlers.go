@@ -2,20 +2,18 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 
 	"github.com/mercury/cmd/mmservice/lib/managers"
 	"github.com/mercury/pkg/clients/matchmaking"
-	"github.com/mercury/pkg/clients/messages"
 	"github.com/mercury/pkg/rmq"
 )
 
 type RMQHandlers interface {
-	UserJoinQueue(ctx context.Context, body []byte) ([]byte, error)
-	GetQueue(ctx context.Context, body []byte) ([]byte, error)
-	UserJoinDequeue(ctx context.Context, body []byte) ([]byte, error)
-	GameserverRegister(ctx context.Context, body []byte) ([]byte, error)
-	GameserverUnregister(ctx context.Context, body []byte) ([]byte, error)
+	UserJoinQueue(ctx context.Context, request *matchmaking.MatchmakingQueueRequest) (*matchmaking.MatchmakingQueueResponse, error)
+	GetQueue(ctx context.Context, request *matchmaking.GetQueueRequest) (*matchmaking.GetQueueResponse, error)
+	UserJoinDequeue(ctx context.Context, request *struct{}) (*struct{}, error)
+	GameserverRegister(ctx context.Context, request *matchmaking.GSRegisterRequest) (*matchmaking.GSRegisterResponse, error)
+	GameserverUnregister(ctx context.Context, request *matchmaking.GSUnregisterRequest) (*matchmaking.GSUnregisterResponse, error)
 }
 
 type rmqHanders struct {
@@ -28,91 +26,55 @@ func NewRMQHandlers(mmManager managers.MatchmakingManager) RMQHandlers {
 	}
 }
 
-func (h *rmqHanders) UserJoinQueue(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) UserJoinQueue(ctx context.Context, request *matchmaking.MatchmakingQueueRequest) (*matchmaking.MatchmakingQueueResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &matchmaking.MatchmakingQueueRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("Failed to parse matchmaking request")
-		return nil, matchmaking.ErrInvalidRequest
-	}
 	queueID, err := h.mmManager.QueueParty(ctx, request.PartyID, request.PlayerIDs)
 	if err != nil {
 		logger.WithError(err).Error("Failed to queue matchmaking party")
 		return nil, matchmaking.ErrFailedToQueueParty
 	}
-	bts, err := json.Marshal(matchmaking.MatchmakingQueueResponse{
+	return &matchmaking.MatchmakingQueueResponse{
 		PartyID: queueID,
-	})
-	if err != nil {
-		return nil, messages.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) GetQueue(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) GetQueue(ctx context.Context, request *matchmaking.GetQueueRequest) (*matchmaking.GetQueueResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &matchmaking.GetQueueRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("Failed to parse matchmaking request")
-		return nil, matchmaking.ErrInvalidRequest
-	}
 	queue, err := h.mmManager.GetQueue(ctx, request.PartyID)
 	if err != nil {
 		logger.WithError(err).Error("Failed to queue matchmaking party")
 		return nil, matchmaking.ErrFailedToQueueParty
 	}
-	bts, err := json.Marshal(matchmaking.GetQueueResponse{
+	return &matchmaking.GetQueueResponse{
 		PartyID:          queue.PartyID,
 		PlayerIDs:        queue.PlayerIDs,
 		AssignedServerID: queue.AssignedServerID,
 		RegisterTime:     queue.RegisterTime,
 		Status:           string(queue.Status),
 		Version:          queue.Version,
-	})
-	if err != nil {
-		return nil, messages.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) UserJoinDequeue(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) UserJoinDequeue(ctx context.Context, request *struct{}) (*struct{}, error) {
 	return nil, nil
 }
 
-func (h *rmqHanders) GameserverRegister(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) GameserverRegister(ctx context.Context, request *matchmaking.GSRegisterRequest) (*matchmaking.GSRegisterResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &matchmaking.GSRegisterRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("Failed to parse gameserver register request")
-		return nil, matchmaking.ErrInvalidRequest
-	}
 	err := h.mmManager.RegisterServer(ctx, request.ServerID, request.IPAddress, request.Port, request.Capacity)
 	if err != nil {
 		logger.WithError(err).Error("Failed to register game server")
 		return nil, matchmaking.ErrFailedToRegisterGameserver
 	}
-	bts, err := json.Marshal(matchmaking.GSRegisterResponse{})
-	if err != nil {
-		return nil, messages.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	return &matchmaking.GSRegisterResponse{}, nil
 }
 
-func (h *rmqHanders) GameserverUnregister(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) GameserverUnregister(ctx context.Context, request *matchmaking.GSUnregisterRequest) (*matchmaking.GSUnregisterResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &matchmaking.GSUnregisterRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("Failed to parse gameserver unregister request")
-		return nil, matchmaking.ErrInvalidRequest
-	}
 	err := h.mmManager.UpdateServerState(ctx, request.ServerID, request.Version, matchmaking.Draining)
 	if err != nil {
 		logger.WithError(err).Error("Failed to unregister game server")
 		return nil, matchmaking.ErrFailedToRegisterGameserver
 	}
-	bts, err := json.Marshal(matchmaking.GSUnregisterResponse{})
-	if err != nil {
-		return nil, messages.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	return &matchmaking.GSUnregisterResponse{}, nil
 }
@@ -10,8 +10,8 @@ import (
 	"github.com/mercury/pkg/clients/matchmaking"
 	"github.com/mercury/pkg/clients/publisher"
 	"github.com/mercury/pkg/instrumentation"
+	"github.com/mercury/pkg/instrumentation/metrics"
 	"github.com/sirupsen/logrus"
-	"github.com/smira/go-statsd"
 )
 
 type MMSolver interface {
@@ -22,7 +22,7 @@ type mmSolver struct {
 	checkInterval      time.Duration
 	solverWorkInterval time.Duration
 	publisherClient    publisher.RMQClient
-	statsdClient       *statsd.Client
+	metrics            metrics.Metrics
 	maxSolveTime       time.Duration
 	mmManager          managers.MatchmakingManager
 }
@@ -33,11 +33,11 @@ func NewMMSolver(
 	maxSolveTime time.Duration,
 	publisherClient publisher.RMQClient,
 	mmManager managers.MatchmakingManager,
-	statsdClient *statsd.Client) MMSolver {
+	m metrics.Metrics) MMSolver {
 	return &mmSolver{
 		checkInterval:      checkInterval,
 		publisherClient:    publisherClient,
-		statsdClient:       statsdClient,
+		metrics:            m,
 		maxSolveTime:       maxSolveTime,
 		mmManager:          mmManager,
 		solverWorkInterval: solverWorkInterval,
@@ -51,7 +51,7 @@ func (s *mmSolver) Solve(ctx context.Context, logger *logrus.Logger) {
 		case <-ctx.Done():
 			return
 		case <-time.After(interval):
-			t := instrumentation.NewMetricsTimer(ctx, "mmsolver.dur", statsd.StringTag("op", "solve"))
+			t := instrumentation.NewMetricsTimer(ctx, "mmsolver.dur", metrics.StringTag("op", "solve"))
 			solveID := uuid.New().String()
 			solveCtx, cancel := context.WithTimeout(ctx, s.maxSolveTime)
 			matched, err := s.solve(logger.WithFields(logrus.Fields{
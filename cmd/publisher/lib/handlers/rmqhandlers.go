@@ -12,8 +12,8 @@ import (
 )
 
 type RMQHandlers interface {
-	SendNotification(ctx context.Context, body []byte) ([]byte, error)
-	Subscribe(ctx context.Context, body []byte) ([]byte, error)
+	SendNotification(ctx context.Context, request *publisher.SendNotificationRequest) (*publisher.SendNotificationResponse, error)
+	Subscribe(ctx context.Context, request *publisher.SubscribeRequest) (*publisher.SubscribeResponse, error)
 }
 
 type rmqHanders struct {
@@ -26,35 +26,21 @@ func NewRMQHandlers(redisClient *redis.Client) RMQHandlers {
 	}
 }
 
-func (h *rmqHanders) SendNotification(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) SendNotification(ctx context.Context, request *publisher.SendNotificationRequest) (*publisher.SendNotificationResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &publisher.SendNotificationRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to unmarshal send notification request")
-		return nil, publisher.ErrInvalidRequest
-	}
 	bts, err := json.Marshal(request)
 	if err != nil {
 		logger.WithError(err).Error("failed to marshal send notification request")
 		return nil, publisher.ErrInvalidRequest
 	}
 	notified := h.redisClient.Publish(ctx, request.Channel, bts)
-	resp, err := json.Marshal(publisher.SendNotificationResponse{
+	return &publisher.SendNotificationResponse{
 		Notified: notified.Val(),
-	})
-	if err != nil {
-		return nil, publisher.ErrFailedToCreateResponse
-	}
-	return resp, nil
+	}, nil
 }
 
-func (h *rmqHanders) Subscribe(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) Subscribe(ctx context.Context, request *publisher.SubscribeRequest) (*publisher.SubscribeResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &publisher.SubscribeRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to unmarshal send notification request")
-		return nil, publisher.ErrInvalidRequest
-	}
 	userID := request.UserID
 	key := fmt.Sprintf("user:%s:channels", userID)
 
@@ -79,11 +65,7 @@ func (h *rmqHanders) Subscribe(ctx context.Context, body []byte) ([]byte, error)
 	})
 	if err != nil {
 		logger.WithError(err).Info("failed to marshal payload")
-		resp, err := json.Marshal(response)
-		if err != nil {
-			return nil, publisher.ErrFailedToCreateResponse
-		}
-		return resp, nil
+		return response, nil
 	}
 	referenceID := uuid.New().String()
 	bts, err := json.Marshal(&publisher.SendNotificationRequest{
@@ -94,12 +76,8 @@ func (h *rmqHanders) Subscribe(ctx context.Context, body []byte) ([]byte, error)
 	})
 	if err != nil {
 		logger.WithError(err).Info("failed to marshal SendNotificationRequest")
-		return json.Marshal(response)
+		return response, nil
 	}
 	h.redisClient.Publish(ctx, userChannel, bts)
-	resp, err := json.Marshal(response)
-	if err != nil {
-		return nil, publisher.ErrFailedToCreateResponse
-	}
-	return resp, nil
+	return response, nil
 }
@@ -28,14 +28,18 @@ type NotifierHandlers interface {
 
 type notifierHandlers struct {
 	authClient       auth.RMQClient
+	keys             middleware.KeySet
 	redisClient      *redis.Client
 	pubsubDispatcher session.PubSubDispatcher
 }
 
+// NewNotifierHandlers returns the subscriber handlers. keys verify tokens
+// sent in a WebSocket's first frame.
 func NewNotifierHandlers(
-	authClient auth.RMQClient, redisClient *redis.Client, pubsubDispatcher session.PubSubDispatcher) NotifierHandlers {
+	authClient auth.RMQClient, keys middleware.KeySet, redisClient *redis.Client, pubsubDispatcher session.PubSubDispatcher) NotifierHandlers {
 	return &notifierHandlers{
 		authClient:       authClient,
+		keys:             keys,
 		redisClient:      redisClient,
 		pubsubDispatcher: pubsubDispatcher,
 	}
@@ -49,19 +53,19 @@ type NotificationEnvelope struct {
 func (h *notifierHandlers) NotifyClient(c echo.Context) error {
 	ctx := instrumentation.ToContext(c)
 	logger := middleware.GetLogger(c)
-	metrics := middleware.GetStatsd(c)
+	m := middleware.GetMetrics(c)
 	w := c.Response()
 	r := c.Request()
 
-	// Validate before upgrading — returning HTTP errors after Upgrade() is not possible
-	// because the connection has been hijacked.
+	// Validate before upgrading when the request carried a token — returning
+	// HTTP errors after Upgrade() is not possible because the connection has
+	// been hijacked.
 	claims := middleware.GetClaims(c)
-	if claims == nil {
-		return echo.ErrUnauthorized
-	}
-	if _, err := h.authClient.GetSession(r.Context(), claims.SessionID); err != nil {
-		logger.WithError(err).Error("session validation failed")
-		return echo.ErrUnauthorized
+	if claims != nil {
+		if _, err := h.authClient.GetSession(r.Context(), claims.SessionID); err != nil {
+			logger.WithError(err).Error("session validation failed")
+			return echo.ErrUnauthorized
+		}
 	}
 	logger.Info("Starting client ws connection")
 
@@ -72,6 +76,24 @@ func (h *notifierHandlers) NotifyClient(c echo.Context) error {
 	}
 	defer conn.Close()
 
+	// Clients without a cookie jar or headers send the token in the first
+	// frame instead.
+	if claims == nil {
+		if claims, _, err = middleware.AuthenticateFirstFrame(c, conn, h.keys); err != nil {
+			return nil
+		}
+		logger = middleware.GetLogger(c)
+		if _, err := h.authClient.GetSession(r.Context(), claims.SessionID); err != nil {
+			logger.WithError(err).Error("session validation failed")
+			conn.WriteControl(
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "unauthorized"),
+				time.Now().Add(time.Second),
+			)
+			return nil
+		}
+	}
+
 	// TODO: POPULATE THIS FROM REDIS
 	subscribed := []string{
 		publisher.UserChannel(claims.UserID),          // for sending pubsub commands
@@ -108,7 +130,7 @@ func (h *notifierHandlers) NotifyClient(c echo.Context) error {
 		}
 	}()
 
-	h.pubsubDispatcher.Start(r.Context(), logger, metrics, conn, pubsub)
+	h.pubsubDispatcher.Start(r.Context(), logger, m, conn, pubsub)
 
 	// go func() {
 	// 	for msg := range pubsub.Channel() {
@@ -7,9 +7,9 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/mercury/pkg/clients/publisher"
+	"github.com/mercury/pkg/instrumentation/metrics"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
-	"github.com/smira/go-statsd"
 )
 
 // Handler processes a notification. Write to send to deliver messages to the
@@ -23,7 +23,7 @@ type PubSubDispatcher interface {
 	RegisterOnSub(notificationType publisher.NotificationName, h PubSubHandler)
 	// Start spawns the dispatch and writer goroutines. Must be called before Listen.
 	Start(
-		ctx context.Context, logger *logrus.Entry, metrics *statsd.Client, conn *websocket.Conn,
+		ctx context.Context, logger *logrus.Entry, m metrics.Metrics, conn *websocket.Conn,
 		pubsub *redis.PubSub)
 }
 
@@ -52,7 +52,7 @@ func (p *pubSubDispatcher) RegisterOnSub(notificationType publisher.Notification
 // When subQueue is closed (by Listen's goroutine when the Redis channel closes),
 // the dispatcher exits and closes send, which causes the writer to exit.
 func (p *pubSubDispatcher) Start(
-	ctx context.Context, logger *logrus.Entry, metrics *statsd.Client, conn *websocket.Conn,
+	ctx context.Context, logger *logrus.Entry, m metrics.Metrics, conn *websocket.Conn,
 	pubsub *redis.PubSub) {
 
 	done := make(chan struct{})
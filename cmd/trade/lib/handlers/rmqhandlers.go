@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"time"
 
@@ -14,11 +13,11 @@ import (
 )
 
 type RMQHandlers interface {
-	DraftTrade(ctx context.Context, body []byte) ([]byte, error)
-	LockTrade(ctx context.Context, body []byte) ([]byte, error)
-	UnlockTrade(ctx context.Context, body []byte) ([]byte, error)
-	DispatchGrants(ctx context.Context, body []byte) ([]byte, error)
-	TradeStatus(ctx context.Context, body []byte) ([]byte, error)
+	DraftTrade(ctx context.Context, request *trade.DraftTradeRequest) (*trade.DraftTradeResponse, error)
+	LockTrade(ctx context.Context, request *trade.LockTradeRequest) (*trade.LockTradeResponse, error)
+	UnlockTrade(ctx context.Context, request *trade.UnlockTradeRequest) (*trade.UnlockTradeResponse, error)
+	DispatchGrants(ctx context.Context, request *trade.DispatchGrantsRequest) (*trade.TradeResponse, error)
+	TradeStatus(ctx context.Context, request *trade.TradeStatusRequest) (*trade.TradeStatusResponse, error)
 }
 
 type rmqHanders struct {
@@ -31,21 +30,8 @@ func NewRMQHandlers(outboxManager managers.OutboxManager) RMQHandlers {
 	}
 }
 
-func (h *rmqHanders) DraftTrade(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) DraftTrade(ctx context.Context, request *trade.DraftTradeRequest) (*trade.DraftTradeResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &trade.DraftTradeRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("Failed to parse create trade request")
-		return nil, trade.ErrInvalidRequest
-	}
-	if !ids.ValidateOrderID(request.OrderID) {
-		logger.WithField("order_id", request.OrderID).Error("order_id must be a valid ULID")
-		return nil, trade.ErrInvalidRequest
-	}
-	if request.PlayerID == "" {
-		logger.Error("player_id is required")
-		return nil, trade.ErrInvalidRequest
-	}
 	commitID := request.TransactionID
 	_, err := h.outboxManager.GetOutboxStatus(ctx, request.OrderID)
 	if errors.Is(err, managers.ErrOrderNotFound) {
@@ -101,40 +87,17 @@ func (h *rmqHanders) DraftTrade(ctx context.Context, body []byte) ([]byte, error
 		grantsByPlayer[pid] = tg
 	}
 
-	bts, err := json.Marshal(trade.DraftTradeResponse{
+	return &trade.DraftTradeResponse{
 		OrderID:            updated.OrderID,
 		TransactionID:      updated.CommitID,
 		InitiatorID:        updated.InitiatorID,
 		ContractingParties: updated.ContractingParties,
 		GrantsByPlayer:     grantsByPlayer,
 		Signatures:         updated.Signatures,
-	})
-	if err != nil {
-		return nil, trade.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) LockTrade(ctx context.Context, body []byte) ([]byte, error) {
-	logger := rmq.GetLogger(ctx)
-	request := &trade.LockTradeRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("Failed to parse lock trade request")
-		return nil, trade.ErrInvalidRequest
-	}
-	if !ids.ValidateOrderID(request.OrderID) {
-		logger.WithField("order_id", request.OrderID).Error("order_id must be a valid ULID")
-		return nil, trade.ErrInvalidRequest
-	}
-	if request.PlayerID == "" {
-		logger.Error("player_id is required")
-		return nil, trade.ErrInvalidRequest
-	}
-	if request.TransactionID == "" {
-		logger.Error("transaction_id is required")
-		return nil, trade.ErrInvalidRequest
-	}
-
+func (h *rmqHanders) LockTrade(ctx context.Context, request *trade.LockTradeRequest) (*trade.LockTradeResponse, error) {
 	updated, err := h.outboxManager.LockTrade(ctx, request.OrderID, request.TransactionID, request.PlayerID)
 	if errors.Is(err, managers.ErrOrderNotFound) {
 		return nil, trade.ErrTradeConflict
@@ -143,39 +106,16 @@ func (h *rmqHanders) LockTrade(ctx context.Context, body []byte) ([]byte, error)
 		return nil, trade.ErrFailedToUpdateTrade
 	}
 
-	bts, err := json.Marshal(trade.LockTradeResponse{
+	return &trade.LockTradeResponse{
 		OrderID:            updated.OrderID,
 		TransactionID:      updated.CommitID,
 		Status:             updated.Status,
 		ContractingParties: updated.ContractingParties,
 		Signatures:         updated.Signatures,
-	})
-	if err != nil {
-		return nil, trade.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) UnlockTrade(ctx context.Context, body []byte) ([]byte, error) {
-	logger := rmq.GetLogger(ctx)
-	request := &trade.UnlockTradeRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("Failed to parse unlock trade request")
-		return nil, trade.ErrInvalidRequest
-	}
-	if !ids.ValidateOrderID(request.OrderID) {
-		logger.WithField("order_id", request.OrderID).Error("order_id must be a valid ULID")
-		return nil, trade.ErrInvalidRequest
-	}
-	if request.PlayerID == "" {
-		logger.Error("player_id is required")
-		return nil, trade.ErrInvalidRequest
-	}
-	if request.TransactionID == "" {
-		logger.Error("transaction_id is required")
-		return nil, trade.ErrInvalidRequest
-	}
-
+func (h *rmqHanders) UnlockTrade(ctx context.Context, request *trade.UnlockTradeRequest) (*trade.UnlockTradeResponse, error) {
 	updated, err := h.outboxManager.UnlockTrade(ctx, request.OrderID, request.TransactionID, request.PlayerID)
 	if errors.Is(err, managers.ErrOrderNotFound) {
 		return nil, trade.ErrTradeConflict
@@ -184,30 +124,16 @@ func (h *rmqHanders) UnlockTrade(ctx context.Context, body []byte) ([]byte, erro
 		return nil, trade.ErrFailedToUpdateTrade
 	}
 
-	bts, err := json.Marshal(trade.UnlockTradeResponse{
+	return &trade.UnlockTradeResponse{
 		OrderID:            updated.OrderID,
 		TransactionID:      updated.CommitID,
 		Status:             updated.Status,
 		ContractingParties: updated.ContractingParties,
 		Signatures:         updated.Signatures,
-	})
-	if err != nil {
-		return nil, trade.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) DispatchGrants(ctx context.Context, body []byte) ([]byte, error) {
-	logger := rmq.GetLogger(ctx)
-	request := &trade.DispatchGrantsRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("Failed to parse dispatch grants request")
-		return nil, trade.ErrInvalidRequest
-	}
-	if !ids.ValidateOrderID(request.OrderID) {
-		logger.WithField("order_id", request.OrderID).Error("order_id must be a valid ULID")
-		return nil, trade.ErrInvalidRequest
-	}
+func (h *rmqHanders) DispatchGrants(ctx context.Context, request *trade.DispatchGrantsRequest) (*trade.TradeResponse, error) {
 	grants := make([]trade.GrantItem, 0, len(request.Grants))
 	for _, grant := range request.Grants {
 		grants = append(grants, trade.GrantItem{
@@ -224,22 +150,12 @@ func (h *rmqHanders) DispatchGrants(ctx context.Context, body []byte) ([]byte, e
 	if err != nil {
 		return nil, trade.ErrFailedToCreateTrade
 	}
-	bts, err := json.Marshal(trade.TradeResponse{
+	return &trade.TradeResponse{
 		OrderID: request.OrderID,
-	})
-	if err != nil {
-		return nil, trade.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) TradeStatus(ctx context.Context, body []byte) ([]byte, error) {
-	logger := rmq.GetLogger(ctx)
-	request := &trade.TradeStatusRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("Failed to parse tradestatus request")
-		return nil, trade.ErrInvalidRequest
-	}
+func (h *rmqHanders) TradeStatus(ctx context.Context, request *trade.TradeStatusRequest) (*trade.TradeStatusResponse, error) {
 	outbox, err := h.outboxManager.GetOutboxStatus(ctx, request.OrderID)
 	if errors.Is(err, managers.ErrOrderNotFound) {
 		return nil, trade.ErrOrderNotFound
@@ -247,12 +163,8 @@ func (h *rmqHanders) TradeStatus(ctx context.Context, body []byte) ([]byte, erro
 	if err != nil {
 		return nil, trade.ErrFailedToGetTradeStatus
 	}
-	bts, err := json.Marshal(trade.TradeStatusResponse{
+	return &trade.TradeStatusResponse{
 		OrderID: request.OrderID,
 		Status:  outbox.Status,
-	})
-	if err != nil {
-		return nil, trade.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
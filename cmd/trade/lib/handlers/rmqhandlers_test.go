@@ -9,6 +9,7 @@ import (
 	"github.com/mercury/cmd/trade/lib/managers"
 	"github.com/mercury/pkg/clients/trade"
 	"github.com/mercury/pkg/ids"
+	"github.com/mercury/pkg/rmq"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -49,8 +50,25 @@ func (m *mockOutboxManager) CreateOutbox(_ context.Context, _, _ string, _ []tra
 	return m.createErr
 }
 
-func newHandlers(mgr managers.OutboxManager) RMQHandlers {
-	return NewRMQHandlers(mgr)
+// routedHandlers serves the handlers through their routes so the tests cover
+// decoding and validation the way the consumer runs them.
+type routedHandlers struct {
+	DraftTrade     rmq.Handler
+	LockTrade      rmq.Handler
+	UnlockTrade    rmq.Handler
+	DispatchGrants rmq.Handler
+	TradeStatus    rmq.Handler
+}
+
+func newHandlers(mgr managers.OutboxManager) routedHandlers {
+	h := NewRMQHandlers(mgr)
+	return routedHandlers{
+		DraftTrade:     trade.DraftTradeRoute.Handle(h.DraftTrade),
+		LockTrade:      trade.LockTradeRoute.Handle(h.LockTrade),
+		UnlockTrade:    trade.UnlockTradeRoute.Handle(h.UnlockTrade),
+		DispatchGrants: trade.DispatchGrantsRoute.Handle(h.DispatchGrants),
+		TradeStatus:    trade.TradeStatusRoute.Handle(h.TradeStatus),
+	}
 }
 
 func marshalJSON(t *testing.T, v any) []byte {
@@ -9,7 +9,7 @@ import (
 	"github.com/mercury/pkg/clients/trade"
 	"github.com/mercury/pkg/ids"
 	"github.com/mercury/pkg/instrumentation"
-	"github.com/smira/go-statsd"
+	"github.com/mercury/pkg/instrumentation/metrics"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -35,11 +35,11 @@ type OutboxManager interface {
 }
 
 type outboxManager struct {
-	col          *mongo.Collection
-	statsdClient *statsd.Client
+	col     *mongo.Collection
+	metrics metrics.Metrics
 }
 
-func NewOutboxManager(mongoAddr string, statsdClient *statsd.Client) (OutboxManager, error) {
+func NewOutboxManager(mongoAddr string, m metrics.Metrics) (OutboxManager, error) {
 	client, err := mongo.Connect(options.Client().ApplyURI(mongoAddr))
 	if err != nil {
 		return nil, err
@@ -59,14 +59,14 @@ func NewOutboxManager(mongoAddr string, statsdClient *statsd.Client) (OutboxMana
 	}
 
 	return &outboxManager{
-		col:          col,
-		statsdClient: statsdClient,
+		col:     col,
+		metrics: m,
 	}, nil
 }
 
 func (m *outboxManager) InsertTrade(ctx context.Context, orderID string, event *trade.OutboxEvent) (_ error) {
 
-	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", statsd.StringTag("op", "insert_trade"))
+	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", metrics.StringTag("op", "insert_trade"))
 	defer func() { t.Done(nil) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -90,7 +90,7 @@ func (m *outboxManager) InsertTrade(ctx context.Context, orderID string, event *
 func (m *outboxManager) UpdateTradeGrants(
 	ctx context.Context, orderID, commitID, playerID string, grants []trade.GrantItem) (_ *trade.OutboxEvent, _ error) {
 
-	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", statsd.StringTag("op", "update_trade"))
+	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", metrics.StringTag("op", "update_trade"))
 	defer func() { t.Done(nil) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -125,7 +125,7 @@ func (m *outboxManager) UpdateTradeGrants(
 func (m *outboxManager) LockTrade(
 	ctx context.Context, orderID, commitID, playerID string) (_ *trade.OutboxEvent, _ error) {
 
-	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", statsd.StringTag("op", "lock_trade"))
+	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", metrics.StringTag("op", "lock_trade"))
 	defer func() { t.Done(nil) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -183,7 +183,7 @@ func (m *outboxManager) LockTrade(
 func (m *outboxManager) UnlockTrade(
 	ctx context.Context, orderID, commitID, playerID string) (_ *trade.OutboxEvent, _ error) {
 
-	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", statsd.StringTag("op", "unlock_trade"))
+	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", metrics.StringTag("op", "unlock_trade"))
 	defer func() { t.Done(nil) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -216,7 +216,7 @@ func (m *outboxManager) UnlockTrade(
 }
 
 func (m *outboxManager) CreateOutbox(ctx context.Context, orderID, initiatorID string, grants []trade.GrantItem) (_ error) {
-	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", statsd.StringTag("op", "create_outbox"))
+	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", metrics.StringTag("op", "create_outbox"))
 	defer func() { t.Done(nil) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -243,7 +243,7 @@ func (m *outboxManager) CreateOutbox(ctx context.Context, orderID, initiatorID s
 }
 
 func (m *outboxManager) GetOutboxStatus(ctx context.Context, orderID string) (_ *trade.OutboxEvent, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", statsd.StringTag("op", "get_outbox_status"))
+	t := instrumentation.NewMetricsTimer(ctx, "trademgr.dur", metrics.StringTag("op", "get_outbox_status"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -10,8 +10,8 @@ import (
 	"github.com/mercury/pkg/clients/trade"
 	"github.com/mercury/pkg/clients/wallet"
 	"github.com/mercury/pkg/instrumentation"
+	"github.com/mercury/pkg/instrumentation/metrics"
 	"github.com/sirupsen/logrus"
-	"github.com/smira/go-statsd"
 )
 
 type Courier interface {
@@ -25,7 +25,7 @@ type courier struct {
 	outboxManager   OutboxManager
 	inventoryClient inventory.RMQClient
 	walletClient    wallet.RMQClient
-	statsdClient    *statsd.Client
+	metrics         metrics.Metrics
 }
 
 func NewCourier(
@@ -34,7 +34,7 @@ func NewCourier(
 	outboxManager OutboxManager,
 	inventoryClient inventory.RMQClient,
 	walletClient wallet.RMQClient,
-	statsdClient *statsd.Client,
+	m metrics.Metrics,
 ) Courier {
 	return &courier{
 		checkInterval:   checkInterval,
@@ -43,7 +43,7 @@ func NewCourier(
 		inventoryClient: inventoryClient,
 		walletClient:    walletClient,
 		maxRunTime:      10 * time.Minute,
-		statsdClient:    statsdClient,
+		metrics:         m,
 	}
 }
 
@@ -54,7 +54,7 @@ func (c *courier) Run(ctx context.Context, logger *logrus.Logger) {
 		case <-ctx.Done():
 			return
 		case <-time.After(interval):
-			t := instrumentation.NewMetricsTimer(ctx, "courier.dur", statsd.StringTag("op", "run"))
+			t := instrumentation.NewMetricsTimer(ctx, "courier.dur", metrics.StringTag("op", "run"))
 			runID := uuid.New().String()
 			runCtx, cancel := context.WithTimeout(ctx, c.maxRunTime)
 			entry := logger.WithFields(logrus.Fields{
@@ -7,7 +7,7 @@ import (
 
 	"github.com/mercury/pkg/clients/trade"
 	"github.com/mercury/pkg/instrumentation"
-	"github.com/smira/go-statsd"
+	"github.com/mercury/pkg/instrumentation/metrics"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
@@ -21,28 +21,28 @@ type OutboxManager interface {
 }
 
 type outboxManager struct {
-	col          *mongo.Collection
-	statsdClient *statsd.Client
-	lockTimeout  time.Duration
-	maxAttempts  int
+	col         *mongo.Collection
+	metrics     metrics.Metrics
+	lockTimeout time.Duration
+	maxAttempts int
 }
 
-func NewOutboxManager(mongoAddr string, statsdClient *statsd.Client, lockTimeout time.Duration, maxAttempts int) (OutboxManager, error) {
+func NewOutboxManager(mongoAddr string, m metrics.Metrics, lockTimeout time.Duration, maxAttempts int) (OutboxManager, error) {
 	client, err := mongo.Connect(options.Client().ApplyURI(mongoAddr))
 	if err != nil {
 		return nil, err
 	}
 	col := client.Database("trade").Collection("outbox")
 	return &outboxManager{
-		col:          col,
-		statsdClient: statsdClient,
-		lockTimeout:  lockTimeout,
-		maxAttempts:  maxAttempts,
+		col:         col,
+		metrics:     m,
+		lockTimeout: lockTimeout,
+		maxAttempts: maxAttempts,
 	}, nil
 }
 
 func (m *outboxManager) LockNext(ctx context.Context) (_ *trade.OutboxEvent, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "courier.dur", statsd.StringTag("op", "locknext"))
+	t := instrumentation.NewMetricsTimer(ctx, "courier.dur", metrics.StringTag("op", "locknext"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -70,7 +70,7 @@ func (m *outboxManager) LockNext(ctx context.Context) (_ *trade.OutboxEvent, err
 }
 
 func (m *outboxManager) Finalize(ctx context.Context, event trade.OutboxEvent, success bool) (err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "courier.dur", statsd.StringTag("op", "finalize"))
+	t := instrumentation.NewMetricsTimer(ctx, "courier.dur", metrics.StringTag("op", "finalize"))
 	defer func() { t.Done(err) }()
 
 	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
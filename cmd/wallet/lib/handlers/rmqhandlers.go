@@ -2,12 +2,10 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 
 	"github.com/mercury/cmd/wallet/lib/managers"
 	"github.com/mercury/pkg/clients/wallet"
-	"github.com/mercury/pkg/ids"
 	"github.com/mercury/pkg/rmq"
 )
 
@@ -23,8 +21,8 @@ func convertDBCurrencyToRMQCurrency(dbcurr map[string]int) []wallet.Currency {
 }
 
 type RMQHandlers interface {
-	AddCurrency(ctx context.Context, body []byte) ([]byte, error)
-	GetWallet(ctx context.Context, body []byte) ([]byte, error)
+	AddCurrency(ctx context.Context, request *wallet.AddCurrencyRequest) (*wallet.GetWalletResponse, error)
+	GetWallet(ctx context.Context, request *wallet.GetWalletRequest) (*wallet.GetWalletResponse, error)
 }
 
 type rmqHanders struct {
@@ -37,18 +35,8 @@ func NewRMQHandlers(walletManager managers.WalletManager) RMQHandlers {
 	}
 }
 
-func (h *rmqHanders) AddCurrency(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) AddCurrency(ctx context.Context, request *wallet.AddCurrencyRequest) (*wallet.GetWalletResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &wallet.AddCurrencyRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to parse add currency request")
-		return nil, wallet.ErrInvalidRequest
-	}
-	if !ids.ValidateOrderID(request.OrderID) {
-		logger.WithField("order_id", request.OrderID).Error("order_id must be a valid ULID")
-		return nil, wallet.ErrInvalidRequest
-	}
-
 	walletInfo, err := h.walletManager.Grant(
 		ctx, request.PlayerID, request.CurrencyID,
 		request.Amount, request.OrderID)
@@ -57,23 +45,14 @@ func (h *rmqHanders) AddCurrency(ctx context.Context, body []byte) ([]byte, erro
 		return nil, wallet.ErrFailedToGrantCurrency
 	}
 
-	bts, err := json.Marshal(wallet.GetWalletResponse{
+	return &wallet.GetWalletResponse{
 		PlayerID:   walletInfo.PlayerID,
 		Currencies: convertDBCurrencyToRMQCurrency(walletInfo.Currencies),
-	})
-	if err != nil {
-		return nil, wallet.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
 
-func (h *rmqHanders) GetWallet(ctx context.Context, body []byte) ([]byte, error) {
+func (h *rmqHanders) GetWallet(ctx context.Context, request *wallet.GetWalletRequest) (*wallet.GetWalletResponse, error) {
 	logger := rmq.GetLogger(ctx)
-	request := &wallet.GetWalletRequest{}
-	if err := json.Unmarshal(body, request); err != nil {
-		logger.WithError(err).Error("failed to parse wallet request")
-		return nil, wallet.ErrInvalidRequest
-	}
 	walletInfo, err := h.walletManager.GetWallet(ctx, request.PlayerID)
 	if err != nil {
 		if errors.Is(err, managers.ErrWalletNotFound) {
@@ -82,12 +61,8 @@ func (h *rmqHanders) GetWallet(ctx context.Context, body []byte) ([]byte, error)
 		logger.WithError(err).Error("failed to get wallet")
 		return nil, wallet.ErrFailedToGetWallet
 	}
-	bts, err := json.Marshal(wallet.GetWalletResponse{
+	return &wallet.GetWalletResponse{
 		PlayerID:   walletInfo.PlayerID,
 		Currencies: convertDBCurrencyToRMQCurrency(walletInfo.Currencies),
-	})
-	if err != nil {
-		return nil, wallet.ErrFailedToCreateResponse
-	}
-	return bts, nil
+	}, nil
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/mercury/cmd/wallet/lib/managers"
 	"github.com/mercury/pkg/clients/wallet"
 	"github.com/mercury/pkg/ids"
+	"github.com/mercury/pkg/rmq"
 )
 
 type mockWalletManager struct {
@@ -37,8 +38,19 @@ func (m *mockWalletManager) Grant(_ context.Context, playerID, _ string, _ int,
 	return &managers.Wallet{PlayerID: playerID, Currencies: map[string]int{}}, nil
 }
 
-func newHandlers(mgr managers.WalletManager) RMQHandlers {
-	return NewRMQHandlers(mgr)
+// routedHandlers serves the handlers through their routes so the tests cover
+// decoding and validation the way the consumer runs them.
+type routedHandlers struct {
+	AddCurrency rmq.Handler
+	GetWallet   rmq.Handler
+}
+
+func newHandlers(mgr managers.WalletManager) routedHandlers {
+	h := NewRMQHandlers(mgr)
+	return routedHandlers{
+		AddCurrency: wallet.AddCurrencyRoute.Handle(h.AddCurrency),
+		GetWallet:   wallet.GetWalletRoute.Handle(h.GetWallet),
+	}
 }
 
 func validOrderID() string {
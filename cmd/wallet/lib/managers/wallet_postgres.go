@@ -7,7 +7,7 @@ import (
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mercury/pkg/instrumentation"
-	"github.com/smira/go-statsd"
+	"github.com/mercury/pkg/instrumentation/metrics"
 )
 
 var ErrWalletNotFound = errors.New("wallet not found")
@@ -23,20 +23,20 @@ type WalletManager interface {
 }
 
 type postgresWalletManager struct {
-	pool         *pgxpool.Pool
-	statsdClient *statsd.Client
+	pool    *pgxpool.Pool
+	metrics metrics.Metrics
 }
 
-func NewPostgresWalletManager(dsn string, statsdClient *statsd.Client) (WalletManager, error) {
+func NewPostgresWalletManager(dsn string, m metrics.Metrics) (WalletManager, error) {
 	pool, err := pgxpool.New(context.Background(), dsn)
 	if err != nil {
 		return nil, err
 	}
-	return &postgresWalletManager{pool: pool, statsdClient: statsdClient}, nil
+	return &postgresWalletManager{pool: pool, metrics: m}, nil
 }
 
 func (s *postgresWalletManager) GetWallet(ctx context.Context, playerID string) (_ *Wallet, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "walletmgr.dur", statsd.StringTag("op", "get_wallet"))
+	t := instrumentation.NewMetricsTimer(ctx, "walletmgr.dur", metrics.StringTag("op", "get_wallet"))
 	defer func() { t.Done(err) }()
 
 	var exists bool
@@ -74,7 +74,7 @@ func (s *postgresWalletManager) GetWallet(ctx context.Context, playerID string)
 }
 
 func (s *postgresWalletManager) Grant(ctx context.Context, playerID, currencyID string, amount int, orderID string) (_ *Wallet, err error) {
-	t := instrumentation.NewMetricsTimer(ctx, "walletmgr.dur", statsd.StringTag("op", "grant"))
+	t := instrumentation.NewMetricsTimer(ctx, "walletmgr.dur", metrics.StringTag("op", "grant"))
 	defer func() { t.Done(err) }()
 
 	tx, err := s.pool.Begin(ctx)
@@ -35,8 +35,8 @@ type rmqClient struct {
 	Publisher *rmq.Publisher
 }
 
-func NewRMQClient(amqpURL string) (RMQClient, error) {
-	publisher, err := rmq.NewPublisher(amqpURL)
+func NewRMQClient(amqpURL string, middlewares ...rmq.ClientMiddleware) (RMQClient, error) {
+	publisher, err := rmq.NewPublisher(amqpURL, middlewares...)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +68,7 @@ type TokenResponse struct {
 }
 
 func (c *rmqClient) Login(ctx context.Context, username, password string) (_ *TokenResponse, err error) {
-	return rmq.Request[LoginRequest, TokenResponse](ctx, c.Publisher, "auth.v1.login", LoginRequest{
+	return LoginRoute.Request(ctx, c.Publisher, LoginRequest{
 		Credentials: Credentials{
 			Username: username,
 			Password: password,
@@ -85,7 +85,7 @@ type RefreshResponse struct {
 }
 
 func (c *rmqClient) Refresh(ctx context.Context, token string) (_ *RefreshResponse, err error) {
-	return rmq.Request[RefreshRequest, RefreshResponse](ctx, c.Publisher, "auth.v1.refresh", RefreshRequest{
+	return RefreshRoute.Request(ctx, c.Publisher, RefreshRequest{
 		Token: token,
 	})
 }
@@ -106,7 +106,7 @@ type AccountCreationResponse struct {
 
 func (c *rmqClient) CreateAccount(ctx context.Context,
 	username string, email string, password string) (_ *AccountCreationResponse, err error) {
-	return rmq.Request[AccountCreationRequest, AccountCreationResponse](ctx, c.Publisher, "auth.v1.createaccount", AccountCreationRequest{
+	return CreateAccountRoute.Request(ctx, c.Publisher, AccountCreationRequest{
 		Username: username,
 		Email:    email,
 		Password: password,
@@ -122,7 +122,7 @@ type ActivateAccountResponse struct {
 }
 
 func (c *rmqClient) ActivateAccount(ctx context.Context, accountID string) (_ *ActivateAccountResponse, err error) {
-	return rmq.Request[ActivateAccountRequest, ActivateAccountResponse](ctx, c.Publisher, "auth.v1.activateaccount", ActivateAccountRequest{
+	return ActivateAccountRoute.Request(ctx, c.Publisher, ActivateAccountRequest{
 		AccountID: accountID,
 	})
 }
@@ -139,7 +139,7 @@ type GetSessionRequest struct {
 }
 
 func (c *rmqClient) GetSession(ctx context.Context, sessionID string) (_ *SessionResponse, err error) {
-	return rmq.Request[GetSessionRequest, SessionResponse](ctx, c.Publisher, "auth.v1.getsession", GetSessionRequest{
+	return GetSessionRoute.Request(ctx, c.Publisher, GetSessionRequest{
 		SessionID: sessionID,
 	})
 }
@@ -149,7 +149,7 @@ type RefreshSessionRequest struct {
 }
 
 func (c *rmqClient) RefreshSession(ctx context.Context, sessionID string) (_ *SessionResponse, err error) {
-	return rmq.Request[RefreshSessionRequest, SessionResponse](ctx, c.Publisher, "auth.v1.refreshsession", RefreshSessionRequest{
+	return RefreshSessionRoute.Request(ctx, c.Publisher, RefreshSessionRequest{
 		SessionID: sessionID,
 	})
 }
@@ -163,7 +163,7 @@ type DeleteSessionResponse struct {
 }
 
 func (c *rmqClient) DeleteSession(ctx context.Context, sessionID string) (_ *DeleteSessionResponse, err error) {
-	return rmq.Request[DeleteSessionRequest, DeleteSessionResponse](ctx, c.Publisher, "auth.v1.deletesession", DeleteSessionRequest{
+	return DeleteSessionRoute.Request(ctx, c.Publisher, DeleteSessionRequest{
 		SessionID: sessionID,
 	})
 }
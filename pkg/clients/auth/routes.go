@@ -0,0 +1,18 @@
+package auth
+
+import "github.com/mercury/pkg/rmq"
+
+// Service owns the auth routes.
+var Service = rmq.Service{Name: "auth", InvalidRequest: ErrInvalidRequest}
+
+// Routes served by the auth service.
+var (
+	LoginRoute           = rmq.NewRoute[LoginRequest, TokenResponse](Service, "auth.v1.login")
+	RefreshRoute         = rmq.NewRoute[RefreshRequest, RefreshResponse](Service, "auth.v1.refresh")
+	RevokeRoute          = rmq.NewRoute[struct{}, struct{}](Service, "auth.v1.revoke") // handler not implemented yet
+	CreateAccountRoute   = rmq.NewRoute[AccountCreationRequest, AccountCreationResponse](Service, "auth.v1.createaccount")
+	ActivateAccountRoute = rmq.NewRoute[ActivateAccountRequest, ActivateAccountResponse](Service, "auth.v1.activateaccount")
+	GetSessionRoute      = rmq.NewRouteWithOpt[GetSessionRequest, SessionResponse](Service, "auth.v1.getsession", rmq.RouteOpt{Idempotent: true})
+	RefreshSessionRoute  = rmq.NewRoute[RefreshSessionRequest, SessionResponse](Service, "auth.v1.refreshsession")
+	DeleteSessionRoute   = rmq.NewRoute[DeleteSessionRequest, DeleteSessionResponse](Service, "auth.v1.deletesession")
+)
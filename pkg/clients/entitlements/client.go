@@ -57,8 +57,8 @@ type client struct {
 }
 
 // NewClient creates a new query client
-func NewClient(amqpURL string) (RMQClient, error) {
-	publisher, err := rmq.NewPublisher(amqpURL)
+func NewClient(amqpURL string, middlewares ...rmq.ClientMiddleware) (RMQClient, error) {
+	publisher, err := rmq.NewPublisher(amqpURL, middlewares...)
 	if err != nil {
 		return nil, err
 	}
@@ -91,7 +91,7 @@ func (c *client) GrantEntitlement(
 	version int,
 ) (*GrantResponse, error) {
 
-	return rmq.Request[GrantRequest, GrantResponse](ctx, c.Publisher, "ent.v1.grant", GrantRequest{
+	return GrantRoute.Request(ctx, c.Publisher, GrantRequest{
 		AccountID:     accountID,
 		PlayerID:      playerID,
 		EntitlementID: entitlementID,
@@ -181,7 +181,7 @@ func (c *client) CreateItem(
 	requirements []string,
 ) (*CreateItemResponse, error) {
 
-	return rmq.Request[CreateItemRequest, CreateItemResponse](ctx, c.Publisher, "cat.v1.additems", CreateItemRequest{
+	return AddItemsRoute.Request(ctx, c.Publisher, CreateItemRequest{
 		Item: CatalogItem{
 			CatalogItemID:  catalogItemID,
 			ItemType:       itemType,
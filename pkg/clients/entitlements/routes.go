@@ -0,0 +1,34 @@
+package entitlements
+
+import (
+	"github.com/mercury/pkg/ids"
+	"github.com/mercury/pkg/rmq"
+)
+
+// Service owns the entitlements routes.
+var Service = rmq.Service{Name: "entitlements", InvalidRequest: ErrInvalidRequest}
+
+// Routes served by the entitlements service.
+var (
+	CheckRoute        = rmq.NewRoute[struct{}, struct{}](Service, "ent.v1.check") // handler not implemented yet
+	GrantRoute        = rmq.NewRoute[GrantRequest, GrantResponse](Service, "ent.v1.grant")
+	RevokeRoute       = rmq.NewRoute[struct{}, struct{}](Service, "ent.v1.revoke") // handler not implemented yet
+	AddItemsRoute     = rmq.NewRoute[CreateItemRequest, CreateItemResponse](Service, "cat.v1.additems")
+	UpdateItemsRoute  = rmq.NewRoute[struct{}, struct{}](Service, "cat.v1.updateitems")  // handler not implemented yet
+	ArchiveItemsRoute = rmq.NewRoute[struct{}, struct{}](Service, "cat.v1.archiveitems") // handler not implemented yet
+)
+
+// Validate rejects grants that can't be dispatched or retried safely.
+func (r *GrantRequest) Validate() error {
+	if r.ServerID == "" {
+		return invalidField("server_id is required")
+	}
+	if !ids.ValidateOrderID(r.OrderID) {
+		return invalidField("order_id must be a valid ULID")
+	}
+	return nil
+}
+
+func invalidField(msg string) *rmq.Error {
+	return rmq.NewError(ErrInvalidRequest.Code, msg)
+}
@@ -18,8 +18,8 @@ type client struct {
 	publisher *rmq.Publisher
 }
 
-func NewClient(amqpURL string) (RMQClient, error) {
-	publisher, err := rmq.NewPublisher(amqpURL)
+func NewClient(amqpURL string, middlewares ...rmq.ClientMiddleware) (RMQClient, error) {
+	publisher, err := rmq.NewPublisher(amqpURL, middlewares...)
 	if err != nil {
 		return nil, err
 	}
@@ -62,19 +62,19 @@ type GetInventoryResponse struct {
 }
 
 func (c *client) CreateInventory(ctx context.Context, playerID string) (*GetInventoryResponse, error) {
-	return rmq.Request[GetInventoryRequest, GetInventoryResponse](ctx, c.publisher, "inventory.v1.createinventory", GetInventoryRequest{
+	return CreateInventoryRoute.Request(ctx, c.publisher, GetInventoryRequest{
 		PlayerID: playerID,
 	})
 }
 
 func (c *client) GetInventory(ctx context.Context, playerID string) (*GetInventoryResponse, error) {
-	return rmq.Request[GetInventoryRequest, GetInventoryResponse](ctx, c.publisher, "inventory.v1.getinventory", GetInventoryRequest{
+	return GetInventoryRoute.Request(ctx, c.publisher, GetInventoryRequest{
 		PlayerID: playerID,
 	})
 }
 
 func (c *client) AddItem(ctx context.Context, playerID, itemID, orderID string, amount, maxStack int) (*GetInventoryResponse, error) {
-	return rmq.Request[AddItemRequest, GetInventoryResponse](ctx, c.publisher, "inventory.v1.additem", AddItemRequest{
+	return AddItemRoute.Request(ctx, c.publisher, AddItemRequest{
 		PlayerID: playerID,
 		ItemID:   itemID,
 		Amount:   amount,
@@ -84,7 +84,7 @@ func (c *client) AddItem(ctx context.Context, playerID, itemID, orderID string,
 }
 
 func (c *client) AddItemToSlot(ctx context.Context, playerID, itemID, orderID string, slotID, amount, maxStack int) (*GetInventoryResponse, error) {
-	return rmq.Request[AddItemToSlotRequest, GetInventoryResponse](ctx, c.publisher, "inventory.v1.additemtoslot", AddItemToSlotRequest{
+	return AddItemToSlotRoute.Request(ctx, c.publisher, AddItemToSlotRequest{
 		PlayerID: playerID,
 		ItemID:   itemID,
 		SlotID:   slotID,
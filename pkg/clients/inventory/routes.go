@@ -0,0 +1,14 @@
+package inventory
+
+import "github.com/mercury/pkg/rmq"
+
+// Service owns the inventory routes.
+var Service = rmq.Service{Name: "inventory", InvalidRequest: ErrInvalidRequest}
+
+// Routes served by the inventory service.
+var (
+	CreateInventoryRoute = rmq.NewRoute[GetInventoryRequest, GetInventoryResponse](Service, "inventory.v1.createinventory")
+	GetInventoryRoute    = rmq.NewRouteWithOpt[GetInventoryRequest, GetInventoryResponse](Service, "inventory.v1.getinventory", rmq.RouteOpt{Idempotent: true})
+	AddItemRoute         = rmq.NewRoute[AddItemRequest, GetInventoryResponse](Service, "inventory.v1.additem")
+	AddItemToSlotRoute   = rmq.NewRoute[AddItemToSlotRequest, GetInventoryResponse](Service, "inventory.v1.additemtoslot")
+)
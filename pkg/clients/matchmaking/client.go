@@ -24,8 +24,8 @@ type rmqClient struct {
 }
 
 // NewClient creates a new query client
-func NewRMQClient(amqpURL string) (RMQClient, error) {
-	publisher, err := rmq.NewPublisher(amqpURL)
+func NewRMQClient(amqpURL string, middlewares ...rmq.ClientMiddleware) (RMQClient, error) {
+	publisher, err := rmq.NewPublisher(amqpURL, middlewares...)
 	if err != nil {
 		return nil, err
 	}
@@ -49,7 +49,7 @@ type MatchmakingQueueResponse struct {
 
 func (c *rmqClient) MatchmakingQueue(
 	ctx context.Context, partyID string, playerIDs []string) (*MatchmakingQueueResponse, error) {
-	return rmq.Request[MatchmakingQueueRequest, MatchmakingQueueResponse](ctx, c.Publisher, "mm.v1.clientregister", MatchmakingQueueRequest{
+	return ClientRegisterRoute.Request(ctx, c.Publisher, MatchmakingQueueRequest{
 		PartyID:   partyID,
 		PlayerIDs: playerIDs,
 	})
@@ -69,7 +69,7 @@ type GetQueueResponse struct {
 }
 
 func (c *rmqClient) GetQueue(ctx context.Context, partyID string) (*GetQueueResponse, error) {
-	return rmq.Request[GetQueueRequest, GetQueueResponse](ctx, c.Publisher, "mm.v1.getqueue", GetQueueRequest{
+	return GetQueueRoute.Request(ctx, c.Publisher, GetQueueRequest{
 		PartyID: partyID,
 	})
 }
@@ -89,7 +89,7 @@ type GSRegisterResponse struct {
 func (c *rmqClient) GameserverRegister(
 	ctx context.Context, serverID string, ipAddress string, port int,
 	capacity int) (*GSRegisterResponse, error) {
-	return rmq.Request[GSRegisterRequest, GSRegisterResponse](ctx, c.Publisher, "mm.v1.gsregister", GSRegisterRequest{
+	return GSRegisterRoute.Request(ctx, c.Publisher, GSRegisterRequest{
 		ServerID:  serverID,
 		IPAddress: ipAddress,
 		Port:      port,
@@ -107,7 +107,7 @@ type GSUnregisterResponse struct {
 
 func (c *rmqClient) GameserverUnregister(
 	ctx context.Context, serverID string, version int) (*GSUnregisterResponse, error) {
-	return rmq.Request[GSUnregisterRequest, GSUnregisterResponse](ctx, c.Publisher, "mm.v1.gsunregister", GSUnregisterRequest{
+	return GSUnregisterRoute.Request(ctx, c.Publisher, GSUnregisterRequest{
 		ServerID: serverID,
 		Version:  version,
 	})
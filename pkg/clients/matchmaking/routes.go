@@ -0,0 +1,15 @@
+package matchmaking
+
+import "github.com/mercury/pkg/rmq"
+
+// Service owns the matchmaking routes.
+var Service = rmq.Service{Name: "matchmaking", InvalidRequest: ErrInvalidRequest}
+
+// Routes served by the matchmaking service.
+var (
+	ClientRegisterRoute   = rmq.NewRoute[MatchmakingQueueRequest, MatchmakingQueueResponse](Service, "mm.v1.clientregister")
+	GetQueueRoute         = rmq.NewRouteWithOpt[GetQueueRequest, GetQueueResponse](Service, "mm.v1.getqueue", rmq.RouteOpt{Idempotent: true})
+	ClientUnregisterRoute = rmq.NewRoute[struct{}, struct{}](Service, "mm.v1.clientunregister") // handler not implemented yet
+	GSRegisterRoute       = rmq.NewRoute[GSRegisterRequest, GSRegisterResponse](Service, "mm.v1.gsregister")
+	GSUnregisterRoute     = rmq.NewRoute[GSUnregisterRequest, GSUnregisterResponse](Service, "mm.v1.gsunregister")
+)
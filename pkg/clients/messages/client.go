@@ -19,8 +19,8 @@ type rmqClient struct {
 }
 
 // NewClient creates a new query client
-func NewRMQClient(amqpURL string) (RMQClient, error) {
-	publisher, err := rmq.NewPublisher(amqpURL)
+func NewRMQClient(amqpURL string, middlewares ...rmq.ClientMiddleware) (RMQClient, error) {
+	publisher, err := rmq.NewPublisher(amqpURL, middlewares...)
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +54,7 @@ type GetMessagesResponse struct {
 
 func (c *rmqClient) GetMessages(
 	ctx context.Context, conversationID string, limit int, nextToken string) (*GetMessagesResponse, error) {
-	return rmq.Request[GetMessagesRequest, GetMessagesResponse](ctx, c.Publisher, "msgs.v1.getmessages", GetMessagesRequest{
+	return GetMessagesRoute.Request(ctx, c.Publisher, GetMessagesRequest{
 		ConversationID: conversationID,
 		Limit:          limit,
 		NextToken:      nextToken,
@@ -73,7 +73,7 @@ type RefreshMessagesResponse struct {
 func (c *rmqClient) RefreshMessages(
 	ctx context.Context,
 	conversationID string, messageID string) (*RefreshMessagesResponse, error) {
-	return rmq.Request[RefreshMessagesRequest, RefreshMessagesResponse](ctx, c.Publisher, "msgs.v1.refreshmessages", RefreshMessagesRequest{
+	return RefreshMessagesRoute.Request(ctx, c.Publisher, RefreshMessagesRequest{
 		ConversationID: conversationID,
 		MessageID:      messageID,
 	})
@@ -100,7 +100,7 @@ func (c *rmqClient) SendMessage(
 	userID string,
 	to []string,
 ) (*SendMessageResponse, error) {
-	return rmq.Request[SendMessageRequest, SendMessageResponse](ctx, c.Publisher, "msgs.v1.sendmessage", SendMessageRequest{
+	return SendMessageRoute.Request(ctx, c.Publisher, SendMessageRequest{
 		ConversationID: conversationID,
 		Body:           body,
 		User:           user,
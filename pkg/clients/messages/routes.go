@@ -0,0 +1,13 @@
+package messages
+
+import "github.com/mercury/pkg/rmq"
+
+// Service owns the messages routes.
+var Service = rmq.Service{Name: "messages", InvalidRequest: ErrInvalidRequest}
+
+// Routes served by the messages service.
+var (
+	GetMessagesRoute     = rmq.NewRouteWithOpt[GetMessagesRequest, GetMessagesResponse](Service, "msgs.v1.getmessages", rmq.RouteOpt{Idempotent: true})
+	RefreshMessagesRoute = rmq.NewRoute[RefreshMessagesRequest, RefreshMessagesResponse](Service, "msgs.v1.refreshmessages")
+	SendMessageRoute     = rmq.NewRoute[SendMessageRequest, SendMessageResponse](Service, "msgs.v1.sendmessage")
+)
@@ -39,8 +39,8 @@ type rmqClient struct {
 	Publisher *rmq.Publisher
 }
 
-func NewRMQClient(amqpURL string) (RMQClient, error) {
-	publisher, err := rmq.NewPublisher(amqpURL)
+func NewRMQClient(amqpURL string, middlewares ...rmq.ClientMiddleware) (RMQClient, error) {
+	publisher, err := rmq.NewPublisher(amqpURL, middlewares...)
 	if err != nil {
 		return nil, err
 	}
@@ -68,7 +68,7 @@ type SendNotificationResponse struct {
 func (c *rmqClient) SendNotification(
 	ctx context.Context, channel string, typ NotificationName, payload []byte) (*SendNotificationResponse, error) {
 	referenceID := uuid.New().String()
-	return rmq.Request[SendNotificationRequest, SendNotificationResponse](ctx, c.Publisher, "pbs.v1.sendnotification", SendNotificationRequest{
+	return SendNotificationRoute.Request(ctx, c.Publisher, SendNotificationRequest{
 		Channel:     channel,
 		Type:        typ,
 		Payload:     payload,
@@ -157,7 +157,7 @@ type SubscribeResponse struct {
 
 func (c *rmqClient) Subscribe(
 	ctx context.Context, userID string, channels []string) (*SubscribeResponse, error) {
-	return rmq.Request[SubscribeRequest, SubscribeResponse](ctx, c.Publisher, "pbs.v1.sendnotification", SubscribeRequest{
+	return SubscribeRoute.Request(ctx, c.Publisher, SubscribeRequest{
 		UserID:   userID,
 		Channels: channels,
 	})
@@ -0,0 +1,12 @@
+package publisher
+
+import "github.com/mercury/pkg/rmq"
+
+// Service owns the publisher routes.
+var Service = rmq.Service{Name: "publisher", InvalidRequest: ErrInvalidRequest}
+
+// Routes served by the publisher service.
+var (
+	SendNotificationRoute = rmq.NewRoute[SendNotificationRequest, SendNotificationResponse](Service, "pbs.v1.sendnotification")
+	SubscribeRoute        = rmq.NewRoute[SubscribeRequest, SubscribeResponse](Service, "pbs.v1.subscribe")
+)
@@ -20,8 +20,8 @@ type rmqClient struct {
 	logger    *logrus.Logger
 }
 
-func NewClient(logger *logrus.Logger, amqpURL string) (RMQClient, error) {
-	publisher, err := rmq.NewPublisher(amqpURL)
+func NewClient(logger *logrus.Logger, amqpURL string, middlewares ...rmq.ClientMiddleware) (RMQClient, error) {
+	publisher, err := rmq.NewPublisher(amqpURL, middlewares...)
 	if err != nil {
 		return nil, err
 	}
@@ -64,7 +64,7 @@ func (c *rmqClient) DispatchGrants(
 	ctx context.Context, orderID string, initiatorID string,
 	grants []TradeGrant,
 ) (*TradeResponse, error) {
-	return rmq.Request[DispatchGrantsRequest, TradeResponse](ctx, c.publisher, "trade.v1.dispatchgrants", DispatchGrantsRequest{
+	return DispatchGrantsRoute.Request(ctx, c.publisher, DispatchGrantsRequest{
 		OrderID:     orderID,
 		InitiatorID: initiatorID,
 		Grants:      grants,
@@ -83,7 +83,7 @@ type TradeStatusResponse struct {
 func (c *rmqClient) TradeStatus(
 	ctx context.Context, orderID string,
 ) (*TradeStatusResponse, error) {
-	return rmq.Request[TradeStatusRequest, TradeStatusResponse](ctx, c.publisher, "trade.v1.status", TradeStatusRequest{
+	return TradeStatusRoute.Request(ctx, c.publisher, TradeStatusRequest{
 		OrderID: orderID,
 	})
 }
@@ -107,7 +107,7 @@ type DraftTradeResponse struct {
 }
 
 func (c *rmqClient) DraftTrade(ctx context.Context, orderID, playerID, initiatorID, transactionID string, contractingParties []string, grants []TradeGrant) (*DraftTradeResponse, error) {
-	return rmq.Request[DraftTradeRequest, DraftTradeResponse](ctx, c.publisher, "trade.v1.drafttrade", DraftTradeRequest{
+	return DraftTradeRoute.Request(ctx, c.publisher, DraftTradeRequest{
 		OrderID:            orderID,
 		PlayerID:           playerID,
 		InitiatorID:        initiatorID,
@@ -132,7 +132,7 @@ type LockTradeResponse struct {
 }
 
 func (c *rmqClient) LockTrade(ctx context.Context, orderID, playerID, transactionID string) (*LockTradeResponse, error) {
-	return rmq.Request[LockTradeRequest, LockTradeResponse](ctx, c.publisher, "trade.v1.locktrade", LockTradeRequest{
+	return LockTradeRoute.Request(ctx, c.publisher, LockTradeRequest{
 		OrderID:       orderID,
 		PlayerID:      playerID,
 		TransactionID: transactionID,
@@ -154,7 +154,7 @@ type UnlockTradeResponse struct {
 }
 
 func (c *rmqClient) UnlockTrade(ctx context.Context, orderID, playerID, transactionID string) (*UnlockTradeResponse, error) {
-	return rmq.Request[UnlockTradeRequest, UnlockTradeResponse](ctx, c.publisher, "trade.v1.unlocktrade", UnlockTradeRequest{
+	return UnlockTradeRoute.Request(ctx, c.publisher, UnlockTradeRequest{
 		OrderID:       orderID,
 		PlayerID:      playerID,
 		TransactionID: transactionID,
@@ -0,0 +1,61 @@
+package trade
+
+import (
+	"github.com/mercury/pkg/ids"
+	"github.com/mercury/pkg/rmq"
+)
+
+// Service owns the trade routes.
+var Service = rmq.Service{Name: "trade", InvalidRequest: ErrInvalidRequest}
+
+// Routes served by the trade service.
+var (
+	DraftTradeRoute     = rmq.NewRoute[DraftTradeRequest, DraftTradeResponse](Service, "trade.v1.drafttrade")
+	LockTradeRoute      = rmq.NewRoute[LockTradeRequest, LockTradeResponse](Service, "trade.v1.locktrade")
+	UnlockTradeRoute    = rmq.NewRoute[UnlockTradeRequest, UnlockTradeResponse](Service, "trade.v1.unlocktrade")
+	DispatchGrantsRoute = rmq.NewRoute[DispatchGrantsRequest, TradeResponse](Service, "trade.v1.dispatchgrants")
+	TradeStatusRoute    = rmq.NewRouteWithOpt[TradeStatusRequest, TradeStatusResponse](Service, "trade.v1.status", rmq.RouteOpt{Idempotent: true})
+)
+
+// Validate rejects requests the trade handlers can't act on.
+func (r *DraftTradeRequest) Validate() error {
+	if !ids.ValidateOrderID(r.OrderID) {
+		return invalidField("order_id must be a valid ULID")
+	}
+	if r.PlayerID == "" {
+		return invalidField("player_id is required")
+	}
+	return nil
+}
+
+func (r *LockTradeRequest) Validate() error {
+	return validateSignature(r.OrderID, r.PlayerID, r.TransactionID)
+}
+
+func (r *UnlockTradeRequest) Validate() error {
+	return validateSignature(r.OrderID, r.PlayerID, r.TransactionID)
+}
+
+func (r *DispatchGrantsRequest) Validate() error {
+	if !ids.ValidateOrderID(r.OrderID) {
+		return invalidField("order_id must be a valid ULID")
+	}
+	return nil
+}
+
+func validateSignature(orderID, playerID, transactionID string) error {
+	if !ids.ValidateOrderID(orderID) {
+		return invalidField("order_id must be a valid ULID")
+	}
+	if playerID == "" {
+		return invalidField("player_id is required")
+	}
+	if transactionID == "" {
+		return invalidField("transaction_id is required")
+	}
+	return nil
+}
+
+func invalidField(msg string) *rmq.Error {
+	return rmq.NewError(ErrInvalidRequest.Code, msg)
+}
@@ -17,8 +17,8 @@ type client struct {
 }
 
 // NewClient creates a new query client
-func NewClient(amqpURL string) (RMQClient, error) {
-	publisher, err := rmq.NewPublisher(amqpURL)
+func NewClient(amqpURL string, middlewares ...rmq.ClientMiddleware) (RMQClient, error) {
+	publisher, err := rmq.NewPublisher(amqpURL, middlewares...)
 	if err != nil {
 		return nil, err
 	}
@@ -46,7 +46,7 @@ type GetWalletRequest struct {
 }
 
 func (c *client) GetWallet(ctx context.Context, playerID string) (*GetWalletResponse, error) {
-	return rmq.Request[GetWalletRequest, GetWalletResponse](ctx, c.Publisher, "wallet.v1.get_wallet", GetWalletRequest{
+	return GetWalletRoute.Request(ctx, c.Publisher, GetWalletRequest{
 		PlayerID: playerID,
 	})
 }
@@ -59,7 +59,7 @@ type AddCurrencyRequest struct {
 }
 
 func (c *client) AddCurrency(ctx context.Context, playerID string, currencyID string, amount int, orderID string) (*GetWalletResponse, error) {
-	return rmq.Request[AddCurrencyRequest, GetWalletResponse](ctx, c.Publisher, "wallet.v1.add_currency", AddCurrencyRequest{
+	return AddCurrencyRoute.Request(ctx, c.Publisher, AddCurrencyRequest{
 		PlayerID:   playerID,
 		CurrencyID: currencyID,
 		Amount:     amount,
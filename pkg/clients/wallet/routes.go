@@ -0,0 +1,23 @@
+package wallet
+
+import (
+	"github.com/mercury/pkg/ids"
+	"github.com/mercury/pkg/rmq"
+)
+
+// Service owns the wallet routes.
+var Service = rmq.Service{Name: "wallet", InvalidRequest: ErrInvalidRequest}
+
+// Routes served by the wallet service.
+var (
+	GetWalletRoute   = rmq.NewRouteWithOpt[GetWalletRequest, GetWalletResponse](Service, "wallet.v1.get_wallet", rmq.RouteOpt{Idempotent: true})
+	AddCurrencyRoute = rmq.NewRoute[AddCurrencyRequest, GetWalletResponse](Service, "wallet.v1.add_currency")
+)
+
+// Validate rejects grants the wallet can't make idempotent.
+func (r *AddCurrencyRequest) Validate() error {
+	if !ids.ValidateOrderID(r.OrderID) {
+		return rmq.NewError(ErrInvalidRequest.Code, "order_id must be a valid ULID")
+	}
+	return nil
+}
@@ -8,12 +8,13 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 )
 
-// AWSConfig holds the AWS configuration values read from viper config.
+// AWSConfig holds the AWS configuration values read from viper config. It
+// binds the same keys in every service that embeds it.
 type AWSConfig struct {
-	AccessKey string
-	SecretKey string
-	Region    string
-	Endpoint  string
+	AccessKey string `config:"aws_access_key,secret" default:"test" usage:"AWS access key (for SSM)"`
+	SecretKey string `config:"aws_secret_key,secret" default:"test" usage:"AWS secret key (for SSM)"`
+	Region    string `config:"aws_region" default:"us-west-1" validate:"required" usage:"AWS region"`
+	Endpoint  string `config:"aws_endpoint" validate:"url" usage:"AWS endpoint override (e.g. LocalStack)"`
 }
 
 // NewSSMClient creates an SSM client from explicit config values.
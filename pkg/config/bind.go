@@ -0,0 +1,455 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// Bind fills the fields of the struct dst points to from the config, using
+// their struct tags:
+//
+//	type serviceConfig struct {
+//		LogLevel string        `config:"log_level" default:"info" validate:"oneof=debug info warn error"`
+//		MongoAddr string       `config:"mongo_addr,secret" validate:"required,url" usage:"MongoDB connection string"`
+//		Workers  int           `config:"workers" default:"8" validate:"min=1,max=64"`
+//		Grace    time.Duration `config:"shutdown_grace" default:"25s"`
+//		AWS      config.AWSConfig
+//	}
+//
+// config names the key and, with ",secret", marks the value as one to
+// redact in AllSettings and PrintConfig. default is the value when neither
+// a config file nor the environment sets the key. validate holds
+// comma-separated rules: required, url, min=N, max=N (the length of a
+// string, the value of a number or duration) and oneof=a b c. usage
+// describes the key in the reference. deprecated names the key's former
+// name, read with a warning while the key itself is unset. Untagged struct
+// fields are bound recursively, so groups such as AWSConfig can be shared
+// between services.
+//
+// Fields may be strings, bools, ints, floats or durations. Every invalid
+// value and every key in a config file that no field binds is reported,
+// joined into one error, instead of stopping at the first.
+func (c *config) Bind(dst any) error {
+	fields, err := bindFields(dst)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	known := map[string]bool{}
+	for _, f := range fields {
+		known[f.key] = true
+		if f.deprecated != "" {
+			known[f.deprecated] = true
+			if !c.Viper.IsSet(f.key) && c.Viper.IsSet(f.deprecated) {
+				log.Printf("[config] %s is deprecated, use %s", f.deprecated, f.key)
+				c.Viper.Set(f.key, c.Viper.Get(f.deprecated))
+			}
+		}
+		if f.def != "" {
+			c.Viper.SetDefault(f.key, f.def)
+		}
+		c.register(f.key, f.secret)
+		if err := f.set(c.Viper.Get(f.key)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.key, err))
+			continue
+		}
+		errs = append(errs, f.validate()...)
+	}
+	for _, key := range c.Viper.AllKeys() {
+		if !known[key] && c.Viper.InConfig(key) {
+			errs = append(errs, fmt.Errorf("%s: set in a config file but not a known key", key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Bind loads the config files in DefaultConfigPaths and binds dst from them
+// and the environment. See Config.Bind for the struct tags.
+func Bind(dst any) error {
+	cfg := NewConfig("yaml")
+	if err := cfg.LoadPaths(DefaultConfigPaths); err != nil {
+		return err
+	}
+	return cfg.Bind(dst)
+}
+
+// MustBind is Bind for a service's main. It exits the process when the
+// config is invalid, listing every error, and also serves two command-line
+// flags: --print-config prints the effective values with secrets redacted,
+// and --config-reference prints a Markdown table of every key. Both exit
+// once printed.
+func MustBind(dst any) {
+	args := os.Args[1:]
+	if slices.Contains(args, "--config-reference") {
+		if err := PrintReference(os.Stdout, dst); err != nil {
+			fmt.Fprintln(os.Stderr, "config:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	err := Bind(dst)
+	if slices.Contains(args, "--print-config") {
+		if perr := PrintConfig(os.Stdout, dst); perr != nil && err == nil {
+			err = perr
+		}
+		if err == nil {
+			os.Exit(0)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config: invalid configuration:\n%s\n", indent(err.Error()))
+		os.Exit(1)
+	}
+}
+
+func indent(s string) string {
+	return "  " + strings.ReplaceAll(s, "\n", "\n  ")
+}
+
+// Setting is one key of a bound struct.
+type Setting struct {
+	Key     string
+	Env     string
+	Type    string
+	Default string
+	Secret  bool
+	Rules   string
+	Usage   string
+	// Deprecated is the key's former name, if it had one.
+	Deprecated string
+	// Value is the current value of the field, or "****" for a secret that
+	// is set.
+	Value any
+}
+
+// Settings lists the keys of the struct dst points to with their current
+// values, secrets redacted, sorted by key. It is meant for logging the
+// effective config at startup.
+func Settings(dst any) ([]Setting, error) {
+	fields, err := bindFields(dst)
+	if err != nil {
+		return nil, err
+	}
+	settings := make([]Setting, 0, len(fields))
+	for _, f := range fields {
+		s := Setting{
+			Key:        f.key,
+			Env:        strings.ToUpper(f.key),
+			Type:       f.typeName(),
+			Default:    f.def,
+			Secret:     f.secret,
+			Rules:      strings.Join(f.rules, ","),
+			Usage:      f.usage,
+			Value:      f.display(),
+			Deprecated: f.deprecated,
+		}
+		settings = append(settings, s)
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings, nil
+}
+
+// PrintConfig writes the effective value and default of every key of dst as
+// a table, secrets redacted.
+func PrintConfig(w io.Writer, dst any) error {
+	settings, err := Settings(dst)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tDEFAULT")
+	for _, s := range settings {
+		def := s.Default
+		if s.Secret && def != "" {
+			def = "****"
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%s\n", s.Key, s.Value, def)
+	}
+	return tw.Flush()
+}
+
+// PrintReference writes a Markdown table documenting every key of dst: its
+// environment variable, type, default, rules and usage.
+func PrintReference(w io.Writer, dst any) error {
+	settings, err := Settings(dst)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "| Key | Variable | Type | Default | Rules | Description |")
+	fmt.Fprintln(w, "|-----|----------|------|---------|-------|-------------|")
+	for _, s := range settings {
+		def := "_(empty)_"
+		if s.Default != "" {
+			def = "`" + s.Default + "`"
+		}
+		if s.Secret {
+			def += " (secret)"
+		}
+		usage := s.Usage
+		if s.Deprecated != "" {
+			usage += fmt.Sprintf(" (replaces the deprecated `%s`)", s.Deprecated)
+		}
+		fmt.Fprintf(w, "| `%s` | `%s` | %s | %s | %s | %s |\n", s.Key, s.Env, s.Type, def, s.Rules, usage)
+	}
+	return nil
+}
+
+var durationType = reflect.TypeFor[time.Duration]()
+
+// field is a tagged struct field.
+type field struct {
+	key        string
+	deprecated string
+	def        string
+	secret     bool
+	rules      []string
+	usage      string
+	value      reflect.Value
+}
+
+// bindFields returns the tagged fields of the struct dst points to, nested
+// ones included, and checks their tags.
+func bindFields(dst any) ([]field, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: bind needs a pointer to a struct, got %T", dst)
+	}
+	var fields []field
+	if err := collectFields(v.Elem(), &fields); err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, f := range fields {
+		for _, key := range []string{f.key, f.deprecated} {
+			if seen[key] {
+				return nil, fmt.Errorf("config: key %s is bound twice", key)
+			}
+			if key != "" {
+				seen[key] = true
+			}
+		}
+	}
+	return fields, nil
+}
+
+func collectFields(v reflect.Value, fields *[]field) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag, ok := sf.Tag.Lookup("config")
+		if !ok {
+			if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+				if err := collectFields(v.Field(i), fields); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		key, opts, _ := strings.Cut(tag, ",")
+		f := field{
+			key:        key,
+			deprecated: sf.Tag.Get("deprecated"),
+			def:        sf.Tag.Get("default"),
+			secret:     opts == "secret",
+			usage:      sf.Tag.Get("usage"),
+			value:      v.Field(i),
+		}
+		if key == "" || (opts != "" && opts != "secret") {
+			return fmt.Errorf("config: field %s: bad config tag %q", sf.Name, tag)
+		}
+		if rules := sf.Tag.Get("validate"); rules != "" {
+			f.rules = strings.Split(rules, ",")
+		}
+		if f.typeName() == "" {
+			return fmt.Errorf("config: field %s: unsupported type %s", sf.Name, sf.Type)
+		}
+		if err := f.checkRules(); err != nil {
+			return fmt.Errorf("config: field %s: %w", sf.Name, err)
+		}
+		if f.def != "" {
+			scratch := f
+			scratch.value = reflect.New(sf.Type).Elem()
+			if err := scratch.set(f.def); err != nil {
+				return fmt.Errorf("config: field %s: bad default: %w", sf.Name, err)
+			}
+		}
+		*fields = append(*fields, f)
+	}
+	return nil
+}
+
+func (f field) typeName() string {
+	if f.value.Type() == durationType {
+		return "duration"
+	}
+	switch f.value.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int64:
+		return "int"
+	case reflect.Float64:
+		return "float"
+	}
+	return ""
+}
+
+// set converts raw, as it comes from a file, the environment or a default,
+// and stores it in the field. nil leaves the field as it is.
+func (f field) set(raw any) error {
+	if raw == nil {
+		return nil
+	}
+	var (
+		v   any
+		err error
+	)
+	switch f.typeName() {
+	case "duration":
+		v, err = cast.ToDurationE(raw)
+		// cast reads a bare number as nanoseconds; nobody means that.
+		if s, ok := raw.(string); ok && err == nil {
+			v, err = time.ParseDuration(s)
+		}
+	case "string":
+		v, err = cast.ToStringE(raw)
+	case "bool":
+		v, err = cast.ToBoolE(raw)
+	case "int":
+		v, err = cast.ToInt64E(raw)
+	case "float":
+		v, err = cast.ToFloat64E(raw)
+	}
+	if err != nil {
+		if f.secret {
+			return fmt.Errorf("invalid %s", f.typeName())
+		}
+		return fmt.Errorf("invalid %s %q", f.typeName(), fmt.Sprint(raw))
+	}
+	f.value.Set(reflect.ValueOf(v).Convert(f.value.Type()))
+	return nil
+}
+
+func (f field) checkRules() error {
+	for _, rule := range f.rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+		case "url":
+			if f.typeName() != "string" {
+				return fmt.Errorf("rule url needs a string")
+			}
+		case "min", "max":
+			if _, err := f.bound(arg); err != nil {
+				return fmt.Errorf("rule %s: %w", rule, err)
+			}
+		case "oneof":
+			if arg == "" {
+				return fmt.Errorf("rule oneof needs values")
+			}
+		default:
+			return fmt.Errorf("unknown rule %q", rule)
+		}
+	}
+	return nil
+}
+
+// bound parses the argument of min or max in the units measure uses.
+func (f field) bound(arg string) (float64, error) {
+	if f.typeName() == "duration" {
+		d, err := time.ParseDuration(arg)
+		return float64(d), err
+	}
+	return strconv.ParseFloat(arg, 64)
+}
+
+// measure is what min and max compare: a string's length, a bool as 0 or 1,
+// or the value of a number.
+func (f field) measure() float64 {
+	switch f.typeName() {
+	case "string":
+		return float64(len(f.value.String()))
+	case "bool":
+		if f.value.Bool() {
+			return 1
+		}
+		return 0
+	case "float":
+		return f.value.Float()
+	}
+	return float64(f.value.Int())
+}
+
+// unit names what min and max count for strings.
+func (f field) unit() string {
+	if f.typeName() == "string" {
+		return " characters"
+	}
+	return ""
+}
+
+// display is the value as it may be shown: durations as text and secrets
+// redacted unless empty.
+func (f field) display() any {
+	if f.secret && !f.value.IsZero() {
+		return "****"
+	}
+	if d, ok := f.value.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	return f.value.Interface()
+}
+
+func (f field) validate() []error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{f.key}, args...)...))
+	}
+	zero := f.value.IsZero()
+	for _, rule := range f.rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			if zero {
+				fail("is required")
+			}
+		case "url":
+			if zero {
+				continue
+			}
+			if u, err := url.Parse(f.value.String()); err != nil || u.Scheme == "" || u.Host == "" {
+				fail("%v is not a URL", f.display())
+			}
+		case "min":
+			if min, _ := f.bound(arg); f.measure() < min {
+				fail("%v is less than the minimum %s%s", f.display(), arg, f.unit())
+			}
+		case "max":
+			if max, _ := f.bound(arg); f.measure() > max {
+				fail("%v is more than the maximum %s%s", f.display(), arg, f.unit())
+			}
+		case "oneof":
+			if options := strings.Fields(arg); !slices.Contains(options, fmt.Sprint(f.value.Interface())) {
+				fail("%v is not one of %s", f.display(), strings.Join(options, ", "))
+			}
+		}
+	}
+	return errs
+}
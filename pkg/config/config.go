@@ -18,6 +18,7 @@ type Config interface {
 	SetDefaultInt(key string, value int, secure bool) int
 	SetDefaultBool(key string, value bool, secure bool) bool
 	SetDefaultDuration(key string, value time.Duration, secure bool) time.Duration
+	Bind(dst any) error
 }
 
 type viperConfig interface {
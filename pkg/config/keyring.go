@@ -0,0 +1,213 @@
+package config
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrUnknownKeyID is returned for a token signed with a key that isn't, or
+// is no longer, in the key ring.
+var ErrUnknownKeyID = errors.New("unknown signing key")
+
+// KeyID identifies an RSA public key by its RFC 7638 thumbprint, the kid
+// tokens signed with the matching private key carry in their header. It
+// depends on the key alone, so the same key has the same ID everywhere
+// without it being stored next to the key.
+func KeyID(pub *rsa.PublicKey) string {
+	e := base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	n := base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+	sum := sha256.Sum256([]byte(`{"e":"` + e + `","kty":"RSA","n":"` + n + `"}`))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// PublicKeys is a set of public keys by key ID.
+type PublicKeys map[string]*rsa.PublicKey
+
+// ParsePublicKeys reads every PEM public key in s. A parameter holding a
+// single key, as before rotation, is a set of one.
+func ParsePublicKeys(s string) (PublicKeys, error) {
+	keys := PublicKeys{}
+	rest := []byte(s)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		pub, err := jwt.ParseRSAPublicKeyFromPEM(pem.EncodeToMemory(block))
+		if err != nil {
+			return nil, err
+		}
+		keys[KeyID(pub)] = pub
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM public key found")
+	}
+	return keys, nil
+}
+
+// PublicKey returns the key with ID kid. Tokens signed before key IDs were
+// added have none; with a single key in the set that key is returned, with
+// several they are verified against each of AllPublicKeys.
+func (k PublicKeys) PublicKey(kid string) (*rsa.PublicKey, error) {
+	if kid == "" && len(k) == 1 {
+		for _, pub := range k {
+			return pub, nil
+		}
+	}
+	if pub, ok := k[kid]; ok {
+		return pub, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownKeyID, kid)
+}
+
+// AllPublicKeys returns every key in the set, in key ID order.
+func (k PublicKeys) AllPublicKeys() []*rsa.PublicKey {
+	all := make([]*rsa.PublicKey, 0, len(k))
+	for _, id := range k.IDs() {
+		all = append(all, k[id])
+	}
+	return all
+}
+
+// IDs returns the key IDs in the set, sorted.
+func (k PublicKeys) IDs() []string {
+	ids := make([]string, 0, len(k))
+	for id := range k {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// PEM encodes the set as it is stored in a public key parameter, one PEM
+// block per key in key ID order.
+func (k PublicKeys) PEM() (string, error) {
+	var b strings.Builder
+	for _, id := range k.IDs() {
+		der, err := x509.MarshalPKIXPublicKey(k[id])
+		if err != nil {
+			return "", err
+		}
+		b.Write(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	}
+	return b.String(), nil
+}
+
+// SigningKey is the private key new tokens are signed with and its key ID.
+type SigningKey struct {
+	ID      string
+	Private *rsa.PrivateKey
+}
+
+// ParseSigningKey reads a PEM private key.
+func ParseSigningKey(s string) (*SigningKey, error) {
+	priv, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(s))
+	if err != nil {
+		return nil, err
+	}
+	return &SigningKey{ID: KeyID(&priv.PublicKey), Private: priv}, nil
+}
+
+// KeyRing holds the public keys tokens are verified with and, for the
+// service issuing them, the key they are signed with. Both follow their
+// parameters through a Poller, so keys rotate without a restart:
+//
+//  1. publish: add the new public key to the public key parameter, next to
+//     the current one, and wait for every service to refresh;
+//  2. switch: put the new private key in the private key parameter, so new
+//     tokens are signed with it while old ones still verify;
+//  3. retire: once the longest-lived token signed with the old key has
+//     expired, remove the old public key.
+//
+// mercuryctl keys runs these steps against SSM.
+type KeyRing struct {
+	public  *Live[PublicKeys]
+	signing *Live[*SigningKey]
+}
+
+// KeyRingOpt configures a KeyRing.
+type KeyRingOpt struct {
+	// PublicParam holds the PEM public keys tokens are verified with.
+	PublicParam string
+	// PrivateParam holds the PEM private key tokens are signed with. Only
+	// the service issuing tokens sets it.
+	PrivateParam string
+}
+
+// NewKeyRing follows the key parameters of opt through p. It fails when the
+// initial fetch found no valid keys, since no token could be verified or
+// signed.
+func NewKeyRing(p *Poller, opt KeyRingOpt) (*KeyRing, error) {
+	r := &KeyRing{public: NewLive(p, opt.PublicParam, PublicKeys(nil), ParsePublicKeys)}
+	if r.public.Get() == nil {
+		return nil, fmt.Errorf("config: no public keys loaded from %s", opt.PublicParam)
+	}
+	if opt.PrivateParam != "" {
+		r.signing = NewLive(p, opt.PrivateParam, (*SigningKey)(nil), ParseSigningKey)
+		if r.signing.Get() == nil {
+			return nil, fmt.Errorf("config: no signing key loaded from %s", opt.PrivateParam)
+		}
+		if _, err := r.SigningKey(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// PublicKey returns the current public key with ID kid.
+func (r *KeyRing) PublicKey(kid string) (*rsa.PublicKey, error) {
+	return r.public.Get().PublicKey(kid)
+}
+
+// AllPublicKeys returns every current public key, for tokens without kid.
+func (r *KeyRing) AllPublicKeys() []*rsa.PublicKey {
+	return r.public.Get().AllPublicKeys()
+}
+
+// PublicKeys returns the current set of public keys.
+func (r *KeyRing) PublicKeys() PublicKeys {
+	return r.public.Get()
+}
+
+// SigningKey returns the current signing key. It fails for a key ring
+// without a private key parameter, and while the public half of the signing
+// key isn't published, since no service could verify the tokens.
+func (r *KeyRing) SigningKey() (*SigningKey, error) {
+	if r.signing == nil {
+		return nil, errors.New("config: key ring has no signing key")
+	}
+	key := r.signing.Get()
+	if _, ok := r.public.Get()[key.ID]; !ok {
+		return nil, fmt.Errorf("config: signing key %s is not among the published public keys", key.ID)
+	}
+	return key, nil
+}
+
+// JWTConfig binds the settings of a service's KeyRing.
+type JWTConfig struct {
+	PublicKeyParam  string        `config:"pub_key_ssm_param" default:"/mercury/jwt-public-key" validate:"required" usage:"SSM parameter holding the PEM public keys tokens are verified with"`
+	KeysFile        string        `config:"jwt_keys_file" usage:"YAML file read instead of SSM for the key parameters, for running offline"`
+	RefreshInterval time.Duration `config:"jwt_key_refresh_interval" default:"1m" validate:"min=1s" usage:"Time between two reads of the key parameters"`
+}
+
+// Source returns where the key parameters are read from: the keys file when
+// set, SSM otherwise.
+func (c JWTConfig) Source(ctx context.Context, aws AWSConfig) Source {
+	if c.KeysFile != "" {
+		return NewFileSource(c.KeysFile)
+	}
+	return NewSSMSource(NewSSMClient(ctx, aws))
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mercury/pkg/middleware"
+)
+
+func newTestKey(t *testing.T) (priv, pub string, key *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	pub = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	return priv, pub, key
+}
+
+// writeKeys writes a keys file as JWTConfig.KeysFile reads it.
+func writeKeys(t *testing.T, path, priv string, pubs ...string) {
+	t.Helper()
+	var b strings.Builder
+	b.WriteString("/jwt/private: |\n")
+	for _, line := range strings.Split(strings.TrimSpace(priv), "\n") {
+		b.WriteString("  " + line + "\n")
+	}
+	b.WriteString("/jwt/public: |\n")
+	for _, pub := range pubs {
+		for _, line := range strings.Split(strings.TrimSpace(pub), "\n") {
+			b.WriteString("  " + line + "\n")
+		}
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyID_dependsOnKeyOnly(t *testing.T) {
+	_, pub, key := newTestKey(t)
+	keys, err := ParsePublicKeys(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keys[KeyID(&key.PublicKey)]; !ok {
+		t.Fatalf("expected key %s in %v", KeyID(&key.PublicKey), keys.IDs())
+	}
+	_, _, other := newTestKey(t)
+	if KeyID(&key.PublicKey) == KeyID(&other.PublicKey) {
+		t.Fatal("expected different keys to have different IDs")
+	}
+}
+
+// legacyToken returns a token signed with key as before key IDs were
+// added, without kid.
+func legacyToken(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, &middleware.Claims{
+		UserID: "u1",
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Add(-time.Minute).Unix(),
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestPublicKeys_withoutKeyID(t *testing.T) {
+	_, pubA, keyA := newTestKey(t)
+	_, pubB, _ := newTestKey(t)
+	token := legacyToken(t, keyA)
+	single, _ := ParsePublicKeys(pubA)
+	if _, err := single.PublicKey(""); err != nil {
+		t.Fatalf("expected the only key for a token without kid, got %v", err)
+	}
+	if _, err := middleware.ValidateToken(token, single); err != nil {
+		t.Fatalf("expected a token without kid to verify, got %v", err)
+	}
+
+	// Publishing a second key must not log out sessions without kid.
+	both, err := ParsePublicKeys(pubB + pubA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := middleware.ValidateToken(token, both); err != nil {
+		t.Fatalf("expected a token without kid to verify with two keys, got %v", err)
+	}
+	other, _ := ParsePublicKeys(pubB)
+	if _, err := middleware.ValidateToken(token, other); err == nil {
+		t.Fatal("expected a token without kid not to verify once its key is retired")
+	}
+}
+
+func TestPublicKeys_PEMRoundTrip(t *testing.T) {
+	_, pubA, _ := newTestKey(t)
+	_, pubB, _ := newTestKey(t)
+	keys, err := ParsePublicKeys(pubA + pubB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := keys.PEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParsePublicKeys(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(again.IDs(), ",") != strings.Join(keys.IDs(), ",") {
+		t.Fatalf("expected %v after round trip, got %v", keys.IDs(), again.IDs())
+	}
+}
+
+func TestKeyRing_rotation(t *testing.T) {
+	privA, pubA, keyA := newTestKey(t)
+	privB, pubB, keyB := newTestKey(t)
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	writeKeys(t, path, privA, pubA)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPoller(ctx, NewFileSource(path), time.Hour)
+	ring, err := NewKeyRing(p, KeyRingOpt{PublicParam: "/jwt/public", PrivateParam: "/jwt/private"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	idA, idB := KeyID(&keyA.PublicKey), KeyID(&keyB.PublicKey)
+	signingID := func() string {
+		key, err := ring.SigningKey()
+		if err != nil {
+			return err.Error()
+		}
+		return key.ID
+	}
+	if signingID() != idA {
+		t.Fatalf("expected to sign with A, got %s", signingID())
+	}
+
+	legacy := legacyToken(t, keyA)
+
+	// Publish B: both verify, A still signs.
+	writeKeys(t, path, privA, pubA, pubB)
+	waitForCondition(t, func() bool { return len(ring.PublicKeys()) == 2 })
+	if signingID() != idA {
+		t.Fatalf("expected to still sign with A, got %s", signingID())
+	}
+	if _, err := middleware.ValidateToken(legacy, ring); err != nil {
+		t.Fatalf("expected a token without kid to verify after publishing B, got %v", err)
+	}
+
+	// Switch to B: tokens signed with A still verify.
+	writeKeys(t, path, privB, pubA, pubB)
+	waitForCondition(t, func() bool { return signingID() == idB })
+	if _, err := ring.PublicKey(idA); err != nil {
+		t.Fatalf("expected A to verify until retired, got %v", err)
+	}
+
+	// Retire A.
+	writeKeys(t, path, privB, pubB)
+	waitForCondition(t, func() bool { return len(ring.PublicKeys()) == 1 })
+	if _, err := ring.PublicKey(idA); !errors.Is(err, ErrUnknownKeyID) {
+		t.Fatalf("expected A to be unknown once retired, got %v", err)
+	}
+}
+
+func TestKeyRing_refusesUnpublishedSigningKey(t *testing.T) {
+	privA, pubA, _ := newTestKey(t)
+	privB, _, _ := newTestKey(t)
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	writeKeys(t, path, privB, pubA)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPoller(ctx, NewFileSource(path), time.Hour)
+	if _, err := NewKeyRing(p, KeyRingOpt{PublicParam: "/jwt/public", PrivateParam: "/jwt/private"}); err == nil {
+		t.Fatal("expected a signing key without its public key to be refused")
+	}
+
+	writeKeys(t, path, privA, pubA)
+	ring, err := NewKeyRing(NewPoller(ctx, NewFileSource(path), time.Hour), KeyRingOpt{PublicParam: "/jwt/public", PrivateParam: "/jwt/private"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKeys(t, path, privB, pubA)
+	waitForCondition(t, func() bool {
+		_, err := ring.SigningKey()
+		return err != nil
+	})
+}
+
+func TestNewKeyRing_noKeys(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPoller(ctx, NewFileSource(filepath.Join(t.TempDir(), "missing.yaml")), time.Hour)
+	if _, err := NewKeyRing(p, KeyRingOpt{PublicParam: "/jwt/public"}); err == nil {
+		t.Fatal("expected an error without public keys")
+	}
+}
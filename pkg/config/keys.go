@@ -3,12 +3,15 @@ package config
 import (
 	"context"
 	"crypto/rsa"
+	"errors"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/dgrijalva/jwt-go"
 )
 
+// Keys is a single key pair loaded once. Use a KeyRing for keys that
+// rotate.
 type Keys struct {
 	Public  *rsa.PublicKey
 	Private *rsa.PrivateKey
@@ -54,3 +57,20 @@ func (k *Keys) LoadPublicFromSSM(ssmClient *ssm.Client, paramName string) error
 	k.Public = pubKey
 	return nil
 }
+
+// PublicKey returns the public key whatever kid is, as tokens are only ever
+// signed with the one private key.
+func (k *Keys) PublicKey(kid string) (*rsa.PublicKey, error) {
+	if k.Public == nil {
+		return nil, errors.New("config: no public key loaded")
+	}
+	return k.Public, nil
+}
+
+// SigningKey returns the private key with its key ID.
+func (k *Keys) SigningKey() (*SigningKey, error) {
+	if k.Private == nil {
+		return nil, errors.New("config: no private key loaded")
+	}
+	return &SigningKey{ID: KeyID(&k.Private.PublicKey), Private: k.Private}, nil
+}
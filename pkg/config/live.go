@@ -2,26 +2,90 @@ package config
 
 import (
 	"context"
+	"encoding/json"
 	"log"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/mercury/pkg/instrumentation/metrics"
 )
 
-// LiveInt is an integer config value backed by an SSM parameter.
-// It polls SSM on a fixed interval so changes take effect without a restart.
-// Reads are lock-free via atomic — safe to call on every request.
-type LiveInt struct {
-	val atomic.Int64
+// Live is a config value that follows its parameter in a Source, so changes
+// take effect without a restart. Reads are lock-free via atomic — safe to
+// call on every request.
+type Live[T any] struct {
+	name     string
+	parse    func(string) (T, error)
+	val      atomic.Pointer[T]
+	mu       sync.Mutex
+	raw      string
+	fetched  bool
+	onChange []func(old, new T)
+}
+
+// The live value types the services use.
+type (
+	LiveInt         = Live[int]
+	LiveString      = Live[string]
+	LiveBool        = Live[bool]
+	LiveDuration    = Live[time.Duration]
+	LiveFloat       = Live[float64]
+	LiveJSON[T any] = Live[T]
+)
+
+// NewLive registers name with p and returns a value parsed with parse. It
+// fetches the parameter immediately; until a fetch succeeds, def is used.
+// When a later value fails to parse, the last good one is kept.
+func NewLive[T any](p *Poller, name string, def T, parse func(string) (T, error)) *Live[T] {
+	l := &Live[T]{name: name, parse: parse}
+	l.val.Store(&def)
+	p.register(l)
+	return l
+}
+
+// NewLiveString follows a string parameter.
+func NewLiveString(p *Poller, name string, def string) *LiveString {
+	return NewLive(p, name, def, func(s string) (string, error) { return s, nil })
+}
+
+// NewLiveBool follows a boolean parameter, in any form strconv.ParseBool
+// accepts.
+func NewLiveBool(p *Poller, name string, def bool) *LiveBool {
+	return NewLive(p, name, def, strconv.ParseBool)
+}
+
+// NewLiveDuration follows a duration parameter such as "1m30s".
+func NewLiveDuration(p *Poller, name string, def time.Duration) *LiveDuration {
+	return NewLive(p, name, def, time.ParseDuration)
+}
+
+// NewLiveFloat follows a floating-point parameter.
+func NewLiveFloat(p *Poller, name string, def float64) *LiveFloat {
+	return NewLive(p, name, def, func(s string) (float64, error) { return strconv.ParseFloat(s, 64) })
+}
+
+// NewLiveJSON follows a parameter holding a JSON document decoded into T.
+func NewLiveJSON[T any](p *Poller, name string, def T) *LiveJSON[T] {
+	return NewLive(p, name, def, func(s string) (T, error) {
+		var v T
+		err := json.Unmarshal([]byte(s), &v)
+		return v, err
+	})
+}
+
+// NewLiveIntFrom follows an integer parameter.
+func NewLiveIntFrom(p *Poller, name string, def int) *LiveInt {
+	return NewLive(p, name, def, strconv.Atoi)
 }
 
 // NewLiveInt fetches the SSM parameter immediately, then polls on interval.
 // If the initial fetch fails, defaultVal is used. If a subsequent poll fails,
 // the previous value is kept and a warning is logged.
-// Polling stops when ctx is cancelled.
+// Polling stops when ctx is cancelled. To share one poller between many
+// values, use NewLiveIntFrom.
 func NewLiveInt(
 	ctx context.Context,
 	client *ssm.Client,
@@ -29,46 +93,184 @@ func NewLiveInt(
 	defaultVal int,
 	interval time.Duration,
 ) *LiveInt {
-	l := &LiveInt{}
-	l.val.Store(int64(defaultVal))
+	return NewLiveIntFrom(NewPoller(ctx, NewSSMSource(client), interval), param, defaultVal)
+}
+
+// Get returns the current value. Safe to call concurrently.
+func (l *Live[T]) Get() T {
+	return *l.val.Load()
+}
+
+// OnChange registers fn to run with the old and new value every time the
+// parameter changes to a value that parses. fn runs on the poller goroutine,
+// so it should return quickly.
+func (l *Live[T]) OnChange(fn func(old, new T)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.onChange = append(l.onChange, fn)
+}
+
+func (l *Live[T]) paramName() string { return l.name }
 
-	if v, err := ssmGetInt(ctx, client, param); err == nil {
-		l.val.Store(int64(v))
-	} else {
-		log.Printf("[config] initial fetch of %s failed, using default %d: %v", param, defaultVal, err)
+// set parses raw and, if it changed and parses, stores it and runs the
+// OnChange callbacks. A parse error leaves the value as it was.
+func (l *Live[T]) set(raw string) error {
+	l.mu.Lock()
+	if l.fetched && raw == l.raw {
+		l.mu.Unlock()
+		return nil
 	}
+	v, err := l.parse(raw)
+	if err != nil {
+		l.mu.Unlock()
+		return err
+	}
+	l.raw, l.fetched = raw, true
+	old := l.val.Swap(&v)
+	callbacks := l.onChange
+	l.mu.Unlock()
 
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				if v, err := ssmGetInt(ctx, client, param); err == nil {
-					l.val.Store(int64(v))
-				} else {
-					log.Printf("[config] poll of %s failed, keeping current value: %v", param, err)
-				}
-			}
-		}
-	}()
+	for _, fn := range callbacks {
+		fn(*old, v)
+	}
+	return nil
+}
 
-	return l
+// liveValue is the part of a Live the poller needs, whatever its type.
+type liveValue interface {
+	paramName() string
+	set(raw string) error
 }
 
-// Get returns the current value. Safe to call concurrently.
-func (l *LiveInt) Get() int {
-	return int(l.val.Load())
+// PollerOpt configures a Poller. Zero values fall back to the package
+// defaults.
+type PollerOpt struct {
+	// Interval is the time between two fetches of every parameter.
+	Interval time.Duration
+	// Metrics counts config.live.fetch_error and config.live.parse_error.
+	// Optional.
+	Metrics metrics.Metrics
 }
 
-func ssmGetInt(ctx context.Context, client *ssm.Client, param string) (int, error) {
-	out, err := client.GetParameter(ctx, &ssm.GetParameterInput{
-		Name: aws.String(param),
-	})
+const defaultPollInterval = 30 * time.Second
+
+func (o PollerOpt) withDefaults() PollerOpt {
+	if o.Interval <= 0 {
+		o.Interval = defaultPollInterval
+	}
+	return o
+}
+
+// Poller keeps every Live value registered with it up to date, fetching all
+// of their parameters from one Source in a single batched call per
+// interval. A Source that can watch for changes, like FileSource, also
+// triggers a fetch as soon as it changes.
+type Poller struct {
+	ctx    context.Context
+	source Source
+	opt    PollerOpt
+	mu     sync.Mutex
+	values map[string][]liveValue
+	wake   chan struct{}
+}
+
+// NewPoller polls source every interval. Polling stops when ctx is
+// cancelled.
+func NewPoller(ctx context.Context, source Source, interval time.Duration) *Poller {
+	return NewPollerWithOpt(ctx, source, PollerOpt{Interval: interval})
+}
+
+// NewPollerWithOpt polls source with opt until ctx is cancelled.
+func NewPollerWithOpt(ctx context.Context, source Source, opt PollerOpt) *Poller {
+	p := &Poller{
+		ctx:    ctx,
+		source: source,
+		opt:    opt.withDefaults(),
+		values: map[string][]liveValue{},
+		wake:   make(chan struct{}, 1),
+	}
+	if w, ok := source.(watcher); ok {
+		w.watch(ctx, p.Refresh)
+	}
+	go p.run()
+	return p
+}
+
+// Refresh makes the poller fetch every parameter now instead of at the next
+// interval. It doesn't wait for the fetch.
+func (p *Poller) Refresh() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// register adds v and fetches its parameter right away, so a value is never
+// read before its first fetch had a chance.
+func (p *Poller) register(v liveValue) {
+	p.mu.Lock()
+	p.values[v.paramName()] = append(p.values[v.paramName()], v)
+	p.mu.Unlock()
+	p.fetch([]string{v.paramName()})
+}
+
+func (p *Poller) run() {
+	ticker := time.NewTicker(p.opt.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.wake:
+		}
+		p.mu.Lock()
+		names := make([]string, 0, len(p.values))
+		for name := range p.values {
+			names = append(names, name)
+		}
+		p.mu.Unlock()
+		if len(names) > 0 {
+			p.fetch(names)
+		}
+	}
+}
+
+// fetch reads names from the source and hands every value found to the
+// Live values following it. Errors keep the current values.
+func (p *Poller) fetch(names []string) {
+	if p.ctx.Err() != nil {
+		return
+	}
+	raw, err := p.source.Fetch(p.ctx, names)
 	if err != nil {
-		return 0, err
+		log.Printf("[config] fetch of %d parameters failed, keeping current values: %v", len(names), err)
+		p.count("config.live.fetch_error")
+		return
+	}
+	// Set outside the lock: an OnChange callback may register a new value.
+	type update struct {
+		v     liveValue
+		value string
+	}
+	var updates []update
+	p.mu.Lock()
+	for name, value := range raw {
+		for _, v := range p.values[name] {
+			updates = append(updates, update{v, value})
+		}
+	}
+	p.mu.Unlock()
+	for _, u := range updates {
+		if err := u.v.set(u.value); err != nil {
+			log.Printf("[config] %s: invalid value %q, keeping current value: %v", u.v.paramName(), u.value, err)
+			p.count("config.live.parse_error", metrics.StringTag("param", u.v.paramName()))
+		}
+	}
+}
+
+func (p *Poller) count(stat string, tags ...metrics.Tag) {
+	if p.opt.Metrics != nil {
+		p.opt.Metrics.Incr(stat, 1, tags...)
 	}
-	return strconv.Atoi(aws.ToString(out.Parameter.Value))
 }
@@ -1,10 +1,15 @@
 package config
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -12,6 +17,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/mercury/pkg/instrumentation/metrics"
 )
 
 func newFakeSSMClient(handler http.HandlerFunc) (*ssm.Client, func()) {
@@ -26,14 +32,34 @@ func newFakeSSMClient(handler http.HandlerFunc) (*ssm.Client, func()) {
 }
 
 func ssmParamHandler(value string) http.HandlerFunc {
+	return ssmParamsHandler(map[string]string{"/test/param": value})
+}
+
+// ssmParamsHandler answers GetParameter and GetParameters from params.
+func ssmParamsHandler(params map[string]string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		var in struct {
+			Name  string
+			Names []string
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
 		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
-		_ = json.NewEncoder(w).Encode(map[string]any{
-			"Parameter": map[string]any{
-				"Name":  "/test/param",
-				"Value": value,
-			},
-		})
+		if in.Names == nil {
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"Parameter": map[string]any{"Name": in.Name, "Value": params[in.Name]},
+			})
+			return
+		}
+		found := []map[string]any{}
+		invalid := []string{}
+		for _, name := range in.Names {
+			if v, ok := params[name]; ok {
+				found = append(found, map[string]any{"Name": name, "Value": v})
+			} else {
+				invalid = append(invalid, name)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"Parameters": found, "InvalidParameters": invalid})
 	}
 }
 
@@ -128,3 +154,210 @@ func TestLiveInt_pollsAndUpdatesValue(t *testing.T) {
 	}
 	t.Fatalf("value never updated to 99, got %d", l.Get())
 }
+
+func TestPoller_batchesParameters(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]string
+	params := map[string]string{"/a": "1", "/b": "true", "/c": "2s"}
+	client, cleanup := newFakeSSMClient(func(w http.ResponseWriter, r *http.Request) {
+		var in struct{ Names []string }
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &in)
+		mu.Lock()
+		batches = append(batches, in.Names)
+		mu.Unlock()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		ssmParamsHandler(params)(w, r)
+	})
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPoller(ctx, NewSSMSource(client), time.Hour)
+	a := NewLiveIntFrom(p, "/a", 0)
+	b := NewLiveBool(p, "/b", false)
+	c := NewLiveDuration(p, "/c", 0)
+	if a.Get() != 1 || !b.Get() || c.Get() != 2*time.Second {
+		t.Fatalf("expected initial values, got %d %v %s", a.Get(), b.Get(), c.Get())
+	}
+
+	mu.Lock()
+	batches = nil
+	mu.Unlock()
+	p.Refresh()
+	waitForCondition(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(batches) == 1
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches[0]) != 3 {
+		t.Fatalf("expected one call for all 3 parameters, got %v", batches)
+	}
+}
+
+func TestLive_onChangeAndParseFailure(t *testing.T) {
+	var mu sync.Mutex
+	values := map[string]string{"/rate": "1.5"}
+	source := sourceFunc(func(_ context.Context, names []string) (map[string]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		out := map[string]string{}
+		for _, n := range names {
+			if v, ok := values[n]; ok {
+				out[n] = v
+			}
+		}
+		return out, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPoller(ctx, source, time.Hour)
+	l := NewLiveFloat(p, "/rate", 0)
+
+	changes := make(chan [2]float64, 4)
+	l.OnChange(func(old, new float64) { changes <- [2]float64{old, new} })
+
+	mu.Lock()
+	values["/rate"] = "not a number"
+	mu.Unlock()
+	p.Refresh()
+	time.Sleep(20 * time.Millisecond)
+	if l.Get() != 1.5 {
+		t.Fatalf("expected last good value 1.5 to be kept, got %v", l.Get())
+	}
+
+	mu.Lock()
+	values["/rate"] = "2.5"
+	mu.Unlock()
+	p.Refresh()
+	select {
+	case c := <-changes:
+		if c != [2]float64{1.5, 2.5} {
+			t.Fatalf("expected change 1.5 -> 2.5, got %v", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnChange was not called")
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected exactly one change, got %d more", len(changes))
+	}
+}
+
+// countingMetrics counts Incr calls by name and tags.
+type countingMetrics struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (m *countingMetrics) Incr(name string, n int64, tags ...metrics.Tag) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range tags {
+		name += "," + t.Key + "=" + t.Value
+	}
+	m.counts[name] += n
+}
+
+func (m *countingMetrics) Gauge(string, int64, ...metrics.Tag)          {}
+func (m *countingMetrics) Timing(string, time.Duration, ...metrics.Tag) {}
+
+func (m *countingMetrics) count(name string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counts[name]
+}
+
+func TestPoller_countsParseAndFetchErrors(t *testing.T) {
+	var mu sync.Mutex
+	value, fail := "not a number", false
+	source := sourceFunc(func(_ context.Context, names []string) (map[string]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return nil, errors.New("throttled")
+		}
+		return map[string]string{"/rate": value}, nil
+	})
+	m := &countingMetrics{counts: map[string]int64{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPollerWithOpt(ctx, source, PollerOpt{Interval: time.Hour, Metrics: m})
+	l := NewLiveFloat(p, "/rate", 1)
+
+	if got := m.count("config.live.parse_error,param=/rate"); got != 1 {
+		t.Fatalf("expected one config.live.parse_error for /rate, got %d", got)
+	}
+	if l.Get() != 1 {
+		t.Fatalf("expected the default to be kept, got %v", l.Get())
+	}
+
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	p.Refresh()
+	waitForCondition(t, func() bool { return m.count("config.live.fetch_error") == 1 })
+}
+
+func TestFileSource_watchesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "live.yaml")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("/matchmaking/window: 30s\n/features: {chat: true}\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPoller(ctx, NewFileSource(path), time.Hour)
+	window := NewLiveDuration(p, "/matchmaking/window", 0)
+	features := NewLiveJSON(p, "/features", map[string]bool{})
+	if window.Get() != 30*time.Second || !features.Get()["chat"] {
+		t.Fatalf("expected values from file, got %s %v", window.Get(), features.Get())
+	}
+
+	write("/matchmaking/window: 45s\n/features: {chat: false}\n")
+	waitForCondition(t, func() bool { return window.Get() == 45*time.Second })
+	if features.Get()["chat"] {
+		t.Fatal("expected feature toggle to follow the file")
+	}
+}
+
+func TestLayered_envOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "live.yaml")
+	os.WriteFile(path, []byte("/gateway/rate-limit: 10\n/gateway/burst: 5\n"), 0o644)
+	t.Setenv("GATEWAY_RATE_LIMIT", "20")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPoller(ctx, Layered(NewEnvSource(), NewFileSource(path)), time.Hour)
+	if got := NewLiveIntFrom(p, "/gateway/rate-limit", 0).Get(); got != 20 {
+		t.Fatalf("expected env override 20, got %d", got)
+	}
+	if got := NewLiveIntFrom(p, "/gateway/burst", 0).Get(); got != 5 {
+		t.Fatalf("expected file value 5, got %d", got)
+	}
+	if got := NewLiveString(p, "/gateway/missing", "def").Get(); got != "def" {
+		t.Fatalf("expected default for a missing parameter, got %q", got)
+	}
+}
+
+type sourceFunc func(ctx context.Context, names []string) (map[string]string, error)
+
+func (f sourceFunc) Fetch(ctx context.Context, names []string) (map[string]string, error) {
+	return f(ctx, names)
+}
+
+func waitForCondition(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met within timeout")
+}
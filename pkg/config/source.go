@@ -0,0 +1,217 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/fsnotify/fsnotify"
+	"go.yaml.in/yaml/v3"
+)
+
+// Source is where a Poller reads live parameters from.
+type Source interface {
+	// Fetch returns the raw value of every name the source has a value for.
+	// Names it has no value for are left out, so their Live values keep
+	// what they had.
+	Fetch(ctx context.Context, names []string) (map[string]string, error)
+}
+
+// watcher is a Source that can tell when its values may have changed.
+type watcher interface {
+	watch(ctx context.Context, changed func())
+}
+
+// ssmBatchSize is the most names GetParameters accepts in one call.
+const ssmBatchSize = 10
+
+// SSMSource reads parameters from SSM Parameter Store, with one
+// GetParameters call per ten names.
+type SSMSource struct {
+	client *ssm.Client
+}
+
+// NewSSMSource reads parameters through client.
+func NewSSMSource(client *ssm.Client) *SSMSource {
+	return &SSMSource{client: client}
+}
+
+func (s *SSMSource) Fetch(ctx context.Context, names []string) (map[string]string, error) {
+	values := make(map[string]string, len(names))
+	for start := 0; start < len(names); start += ssmBatchSize {
+		out, err := s.client.GetParameters(ctx, &ssm.GetParametersInput{
+			Names:          names[start:min(start+ssmBatchSize, len(names))],
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, err
+		}
+		// Names in out.InvalidParameters don't exist; leave them out.
+		for _, p := range out.Parameters {
+			values[aws.ToString(p.Name)] = aws.ToString(p.Value)
+		}
+	}
+	return values, nil
+}
+
+// FileSource reads parameters from a YAML file mapping each parameter name
+// to its value, for running offline in dev:
+//
+//	/mercury/gateway/rate_limit: 100
+//	/mercury/matchmaking/window: 30s
+//	/mercury/features: {chat: true}
+//
+// Maps and lists are handed to the Live value as JSON, for LiveJSON. The
+// file is watched, so saving it applies the change at once. A missing file
+// has no values.
+type FileSource struct {
+	path string
+}
+
+// NewFileSource reads parameters from the YAML file at path.
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (s *FileSource) Fetch(_ context.Context, names []string) (map[string]string, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		v, ok := doc[name]
+		if !ok {
+			continue
+		}
+		switch v := v.(type) {
+		case map[string]any, []any:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", s.path, name, err)
+			}
+			values[name] = string(b)
+		default:
+			values[name] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// watch watches the file's directory rather than the file itself, since
+// editors often save by replacing the file.
+func (s *FileSource) watch(ctx context.Context, changed func()) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("[config] cannot watch %s, falling back to polling: %v", s.path, err)
+		return
+	}
+	if err := w.Add(filepath.Dir(s.path)); err != nil {
+		log.Printf("[config] cannot watch %s, falling back to polling: %v", s.path, err)
+		w.Close()
+		return
+	}
+	go func() {
+		defer w.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) == filepath.Clean(s.path) {
+					changed()
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("[config] watching %s: %v", s.path, err)
+			}
+		}
+	}()
+}
+
+// EnvSource reads parameters from environment variables, so any of them can
+// be overridden in dev or a container without a backend. The variable of a
+// parameter is its name in upper case with separators turned into
+// underscores: /mercury/gateway/rate-limit is MERCURY_GATEWAY_RATE_LIMIT.
+type EnvSource struct{}
+
+// NewEnvSource reads parameters from the environment.
+func NewEnvSource() EnvSource {
+	return EnvSource{}
+}
+
+var envReplacer = strings.NewReplacer("/", "_", "-", "_", ".", "_")
+
+// EnvVar returns the environment variable EnvSource reads name from.
+func EnvVar(name string) string {
+	return strings.ToUpper(envReplacer.Replace(strings.TrimPrefix(name, "/")))
+}
+
+func (EnvSource) Fetch(_ context.Context, names []string) (map[string]string, error) {
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		if v, ok := os.LookupEnv(EnvVar(name)); ok {
+			values[name] = v
+		}
+	}
+	return values, nil
+}
+
+// Layered reads every name from the first source that has a value for it,
+// so earlier sources override later ones, e.g. environment variables over a
+// dev file over SSM. A failing source fails the fetch.
+func Layered(sources ...Source) Source {
+	return layered(sources)
+}
+
+type layered []Source
+
+func (l layered) Fetch(ctx context.Context, names []string) (map[string]string, error) {
+	values := make(map[string]string, len(names))
+	missing := names
+	for _, s := range l {
+		if len(missing) == 0 {
+			break
+		}
+		found, err := s.Fetch(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		var rest []string
+		for _, name := range missing {
+			if v, ok := found[name]; ok {
+				values[name] = v
+			} else {
+				rest = append(rest, name)
+			}
+		}
+		missing = rest
+	}
+	return values, nil
+}
+
+func (l layered) watch(ctx context.Context, changed func()) {
+	for _, s := range l {
+		if w, ok := s.(watcher); ok {
+			w.watch(ctx, changed)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Package metrics is the facade services count, gauge and time through. A
+// Metrics writes to statsd or keeps Prometheus series, and Init serves
+// /metrics for either, so every service can be scraped.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Tag is a dimension of a metric: a statsd tag or a Prometheus label.
+type Tag struct {
+	Key, Value string
+}
+
+func StringTag(key, value string) Tag {
+	return Tag{Key: key, Value: value}
+}
+
+func IntTag(key string, value int) Tag {
+	return Tag{Key: key, Value: strconv.Itoa(value)}
+}
+
+// Metrics records metrics named like "mq.msg.count". Implementations are
+// safe for concurrent use.
+type Metrics interface {
+	// Incr adds n to the counter name.
+	Incr(name string, n int64, tags ...Tag)
+	// Gauge sets the gauge name to value.
+	Gauge(name string, value int64, tags ...Tag)
+	// Timing records d in the histogram name.
+	Timing(name string, d time.Duration, tags ...Tag)
+}
+
+// Discard is a Metrics that drops everything.
+var Discard Metrics = discard{}
+
+type discard struct{}
+
+func (discard) Incr(string, int64, ...Tag)           {}
+func (discard) Gauge(string, int64, ...Tag)          {}
+func (discard) Timing(string, time.Duration, ...Tag) {}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying m.
+func NewContext(ctx context.Context, m Metrics) context.Context {
+	return context.WithValue(ctx, contextKey{}, m)
+}
+
+// FromContext returns the Metrics in ctx, or Discard if there is none.
+func FromContext(ctx context.Context) Metrics {
+	m, _ := ctx.Value(contextKey{}).(Metrics)
+	if m == nil {
+		return Discard
+	}
+	return m
+}
+
+const (
+	BackendStatsd     = "statsd"
+	BackendPrometheus = "prometheus"
+)
+
+// Opt configures Init.
+type Opt struct {
+	// Backend is BackendStatsd (the default) or BackendPrometheus.
+	Backend string
+	// StatsdAddr is the statsd UDP address for BackendStatsd.
+	StatsdAddr string
+	// Addr serves /metrics and /ready, e.g. ":2112"; empty serves nothing.
+	// /metrics always has the Go runtime and process metrics, and the
+	// service's own with BackendPrometheus.
+	Addr string
+	// Ready backs /ready: 200 while it reports true and 503 otherwise, so
+	// a pod draining its consumers is taken out of rotation. Nil is always
+	// ready.
+	Ready func() bool
+}
+
+// Init returns the Metrics for service, tagged with service=<service>, and
+// starts serving /metrics and /ready. The returned func stops serving and
+// flushes pending statsd metrics, and should be deferred by main.
+func Init(service string, opt Opt) (Metrics, func(context.Context) error, error) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	var m Metrics
+	var flush func() error
+	switch opt.Backend {
+	case BackendStatsd, "":
+		s := NewStatsd(NewStatsdClient(opt.StatsdAddr, service))
+		m, flush = s, s.client.Close
+	case BackendPrometheus:
+		m, flush = NewPrometheus(service, registry), func() error { return nil }
+	default:
+		return nil, nil, fmt.Errorf("metrics: unknown backend %q", opt.Backend)
+	}
+	if opt.Addr == "" {
+		return m, func(context.Context) error { return flush() }, nil
+	}
+
+	ln, err := net.Listen("tcp", opt.Addr)
+	if err != nil {
+		flush()
+		return nil, nil, fmt.Errorf("metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if opt.Ready != nil && !opt.Ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go srv.Serve(ln)
+	return m, func(ctx context.Context) error {
+		return errors.Join(srv.Shutdown(ctx), flush())
+	}, nil
+}
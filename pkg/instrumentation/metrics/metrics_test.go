@@ -0,0 +1,202 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/smira/go-statsd"
+)
+
+// newTestPrometheus returns a Prometheus for service "svc" and a func
+// scraping it.
+func newTestPrometheus(t *testing.T) (*Prometheus, func() string) {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	return NewPrometheus("svc", registry), func() string { return scrape(t, registry) }
+}
+
+func scrape(t *testing.T, registry *prometheus.Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorHandling: promhttp.PanicOnError}).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rec.Body.String()
+}
+
+func expectLines(t *testing.T, body string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestPrometheus_exposesCountersGaugesAndHistograms(t *testing.T) {
+	p, scrape := newTestPrometheus(t)
+	p.Incr("mq.msg.count", 1, StringTag("queue", "q"))
+	p.Incr("mq.msg.count", 2, StringTag("queue", "q"))
+	p.Gauge("mq.msg.inflight", 3, StringTag("queue", "q"))
+	p.Timing("mq.msg.duration", 20*time.Millisecond, StringTag("queue", "q"))
+	p.Timing("mq.msg.duration", 2*time.Hour, StringTag("queue", "q"))
+
+	expectLines(t, scrape(),
+		`mq_msg_count_total{queue="q",service="svc"} 3`,
+		`mq_msg_inflight{queue="q",service="svc"} 3`,
+		`mq_msg_duration_seconds_bucket{queue="q",service="svc",le="0.01"} 0`,
+		`mq_msg_duration_seconds_bucket{queue="q",service="svc",le="0.025"} 1`,
+		`mq_msg_duration_seconds_bucket{queue="q",service="svc",le="3600"} 1`,
+		`mq_msg_duration_seconds_bucket{queue="q",service="svc",le="7200"} 2`,
+		`mq_msg_duration_seconds_count{queue="q",service="svc"} 2`,
+	)
+}
+
+func TestPrometheus_sanitizesTags(t *testing.T) {
+	p, scrape := newTestPrometheus(t)
+	p.Incr("bad-name", 1, StringTag("service", "ignored"), StringTag("x.y", "1"), StringTag("x.y", "2"))
+	p.Incr("http.response.status", 1, IntTag("status", 200), StringTag("path", "/a"))
+	p.Incr("http.response.status", 1, StringTag("path", "/a"), IntTag("status", 200))
+
+	expectLines(t, scrape(),
+		`bad_name_total{service="svc",x_y="2"} 1`,
+		`http_response_status_total{path="/a",service="svc",status="200"} 2`,
+	)
+}
+
+func TestPrometheus_rejectsInconsistentTags(t *testing.T) {
+	p, scrape := newTestPrometheus(t)
+	p.Incr("http.response.status", 1, StringTag("path", "/a"), IntTag("status", 200))
+	p.Incr("http.response.status", 1, StringTag("path", "/a"))
+	p.Incr("http.response.status", 1, StringTag("path", "/b"), IntTag("status", 500))
+	p.Gauge("queue.depth", 1)
+	p.Gauge("queue.depth", 2, StringTag("queue", "q"))
+	p.Timing("rpc.duration", time.Second, StringTag("route", "r"))
+	p.Timing("rpc.duration", time.Second)
+
+	// Scraping panics on an inconsistent family rather than failing the
+	// request, so getting here means the scrape would have succeeded.
+	body := scrape()
+	expectLines(t, body,
+		`http_response_status_total{path="/a",service="svc",status="200"} 1`,
+		`http_response_status_total{path="/b",service="svc",status="500"} 1`,
+		`queue_depth{service="svc"} 1`,
+		`rpc_duration_seconds_count{route="r",service="svc"} 1`,
+		`metrics_rejected_total{metric="http.response.status",service="svc"} 1`,
+		`metrics_rejected_total{metric="queue.depth",service="svc"} 1`,
+		`metrics_rejected_total{metric="rpc.duration",service="svc"} 1`,
+	)
+	if strings.Contains(body, `http_response_status_total{path="/a",service="svc"}`) {
+		t.Fatalf("expected the series without status to be dropped:\n%s", body)
+	}
+}
+
+func TestStatsd_sendsMilliseconds(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := statsd.NewClient(conn.LocalAddr().String(), statsd.FlushInterval(10*time.Millisecond))
+	defer client.Close()
+
+	s := NewStatsd(client)
+	s.Incr("mq.msg.count", 1, StringTag("queue", "q"))
+	s.Timing("mq.msg.duration", 1500*time.Millisecond)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 4096)
+	var received string
+	for !strings.Contains(received, "mq.msg.duration") {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("expected metrics to be flushed, got %q (%v)", received, err)
+		}
+		received += string(buf[:n])
+	}
+	if !strings.Contains(received, "mq.msg.count,queue=q:1|c") || !strings.Contains(received, "mq.msg.duration:1500|ms") {
+		t.Fatalf("expected a counter and a timing in ms, got %q", received)
+	}
+}
+
+func TestFromContext_defaultsToDiscard(t *testing.T) {
+	if m := FromContext(context.Background()); m != Discard {
+		t.Fatalf("expected Discard, got %v", m)
+	}
+	p := NewPrometheus("svc", prometheus.NewRegistry())
+	if m := FromContext(NewContext(context.Background(), p)); m != p {
+		t.Fatalf("expected the stored Metrics, got %v", m)
+	}
+}
+
+func TestInit_servesMetrics(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	m, shutdown, err := Init("svc", Opt{Backend: BackendPrometheus, Addr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+	m.Incr("jobs", 1)
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	expectLines(t, string(body), `jobs_total{service="svc"} 1`)
+	if !strings.Contains(string(body), "go_goroutines") {
+		t.Error("expected Go runtime metrics")
+	}
+
+	if _, _, err := Init("svc", Opt{Backend: "influx"}); err == nil {
+		t.Fatal("expected an unknown backend to be refused")
+	}
+}
+
+func TestInit_servesReadiness(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	var draining atomic.Bool
+	_, shutdown, err := Init("svc", Opt{Addr: addr, Ready: func() bool { return !draining.Load() }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	status := func() int {
+		t.Helper()
+		resp, err := http.Get("http://" + addr + "/ready")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if got := status(); got != http.StatusOK {
+		t.Fatalf("expected 200 before draining, got %d", got)
+	}
+	draining.Store(true)
+	if got := status(); got != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 while draining, got %d", got)
+	}
+}
@@ -0,0 +1,216 @@
+package metrics
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultBuckets are the histogram buckets in seconds. They resolve RPC
+// latencies from 5ms to 10s and still place WebSocket sessions, which
+// UseMetrics times like any request, between a minute and four hours.
+var DefaultBuckets = []float64{
+	.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+	30, 60, 300, 900, 1800, 3600, 7200, 14400,
+}
+
+// PrometheusOpt configures NewPrometheusWithOpt.
+type PrometheusOpt struct {
+	// Buckets are the histogram upper bounds in seconds, DefaultBuckets if
+	// empty.
+	Buckets []float64
+}
+
+// Prometheus is a Metrics registering a CounterVec, GaugeVec or HistogramVec
+// per name and set of tag keys as they are first recorded. Names become
+// Prometheus names with dots replaced by underscores: counters get a _total
+// suffix and timings are histograms in seconds with a _seconds suffix. Each
+// set of tags is its own series, so tags must have few values.
+//
+// A name must always come with the same tag keys. Recording it with other
+// keys would break the scrape, so those values are dropped instead and
+// counted in metrics_rejected_total, labelled with the name.
+type Prometheus struct {
+	service  string
+	buckets  []float64
+	reg      prometheus.Registerer
+	rejected *prometheus.CounterVec
+
+	mu sync.Mutex
+	// vecs holds the collector registered for each name and set of label
+	// names, nil if the registry rejected it.
+	vecs map[string]prometheus.Collector
+}
+
+// NewPrometheus returns a Prometheus registering its metrics with reg,
+// labelling every series with service.
+func NewPrometheus(service string, reg prometheus.Registerer) *Prometheus {
+	return NewPrometheusWithOpt(service, reg, PrometheusOpt{})
+}
+
+func NewPrometheusWithOpt(service string, reg prometheus.Registerer, opt PrometheusOpt) *Prometheus {
+	buckets := opt.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = slices.Clone(buckets)
+	slices.Sort(buckets)
+	p := &Prometheus{service: service, buckets: buckets, reg: reg, vecs: map[string]prometheus.Collector{}}
+	p.rejected, _ = p.register(prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name:        "metrics_rejected_total",
+		Help:        "Values dropped because their name was first recorded with other tags.",
+		ConstLabels: p.constLabels(),
+	}, []string{"metric"})).(*prometheus.CounterVec)
+	return p
+}
+
+// Incr adds n to a counter. Counters only go up, so a negative n is
+// dropped.
+func (p *Prometheus) Incr(name string, n int64, tags ...Tag) {
+	if n < 0 {
+		return
+	}
+	names, values := labels(tags)
+	v, ok := p.vec(promName(name, "_total"), names, func() prometheus.Collector {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        promName(name, "_total"),
+			Help:        name,
+			ConstLabels: p.constLabels(),
+		}, names)
+	}).(*prometheus.CounterVec)
+	if !ok {
+		p.reject(name)
+		return
+	}
+	v.WithLabelValues(values...).Add(float64(n))
+}
+
+func (p *Prometheus) Gauge(name string, value int64, tags ...Tag) {
+	names, values := labels(tags)
+	v, ok := p.vec(promName(name, ""), names, func() prometheus.Collector {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name:        promName(name, ""),
+			Help:        name,
+			ConstLabels: p.constLabels(),
+		}, names)
+	}).(*prometheus.GaugeVec)
+	if !ok {
+		p.reject(name)
+		return
+	}
+	v.WithLabelValues(values...).Set(float64(value))
+}
+
+func (p *Prometheus) Timing(name string, d time.Duration, tags ...Tag) {
+	names, values := labels(tags)
+	v, ok := p.vec(promName(name, "_seconds"), names, func() prometheus.Collector {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        promName(name, "_seconds"),
+			Help:        name,
+			ConstLabels: p.constLabels(),
+			Buckets:     p.buckets,
+		}, names)
+	}).(*prometheus.HistogramVec)
+	if !ok {
+		p.reject(name)
+		return
+	}
+	v.WithLabelValues(values...).Observe(d.Seconds())
+}
+
+// vec returns the collector of fqName with label names, registering the
+// one newVec returns the first time. It returns nil if the registry
+// rejected it, such as for other label names than a collector of fqName
+// already has.
+func (p *Prometheus) vec(fqName string, names []string, newVec func() prometheus.Collector) prometheus.Collector {
+	key := fqName + "\xff" + strings.Join(names, "\xfe")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c, ok := p.vecs[key]; ok {
+		return c
+	}
+	c := p.register(newVec())
+	p.vecs[key] = c
+	return c
+}
+
+// register registers c with p.reg and returns it, or the collector already
+// registered in its place. It returns nil if c conflicts with another one.
+func (p *Prometheus) register(c prometheus.Collector) prometheus.Collector {
+	err := p.reg.Register(c)
+	if err == nil {
+		return c
+	}
+	var already prometheus.AlreadyRegisteredError
+	if errors.As(err, &already) {
+		return already.ExistingCollector
+	}
+	return nil
+}
+
+func (p *Prometheus) reject(name string) {
+	if p.rejected != nil {
+		p.rejected.WithLabelValues(name).Inc()
+	}
+}
+
+func (p *Prometheus) constLabels() prometheus.Labels {
+	return prometheus.Labels{"service": p.service}
+}
+
+// labels returns the label names and values of tags.
+func labels(tags []Tag) (names, values []string) {
+	tags = normalizeTags(tags)
+	names = make([]string, len(tags))
+	values = make([]string, len(tags))
+	for i, t := range tags {
+		names[i], values[i] = t.Key, t.Value
+	}
+	return names, values
+}
+
+// promName turns a dotted statsd name into a Prometheus name ending in
+// suffix.
+func promName(name, suffix string) string {
+	n := sanitize(name)
+	if !strings.HasSuffix(n, suffix) {
+		n += suffix
+	}
+	return n
+}
+
+// normalizeTags returns tags with Prometheus label names, sorted, keeping
+// the last of tags with the same name.
+func normalizeTags(tags []Tag) []Tag {
+	out := make([]Tag, 0, len(tags))
+	for _, t := range tags {
+		key := sanitize(t.Key)
+		if key == "service" {
+			// Set on every series already.
+			continue
+		}
+		if i := slices.IndexFunc(out, func(o Tag) bool { return o.Key == key }); i >= 0 {
+			out[i].Value = t.Value
+			continue
+		}
+		out = append(out, Tag{Key: key, Value: t.Value})
+	}
+	slices.SortFunc(out, func(a, b Tag) int { return strings.Compare(a.Key, b.Key) })
+	return out
+}
+
+// sanitize replaces characters Prometheus names can't hold with '_'.
+func sanitize(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		ok := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' && i > 0
+		if !ok {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/smira/go-statsd"
+)
+
+// NewStatsdClient returns a statsd client sending to addr with Datadog-style
+// tags, tagging every metric with service.
+func NewStatsdClient(addr string, service string) *statsd.Client {
+	return statsd.NewClient(
+		addr,
+		statsd.TagStyle(statsd.TagFormatDatadog),
+		statsd.DefaultTags(statsd.StringTag("service", service)),
+	)
+}
+
+// Statsd is a Metrics sending to a statsd client. Timings are sent in
+// milliseconds.
+type Statsd struct {
+	client *statsd.Client
+}
+
+func NewStatsd(client *statsd.Client) *Statsd {
+	return &Statsd{client: client}
+}
+
+func (s *Statsd) Incr(name string, n int64, tags ...Tag) {
+	s.client.Incr(name, n, statsdTags(tags)...)
+}
+
+func (s *Statsd) Gauge(name string, value int64, tags ...Tag) {
+	s.client.Gauge(name, value, statsdTags(tags)...)
+}
+
+func (s *Statsd) Timing(name string, d time.Duration, tags ...Tag) {
+	s.client.Timing(name, int64(d/time.Millisecond), statsdTags(tags)...)
+}
+
+func statsdTags(tags []Tag) []statsd.Tag {
+	if len(tags) == 0 {
+		return nil
+	}
+	out := make([]statsd.Tag, len(tags))
+	for i, t := range tags {
+		out[i] = statsd.StringTag(t.Key, t.Value)
+	}
+	return out
+}
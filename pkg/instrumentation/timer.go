@@ -4,8 +4,9 @@ import (
 	"context"
 	"time"
 
-	"github.com/mercury/pkg/middleware"
-	"github.com/smira/go-statsd"
+	"github.com/mercury/pkg/instrumentation/metrics"
+	"github.com/mercury/pkg/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Timing interface {
@@ -38,45 +39,50 @@ func NewTimer() Timing {
 
 type metrcstimer struct {
 	start   time.Time
-	metrics *statsd.Client
+	metrics metrics.Metrics
 	name    string
-	tags    []statsd.Tag
+	tags    []metrics.Tag
+	span    trace.Span // nil for timers created without a context
 }
 
 func (t *metrcstimer) Done(err error) {
+	if t.span != nil {
+		tracing.End(t.span, err)
+	}
 	dur := time.Since(t.start)
 	errTag := "false"
 	if err != nil {
 		errTag = "true"
 	}
 
-	tags := append(t.tags, statsd.StringTag("error", errTag))
-	t.metrics.Timing(t.name, int64(dur/time.Millisecond), tags...)
+	tags := append(t.tags, metrics.StringTag("error", errTag))
+	t.metrics.Timing(t.name, dur, tags...)
 }
 
-func NewMetricsTimer(ctx context.Context, name string, tags ...statsd.Tag) Timer {
-	metrics := StatsdFromContext(ctx)
-
-	// if no client, use a silent dummy that drops all metrics
-	if metrics == nil {
-		metrics = statsd.NewClient("localhost:0", statsd.Logger(middleware.StatsDNoopLogger{}))
-	}
+// NewMetricsTimer times name with the metrics in ctx, which drops it if ctx
+// has none, and traces it as a span.
+func NewMetricsTimer(ctx context.Context, name string, tags ...metrics.Tag) Timer {
 	start := time.Now()
+	// The span is a leaf under the caller's span; the ctx it lives in is not
+	// handed back, so calls made while timing are its siblings.
+	_, span := tracing.Start(ctx, name, trace.SpanKindInternal)
 
 	return &metrcstimer{
 		name:    name,
 		start:   start,
-		metrics: metrics,
+		metrics: metrics.FromContext(ctx),
 		tags:    tags,
+		span:    span,
 	}
 }
 
-func NewStatsdTimer(metrics *statsd.Client, name string, tags ...statsd.Tag) Timer {
+// NewTimerFor times name with m, without a span.
+func NewTimerFor(m metrics.Metrics, name string, tags ...metrics.Tag) Timer {
 	start := time.Now()
 	return &metrcstimer{
 		name:    name,
 		start:   start,
-		metrics: metrics,
+		metrics: m,
 		tags:    tags,
 	}
 }
@@ -0,0 +1,89 @@
+package kmq
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mercury/pkg/instrumentation/metrics"
+	"github.com/mercury/pkg/tracing"
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// BatchHandler handles a whole batch at once, such as with one bulk insert.
+// It returns a Result per message, in order; missing results count as
+// Success. An error applies to every message of the batch.
+type BatchHandler func(ctx context.Context, msgs []kafka.Message) ([]Result, error)
+
+// ConsumeBatch runs handler on the messages of each fetched batch of up to
+// opt.BatchSize, split among opt.Workers by key so one key's messages stay
+// in order, and on single retried messages from the retry topic. Failures
+// are routed like in Consume. Middlewares don't apply; ctx carries the consumer's logger and
+// opt.Metrics instead.
+func (c *kmqConsumer) ConsumeBatch(handler BatchHandler) {
+	c.start(func(batch []kafka.Message) []bool {
+		return c.handleBatch(handler, batch)
+	})
+}
+
+func (c *kmqConsumer) handleBatch(h BatchHandler, batch []kafka.Message) []bool {
+	// Derived from handlerCtx for the same reason as in handle.
+	ctx, cancel := context.WithTimeout(c.handlerCtx, 5*time.Minute)
+	defer cancel()
+	requestID := uuid.New().String()
+	ctx = tracing.WithRequestID(ctx, requestID)
+	ctx = context.WithValue(ctx, loggerCtxKey{}, c.logger.WithContext(ctx).WithFields(logrus.Fields{
+		"topic":      c.topic,
+		"batch_size": len(batch),
+		"request_id": requestID,
+	}))
+	ctx = metrics.NewContext(ctx, c.opt.Metrics)
+	ctx, span := tracing.Start(ctx, c.topic+" process", trace.SpanKindConsumer,
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", c.topic),
+		attribute.Int("messaging.batch.message_count", len(batch)),
+	)
+
+	results, cause := c.callBatch(ctx, h, batch)
+	tracing.End(span, cause)
+
+	settled := make([]bool, len(batch))
+	for i, msg := range batch {
+		res := Success
+		if i < len(results) {
+			res = results[i]
+		}
+		settled[i] = c.settle(ctx, msg, res, cause)
+	}
+	return settled
+}
+
+// callBatch runs h, retrying the whole batch if it panics, like UseRecover
+// does for a single message.
+func (c *kmqConsumer) callBatch(ctx context.Context, h BatchHandler, batch []kafka.Message) (results []Result, err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		LoggerFromContext(ctx).WithFields(logrus.Fields{
+			"panic": fmt.Sprint(r),
+			"stack": string(debug.Stack()),
+		}).Error("kafka: batch handler panicked")
+		c.opt.Metrics.Incr("kmq.panic", 1,
+			metrics.StringTag("topic", c.topic),
+			metrics.StringTag("queue", c.topic),
+		)
+		results = make([]Result, len(batch))
+		for i := range results {
+			results[i] = Retry
+		}
+		err = nil
+	}()
+	return h(ctx, batch)
+}
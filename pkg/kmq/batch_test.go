@@ -0,0 +1,253 @@
+package kmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mercury/pkg/instrumentation/metrics"
+	"github.com/mercury/pkg/rmq"
+	"github.com/segmentio/kafka-go"
+)
+
+// recordingMetrics keeps the last value of every gauge, keyed by name and
+// tags.
+type recordingMetrics struct {
+	mu     sync.Mutex
+	gauges map[string]int64
+}
+
+func (m *recordingMetrics) Incr(string, int64, ...metrics.Tag)           {}
+func (m *recordingMetrics) Timing(string, time.Duration, ...metrics.Tag) {}
+
+func (m *recordingMetrics) Gauge(name string, value int64, tags ...metrics.Tag) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.gauges == nil {
+		m.gauges = map[string]int64{}
+	}
+	m.gauges[seriesKey(name, tags...)] = value
+}
+
+func (m *recordingMetrics) gauge(name string, tags ...metrics.Tag) (int64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.gauges[seriesKey(name, tags...)]
+	return v, ok
+}
+
+func seriesKey(name string, tags ...metrics.Tag) string {
+	for _, tag := range tags {
+		name += fmt.Sprintf(",%s=%s", tag.Key, tag.Value)
+	}
+	return name
+}
+
+// keysOnLanes returns a key for each of n lanes.
+func keysOnLanes(n int) []string {
+	keys := make([]string, n)
+	found := 0
+	for i := 0; found < n; i++ {
+		key := "conv-" + strconv.Itoa(i)
+		hash := fnv.New32a()
+		hash.Write([]byte(key))
+		if lane := hash.Sum32() % uint32(n); keys[lane] == "" {
+			keys[lane] = key
+			found++
+		}
+	}
+	return keys
+}
+
+func TestFetchBatch_fillsUpOrTimesOut(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	c, b := newTestConsumer(t, ConsumerOpt{BatchSize: 3, BatchTimeout: timeout})
+	for range 4 {
+		b.send("topic", kafka.Message{})
+	}
+	reader := b.reader("topic")
+
+	if got := c.fetchBatch(reader, 3); len(got) != 3 {
+		t.Fatalf("expected a full batch of 3, got %d", len(got))
+	}
+	start := time.Now()
+	got := c.fetchBatch(reader, 3)
+	if len(got) != 1 || got[0].Offset != 3 {
+		t.Fatalf("expected the remaining message alone, got %d messages", len(got))
+	}
+	if d := time.Since(start); d < timeout {
+		t.Fatalf("expected the batch to wait %s to fill up, returned after %s", timeout, d)
+	}
+}
+
+func TestConsume_handlesKeysInParallelWithBatchSizeOne(t *testing.T) {
+	c, b := newTestConsumer(t, ConsumerOpt{Workers: 2, BatchSize: 1})
+	var started, overlapped atomic.Int32
+	c.Consume(func(context.Context, kafka.Message) (Result, error) {
+		started.Add(1)
+		// Wait for the other key's message to be started alongside.
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			if started.Load() == 2 {
+				overlapped.Add(1)
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return Success, nil
+	})
+	for _, key := range keysOnLanes(2) {
+		b.send("topic", kafka.Message{Key: []byte(key)})
+	}
+	waitFor(t, func() bool { return b.reader("topic").committedOffset(0) == 2 })
+	if got := overlapped.Load(); got != 2 {
+		t.Fatalf("expected both messages to be handled at once, %d of them were", got)
+	}
+}
+
+func TestConsume_keepsOrderPerKey(t *testing.T) {
+	c, b := newTestConsumer(t, ConsumerOpt{Workers: 4, BatchSize: 5})
+	var mu sync.Mutex
+	seen := map[string][]int{}
+	c.Consume(func(_ context.Context, msg kafka.Message) (Result, error) {
+		time.Sleep(time.Duration(rand.IntN(500)) * time.Microsecond)
+		n, _ := strconv.Atoi(string(msg.Value))
+		mu.Lock()
+		defer mu.Unlock()
+		seen[string(msg.Key)] = append(seen[string(msg.Key)], n)
+		return Success, nil
+	})
+	keys := []string{"conv-1", "conv-2", "conv-3"}
+	const total = 30
+	for i := range total {
+		b.send("topic", kafka.Message{Key: []byte(keys[i%len(keys)]), Value: []byte(strconv.Itoa(i))})
+	}
+	waitFor(t, func() bool { return b.reader("topic").committedOffset(0) == total })
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, key := range keys {
+		got := seen[key]
+		if len(got) != total/len(keys) {
+			t.Fatalf("expected %d messages for %s, got %d", total/len(keys), key, len(got))
+		}
+		for i := 1; i < len(got); i++ {
+			if got[i] < got[i-1] {
+				t.Fatalf("expected %s handled in order, got %v", key, got)
+			}
+		}
+	}
+}
+
+func TestConsume_commitsOncePerBatch(t *testing.T) {
+	c, b := newTestConsumer(t, ConsumerOpt{BatchSize: 3, BatchTimeout: time.Hour})
+	// Sent before consuming so both batches fill up at once.
+	for i := range 6 {
+		b.send("topic", kafka.Message{Key: []byte(strconv.Itoa(i))})
+	}
+	c.Consume(func(context.Context, kafka.Message) (Result, error) {
+		return Success, nil
+	})
+	main := b.reader("topic")
+	waitFor(t, func() bool { return main.committedOffset(0) == 6 })
+	if got := main.commitCount(); got != 2 {
+		t.Fatalf("expected a commit per batch, got %d commits", got)
+	}
+}
+
+func TestConsume_unsettledMessageHoldsBackItsPartition(t *testing.T) {
+	c, b := newTestConsumer(t, ConsumerOpt{})
+	b.failTopics["topic.retry"] = true
+	c.Consume(func(_ context.Context, msg kafka.Message) (Result, error) {
+		if string(msg.Key) == "bad" {
+			// Can't be written to the retry topic, so it isn't settled.
+			return Retry, nil
+		}
+		return Success, nil
+	})
+	b.send("topic", kafka.Message{Key: []byte("ok"), Partition: 0})
+	b.send("topic", kafka.Message{Key: []byte("bad"), Partition: 0})
+	b.send("topic", kafka.Message{Key: []byte("ok"), Partition: 0})
+	b.send("topic", kafka.Message{Key: []byte("ok"), Partition: 1})
+	main := b.reader("topic")
+	// Handled one at a time, so partition 0 is done once partition 1 is.
+	waitFor(t, func() bool { return main.committedOffset(1) == 4 })
+
+	if got := main.committedOffset(0); got != 1 {
+		t.Fatalf("expected partition 0 committed up to the unsettled message, resuming at 1, got %d", got)
+	}
+}
+
+func TestConsumeBatch_routesResults(t *testing.T) {
+	cases := []struct {
+		name    string
+		results []Result
+		err     error
+		// retry and dlq are the keys expected on each topic.
+		retry, dlq string
+	}{
+		{name: "per message results", results: []Result{Success, Retry, DeadLetter}, retry: "b", dlq: "c"},
+		{name: "missing results succeed", results: []Result{Retry}, retry: "a"},
+		{name: "retryable error", err: errors.New("bulk insert timeout"), retry: "abc"},
+		{name: "permanent error", err: rmq.Permanent(errors.New("corrupt")), dlq: "abc"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// A long backoff keeps the retry loop from handling the messages again.
+			c, b := newTestConsumer(t, ConsumerOpt{BatchSize: 3, BatchTimeout: time.Hour, BackoffBase: time.Hour})
+			for _, key := range []string{"a", "b", "c"} {
+				b.send("topic", kafka.Message{Key: []byte(key)})
+			}
+			var sizes []int
+			c.ConsumeBatch(func(_ context.Context, msgs []kafka.Message) ([]Result, error) {
+				sizes = append(sizes, len(msgs))
+				return tc.results, tc.err
+			})
+			waitFor(t, func() bool { return b.reader("topic").committedOffset(0) == 3 })
+
+			if len(sizes) != 1 || sizes[0] != 3 {
+				t.Fatalf("expected one batch of 3, got %v", sizes)
+			}
+			for topic, want := range map[string]string{"topic.retry": tc.retry, "topic.dlq": tc.dlq} {
+				got := ""
+				for _, msg := range b.messages(topic) {
+					got += string(msg.Key)
+				}
+				if got != want {
+					t.Fatalf("expected %q on %s, got %q", want, topic, got)
+				}
+			}
+		})
+	}
+}
+
+func TestConsume_recordsBatchSizeAndLag(t *testing.T) {
+	m := &recordingMetrics{}
+	c, b := newTestConsumer(t, ConsumerOpt{BatchSize: 2, BatchTimeout: time.Hour, Metrics: m})
+	main := b.reader("topic")
+	// The partition already holds 5 messages; the batch is its first two.
+	main.msgs <- kafka.Message{Topic: "topic", Offset: 0, HighWaterMark: 5}
+	main.msgs <- kafka.Message{Topic: "topic", Offset: 1, HighWaterMark: 5}
+	c.Consume(func(context.Context, kafka.Message) (Result, error) {
+		return Success, nil
+	})
+	topic := metrics.StringTag("topic", "topic")
+	waitFor(t, func() bool {
+		_, ok := m.gauge("kmq.lag", topic, metrics.IntTag("partition", 0))
+		return ok
+	})
+
+	if got, _ := m.gauge("kmq.batch.size", topic); got != 2 {
+		t.Fatalf("expected kmq.batch.size 2, got %d", got)
+	}
+	if got, _ := m.gauge("kmq.lag", topic, metrics.IntTag("partition", 0)); got != 3 {
+		t.Fatalf("expected kmq.lag 3 behind the last message of the batch, got %d", got)
+	}
+}
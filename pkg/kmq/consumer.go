@@ -2,10 +2,15 @@ package kmq
 
 import (
 	"context"
+	"hash/fnv"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/mercury/pkg/instrumentation/metrics"
+	"github.com/mercury/pkg/rmq"
+	"github.com/mercury/pkg/tracing"
 	"github.com/segmentio/kafka-go"
 	"github.com/sirupsen/logrus"
 )
@@ -20,113 +25,472 @@ const (
 
 type Handler func(ctx context.Context, msg kafka.Message) (Result, error)
 
-type requestIDCtxKey struct{}
+// defaultShutdownGrace bounds how long Close waits for the in-flight message.
+const defaultShutdownGrace = 25 * time.Second
+
+const (
+	defaultMaxAttempts = 5
+	defaultBackoffBase = time.Second
+	defaultBackoffMax  = time.Minute
+	// defaultBatchTimeout keeps a half-empty batch from adding more than a
+	// blink to the latency of a quiet topic.
+	defaultBatchTimeout = 100 * time.Millisecond
+)
+
+// ConsumerOpt configures how a consumer fetches and handles messages, and
+// where it sends the ones it can't handle. Zero values fall back to the
+// package defaults.
+type ConsumerOpt struct {
+	// RetryTopic receives messages whose handler asked for a retry. The
+	// consumer reads it back and hands each message to the handler again
+	// once its backoff has passed. Defaults to topic + ".retry".
+	RetryTopic string
+	// DeadLetterTopic receives messages that can't be handled. Defaults to
+	// topic + ".dlq".
+	DeadLetterTopic string
+	// MaxAttempts is the number of times a message is handled before it is
+	// moved to the dead-letter topic. 1 disables retries.
+	MaxAttempts int
+	// BackoffBase is the delay before the first retry. Each following retry
+	// doubles it, capped at BackoffMax.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// Workers is the number of messages handled concurrently, whatever the
+	// BatchSize. Messages with the same key go to the same worker, so they
+	// are always handled in order. Defaults to 1.
+	Workers int
+	// BatchSize is the number of messages fetched and committed together.
+	// Defaults to 1.
+	BatchSize int
+	// BatchTimeout bounds how long a batch waits to fill up once its first
+	// message has arrived. Defaults to 100ms.
+	BatchTimeout time.Duration
+	// Metrics receives the kmq.batch.size, kmq.batch.duration and kmq.lag
+	// metrics. Defaults to metrics.Discard.
+	Metrics metrics.Metrics
+}
+
+func (o ConsumerOpt) withDefaults(topic string) ConsumerOpt {
+	if o.RetryTopic == "" {
+		o.RetryTopic = topic + ".retry"
+	}
+	if o.DeadLetterTopic == "" {
+		o.DeadLetterTopic = topic + ".dlq"
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = defaultMaxAttempts
+	}
+	if o.BackoffBase <= 0 {
+		o.BackoffBase = defaultBackoffBase
+	}
+	if o.BackoffMax <= 0 {
+		o.BackoffMax = defaultBackoffMax
+	}
+	if o.Workers <= 0 {
+		o.Workers = 1
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = 1
+	}
+	if o.BatchTimeout <= 0 {
+		o.BatchTimeout = defaultBatchTimeout
+	}
+	if o.Metrics == nil {
+		o.Metrics = metrics.Discard
+	}
+	return o
+}
 
 type KMQConsumer interface {
 	Close()
+	Shutdown(ctx context.Context) error
+	Ready() bool
 	Consume(handler Handler, middlewares ...Middleware)
+	ConsumeBatch(handler BatchHandler)
+}
+
+// kafkaReader is the part of *kafka.Reader the consumer uses, so tests can
+// feed it messages without a broker.
+type kafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
 }
 
 type kmqConsumer struct {
-	reader   *kafka.Reader
-	logger   *logrus.Logger
-	producer *Producer
-	ctx      context.Context // loop lifetime — cancelled by Close()
-	cancel   context.CancelFunc
+	topic  string
+	opt    ConsumerOpt
+	reader kafkaReader
+	// retryReader reads opt.RetryTopic back; nil when retries are disabled.
+	retryReader kafkaReader
+	logger      *logrus.Logger
+	producer    *Producer
+	ctx         context.Context // fetch loop lifetime — cancelled when draining starts
+	cancel      context.CancelFunc
+	// handlerCtx outlives ctx so the in-flight message can finish during a
+	// drain; it is only cancelled once the grace period has run out.
+	handlerCtx    context.Context
+	handlerCancel context.CancelFunc
+	draining      atomic.Bool
+	started       atomic.Bool
+	// keyless spreads keyless messages across the workers.
+	keyless   atomic.Uint32
+	done      chan struct{} // closed when the fetch loops exit
+	closeOnce sync.Once
 }
 
+// NewKafkaConsumer consumes topic with the default ConsumerOpt.
 func NewKafkaConsumer(
 	brokers []string,
 	groupID string,
 	topic string,
 	logger *logrus.Logger,
 ) KMQConsumer {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:        brokers,
-		GroupID:        groupID,
-		Topic:          topic,
-		MinBytes:       1,
-		MaxBytes:       10e6,
-		CommitInterval: 0, // disable auto-commit (manual control)
-	})
+	return NewKafkaConsumerWithOpt(brokers, groupID, topic, logger, ConsumerOpt{})
+}
 
-	producer := NewProducer(brokers)
+// NewKafkaConsumerWithOpt consumes topic with opt. Unless retries are
+// disabled, it also reads opt.RetryTopic as groupID + ".retry", so retried
+// messages don't hold up the partitions of topic while they wait.
+func NewKafkaConsumerWithOpt(
+	brokers []string,
+	groupID string,
+	topic string,
+	logger *logrus.Logger,
+	opt ConsumerOpt,
+) KMQConsumer {
+	opt = opt.withDefaults(topic)
+	newReader := func(groupID, topic string) *kafka.Reader {
+		return kafka.NewReader(kafka.ReaderConfig{
+			Brokers:        brokers,
+			GroupID:        groupID,
+			Topic:          topic,
+			MinBytes:       1,
+			MaxBytes:       10e6,
+			CommitInterval: 0, // disable auto-commit (manual control)
+		})
+	}
+	var retryReader kafkaReader
+	if opt.MaxAttempts > 1 {
+		retryReader = newReader(groupID+".retry", opt.RetryTopic)
+	}
+	return newConsumer(topic, newReader(groupID, topic), retryReader, NewProducer(brokers), logger, opt)
+}
 
+// newConsumer returns a consumer of topic reading from reader and
+// retryReader, which may be nil, with opt already defaulted.
+func newConsumer(
+	topic string,
+	reader kafkaReader,
+	retryReader kafkaReader,
+	producer *Producer,
+	logger *logrus.Logger,
+	opt ConsumerOpt,
+) *kmqConsumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	handlerCtx, handlerCancel := context.WithCancel(context.Background())
 	return &kmqConsumer{
-		reader:   reader,
-		logger:   logger,
-		producer: producer,
-		ctx:      ctx,
-		cancel:   cancel,
+		topic:         topic,
+		opt:           opt,
+		reader:        reader,
+		retryReader:   retryReader,
+		logger:        logger,
+		producer:      producer,
+		ctx:           ctx,
+		cancel:        cancel,
+		handlerCtx:    handlerCtx,
+		handlerCancel: handlerCancel,
+		done:          make(chan struct{}),
 	}
 }
 
+// Close drains with the default grace period.
 func (mq *kmqConsumer) Close() {
-	mq.cancel()
-	mq.reader.Close()
-	mq.producer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownGrace)
+	defer cancel()
+	mq.Shutdown(ctx)
+}
+
+// Shutdown stops fetching, lets the in-flight message finish and commit until
+// ctx is done, then closes the reader and producer. An uncommitted message is
+// redelivered to the next member of the group.
+func (mq *kmqConsumer) Shutdown(ctx context.Context) error {
+	var err error
+	mq.closeOnce.Do(func() {
+		mq.draining.Store(true)
+		mq.cancel()
+		// No fetch loop will ever close done if Consume was never called.
+		if mq.started.CompareAndSwap(false, true) {
+			close(mq.done)
+		}
+
+		select {
+		case <-mq.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+			// Cancel the handler and wait for the loop to give the message up
+			// uncommitted before the reader is closed underneath it.
+			mq.handlerCancel()
+			<-mq.done
+		}
+		mq.handlerCancel()
+		mq.reader.Close()
+		if mq.retryReader != nil {
+			mq.retryReader.Close()
+		}
+		mq.producer.Close()
+	})
+	return err
+}
+
+// Ready reports false once the consumer has started draining.
+func (mq *kmqConsumer) Ready() bool {
+	return !mq.draining.Load()
 }
 
+// Consume runs handler on every message of the topic and of its retry
+// topic, on up to opt.Workers messages at once. A Retry result, or an error
+// Classify finds retryable, sends the message to the retry topic with its
+// attempt count; once it has used up MaxAttempts, or on DeadLetter and any
+// other error, it goes to the dead-letter topic instead.
 func (c *kmqConsumer) Consume(handler Handler, middlewares ...Middleware) {
-	// Apply middleware (right-to-left)
-	h := handler
+	// Apply middleware (right-to-left); UseRecover always wraps the handler
+	// itself so a panic can't stop the fetch loop.
+	h := UseRecover()(c.topic, handler)
 	for i := len(middlewares) - 1; i >= 0; i-- {
-		h = middlewares[i](c.reader.Config().Topic, h)
+		h = middlewares[i](c.topic, h)
 	}
+	c.start(func(msgs []kafka.Message) []bool {
+		settled := make([]bool, len(msgs))
+		for i, msg := range msgs {
+			settled[i] = c.handle(h, msg)
+		}
+		return settled
+	})
+}
 
-	c.logger.Infof("kafka consumer listening on (%s)", c.reader.Config().Topic)
+// batch is a fetched batch of one reader, settled by the workers its
+// messages were spread across.
+type batch struct {
+	msgs    []kafka.Message
+	settled []bool
+	offsets *offsets
+	topic   string
+	fetched time.Time
+	// pending counts the jobs of the batch still being handled.
+	pending atomic.Int32
+}
 
-	go func() {
-		for {
-			// FetchMessage blocks until a message arrives or the loop ctx is cancelled.
-			msg, err := c.reader.FetchMessage(c.ctx)
-			if err != nil {
-				if c.ctx.Err() != nil {
-					log.Println("consumer shutting down")
-					return
-				}
-				log.Printf("fetch error: %v\n", err)
-				continue
-			}
+// job is the part of a batch one worker handles, in fetch order.
+type job struct {
+	batch *batch
+	index []int
+}
+
+// start runs opt.Workers workers and the fetch loops feeding them. Each
+// worker hands its jobs to process, which reports the messages it settled.
+func (c *kmqConsumer) start(process func([]kafka.Message) []bool) {
+	if !c.started.CompareAndSwap(false, true) {
+		c.logger.Warn("kafka: consumer already started or shut down")
+		return
+	}
+	c.logger.Infof("kafka consumer listening on (%s)", c.topic)
 
-			// Per-message context: timeout for processing this one message.
-			// Derived from the loop ctx so shutdown also cancels in-flight work.
-			msgCtx, cancel := context.WithTimeout(c.ctx, 5*time.Minute)
-			msgCtx = context.WithValue(msgCtx, requestIDCtxKey{}, uuid.New().String())
-
-			res, err := h(msgCtx, msg)
-			if err != nil {
-				cancel()
-				c.logger.
-					WithError(err).
-					Error("handler execution failed")
-				// Do NOT commit — let it retry after restart/rebalance.
-				continue
+	lanes := make([]chan job, c.opt.Workers)
+	var workers sync.WaitGroup
+	for i := range lanes {
+		lanes[i] = make(chan job, c.opt.BatchSize)
+		workers.Go(func() {
+			for j := range lanes[i] {
+				c.work(j, process)
 			}
+		})
+	}
+
+	var fetchers sync.WaitGroup
+	fetchers.Go(func() { c.fetch(c.reader, c.topic, lanes, false) })
+	if c.retryReader != nil {
+		fetchers.Go(func() { c.fetch(c.retryReader, c.opt.RetryTopic, lanes, true) })
+	}
+	go func() {
+		fetchers.Wait()
+		for _, lane := range lanes {
+			close(lane)
+		}
+		workers.Wait()
+		close(c.done)
+	}()
+}
 
-			switch res {
-			case Success:
-				// nothing extra
-			case Retry:
-				if err = c.producer.Produce(msgCtx, "messages.retry", msg); err != nil {
-					cancel()
-					c.logger.WithError(err).Error("retry produce failed")
-					continue // do NOT commit
-				}
-			case DeadLetter:
-				if err = c.producer.Produce(msgCtx, "messages.dlq", msg); err != nil {
-					cancel()
-					c.logger.WithError(err).Error("dlq produce failed")
-					continue // do NOT commit
-				}
+// fetch hands the messages of reader to the workers until the loop ctx is
+// cancelled, without waiting for one batch to settle before fetching the
+// next. When delayed is set, messages are fetched one at a time, each held
+// until its retry is due.
+func (c *kmqConsumer) fetch(reader kafkaReader, topic string, lanes []chan job, delayed bool) {
+	size := c.opt.BatchSize
+	if delayed {
+		size = 1
+	}
+	offsets := newOffsets(reader, c.logger)
+	for {
+		msgs := c.fetchBatch(reader, size)
+		if len(msgs) == 0 {
+			log.Println("consumer shutting down")
+			return
+		}
+		if delayed {
+			// Retries on a partition are in the order they failed, so waiting
+			// for this one rarely holds back one that is already due.
+			if err := waitUntil(c.ctx, c.opt.retryAt(msgs[0])); err != nil {
+				// Draining: leave it uncommitted to be fetched again.
+				return
 			}
-			cancel()
+		}
+		c.dispatch(&batch{
+			msgs:    msgs,
+			settled: make([]bool, len(msgs)),
+			offsets: offsets,
+			topic:   topic,
+			fetched: time.Now(),
+		}, lanes)
+	}
+}
+
+// dispatch splits b across the lanes. Messages with the same key go to the
+// same lane in fetch order, so they are handled in order; keyless ones are
+// spread evenly.
+func (c *kmqConsumer) dispatch(b *batch, lanes []chan job) {
+	b.offsets.track(b.msgs)
+	index := make([][]int, len(lanes))
+	for i, msg := range b.msgs {
+		lane := int(c.keyless.Add(1) % uint32(len(lanes)))
+		if len(msg.Key) > 0 {
+			hash := fnv.New32a()
+			hash.Write(msg.Key)
+			lane = int(hash.Sum32() % uint32(len(lanes)))
+		}
+		index[lane] = append(index[lane], i)
+	}
+	var jobs int32
+	for _, idx := range index {
+		if len(idx) > 0 {
+			jobs++
+		}
+	}
+	b.pending.Store(jobs)
+	for lane, idx := range index {
+		if len(idx) > 0 {
+			lanes[lane] <- job{batch: b, index: idx}
+		}
+	}
+}
+
+// work processes j, and commits its batch once j was the last part of it
+// to settle.
+func (c *kmqConsumer) work(j job, process func([]kafka.Message) []bool) {
+	msgs := make([]kafka.Message, len(j.index))
+	for i, idx := range j.index {
+		msgs[i] = j.batch.msgs[idx]
+	}
+	settled := process(msgs)
+	for i, idx := range j.index {
+		j.batch.settled[idx] = settled[i]
+	}
+	if j.batch.pending.Add(-1) > 0 {
+		return
+	}
+	j.batch.offsets.commit(j.batch.msgs, j.batch.settled)
+	c.recordBatch(j.batch.topic, j.batch.msgs, time.Since(j.batch.fetched))
+}
 
-			if err := c.reader.CommitMessages(context.Background(), msg); err != nil {
-				c.logger.WithError(err).Error("kafka: commit failed")
+// fetchBatch returns up to size messages, waiting at most opt.BatchTimeout
+// for more once the first has arrived. It returns nil once the loop ctx is
+// cancelled and nothing was fetched.
+func (c *kmqConsumer) fetchBatch(reader kafkaReader, size int) []kafka.Message {
+	var batch []kafka.Message
+	for len(batch) == 0 {
+		// FetchMessage blocks until a message arrives or the loop ctx is cancelled.
+		msg, err := reader.FetchMessage(c.ctx)
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return nil
 			}
+			log.Printf("fetch error: %v\n", err)
+			continue
 		}
-	}()
+		batch = append(batch, msg)
+	}
+	if size <= 1 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, c.opt.BatchTimeout)
+	defer cancel()
+	for len(batch) < size {
+		msg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			// Timed out, draining or a fetch error: handle what we have.
+			break
+		}
+		batch = append(batch, msg)
+	}
+	return batch
+}
+
+// recordBatch reports the batch size and duration, and the lag of every
+// partition in the batch as of its last message.
+func (c *kmqConsumer) recordBatch(topic string, batch []kafka.Message, took time.Duration) {
+	c.opt.Metrics.Gauge("kmq.batch.size", int64(len(batch)), metrics.StringTag("topic", topic))
+	c.opt.Metrics.Timing("kmq.batch.duration", took, metrics.StringTag("topic", topic))
+	last := map[int]kafka.Message{}
+	for _, msg := range batch {
+		last[msg.Partition] = msg
+	}
+	for partition, msg := range last {
+		c.opt.Metrics.Gauge("kmq.lag", max(msg.HighWaterMark-msg.Offset-1, 0),
+			metrics.StringTag("topic", topic),
+			metrics.IntTag("partition", partition),
+		)
+	}
+}
+
+// handle runs h on msg and settles the outcome.
+func (c *kmqConsumer) handle(h Handler, msg kafka.Message) bool {
+	// Per-message context: timeout for processing this one message.
+	// Derived from handlerCtx, not the loop ctx, so a drain lets the
+	// message finish and only an expired grace period cancels it.
+	msgCtx, cancel := context.WithTimeout(c.handlerCtx, 5*time.Minute)
+	defer cancel()
+	msgCtx = tracing.WithRequestID(msgCtx, tracing.EnsureRequestID(headerCarrier{&msg.Headers}.Get(tracing.HeaderRequestID)))
+	msgCtx, span := startProcessSpan(msgCtx, msg)
+
+	res, cause := h(msgCtx, msg)
+	tracing.End(span, cause)
+	return c.settle(msgCtx, msg, res, cause)
+}
+
+// settle routes msg by the handler's outcome and reports whether it can be
+// committed.
+func (c *kmqConsumer) settle(ctx context.Context, msg kafka.Message, res Result, cause error) bool {
+	if cause != nil {
+		class := rmq.Classify(cause)
+		c.logger.
+			WithContext(ctx).
+			WithError(cause).
+			WithField("class", class).
+			Error("handler execution failed")
+		// Permanent and client errors fail the same way every time.
+		res = DeadLetter
+		if class == rmq.ClassRetryable {
+			res = Retry
+		}
+	}
+
+	if res == Retry || res == DeadLetter {
+		if err := c.retryOrDeadLetter(ctx, msg, res == DeadLetter, cause); err != nil {
+			c.logger.WithError(err).Error("kafka: retry produce failed")
+			return false // do NOT commit
+		}
+	}
+	return true
 }
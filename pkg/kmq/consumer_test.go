@@ -0,0 +1,173 @@
+package kmq
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeBroker stands in for Kafka. It writes messages to topics, delivering
+// them to the reader of the topic if there is one, and remembers what each
+// reader committed.
+type fakeBroker struct {
+	mu      sync.Mutex
+	readers map[string]*fakeReader
+	written map[string][]kafka.Message
+	offsets map[string]int64
+	// failTopics makes writes to these topics fail.
+	failTopics map[string]bool
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		readers:    map[string]*fakeReader{},
+		written:    map[string][]kafka.Message{},
+		offsets:    map[string]int64{},
+		failTopics: map[string]bool{},
+	}
+}
+
+// reader returns the reader of topic, creating it.
+func (b *fakeBroker) reader(topic string) *fakeReader {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r, ok := b.readers[topic]
+	if !ok {
+		r = &fakeReader{msgs: make(chan kafka.Message, 100)}
+		b.readers[topic] = r
+	}
+	return r
+}
+
+// send delivers msg on topic as if a producer had written it, numbering it
+// after the last message of the topic.
+func (b *fakeBroker) send(topic string, msg kafka.Message) kafka.Message {
+	b.mu.Lock()
+	msg.Topic = topic
+	msg.Offset = b.offsets[topic]
+	b.offsets[topic]++
+	msg.HighWaterMark = b.offsets[topic]
+	b.written[topic] = append(b.written[topic], msg)
+	r := b.readers[topic]
+	b.mu.Unlock()
+	if r != nil {
+		r.msgs <- msg
+	}
+	return msg
+}
+
+func (b *fakeBroker) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	for _, msg := range msgs {
+		b.mu.Lock()
+		fail := b.failTopics[msg.Topic]
+		b.mu.Unlock()
+		if fail {
+			return io.ErrClosedPipe
+		}
+		b.send(msg.Topic, msg)
+	}
+	return nil
+}
+
+func (b *fakeBroker) Close() error { return nil }
+
+// messages returns what was written to topic.
+func (b *fakeBroker) messages(topic string) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]kafka.Message(nil), b.written[topic]...)
+}
+
+type fakeReader struct {
+	msgs chan kafka.Message
+
+	mu        sync.Mutex
+	commits   [][]kafka.Message
+	committed map[int]int64
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	select {
+	case msg := <-r.msgs:
+		return msg, nil
+	case <-ctx.Done():
+		return kafka.Message{}, ctx.Err()
+	}
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.committed == nil {
+		r.committed = map[int]int64{}
+	}
+	r.commits = append(r.commits, msgs)
+	for _, msg := range msgs {
+		// Like Kafka, the group resumes after the highest committed offset.
+		r.committed[msg.Partition] = max(r.committed[msg.Partition], msg.Offset+1)
+	}
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+// committedOffset returns the offset the group resumes partition from, 0
+// if nothing was committed.
+func (r *fakeReader) committedOffset(partition int) int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.committed[partition]
+}
+
+func (r *fakeReader) commitCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.commits)
+}
+
+// newTestConsumer returns a consumer of "topic" on a fake broker, shut down
+// when the test ends.
+func newTestConsumer(t *testing.T, opt ConsumerOpt) (*kmqConsumer, *fakeBroker) {
+	t.Helper()
+	opt = opt.withDefaults("topic")
+	b := newFakeBroker()
+	var retryReader kafkaReader
+	if opt.MaxAttempts > 1 {
+		retryReader = b.reader(opt.RetryTopic)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	c := newConsumer("topic", b.reader("topic"), retryReader, &Producer{writer: b}, logger, opt)
+	t.Cleanup(func() { c.Shutdown(context.Background()) })
+	return c, b
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("condition not met within timeout")
+}
+
+func TestReady_falseWhileDraining(t *testing.T) {
+	c := NewKafkaConsumer([]string{"127.0.0.1:1"}, "group", "topic", logrus.New())
+	if !c.Ready() {
+		t.Fatal("expected a new consumer to be ready")
+	}
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Ready() {
+		t.Fatal("expected a draining consumer not to be ready")
+	}
+}
@@ -4,11 +4,10 @@ import (
 	"context"
 	"time"
 
-	"github.com/google/uuid"
-	"github.com/mercury/pkg/middleware"
+	"github.com/mercury/pkg/instrumentation/metrics"
+	"github.com/mercury/pkg/tracing"
 	"github.com/segmentio/kafka-go"
 	"github.com/sirupsen/logrus"
-	"github.com/smira/go-statsd"
 )
 
 // Middleware receives the queue name (injected by Consume) and wraps a Handler.
@@ -20,15 +19,14 @@ func UseLogger(logger *logrus.Logger, environment string) Middleware {
 	return func(queue string, next Handler) Handler {
 		return func(ctx context.Context, msg kafka.Message) (Result, error) {
 			log := logger.WithContext(ctx)
-			correlationID := uuid.New().String()
 			log = log.WithFields(logrus.Fields{
-				"environment":    environment,
-				"offset":         msg.Offset,
-				"key":            string(msg.Key),
-				"partition":      msg.Partition,
-				"topic":          msg.Topic,
-				"queue":          queue,
-				"correlation_id": correlationID,
+				"environment": environment,
+				"offset":      msg.Offset,
+				"key":         string(msg.Key),
+				"partition":   msg.Partition,
+				"topic":       msg.Topic,
+				"queue":       queue,
+				"request_id":  tracing.RequestID(ctx),
 			})
 			ctx = context.WithValue(ctx, loggerCtxKey{}, log)
 			result, err := next(ctx, msg)
@@ -51,39 +49,33 @@ func LoggerFromContext(ctx context.Context) *logrus.Entry {
 	return l
 }
 
-type statsdCtxKey struct{}
-
-func UseStatsd(client *statsd.Client) Middleware {
+// UseMetrics times handlers as kmq.duration, tagged with the topic, the
+// queue and whether the handler failed. Message keys are left out: a series
+// per key would grow without bound in Prometheus.
+func UseMetrics(m metrics.Metrics) Middleware {
 	return func(queue string, next Handler) Handler {
 		return func(ctx context.Context, msg kafka.Message) (_ Result, err error) {
-			ctx = context.WithValue(ctx, statsdCtxKey{}, client)
+			ctx = metrics.NewContext(ctx, m)
 			start := time.Now()
 
-			defer func(err error) {
-				duration := time.Since(start)
-				key := string(msg.Key)
-				topic := msg.Topic
-
-				tags := []statsd.Tag{
-					statsd.StringTag("key", key),
-					statsd.StringTag("topic", topic),
-					statsd.StringTag("queue", queue),
-				}
+			defer func() {
+				errTag := "false"
 				if err != nil {
-					tags = append(tags, statsd.StringTag("err", err.Error()))
+					errTag = "true"
 				}
-				client.Timing("kmq.duration", int64(duration/time.Millisecond), tags...)
-
-			}(err)
+				m.Timing("kmq.duration", time.Since(start),
+					metrics.StringTag("topic", msg.Topic),
+					metrics.StringTag("queue", queue),
+					metrics.StringTag("error", errTag),
+				)
+			}()
 			return next(ctx, msg)
 		}
 	}
 }
 
-func StatsdFromContext(ctx context.Context) *statsd.Client {
-	l, _ := ctx.Value(statsdCtxKey{}).(*statsd.Client)
-	if l == nil {
-		return statsd.NewClient("localhost:0", statsd.Logger(middleware.StatsDNoopLogger{}))
-	}
-	return l
+// MetricsFromContext returns the metrics stored in context, falling back to
+// metrics.Discard.
+func MetricsFromContext(ctx context.Context) metrics.Metrics {
+	return metrics.FromContext(ctx)
 }
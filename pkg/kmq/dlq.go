@@ -0,0 +1,266 @@
+package kmq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// DeadLetterMessage is a message read from a dead-letter topic, with the
+// headers the consumer wrote when it gave up on it.
+type DeadLetterMessage struct {
+	Topic          string
+	Partition      int
+	Offset         int64
+	Key            string
+	Time           time.Time
+	Attempts       int
+	LastError      string
+	OriginalTopic  string
+	RetryAt        time.Time
+	DeadLetteredAt time.Time
+	Headers        map[string]string
+	Value          []byte
+
+	msg kafka.Message
+}
+
+func newDeadLetterMessage(msg kafka.Message) DeadLetterMessage {
+	m := DeadLetterMessage{
+		Topic:         msg.Topic,
+		Partition:     msg.Partition,
+		Offset:        msg.Offset,
+		Key:           string(msg.Key),
+		Time:          msg.Time,
+		Attempts:      Attempts(msg),
+		LastError:     header(msg, HeaderLastError),
+		OriginalTopic: header(msg, HeaderOriginalTopic),
+		Headers:       make(map[string]string, len(msg.Headers)),
+		Value:         msg.Value,
+		msg:           msg,
+	}
+	m.RetryAt, _ = time.Parse(time.RFC3339Nano, header(msg, HeaderRetryAt))
+	m.DeadLetteredAt, _ = time.Parse(time.RFC3339Nano, header(msg, HeaderDeadLetteredAt))
+	for _, h := range msg.Headers {
+		m.Headers[h.Key] = string(h.Value)
+	}
+	return m
+}
+
+// DLQFilter selects dead-lettered messages. Zero fields match everything.
+type DLQFilter struct {
+	// Key matches the message key exactly.
+	Key string
+	// Since and Until bound when the message was dead-lettered, falling back
+	// to when it was written to the topic.
+	Since time.Time
+	Until time.Time
+	// Error matches a substring of the last handler error.
+	Error string
+	// Limit caps the number of messages returned.
+	Limit int
+}
+
+func (f DLQFilter) match(m DeadLetterMessage) bool {
+	at := m.DeadLetteredAt
+	if at.IsZero() {
+		at = m.Time
+	}
+	switch {
+	case f.Key != "" && m.Key != f.Key:
+		return false
+	case !f.Since.IsZero() && at.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && at.After(f.Until):
+		return false
+	case f.Error != "" && !strings.Contains(m.LastError, f.Error):
+		return false
+	}
+	return true
+}
+
+// dlqIdleTimeout is how long readPartition waits for the next message
+// before taking the partition as read. Offsets up to the end of a partition
+// can hold no message: transaction markers and compacted records.
+var dlqIdleTimeout = 5 * time.Second
+
+// dlqCluster is the part of Kafka the dead-letter tools use.
+type dlqCluster interface {
+	partitions(ctx context.Context, topic string) ([]int, error)
+	// offsets returns the first offset of partition and the offset after its
+	// last.
+	offsets(ctx context.Context, topic string, partition int) (first, last int64, err error)
+	reader(topic string, partition int, offset int64) (partitionReader, error)
+	producer() *Producer
+}
+
+// partitionReader is the part of *kafka.Reader readPartition uses.
+type partitionReader interface {
+	ReadMessage(ctx context.Context) (kafka.Message, error)
+	Close() error
+}
+
+// kafkaCluster is a dlqCluster reaching Kafka through brokers.
+type kafkaCluster struct {
+	brokers []string
+}
+
+func (c kafkaCluster) partitions(ctx context.Context, topic string) ([]int, error) {
+	conn, err := kafka.DialContext(ctx, "tcp", c.brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	partitions, err := conn.ReadPartitions(topic)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, len(partitions))
+	for i, p := range partitions {
+		ids[i] = p.ID
+	}
+	return ids, nil
+}
+
+func (c kafkaCluster) offsets(ctx context.Context, topic string, partition int) (int64, int64, error) {
+	leader, err := kafka.DialLeader(ctx, "tcp", c.brokers[0], topic, partition)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer leader.Close()
+	return leader.ReadOffsets()
+}
+
+func (c kafkaCluster) reader(topic string, partition int, offset int64) (partitionReader, error) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   c.brokers,
+		Topic:     topic,
+		Partition: partition,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	if err := r.SetOffset(offset); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (c kafkaCluster) producer() *Producer {
+	return NewProducer(c.brokers)
+}
+
+// ListDeadLetters reads every partition of the dead-letter topic up to its
+// current end and returns the messages that match filter. It reads without
+// a consumer group, so nothing is committed or removed.
+func ListDeadLetters(ctx context.Context, brokers []string, topic string, filter DLQFilter) ([]DeadLetterMessage, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("kafka: no brokers")
+	}
+	return listDeadLetters(ctx, kafkaCluster{brokers}, topic, filter)
+}
+
+func listDeadLetters(ctx context.Context, c dlqCluster, topic string, filter DLQFilter) ([]DeadLetterMessage, error) {
+	partitions, err := c.partitions(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []DeadLetterMessage
+	for _, p := range partitions {
+		msgs, err := readPartition(ctx, c, topic, p, filter, filter.Limit-len(found))
+		if err != nil {
+			return found, err
+		}
+		found = append(found, msgs...)
+		if filter.Limit > 0 && len(found) >= filter.Limit {
+			break
+		}
+	}
+	return found, nil
+}
+
+// readPartition returns up to limit matching messages of one partition, or
+// all of them when limit is 0 or less. It stops at the partition's current
+// end, or once no message came for dlqIdleTimeout.
+func readPartition(ctx context.Context, c dlqCluster, topic string, partition int, filter DLQFilter, limit int) ([]DeadLetterMessage, error) {
+	first, last, err := c.offsets(ctx, topic, partition)
+	if err != nil || first >= last {
+		return nil, err
+	}
+	r, err := c.reader(topic, partition, first)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var found []DeadLetterMessage
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, dlqIdleTimeout)
+		msg, err := r.ReadMessage(readCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				// The offsets left before last hold no message.
+				return found, nil
+			}
+			return found, err
+		}
+		if m := newDeadLetterMessage(msg); filter.match(m) {
+			found = append(found, m)
+		}
+		if msg.Offset >= last-1 || (limit > 0 && len(found) >= limit) {
+			return found, nil
+		}
+	}
+}
+
+// ReplayDeadLetters copies the matching messages of the dead-letter topic
+// back to their original topic, with their attempt count and failure
+// headers cleared, and returns them. With dryRun it only lists them. Kafka
+// can't delete single messages, so replayed ones stay in the dead-letter
+// topic; narrow the next replay with Since to skip them.
+func ReplayDeadLetters(ctx context.Context, brokers []string, topic string, filter DLQFilter, dryRun bool) ([]DeadLetterMessage, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("kafka: no brokers")
+	}
+	return replayDeadLetters(ctx, kafkaCluster{brokers}, topic, filter, dryRun)
+}
+
+func replayDeadLetters(ctx context.Context, c dlqCluster, topic string, filter DLQFilter, dryRun bool) ([]DeadLetterMessage, error) {
+	msgs, err := listDeadLetters(ctx, c, topic, filter)
+	if err != nil || dryRun {
+		return msgs, err
+	}
+
+	producer := c.producer()
+	defer producer.Close()
+	for i, m := range msgs {
+		target := m.OriginalTopic
+		if target == "" {
+			target = strings.TrimSuffix(topic, ".dlq")
+		}
+		if err := producer.Produce(ctx, target, replayable(m.msg)); err != nil {
+			return msgs[:i], err
+		}
+	}
+	return msgs, nil
+}
+
+// replayable strips the headers that would make the consumer treat msg as
+// already failed.
+func replayable(msg kafka.Message) kafka.Message {
+	headers := make([]kafka.Header, 0, len(msg.Headers))
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case HeaderAttempts, HeaderRetryAt, HeaderLastError, HeaderOriginalTopic, HeaderDeadLetteredAt:
+			continue
+		}
+		headers = append(headers, h)
+	}
+	msg.Headers = headers
+	return msg
+}
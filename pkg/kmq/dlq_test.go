@@ -0,0 +1,209 @@
+package kmq
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fakeCluster serves the topics of a fakeBroker to the dead-letter tools.
+type fakeCluster struct {
+	*fakeBroker
+	// markers is how many offsets with no message end each partition, like
+	// a transaction's commit marker.
+	markers int64
+}
+
+func (c fakeCluster) partitions(_ context.Context, topic string) ([]int, error) {
+	var ids []int
+	seen := map[int]bool{}
+	for _, msg := range c.messages(topic) {
+		if !seen[msg.Partition] {
+			seen[msg.Partition] = true
+			ids = append(ids, msg.Partition)
+		}
+	}
+	return ids, nil
+}
+
+func (c fakeCluster) offsets(_ context.Context, topic string, partition int) (int64, int64, error) {
+	first, last := int64(-1), int64(0)
+	for _, msg := range c.messages(topic) {
+		if msg.Partition != partition {
+			continue
+		}
+		if first < 0 {
+			first = msg.Offset
+		}
+		last = msg.Offset + 1 + c.markers
+	}
+	return max(first, 0), last, nil
+}
+
+func (c fakeCluster) reader(topic string, partition int, offset int64) (partitionReader, error) {
+	r := &fakeReader{msgs: make(chan kafka.Message, 100)}
+	for _, msg := range c.messages(topic) {
+		if msg.Partition == partition && msg.Offset >= offset {
+			r.msgs <- msg
+		}
+	}
+	return r, nil
+}
+
+// ReadMessage is FetchMessage: without a consumer group there is nothing to
+// commit.
+func (r *fakeReader) ReadMessage(ctx context.Context) (kafka.Message, error) {
+	return r.FetchMessage(ctx)
+}
+
+func (c fakeCluster) producer() *Producer {
+	return &Producer{writer: c.fakeBroker}
+}
+
+// deadLetter writes a message to "orders.dlq" the way the consumer does
+// when it gives up on it.
+func deadLetter(b *fakeBroker, partition int, key, cause string, at time.Time) {
+	b.send("orders.dlq", kafka.Message{
+		Partition: partition,
+		Key:       []byte(key),
+		Value:     []byte(`{"id":"` + key + `"}`),
+		Headers: []kafka.Header{
+			{Key: HeaderAttempts, Value: []byte(strconv.Itoa(defaultMaxAttempts))},
+			{Key: HeaderLastError, Value: []byte(cause)},
+			{Key: HeaderOriginalTopic, Value: []byte("orders")},
+			{Key: HeaderDeadLetteredAt, Value: []byte(at.Format(time.RFC3339Nano))},
+			{Key: "x-tenant", Value: []byte("acme")},
+		},
+	})
+}
+
+func newDLQCluster() fakeCluster {
+	b := newFakeBroker()
+	now := time.Now()
+	deadLetter(b, 0, "o1", "cassandra: timeout", now.Add(-2*time.Hour))
+	deadLetter(b, 1, "o2", "invalid amount", now.Add(-time.Hour))
+	deadLetter(b, 0, "o3", "cassandra: timeout", now)
+	return fakeCluster{fakeBroker: b}
+}
+
+func TestListDeadLetters_readsEveryPartition(t *testing.T) {
+	c := newDLQCluster()
+	msgs, err := listDeadLetters(context.Background(), c, "orders.dlq", DLQFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 dead letters, got %+v", msgs)
+	}
+	m := msgs[0]
+	if m.Key != "o1" || m.Attempts != defaultMaxAttempts || m.LastError != "cassandra: timeout" ||
+		m.OriginalTopic != "orders" || m.DeadLetteredAt.IsZero() || m.Headers["x-tenant"] != "acme" {
+		t.Fatalf("unexpected dead letter %+v", m)
+	}
+	if n := len(c.messages("orders.dlq")); n != 3 {
+		t.Fatalf("expected the topic left untouched, got %d messages", n)
+	}
+}
+
+func TestListDeadLetters_filters(t *testing.T) {
+	c := newDLQCluster()
+	now := time.Now()
+	cases := []struct {
+		filter DLQFilter
+		want   []string
+	}{
+		{DLQFilter{Error: "cassandra"}, []string{"o1", "o3"}},
+		{DLQFilter{Key: "o2"}, []string{"o2"}},
+		{DLQFilter{Since: now.Add(-90 * time.Minute)}, []string{"o3", "o2"}},
+		{DLQFilter{Until: now.Add(-90 * time.Minute)}, []string{"o1"}},
+		{DLQFilter{Limit: 1}, []string{"o1"}},
+		{DLQFilter{Error: "cassandra", Limit: 2}, []string{"o1", "o3"}},
+	}
+	for _, tc := range cases {
+		msgs, err := listDeadLetters(context.Background(), c, "orders.dlq", tc.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, m := range msgs {
+			keys = append(keys, m.Key)
+		}
+		if len(keys) != len(tc.want) {
+			t.Errorf("%+v: expected %v, got %v", tc.filter, tc.want, keys)
+			continue
+		}
+		for i := range keys {
+			if keys[i] != tc.want[i] {
+				t.Errorf("%+v: expected %v, got %v", tc.filter, tc.want, keys)
+				break
+			}
+		}
+	}
+}
+
+func TestListDeadLetters_stopsAtOffsetsWithoutMessages(t *testing.T) {
+	timeout := dlqIdleTimeout
+	dlqIdleTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { dlqIdleTimeout = timeout })
+
+	c := newDLQCluster()
+	c.markers = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msgs, err := listDeadLetters(ctx, c, "orders.dlq", DLQFilter{})
+	if err != nil {
+		t.Fatalf("expected the read to end at the marker, got %v", err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 dead letters, got %d", len(msgs))
+	}
+}
+
+func TestReplayDeadLetters_copiesToOriginalTopic(t *testing.T) {
+	c := newDLQCluster()
+	msgs, err := replayDeadLetters(context.Background(), c, "orders.dlq", DLQFilter{Error: "cassandra"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 replayed messages, got %d", len(msgs))
+	}
+	replayed := c.messages("orders")
+	if len(replayed) != 2 || string(replayed[0].Key) != "o1" || string(replayed[1].Key) != "o3" {
+		t.Fatalf("expected o1 and o3 back on orders, got %+v", replayed)
+	}
+	for _, msg := range replayed {
+		if Attempts(msg) != 0 || header(msg, HeaderLastError) != "" || header(msg, HeaderDeadLetteredAt) != "" {
+			t.Fatalf("expected failure headers cleared, got %+v", msg.Headers)
+		}
+		if header(msg, "x-tenant") != "acme" {
+			t.Fatalf("expected other headers kept, got %+v", msg.Headers)
+		}
+	}
+	if n := len(c.messages("orders.dlq")); n != 3 {
+		t.Fatalf("expected replayed messages to stay dead-lettered, got %d", n)
+	}
+}
+
+func TestReplayDeadLetters_dryRunWritesNothing(t *testing.T) {
+	c := newDLQCluster()
+	msgs, err := replayDeadLetters(context.Background(), c, "orders.dlq", DLQFilter{}, true)
+	if err != nil || len(msgs) != 3 {
+		t.Fatalf("expected 3 messages listed, got %d (%v)", len(msgs), err)
+	}
+	if n := len(c.messages("orders")); n != 0 {
+		t.Fatalf("expected nothing replayed, got %d messages", n)
+	}
+}
+
+func TestReplayDeadLetters_stopsAtFailedWrite(t *testing.T) {
+	c := newDLQCluster()
+	c.failTopics["orders"] = true
+	msgs, err := replayDeadLetters(context.Background(), c, "orders.dlq", DLQFilter{}, false)
+	if err == nil || len(msgs) != 0 {
+		t.Fatalf("expected a failure before any replay, got %d messages (%v)", len(msgs), err)
+	}
+}
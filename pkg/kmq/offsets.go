@@ -0,0 +1,117 @@
+package kmq
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Offset states of a fetched message.
+const (
+	offsetInFlight = iota
+	offsetSettled
+	offsetUnsettled
+)
+
+type trackedOffset struct {
+	offset int64
+	state  int
+}
+
+// offsets commits the messages of a reader in partition order. Kafka keeps
+// one committed offset per partition, so committing a message also commits
+// every message before it; offsets only commits up to the last message
+// before the first one that isn't settled yet. A message that could not be
+// settled holds back its partition from then on, and is fetched again, with
+// everything after it, once the partition is reassigned or the consumer
+// restarts.
+type offsets struct {
+	reader kafkaReader
+	logger *logrus.Logger
+
+	mu sync.Mutex
+	// partitions holds the uncommitted offsets of each partition in fetch
+	// order.
+	partitions map[int][]trackedOffset
+	topic      map[int]string
+}
+
+func newOffsets(reader kafkaReader, logger *logrus.Logger) *offsets {
+	return &offsets{
+		reader:     reader,
+		logger:     logger,
+		partitions: map[int][]trackedOffset{},
+		topic:      map[int]string{},
+	}
+}
+
+// track records msgs as fetched and in flight.
+func (o *offsets) track(msgs []kafka.Message) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, msg := range msgs {
+		tracked := o.partitions[msg.Partition]
+		if n := len(tracked); n > 0 && msg.Offset <= tracked[n-1].offset {
+			// The reader went back to the committed offset after a
+			// rebalance: what was in flight is being fetched again.
+			tracked = nil
+		}
+		o.partitions[msg.Partition] = append(tracked, trackedOffset{offset: msg.Offset})
+		o.topic[msg.Partition] = msg.Topic
+	}
+}
+
+// commit marks msgs settled or not and commits every partition of msgs up
+// to its first message that isn't settled.
+func (o *offsets) commit(msgs []kafka.Message, settled []bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	touched := map[int]bool{}
+	for i, msg := range msgs {
+		tracked := o.partitions[msg.Partition]
+		j := sort.Search(len(tracked), func(j int) bool { return tracked[j].offset >= msg.Offset })
+		if j == len(tracked) || tracked[j].offset != msg.Offset {
+			// No longer tracked after a rebalance.
+			continue
+		}
+		tracked[j].state = offsetSettled
+		if !settled[i] {
+			tracked[j].state = offsetUnsettled
+			o.logger.WithFields(logrus.Fields{
+				"topic":     msg.Topic,
+				"partition": msg.Partition,
+				"offset":    msg.Offset,
+			}).Error("kafka: message not settled, holding back commits of its partition")
+		}
+		touched[msg.Partition] = true
+	}
+
+	var commit []kafka.Message
+	for partition := range touched {
+		tracked := o.partitions[partition]
+		n := 0
+		for n < len(tracked) && tracked[n].state == offsetSettled {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		commit = append(commit, kafka.Message{
+			Topic:     o.topic[partition],
+			Partition: partition,
+			Offset:    tracked[n-1].offset,
+		})
+		o.partitions[partition] = tracked[n:]
+	}
+	if len(commit) == 0 {
+		return
+	}
+	// Committed under o.mu so a later offset can't be committed before an
+	// earlier one.
+	if err := o.reader.CommitMessages(context.Background(), commit...); err != nil {
+		o.logger.WithError(err).Error("kafka: commit failed")
+	}
+}
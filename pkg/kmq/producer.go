@@ -4,11 +4,20 @@ import (
 	"context"
 	"time"
 
+	"github.com/mercury/pkg/tracing"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// kafkaWriter is the part of *kafka.Writer the producer uses.
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
 type Producer struct {
-	writer *kafka.Writer
+	writer kafkaWriter
 }
 
 func NewProducer(brokers []string) *Producer {
@@ -27,21 +36,50 @@ func (p *Producer) Close() error {
 	return p.writer.Close()
 }
 
+// Produce copies original to topic, keeping its key so it lands on the
+// same partition, and propagates the span and request ID in ctx through its
+// headers.
 func (p *Producer) Produce(
 	ctx context.Context,
 	topic string,
 	original kafka.Message,
 ) error {
+	return p.produce(ctx, topic, original)
+}
+
+// produce is Produce with extra headers, each replacing any header of the
+// same key on original.
+func (p *Producer) produce(
+	ctx context.Context,
+	topic string,
+	original kafka.Message,
+	extra ...kafka.Header,
+) (err error) {
+	ctx, span := tracing.Start(ctx, topic+" publish", trace.SpanKindProducer,
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", topic),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	// Copy the headers so the caller's message isn't modified by the
+	// extra headers or the injected traceparent.
+	headers := make([]kafka.Header, 0, len(original.Headers)+len(extra)+2)
+	headers = append(headers, original.Headers...)
+	carrier := headerCarrier{&headers}
+	for _, h := range extra {
+		carrier.Set(h.Key, string(h.Value))
+	}
+	tracing.Inject(ctx, carrier)
+	if id := tracing.RequestID(ctx); id != "" {
+		carrier.Set(tracing.HeaderRequestID, id)
+	}
 
 	newMsg := kafka.Message{
-		Topic: topic,
-		Key:   original.Key, // preserve partitioning
-		Value: original.Value,
-		Headers: append(original.Headers, kafka.Header{
-			Key:   "x-retry-at",
-			Value: []byte(time.Now().UTC().Format(time.RFC3339)),
-		}),
-		Time: time.Now(),
+		Topic:   topic,
+		Key:     original.Key, // preserve partitioning
+		Value:   original.Value,
+		Headers: headers,
+		Time:    time.Now(),
 	}
 
 	return p.writer.WriteMessages(ctx, newMsg)
@@ -0,0 +1,41 @@
+package kmq
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/mercury/pkg/instrumentation/metrics"
+	"github.com/mercury/pkg/tracing"
+	"github.com/segmentio/kafka-go"
+	"github.com/sirupsen/logrus"
+)
+
+// UseRecover turns a panic in the handler into a Retry, logging the stack
+// with the request ID and counting it as kmq.panic. Consume always applies it
+// closest to the handler, so the logger and metrics set by the other
+// middlewares are in ctx.
+func UseRecover() Middleware {
+	return func(queue string, next Handler) Handler {
+		return func(ctx context.Context, msg kafka.Message) (res Result, err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				LoggerFromContext(ctx).WithFields(logrus.Fields{
+					"queue":      queue,
+					"request_id": tracing.RequestID(ctx),
+					"panic":      fmt.Sprint(r),
+					"stack":      string(debug.Stack()),
+				}).Error("kafka: handler panicked")
+				MetricsFromContext(ctx).Incr("kmq.panic", 1,
+					metrics.StringTag("topic", msg.Topic),
+					metrics.StringTag("queue", queue),
+				)
+				res, err = Retry, nil
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package kmq
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers written on messages that are retried or dead-lettered.
+const (
+	HeaderAttempts       = "x-attempts"
+	HeaderRetryAt        = "x-retry-at"
+	HeaderLastError      = "x-last-error"
+	HeaderOriginalTopic  = "x-original-topic"
+	HeaderDeadLetteredAt = "x-dead-lettered-at"
+)
+
+// backoff returns the delay before the given retry (1-based).
+func (o ConsumerOpt) backoff(attempt int) time.Duration {
+	d := o.BackoffBase
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= o.BackoffMax {
+			return o.BackoffMax
+		}
+	}
+	return d
+}
+
+// Attempts returns how many times msg has already been handled and failed.
+func Attempts(msg kafka.Message) int {
+	n, _ := strconv.Atoi(header(msg, HeaderAttempts))
+	return n
+}
+
+// retryAt returns when msg is due to be handled again: the time it was sent
+// to the retry topic plus the backoff for its attempt. A message without
+// x-retry-at is due at once.
+func (o ConsumerOpt) retryAt(msg kafka.Message) time.Time {
+	failedAt, err := time.Parse(time.RFC3339Nano, header(msg, HeaderRetryAt))
+	if err != nil {
+		return time.Time{}
+	}
+	return failedAt.Add(o.backoff(max(Attempts(msg), 1)))
+}
+
+// waitUntil sleeps until t or until ctx is done.
+func waitUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func header(msg kafka.Message, key string) string {
+	return headerCarrier{&msg.Headers}.Get(key)
+}
+
+// retryOrDeadLetter sends a failed message to the retry topic, or to the
+// dead-letter topic once it has used up its attempts or when dead is set.
+// cause may be nil when the handler returned Retry or DeadLetter on its own.
+func (c *kmqConsumer) retryOrDeadLetter(ctx context.Context, msg kafka.Message, dead bool, cause error) error {
+	attempt := Attempts(msg) + 1
+	headers := []kafka.Header{
+		{Key: HeaderAttempts, Value: []byte(strconv.Itoa(attempt))},
+		{Key: HeaderOriginalTopic, Value: []byte(c.topic)},
+	}
+	if cause != nil {
+		headers = append(headers, kafka.Header{Key: HeaderLastError, Value: []byte(cause.Error())})
+	}
+	now := time.Now().UTC()
+	if dead || attempt >= c.opt.MaxAttempts {
+		headers = append(headers, kafka.Header{Key: HeaderDeadLetteredAt, Value: []byte(now.Format(time.RFC3339Nano))})
+		if err := c.producer.produce(ctx, c.opt.DeadLetterTopic, msg, headers...); err != nil {
+			return err
+		}
+		c.logger.WithContext(ctx).
+			WithField("topic", c.topic).
+			WithField("attempts", attempt).
+			WithError(cause).
+			Error("kafka: message dead-lettered")
+		return nil
+	}
+	headers = append(headers, kafka.Header{Key: HeaderRetryAt, Value: []byte(now.Format(time.RFC3339Nano))})
+	return c.producer.produce(ctx, c.opt.RetryTopic, msg, headers...)
+}
@@ -0,0 +1,198 @@
+package kmq
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mercury/pkg/rmq"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestConsumerOpt_withDefaults_namesTopicsAfterTopic(t *testing.T) {
+	opt := ConsumerOpt{}.withDefaults("chat")
+	if opt.RetryTopic != "chat.retry" || opt.DeadLetterTopic != "chat.dlq" {
+		t.Fatalf("expected chat.retry and chat.dlq, got %s and %s", opt.RetryTopic, opt.DeadLetterTopic)
+	}
+	if opt.MaxAttempts != defaultMaxAttempts || opt.Workers != 1 || opt.BatchSize != 1 {
+		t.Fatalf("unexpected defaults %+v", opt)
+	}
+	opt = ConsumerOpt{RetryTopic: "r", DeadLetterTopic: "d"}.withDefaults("chat")
+	if opt.RetryTopic != "r" || opt.DeadLetterTopic != "d" {
+		t.Fatalf("expected configured topics to be kept, got %s and %s", opt.RetryTopic, opt.DeadLetterTopic)
+	}
+}
+
+func TestConsumerOpt_backoff_doublesAndCaps(t *testing.T) {
+	opt := ConsumerOpt{BackoffBase: time.Second, BackoffMax: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := opt.backoff(i + 1); got != w {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, w, got)
+		}
+	}
+}
+
+func TestConsumerOpt_retryAt_addsBackoffForAttempt(t *testing.T) {
+	opt := ConsumerOpt{BackoffBase: time.Second, BackoffMax: time.Minute}
+	failedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	msg := kafka.Message{Headers: []kafka.Header{
+		{Key: HeaderAttempts, Value: []byte("3")},
+		{Key: HeaderRetryAt, Value: []byte(failedAt.Format(time.RFC3339Nano))},
+	}}
+	if got := opt.retryAt(msg); !got.Equal(failedAt.Add(4 * time.Second)) {
+		t.Fatalf("expected the third retry 4s after the failure, got %s", got)
+	}
+	if got := opt.retryAt(kafka.Message{}); !got.IsZero() {
+		t.Fatalf("expected a message without x-retry-at to be due at once, got %s", got)
+	}
+}
+
+func TestConsume_routesByOutcome(t *testing.T) {
+	cases := []struct {
+		name     string
+		attempts int // x-attempts on the incoming message
+		res      Result
+		err      error
+		// topic is where the message goes, "" when it is only committed.
+		topic    string
+		attempt  string
+		lastErr  string
+		deadline bool
+	}{
+		{name: "success", res: Success},
+		{name: "retry result", res: Retry, topic: "topic.retry", attempt: "1"},
+		{name: "retryable error", err: errors.New("cassandra timeout"), topic: "topic.retry", attempt: "1", lastErr: "cassandra timeout"},
+		{name: "dead letter result", res: DeadLetter, topic: "topic.dlq", attempt: "1", deadline: true},
+		{name: "permanent error", err: rmq.Permanent(errors.New("corrupt")), topic: "topic.dlq", attempt: "1", lastErr: "corrupt", deadline: true},
+		{name: "client error", err: rmq.NewError(400, "bad request"), topic: "topic.dlq", attempt: "1", lastErr: "bad request", deadline: true},
+		{name: "retry on last attempt", attempts: 2, res: Retry, topic: "topic.dlq", attempt: "3", deadline: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// A long backoff keeps the retry loop from handling the message again.
+			c, b := newTestConsumer(t, ConsumerOpt{MaxAttempts: 3, BackoffBase: time.Hour})
+			c.Consume(func(context.Context, kafka.Message) (Result, error) {
+				return tc.res, tc.err
+			})
+			msg := kafka.Message{Key: []byte("conv-1"), Value: []byte("hi")}
+			if tc.attempts > 0 {
+				msg.Headers = []kafka.Header{{Key: HeaderAttempts, Value: []byte(strconv.Itoa(tc.attempts))}}
+			}
+			b.send("topic", msg)
+			main := b.reader("topic")
+			waitFor(t, func() bool { return main.committedOffset(0) == 1 })
+
+			for _, topic := range []string{"topic.retry", "topic.dlq"} {
+				got := b.messages(topic)
+				if topic != tc.topic {
+					if len(got) != 0 {
+						t.Fatalf("expected nothing on %s, got %d messages", topic, len(got))
+					}
+					continue
+				}
+				if len(got) != 1 {
+					t.Fatalf("expected one message on %s, got %d", topic, len(got))
+				}
+				out := got[0]
+				if string(out.Key) != "conv-1" || string(out.Value) != "hi" {
+					t.Fatalf("expected key and value to be kept, got %q/%q", out.Key, out.Value)
+				}
+				if a := header(out, HeaderAttempts); a != tc.attempt {
+					t.Fatalf("expected x-attempts %s, got %q", tc.attempt, a)
+				}
+				if e := header(out, HeaderLastError); e != tc.lastErr {
+					t.Fatalf("expected x-last-error %q, got %q", tc.lastErr, e)
+				}
+				if o := header(out, HeaderOriginalTopic); o != "topic" {
+					t.Fatalf("expected x-original-topic topic, got %q", o)
+				}
+				if d := header(out, HeaderDeadLetteredAt) != ""; d != tc.deadline {
+					t.Fatalf("expected x-dead-lettered-at set: %v, got %v", tc.deadline, d)
+				}
+				if r := header(out, HeaderRetryAt) != ""; r == tc.deadline {
+					t.Fatalf("expected x-retry-at only on retries, got %v", r)
+				}
+			}
+		})
+	}
+}
+
+func TestConsume_retriesUntilDeadLettered(t *testing.T) {
+	c, b := newTestConsumer(t, ConsumerOpt{MaxAttempts: 3, BackoffBase: time.Millisecond})
+	var calls atomic.Int32
+	c.Consume(func(context.Context, kafka.Message) (Result, error) {
+		calls.Add(1)
+		return Retry, nil
+	})
+	b.send("topic", kafka.Message{Key: []byte("conv-1"), Value: []byte("hi")})
+	waitFor(t, func() bool { return len(b.messages("topic.dlq")) == 1 })
+
+	if got := calls.Load(); got != 3 {
+		t.Fatalf("expected the handler to run MaxAttempts times, got %d", got)
+	}
+	retries := b.messages("topic.retry")
+	if len(retries) != 2 || header(retries[0], HeaderAttempts) != "1" || header(retries[1], HeaderAttempts) != "2" {
+		t.Fatalf("expected retries with x-attempts 1 and 2, got %d messages", len(retries))
+	}
+	if got := header(b.messages("topic.dlq")[0], HeaderAttempts); got != "3" {
+		t.Fatalf("expected the dead letter to carry x-attempts 3, got %q", got)
+	}
+	waitFor(t, func() bool { return b.reader("topic.retry").committedOffset(0) == 2 })
+}
+
+func TestConsume_holdsRetryUntilDue(t *testing.T) {
+	const backoff = 150 * time.Millisecond
+	c, b := newTestConsumer(t, ConsumerOpt{MaxAttempts: 3, BackoffBase: backoff})
+	var mu sync.Mutex
+	handled := map[string]time.Time{}
+	c.Consume(func(_ context.Context, msg kafka.Message) (Result, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[string(msg.Key)] = time.Now()
+		return Success, nil
+	})
+
+	retry := func(key string, failedAt time.Time) {
+		b.send("topic.retry", kafka.Message{Key: []byte(key), Headers: []kafka.Header{
+			{Key: HeaderAttempts, Value: []byte("1")},
+			{Key: HeaderRetryAt, Value: []byte(failedAt.Format(time.RFC3339Nano))},
+		}})
+	}
+	start := time.Now()
+	retry("due", start.Add(-time.Hour))
+	retry("held", start)
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(handled) == 2
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if d := handled["due"].Sub(start); d >= backoff {
+		t.Fatalf("expected an overdue retry to be handled at once, took %s", d)
+	}
+	if d := handled["held"].Sub(start); d < backoff {
+		t.Fatalf("expected the retry to wait for its %s backoff, handled after %s", backoff, d)
+	}
+}
+
+func TestConsume_retriesDisabled_deadLettersFirstFailure(t *testing.T) {
+	c, b := newTestConsumer(t, ConsumerOpt{MaxAttempts: 1})
+	if c.retryReader != nil {
+		t.Fatal("expected no retry reader when retries are disabled")
+	}
+	c.Consume(func(context.Context, kafka.Message) (Result, error) {
+		return Retry, nil
+	})
+	b.send("topic", kafka.Message{Key: []byte("conv-1")})
+	waitFor(t, func() bool { return len(b.messages("topic.dlq")) == 1 })
+	if got := len(b.messages("topic.retry")); got != 0 {
+		t.Fatalf("expected nothing on the retry topic, got %d", got)
+	}
+}
@@ -0,0 +1,54 @@
+package kmq
+
+import (
+	"context"
+
+	"github.com/mercury/pkg/tracing"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerCarrier adapts kafka message headers to propagation.TextMapCarrier.
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+func (h headerCarrier) Get(key string) string {
+	for _, hdr := range *h.headers {
+		if hdr.Key == key {
+			return string(hdr.Value)
+		}
+	}
+	return ""
+}
+
+// Set replaces an existing header so a re-produced message carries only the
+// latest traceparent.
+func (h headerCarrier) Set(key, value string) {
+	for i, hdr := range *h.headers {
+		if hdr.Key == key {
+			(*h.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*h.headers = append(*h.headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*h.headers))
+	for _, hdr := range *h.headers {
+		keys = append(keys, hdr.Key)
+	}
+	return keys
+}
+
+func startProcessSpan(ctx context.Context, msg kafka.Message) (context.Context, trace.Span) {
+	ctx = tracing.Extract(ctx, headerCarrier{&msg.Headers})
+	return tracing.Start(ctx, msg.Topic+" process", trace.SpanKindConsumer,
+		attribute.String("messaging.system", "kafka"),
+		attribute.String("messaging.destination.name", msg.Topic),
+		attribute.Int("messaging.kafka.destination.partition", msg.Partition),
+		attribute.Int64("messaging.kafka.message.offset", msg.Offset),
+	)
+}
@@ -0,0 +1,53 @@
+package kmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mercury/pkg/tracing"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestProduce_carriesRequestIDToConsumer(t *testing.T) {
+	c, b := newTestConsumer(t, ConsumerOpt{})
+	ids := make(chan string, 2)
+	c.Consume(func(ctx context.Context, _ kafka.Message) (Result, error) {
+		ids <- tracing.RequestID(ctx)
+		return Success, nil
+	})
+	next := func() string {
+		t.Helper()
+		select {
+		case id := <-ids:
+			return id
+		case <-time.After(2 * time.Second):
+			t.Fatal("handler was not called")
+			return ""
+		}
+	}
+
+	p := &Producer{writer: b}
+	ctx := tracing.WithRequestID(context.Background(), "req-1")
+	original := kafka.Message{
+		Value:   []byte("body"),
+		Headers: []kafka.Header{{Key: tracing.HeaderRequestID, Value: []byte("stale")}},
+	}
+	if err := p.Produce(ctx, "topic", original); err != nil {
+		t.Fatal(err)
+	}
+	written := b.messages("topic")
+	if got := (headerCarrier{&written[0].Headers}).Get(tracing.HeaderRequestID); got != "req-1" {
+		t.Fatalf("expected request ID %q in headers, got %q", "req-1", got)
+	}
+	if got := next(); got != "req-1" {
+		t.Fatalf("expected the producer's request ID, got %q", got)
+	}
+
+	if err := p.Produce(context.Background(), "topic", kafka.Message{Value: []byte("body")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(); got == "" {
+		t.Fatal("expected a new request ID for a message without one")
+	}
+}
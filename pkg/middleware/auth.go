@@ -27,18 +27,59 @@ type Claims struct {
 	jwt.StandardClaims
 }
 
-// UseAuth validates a JWT from the session cookie and stores claims in context.
-func UseAuth(pubKey *rsa.PublicKey, requirements ...Requirement) echo.MiddlewareFunc {
+// KeySet gives the public key a token was signed with, by the key ID (kid)
+// in its header. config.KeyRing follows rotated keys; config.Keys is a
+// single fixed key.
+type KeySet interface {
+	PublicKey(kid string) (*rsa.PublicKey, error)
+}
+
+// keyLister is a KeySet that can list its keys, like config.KeyRing.
+// Tokens signed before key IDs were added have no kid, and are verified
+// against each key so they outlive the first rotation.
+type keyLister interface {
+	AllPublicKeys() []*rsa.PublicKey
+}
+
+// UseAuth validates a JWT from the Authorization header or the session
+// cookie and stores claims in context.
+func UseAuth(keys KeySet, requirements ...Requirement) echo.MiddlewareFunc {
+	return UseAuthWithOpt(keys, AuthOpt{}, requirements...)
+}
+
+// AuthOpt configures UseAuthWithOpt.
+type AuthOpt struct {
+	// Extractors are tried in order; the first that finds a token decides,
+	// so an invalid bearer token isn't rescued by a valid cookie. Defaults
+	// to DefaultTokenExtractors.
+	Extractors []TokenExtractor
+	// Optional lets requests without a token through without claims, for
+	// handlers that authenticate otherwise, like a WebSocket's first frame.
+	// A token that doesn't validate is still rejected.
+	Optional bool
+}
+
+// UseAuthWithOpt validates a JWT found by opt's extractors and stores claims
+// in context. The extractor that found it is logged as auth_source.
+func UseAuthWithOpt(keys KeySet, opt AuthOpt, requirements ...Requirement) echo.MiddlewareFunc {
 	reqs := append(requirements, EnforceTimes)
+	extractors := opt.Extractors
+	if len(extractors) == 0 {
+		extractors = DefaultTokenExtractors
+	}
 
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			cookie, err := c.Cookie(SessionCookieName)
-			if err != nil {
+			token, source := extractToken(c, extractors)
+			if token == "" {
+				if opt.Optional {
+					return next(c)
+				}
 				return echo.NewHTTPError(http.StatusUnauthorized, "unauthorized")
 			}
+			setAuthSource(c, source)
 
-			claims, err := ValidateToken(cookie.Value, pubKey)
+			claims, err := ValidateToken(token, keys)
 			if err != nil {
 				return echo.NewHTTPError(http.StatusUnauthorized, "unauthorized")
 			}
@@ -101,7 +142,7 @@ func EnforceRoles(roles ...string) Requirement {
 
 // UseAuthRedirect redirects unauthenticated users to the given login URL.
 // API routes (prefixed with "api/") are skipped and handled by UseAuth instead.
-func UseAuthRedirect(pubKey *rsa.PublicKey, loginURL string) echo.MiddlewareFunc {
+func UseAuthRedirect(keys KeySet, loginURL string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			path := c.Request().URL.Path
@@ -128,7 +169,7 @@ func UseAuthRedirect(pubKey *rsa.PublicKey, loginURL string) echo.MiddlewareFunc
 				return c.Redirect(http.StatusFound, redirect)
 			}
 
-			_, err = ValidateToken(cookie.Value, pubKey)
+			_, err = ValidateToken(cookie.Value, keys)
 			if err != nil {
 				redirect := loginURL + "?redirect=" + url.QueryEscape(fullURL)
 				return c.Redirect(http.StatusFound, redirect)
@@ -141,14 +182,14 @@ func UseAuthRedirect(pubKey *rsa.PublicKey, loginURL string) echo.MiddlewareFunc
 
 // AuthCallbackHandler returns a handler that reads a JWT from the "token" query param,
 // validates it, sets the session cookie on this service's domain, and redirects to "/".
-func AuthCallbackHandler(pubKey *rsa.PublicKey) echo.HandlerFunc {
+func AuthCallbackHandler(keys KeySet) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		tokenStr := c.QueryParam("token")
 		if tokenStr == "" {
 			return echo.NewHTTPError(http.StatusBadRequest, "missing token")
 		}
 
-		claims, err := ValidateToken(tokenStr, pubKey)
+		claims, err := ValidateToken(tokenStr, keys)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusUnauthorized, "invalid token")
 		}
@@ -164,14 +205,25 @@ func AuthCallbackHandler(pubKey *rsa.PublicKey) echo.HandlerFunc {
 	}
 }
 
-// ValidateToken parses and validates a JWT token string.
-func ValidateToken(tokenString string, pubKey *rsa.PublicKey) (*Claims, error) {
+// ValidateToken parses and validates a JWT token string, verifying it with
+// the key of keys its kid header names. A token without kid is verified
+// against every key of a KeySet that lists them.
+func ValidateToken(tokenString string, keys KeySet) (*Claims, error) {
 	if tokenString == "" {
 		return nil, errors.New("invalid token")
 	}
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
-		return pubKey, nil
+	var kid string
+	token, err := parseToken(tokenString, func(token *jwt.Token) (any, error) {
+		kid, _ = token.Header["kid"].(string)
+		return keys.PublicKey(kid)
 	})
+	if lister, ok := keys.(keyLister); ok && err != nil && kid == "" {
+		for _, pub := range lister.AllPublicKeys() {
+			if token, err = parseToken(tokenString, func(*jwt.Token) (any, error) { return pub, nil }); err == nil {
+				break
+			}
+		}
+	}
 	if err != nil {
 		fmt.Println(err.Error())
 		return nil, err
@@ -186,8 +238,19 @@ func ValidateToken(tokenString string, pubKey *rsa.PublicKey) (*Claims, error) {
 	return claims, nil
 }
 
+// parseToken parses an RS* signed token, verifying it with the key keyFunc
+// returns.
+func parseToken(tokenString string, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return keyFunc(token)
+	})
+}
+
 // extractClaims returns claims from context (set by UseAuth) if present,
-// or decodes the session cookie JWT without signature verification.
+// or decodes the bearer or session cookie JWT without signature verification.
 // Signature verification is intentionally skipped — this is for identification only.
 // Auth middleware handles actual verification.
 func extractClaims(c echo.Context) *Claims {
@@ -196,11 +259,8 @@ func extractClaims(c echo.Context) *Claims {
 		return claims
 	}
 
-	cookie, err := c.Cookie(SessionCookieName)
-	if err != nil || cookie.Value == "" {
-		return nil
-	}
-	parts := strings.SplitN(cookie.Value, ".", 3)
+	token, _ := extractToken(c, DefaultTokenExtractors)
+	parts := strings.SplitN(token, ".", 3)
 	if len(parts) != 3 {
 		return nil
 	}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// testKeys is a KeySet of a single key, whatever the kid.
+type testKeys struct {
+	pub *rsa.PublicKey
+}
+
+func (k testKeys) PublicKey(string) (*rsa.PublicKey, error) {
+	return k.pub, nil
+}
+
+func newTestKey(t *testing.T) (*rsa.PrivateKey, KeySet) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, testKeys{pub: &key.PublicKey}
+}
+
+// signToken returns a token for username, who is also its user ID, signed
+// with key and expiring after ttl; a negative ttl makes it expired.
+func signToken(t *testing.T, key *rsa.PrivateKey, username string, ttl time.Duration) string {
+	t.Helper()
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, &Claims{
+		Username: username,
+		UserID:   username,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  now.Add(-time.Minute).Unix(),
+			ExpiresAt: now.Add(ttl).Unix(),
+		},
+	}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// serveAuth runs req through UseAuthWithOpt and returns the status and the
+// username the handler saw, "" if it had no claims.
+func serveAuth(keys KeySet, opt AuthOpt, req *http.Request) (int, string) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	var username string
+	err := UseAuthWithOpt(keys, opt)(func(c echo.Context) error {
+		if claims := GetClaims(c); claims != nil {
+			username = claims.Username
+		}
+		return c.NoContent(http.StatusOK)
+	})(c)
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code, ""
+	}
+	return rec.Code, username
+}
+
+func TestUseAuthWithOpt(t *testing.T) {
+	key, keys := newTestKey(t)
+	valid := signToken(t, key, "alice", time.Hour)
+	cookie := signToken(t, key, "bob", time.Hour)
+	expired := signToken(t, key, "alice", -time.Minute)
+
+	cases := []struct {
+		name     string
+		opt      AuthOpt
+		header   string
+		cookie   string
+		status   int
+		username string
+	}{
+		{name: "bearer", header: "Bearer " + valid, status: http.StatusOK, username: "alice"},
+		{name: "cookie", cookie: cookie, status: http.StatusOK, username: "bob"},
+		{name: "bearer before cookie", header: "Bearer " + valid, cookie: cookie, status: http.StatusOK, username: "alice"},
+		{name: "invalid bearer not rescued by cookie", header: "Bearer garbage", cookie: cookie, status: http.StatusUnauthorized},
+		{name: "expired bearer not rescued by cookie", header: "Bearer " + expired, cookie: cookie, status: http.StatusUnauthorized},
+		{name: "other scheme falls through to cookie", header: "Basic dXNlcjpwdw==", cookie: cookie, status: http.StatusOK, username: "bob"},
+		{name: "no token", status: http.StatusUnauthorized},
+		{name: "optional without token", opt: AuthOpt{Optional: true}, status: http.StatusOK},
+		{name: "optional with invalid token", opt: AuthOpt{Optional: true}, header: "Bearer garbage", status: http.StatusUnauthorized},
+		{name: "optional with expired token", opt: AuthOpt{Optional: true}, cookie: expired, status: http.StatusUnauthorized},
+		{name: "optional with valid token", opt: AuthOpt{Optional: true}, header: "Bearer " + valid, status: http.StatusOK, username: "alice"},
+		{name: "cookie only extractor ignores bearer", opt: AuthOpt{Extractors: []TokenExtractor{CookieToken(SessionCookieName)}}, header: "Bearer " + valid, status: http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+			if tc.header != "" {
+				req.Header.Set(echo.HeaderAuthorization, tc.header)
+			}
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: tc.cookie})
+			}
+			status, username := serveAuth(keys, tc.opt, req)
+			if status != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, status)
+			}
+			if username != tc.username {
+				t.Fatalf("expected claims for %q, got %q", tc.username, username)
+			}
+		})
+	}
+}
+
+func TestUseAuthWithOpt_rejectsTokenSignedWithOtherKey(t *testing.T) {
+	key, _ := newTestKey(t)
+	_, otherKeys := newTestKey(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+signToken(t, key, "alice", time.Hour))
+	if status, _ := serveAuth(otherKeys, AuthOpt{}, req); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", status)
+	}
+}
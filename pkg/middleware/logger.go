@@ -3,27 +3,33 @@ package middleware
 import (
 	"net/http"
 
-	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/mercury/pkg/tracing"
 	"github.com/sirupsen/logrus"
 )
 
 const ContextKeyLogger = "Logger"
 
-// UseLogger adds a structured logger to the request context.
+// UseLogger adds a structured logger to the request context. The request
+// is logged under the X-Request-ID it came with, or a new one, which is
+// echoed in the response and stored in the request context so rmq and kmq
+// pass it on to other services.
 func UseLogger(logger *logrus.Logger, environment string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			req := c.Request()
+			requestID := tracing.EnsureRequestID(req.Header.Get(tracing.HeaderRequestID))
+			c.Response().Header().Set(tracing.HeaderRequestID, requestID)
+			req = req.WithContext(tracing.WithRequestID(req.Context(), requestID))
+			c.SetRequest(req)
 			log := logger.WithContext(req.Context())
-			correlationID := uuid.New().String()
 			log = log.WithFields(logrus.Fields{
 				"content_length": req.ContentLength,
 				"method":         req.Method,
 				"rpath":          c.Path(),
 				"path":           req.URL.Path,
 				"raw_query":      req.URL.RawQuery,
-				"correlation_id": correlationID,
+				"request_id":     requestID,
 				"environment":    environment,
 			})
 			c.Set(ContextKeyLogger, log)
@@ -36,7 +42,9 @@ func UseLogger(logger *logrus.Logger, environment string) echo.MiddlewareFunc {
 					status = http.StatusInternalServerError
 				}
 			}
-			log.WithFields(logrus.Fields{
+			// Handlers and later middleware may have added fields, like
+			// UseAuth's auth_source.
+			GetLogger(c).WithFields(logrus.Fields{
 				"status": status,
 			}).Info("request")
 			return err
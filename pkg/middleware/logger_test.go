@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercury/pkg/tracing"
+	"github.com/sirupsen/logrus"
+)
+
+// serveLogged runs req through UseLogger and returns the response and the
+// request ID the handler found in its request context.
+func serveLogged(t *testing.T, req *http.Request) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	e := echo.New()
+	var seen string
+	e.GET("/ping", func(c echo.Context) error {
+		seen = tracing.RequestID(c.Request().Context())
+		return c.NoContent(http.StatusOK)
+	}, UseLogger(logger, "test"))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec, seen
+}
+
+func TestUseLogger_keepsInboundRequestID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	req.Header.Set(tracing.HeaderRequestID, "abc-123")
+	rec, seen := serveLogged(t, req)
+	if seen != "abc-123" {
+		t.Fatalf("expected the handler to see %q, got %q", "abc-123", seen)
+	}
+	if got := rec.Header().Get(tracing.HeaderRequestID); got != "abc-123" {
+		t.Fatalf("expected %q echoed in the response, got %q", "abc-123", got)
+	}
+}
+
+func TestUseLogger_generatesRequestID(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+	}{
+		{name: "missing"},
+		{name: "not printable", header: "abc\x01"},
+		{name: "too long", header: strings.Repeat("a", 129)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			if tc.header != "" {
+				req.Header.Set(tracing.HeaderRequestID, tc.header)
+			}
+			rec, seen := serveLogged(t, req)
+			if seen == "" || seen == tc.header {
+				t.Fatalf("expected a new request ID, got %q", seen)
+			}
+			if got := rec.Header().Get(tracing.HeaderRequestID); got != seen {
+				t.Fatalf("expected %q echoed in the response, got %q", seen, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercury/pkg/instrumentation/metrics"
+)
+
+const ContextKeyMetrics = "Metrics"
+
+// UseMetrics counts and times requests by method and route. WebSocket
+// routes are timed for the whole session.
+func UseMetrics(m metrics.Metrics) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(ContextKeyMetrics, m)
+			start := time.Now()
+
+			defer func() {
+				duration := time.Since(start)
+				method := c.Request().Method
+				path := c.Path()
+				status := c.Response().Status
+
+				tags := []metrics.Tag{
+					metrics.StringTag("method", method),
+					metrics.StringTag("path", path),
+				}
+
+				m.Incr("http.request.count", 1, tags...)
+				m.Incr("http.response.status", 1, append(tags, metrics.IntTag("status", status))...)
+				m.Timing("http.request.duration", duration, tags...)
+			}()
+
+			return next(c)
+		}
+	}
+}
+
+func GetMetrics(c echo.Context) metrics.Metrics {
+	m, ok := c.Get(ContextKeyMetrics).(metrics.Metrics)
+	if !ok || m == nil {
+		return metrics.Discard
+	}
+	return m
+}
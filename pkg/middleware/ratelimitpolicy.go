@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercury/pkg/ratelimit"
+	"go.yaml.in/yaml/v3"
+)
+
+// RateLimitRule is the limits of one scope. Anonymous requests are counted
+// per client IP, authenticated ones per user ID. A rule setting only one of
+// Anonymous and User applies it to both, so a route limited by IP can't be
+// escaped by signing in. Roles raises or lowers User for users with one of
+// the roles; with several, the highest rate wins.
+type RateLimitRule struct {
+	Anonymous ratelimit.Rate            `yaml:"anonymous"`
+	User      ratelimit.Rate            `yaml:"user"`
+	Roles     map[string]ratelimit.Rate `yaml:"roles"`
+}
+
+// rate returns the rule's rate for the user of claims, or for an anonymous
+// request when claims is nil.
+func (r RateLimitRule) rate(claims *Claims) ratelimit.Rate {
+	anon, user := r.Anonymous, r.User
+	if anon.IsZero() {
+		anon = user
+	}
+	if user.IsZero() {
+		user = anon
+	}
+	if claims == nil {
+		return anon
+	}
+	var best ratelimit.Rate
+	for _, role := range claims.Roles {
+		if rate, ok := r.Roles[role]; ok && (best.IsZero() || rate.PerSecond() > best.PerSecond()) {
+			best = rate
+		}
+	}
+	if !best.IsZero() {
+		return best
+	}
+	return user
+}
+
+// RateLimitPolicy is the limits UseRateLimits enforces. Every request is
+// counted against Default and, when its route has one, against the route's
+// rule in Routes, keyed "METHOD /path" with the path as registered, like
+// "POST /api/v1/messages" or "GET /api/v1/mm/join/party/:partyid".
+type RateLimitPolicy struct {
+	Default RateLimitRule            `yaml:"default"`
+	Routes  map[string]RateLimitRule `yaml:"routes"`
+}
+
+// ParseRateLimitPolicy reads a policy from YAML:
+//
+//	default:
+//	  anonymous: 300/1m
+//	  user: 600/1m
+//	  roles:
+//	    premium: 1200/1m
+//	routes:
+//	  POST /api/v1/auth/login:
+//	    anonymous: 10/1m
+func ParseRateLimitPolicy(s string) (*RateLimitPolicy, error) {
+	var p RateLimitPolicy
+	dec := yaml.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.KnownFields(true)
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("rate limit policy: %w", err)
+	}
+	var errs []error
+	for route := range p.Routes {
+		method, path, ok := strings.Cut(route, " ")
+		if !ok || method != strings.ToUpper(method) || !strings.HasPrefix(path, "/") {
+			errs = append(errs, fmt.Errorf("rate limit policy: route %q: want METHOD /path", route))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return &p, nil
+}
+
+// rateLimitScope is a rule and the bucket key it counts a client under.
+type rateLimitScope struct {
+	key  string
+	rule RateLimitRule
+}
+
+// UseRateLimits enforces the policy policy returns, read on every request so
+// it can change at runtime, e.g. config.Live.Get, with token buckets in
+// backend. Users are identified by a token keys verify; a request without
+// one is anonymous. Responses carry the headers of UseRateLimit for the
+// tightest bucket.
+func UseRateLimits(backend ratelimit.Backend, keys KeySet, policy func() *RateLimitPolicy) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p := policy()
+			if p == nil {
+				return next(c)
+			}
+			claims := rateLimitClaims(c, keys)
+			client := "anon:" + c.RealIP()
+			if claims != nil {
+				client = "user:" + claims.UserID
+			}
+
+			route := c.Request().Method + " " + routePath(c)
+			scopes := []rateLimitScope{{"ratelimit:" + client, p.Default}}
+			if rule, ok := p.Routes[route]; ok {
+				scopes = append(scopes, rateLimitScope{"ratelimit:route:" + route + ":" + client, rule})
+			}
+
+			var tightest *ratelimit.Result
+			for _, s := range scopes {
+				rate := s.rule.rate(claims)
+				if rate.IsZero() {
+					continue
+				}
+				res, err := backend.Take(c.Request().Context(), ratelimit.TokenBucket, s.key, rate)
+				if err != nil {
+					// Behind a Fallback this takes Redis and the local
+					// backend both failing, or the request going away.
+					continue
+				}
+				if tightest == nil || res.Tighter(*tightest) {
+					tightest = &res
+				}
+			}
+			if tightest == nil {
+				return next(c)
+			}
+			if err := applyRateLimit(c, *tightest); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// rateLimitClaims returns the claims of the request's token if it is valid.
+// Unlike extractClaims it verifies the token: a made-up user ID would
+// otherwise get a fresh bucket.
+func rateLimitClaims(c echo.Context, keys KeySet) *Claims {
+	if claims := GetClaims(c); claims != nil {
+		return claims
+	}
+	token, _ := extractToken(c, DefaultTokenExtractors)
+	if token == "" {
+		return nil
+	}
+	claims, err := ValidateToken(token, keys)
+	if err != nil || EnforceTimes(claims) != nil {
+		return nil
+	}
+	return claims
+}
+
+// routePath returns the path the matched route was registered with, with a
+// leading slash whether or not the group prefix had one.
+func routePath(c echo.Context) string {
+	path := c.Path()
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
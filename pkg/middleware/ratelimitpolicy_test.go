@@ -0,0 +1,270 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercury/pkg/ratelimit"
+)
+
+func perMinute(n int) ratelimit.Rate {
+	return ratelimit.Rate{Limit: n, Window: time.Minute}
+}
+
+func TestRateLimitRule_rate(t *testing.T) {
+	user := &Claims{UserID: "u1"}
+	premium := &Claims{UserID: "u1", Roles: []string{"premium"}}
+	both := &Claims{UserID: "u1", Roles: []string{"trial", "premium", "staff"}}
+	trial := &Claims{UserID: "u1", Roles: []string{"trial"}}
+
+	cases := []struct {
+		name   string
+		rule   RateLimitRule
+		claims *Claims
+		want   ratelimit.Rate
+	}{
+		{name: "anonymous", rule: RateLimitRule{Anonymous: perMinute(10), User: perMinute(20)}, want: perMinute(10)},
+		{name: "user", rule: RateLimitRule{Anonymous: perMinute(10), User: perMinute(20)}, claims: user, want: perMinute(20)},
+		{name: "user falls back to anonymous", rule: RateLimitRule{Anonymous: perMinute(10)}, claims: user, want: perMinute(10)},
+		{name: "anonymous falls back to user", rule: RateLimitRule{User: perMinute(20)}, want: perMinute(20)},
+		{name: "unset", rule: RateLimitRule{}, claims: user},
+		{name: "role raises user", rule: RateLimitRule{User: perMinute(20), Roles: map[string]ratelimit.Rate{"premium": perMinute(100)}}, claims: premium, want: perMinute(100)},
+		{name: "role lowers user", rule: RateLimitRule{User: perMinute(20), Roles: map[string]ratelimit.Rate{"trial": perMinute(5)}}, claims: trial, want: perMinute(5)},
+		{name: "role without rate", rule: RateLimitRule{User: perMinute(20), Roles: map[string]ratelimit.Rate{"premium": perMinute(100)}}, claims: trial, want: perMinute(20)},
+		{name: "highest role wins", rule: RateLimitRule{User: perMinute(20), Roles: map[string]ratelimit.Rate{
+			"trial":   perMinute(5),
+			"premium": perMinute(100),
+			"staff":   {Limit: 10, Window: time.Second},
+		}}, claims: both, want: ratelimit.Rate{Limit: 10, Window: time.Second}},
+		{name: "roles ignored when anonymous", rule: RateLimitRule{Anonymous: perMinute(10), Roles: map[string]ratelimit.Rate{"premium": perMinute(100)}}, want: perMinute(10)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.rule.rate(tc.claims); got != tc.want {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseRateLimitPolicy(t *testing.T) {
+	p, err := ParseRateLimitPolicy(`
+default:
+  anonymous: 300/1m
+  user: 600/1m
+  roles:
+    premium: 1200/1m
+routes:
+  POST /api/v1/auth/login:
+    anonymous: 10/1m
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Default.Anonymous != perMinute(300) || p.Default.User != perMinute(600) || p.Default.Roles["premium"] != perMinute(1200) {
+		t.Fatalf("unexpected default rule %+v", p.Default)
+	}
+	if got := p.Routes["POST /api/v1/auth/login"].Anonymous; got != perMinute(10) {
+		t.Fatalf("expected the login route limited to 10/1m, got %v", got)
+	}
+}
+
+func TestParseRateLimitPolicy_rejectsMalformedPolicies(t *testing.T) {
+	cases := map[string]string{
+		"lower case method":  "routes:\n  post /api/v1/messages:\n    user: 1/1s\n",
+		"relative path":      "routes:\n  POST api/v1/messages:\n    user: 1/1s\n",
+		"missing method":     "routes:\n  /api/v1/messages:\n    user: 1/1s\n",
+		"missing space":      "routes:\n  POST/api/v1/messages:\n    user: 1/1s\n",
+		"bad rate":           "default:\n  user: lots\n",
+		"unknown field":      "default:\n  users: 1/1s\n",
+		"unknown rule field": "routes:\n  POST /api/v1/messages:\n    burst: 5\n",
+	}
+	for name, policy := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseRateLimitPolicy(policy); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestParseRateLimitPolicy_reportsEveryMalformedRoute(t *testing.T) {
+	_, err := ParseRateLimitPolicy("routes:\n  post /a:\n    user: 1/1s\n  GET b:\n    user: 1/1s\n")
+	if err == nil || !strings.Contains(err.Error(), `"post /a"`) || !strings.Contains(err.Error(), `"GET b"`) {
+		t.Fatalf("expected both routes reported, got %v", err)
+	}
+}
+
+// rateLimitRequest is a request through UseRateLimits.
+type rateLimitRequest struct {
+	method string
+	// route is the path the matched route was registered with.
+	route  string
+	ip     string
+	claims *Claims
+	bearer string
+}
+
+// serveRateLimits runs req through mw and returns the status and the
+// X-RateLimit-Limit and X-RateLimit-Remaining headers.
+func serveRateLimits(mw echo.MiddlewareFunc, req rateLimitRequest) (status int, limit, remaining string) {
+	r := httptest.NewRequest(req.method, "/", nil)
+	r.RemoteAddr = req.ip + ":1234"
+	if req.bearer != "" {
+		r.Header.Set(echo.HeaderAuthorization, "Bearer "+req.bearer)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(r, rec)
+	c.SetPath(req.route)
+	if req.claims != nil {
+		c.Set(ContextKeyClaims, req.claims)
+	}
+	err := mw(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})(c)
+	status = rec.Code
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		status = httpErr.Code
+	}
+	h := rec.Header()
+	return status, h.Get("X-RateLimit-Limit"), h.Get("X-RateLimit-Remaining")
+}
+
+func staticPolicy(p *RateLimitPolicy) func() *RateLimitPolicy {
+	return func() *RateLimitPolicy { return p }
+}
+
+func TestUseRateLimits_countsDefaultAndRouteReportingTightest(t *testing.T) {
+	_, keys := newTestKey(t)
+	mw := UseRateLimits(ratelimit.NewMemory(), keys, staticPolicy(&RateLimitPolicy{
+		Default: RateLimitRule{Anonymous: perMinute(5)},
+		Routes: map[string]RateLimitRule{
+			"POST /api/v1/auth/login": {Anonymous: perMinute(2)},
+		},
+	}))
+	login := rateLimitRequest{method: http.MethodPost, route: "/api/v1/auth/login", ip: "10.0.0.1"}
+
+	if status, limit, remaining := serveRateLimits(mw, login); status != http.StatusOK || limit != "2" || remaining != "1" {
+		t.Fatalf("expected the route bucket's headers 2/1, got %d %s/%s", status, limit, remaining)
+	}
+	serveRateLimits(mw, login)
+	if status, _, remaining := serveRateLimits(mw, login); status != http.StatusTooManyRequests || remaining != "0" {
+		t.Fatalf("expected the third login rejected, got %d with %s remaining", status, remaining)
+	}
+	// Every login also counted against the default bucket.
+	other := rateLimitRequest{method: http.MethodGet, route: "/api/v1/messages", ip: "10.0.0.1"}
+	if status, limit, remaining := serveRateLimits(mw, other); status != http.StatusOK || limit != "5" || remaining != "1" {
+		t.Fatalf("expected the default bucket's headers 5/1, got %d %s/%s", status, limit, remaining)
+	}
+}
+
+func TestUseRateLimits_normalizesRouteWithoutLeadingSlash(t *testing.T) {
+	_, keys := newTestKey(t)
+	mw := UseRateLimits(ratelimit.NewMemory(), keys, staticPolicy(&RateLimitPolicy{
+		Default: RateLimitRule{Anonymous: perMinute(100)},
+		Routes: map[string]RateLimitRule{
+			"GET /api/v1/mm/join/party/:partyid": {Anonymous: perMinute(1)},
+		},
+	}))
+	// Registered on a group whose prefix had no leading slash.
+	join := rateLimitRequest{method: http.MethodGet, route: "api/v1/mm/join/party/:partyid", ip: "10.0.0.1"}
+	if _, limit, _ := serveRateLimits(mw, join); limit != "1" {
+		t.Fatalf("expected the route rule to apply, got limit %s", limit)
+	}
+	if status, _, _ := serveRateLimits(mw, join); status != http.StatusTooManyRequests {
+		t.Fatalf("expected the second join rejected, got %d", status)
+	}
+	// The method is part of the key.
+	post := join
+	post.method = http.MethodPost
+	if _, limit, _ := serveRateLimits(mw, post); limit != "100" {
+		t.Fatalf("expected only the default rule for another method, got limit %s", limit)
+	}
+}
+
+func TestUseRateLimits_countsAnonymousByIPAndUsersByID(t *testing.T) {
+	key, keys := newTestKey(t)
+	_, otherKeys := newTestKey(t)
+	mw := UseRateLimits(ratelimit.NewMemory(), keys, staticPolicy(&RateLimitPolicy{
+		Default: RateLimitRule{Anonymous: perMinute(1), User: perMinute(2)},
+	}))
+	req := func(ip, bearer string) rateLimitRequest {
+		return rateLimitRequest{method: http.MethodGet, route: "/api/v1/messages", ip: ip, bearer: bearer}
+	}
+
+	if status, _, _ := serveRateLimits(mw, req("10.0.0.1", "")); status != http.StatusOK {
+		t.Fatalf("expected the first anonymous request allowed, got %d", status)
+	}
+	if status, _, _ := serveRateLimits(mw, req("10.0.0.1", "")); status != http.StatusTooManyRequests {
+		t.Fatalf("expected the second anonymous request from the IP rejected, got %d", status)
+	}
+	if status, _, _ := serveRateLimits(mw, req("10.0.0.2", "")); status != http.StatusOK {
+		t.Fatalf("expected another IP to have its own bucket, got %d", status)
+	}
+
+	alice := signToken(t, key, "alice", time.Hour)
+	if status, limit, _ := serveRateLimits(mw, req("10.0.0.1", alice)); status != http.StatusOK || limit != "2" {
+		t.Fatalf("expected alice counted under the user rate, got %d with limit %s", status, limit)
+	}
+	if status, _, _ := serveRateLimits(mw, req("10.0.0.3", alice)); status != http.StatusOK {
+		t.Fatalf("expected alice's bucket to follow her across IPs, got %d", status)
+	}
+	if status, _, _ := serveRateLimits(mw, req("10.0.0.4", alice)); status != http.StatusTooManyRequests {
+		t.Fatalf("expected alice's third request rejected, got %d", status)
+	}
+
+	// A token that doesn't verify counts as anonymous, not as its user.
+	forged := signToken(t, key, "mallory", time.Hour)
+	forgedMW := UseRateLimits(ratelimit.NewMemory(), otherKeys, staticPolicy(&RateLimitPolicy{
+		Default: RateLimitRule{Anonymous: perMinute(1), User: perMinute(2)},
+	}))
+	if _, limit, _ := serveRateLimits(forgedMW, req("10.0.0.1", forged)); limit != "1" {
+		t.Fatalf("expected an unverified token counted as anonymous, got limit %s", limit)
+	}
+}
+
+func TestUseRateLimits_appliesHighestRole(t *testing.T) {
+	_, keys := newTestKey(t)
+	mw := UseRateLimits(ratelimit.NewMemory(), keys, staticPolicy(&RateLimitPolicy{
+		Default: RateLimitRule{User: perMinute(2), Roles: map[string]ratelimit.Rate{
+			"premium": perMinute(10),
+			"staff":   perMinute(50),
+		}},
+	}))
+	staff := rateLimitRequest{method: http.MethodGet, route: "/api/v1/messages", ip: "10.0.0.1",
+		claims: &Claims{UserID: "u1", Roles: []string{"premium", "staff"}}}
+	if _, limit, _ := serveRateLimits(mw, staff); limit != "50" {
+		t.Fatalf("expected the staff rate, got limit %s", limit)
+	}
+}
+
+func TestUseRateLimits_readsPolicyOnEveryRequest(t *testing.T) {
+	_, keys := newTestKey(t)
+	var policy atomic.Pointer[RateLimitPolicy]
+	mw := UseRateLimits(ratelimit.NewMemory(), keys, policy.Load)
+	req := rateLimitRequest{method: http.MethodGet, route: "/api/v1/messages", ip: "10.0.0.1"}
+
+	if status, limit, _ := serveRateLimits(mw, req); status != http.StatusOK || limit != "" {
+		t.Fatalf("expected no limit without a policy, got %d with limit %q", status, limit)
+	}
+	policy.Store(&RateLimitPolicy{Default: RateLimitRule{Anonymous: perMinute(100)}})
+	if _, limit, _ := serveRateLimits(mw, req); limit != "100" {
+		t.Fatalf("expected the stored policy to apply, got limit %q", limit)
+	}
+	policy.Store(&RateLimitPolicy{Routes: map[string]RateLimitRule{
+		"GET /api/v1/messages": {Anonymous: perMinute(1)},
+	}})
+	if _, limit, _ := serveRateLimits(mw, req); limit != "1" {
+		t.Fatalf("expected the swapped policy to apply, got limit %q", limit)
+	}
+	if status, _, _ := serveRateLimits(mw, req); status != http.StatusTooManyRequests {
+		t.Fatalf("expected the swapped route limit enforced, got %d", status)
+	}
+}
@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+// FirstFrameTimeout is how long AuthenticateFirstFrame waits for the first
+// frame.
+var FirstFrameTimeout = 10 * time.Second
+
+// TokenExtractor finds a JWT in a request. Name is logged as auth_source
+// when it does.
+type TokenExtractor struct {
+	Name    string
+	Extract func(c echo.Context) string
+}
+
+// DefaultTokenExtractors are what UseAuth reads a token from: the
+// Authorization header, for clients without a cookie jar, then the session
+// cookie.
+var DefaultTokenExtractors = []TokenExtractor{
+	BearerToken(),
+	CookieToken(SessionCookieName),
+}
+
+// BearerToken reads an "Authorization: Bearer <token>" header.
+func BearerToken() TokenExtractor {
+	return TokenExtractor{
+		Name: "bearer",
+		Extract: func(c echo.Context) string {
+			scheme, token, ok := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") {
+				return ""
+			}
+			return strings.TrimSpace(token)
+		},
+	}
+}
+
+// CookieToken reads the cookie name.
+func CookieToken(name string) TokenExtractor {
+	return TokenExtractor{
+		Name: "cookie",
+		Extract: func(c echo.Context) string {
+			cookie, err := c.Cookie(name)
+			if err != nil {
+				return ""
+			}
+			return cookie.Value
+		},
+	}
+}
+
+// QueryToken reads the query parameter param of WebSocket upgrade requests,
+// for browsers, which can't set headers on them. It is opt-in: the token
+// ends up in proxy logs, so prefer AuthenticateFirstFrame. The request log
+// gets raw_query with the token redacted.
+func QueryToken(param string) TokenExtractor {
+	return TokenExtractor{
+		Name: "query",
+		Extract: func(c echo.Context) string {
+			if !websocket.IsWebSocketUpgrade(c.Request()) {
+				return ""
+			}
+			token := c.QueryParam(param)
+			if token != "" {
+				query := c.QueryParams()
+				query.Set(param, "REDACTED")
+				c.Set(ContextKeyLogger, GetLogger(c).WithField("raw_query", query.Encode()))
+			}
+			return token
+		},
+	}
+}
+
+// extractToken returns the token of the first extractor that finds one, and
+// that extractor's name.
+func extractToken(c echo.Context, extractors []TokenExtractor) (token, source string) {
+	for _, e := range extractors {
+		if token := e.Extract(c); token != "" {
+			return token, e.Name
+		}
+	}
+	return "", ""
+}
+
+// setAuthSource adds where the token came from to the request log.
+func setAuthSource(c echo.Context, source string) {
+	c.Set(ContextKeyLogger, GetLogger(c).WithField("auth_source", source))
+}
+
+// authFrame is the part of a WebSocket's first frame AuthenticateFirstFrame
+// reads.
+type authFrame struct {
+	Token string `json:"token"`
+}
+
+// AuthenticateFirstFrame authenticates a WebSocket upgraded without a token,
+// from a first frame of the form {"token": "eyJ...", ...}, and stores claims
+// in context like UseAuth. It returns the frame so the caller can read the
+// rest of it. On failure it closes conn with a policy violation; the caller
+// only returns.
+func AuthenticateFirstFrame(c echo.Context, conn *websocket.Conn, keys KeySet, requirements ...Requirement) (*Claims, []byte, error) {
+	claims, frame, err := readAuthFrame(conn, keys, append(requirements, EnforceTimes))
+	if err != nil {
+		conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "unauthorized"),
+			time.Now().Add(time.Second),
+		)
+		conn.Close()
+		return nil, nil, echo.NewHTTPError(http.StatusUnauthorized, "unauthorized").SetInternal(err)
+	}
+	setAuthSource(c, "first_frame")
+	c.Set(ContextKeyClaims, claims)
+	return claims, frame, nil
+}
+
+func readAuthFrame(conn *websocket.Conn, keys KeySet, reqs []Requirement) (*Claims, []byte, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(FirstFrameTimeout)); err != nil {
+		return nil, nil, err
+	}
+	_, frame, err := conn.ReadMessage()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, nil, err
+	}
+	var f authFrame
+	if err := json.Unmarshal(frame, &f); err != nil {
+		return nil, nil, err
+	}
+	if f.Token == "" {
+		return nil, nil, errors.New("first frame has no token")
+	}
+	claims, err := ValidateToken(f.Token, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range reqs {
+		if err := r(claims); err != nil {
+			return nil, nil, err
+		}
+	}
+	return claims, frame, nil
+}
@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+)
+
+func TestBearerToken_parsesAuthorizationHeader(t *testing.T) {
+	cases := []struct {
+		header string
+		want   string
+	}{
+		{header: "Bearer abc", want: "abc"},
+		{header: "bearer abc", want: "abc"},
+		{header: "BEARER abc", want: "abc"},
+		{header: "Bearer  abc ", want: "abc"},
+		{header: "Bearer", want: ""},
+		{header: "Bearer ", want: ""},
+		{header: "abc", want: ""},
+		{header: "Basic abc", want: ""},
+		// Kept whole so it fails validation rather than falling through to
+		// another extractor.
+		{header: "Bearer abc def", want: "abc def"},
+		{header: "", want: ""},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.header != "" {
+			req.Header.Set(echo.HeaderAuthorization, tc.header)
+		}
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+		if got := BearerToken().Extract(c); got != tc.want {
+			t.Errorf("%q: expected %q, got %q", tc.header, tc.want, got)
+		}
+	}
+}
+
+func TestQueryToken_onlyReadsUpgradeRequests(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ws?access_token=abc&room=1", nil)
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	if got := QueryToken("access_token").Extract(c); got != "" {
+		t.Fatalf("expected no token from a plain request, got %q", got)
+	}
+	if _, ok := GetLogger(c).Data["raw_query"]; ok {
+		t.Fatal("expected raw_query not to be logged without a token")
+	}
+}
+
+func TestQueryToken_redactsRawQuery(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/ws?access_token=abc&room=1", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	if got := QueryToken("access_token").Extract(c); got != "abc" {
+		t.Fatalf("expected the token of an upgrade request, got %q", got)
+	}
+	rawQuery, _ := GetLogger(c).Data["raw_query"].(string)
+	if strings.Contains(rawQuery, "abc") || !strings.Contains(rawQuery, "access_token=REDACTED") || !strings.Contains(rawQuery, "room=1") {
+		t.Fatalf("expected raw_query with the token redacted, got %q", rawQuery)
+	}
+	if req.URL.Query().Get("access_token") != "abc" {
+		t.Fatal("expected the request's own query to be left alone")
+	}
+}
+
+func TestUseAuthWithOpt_queryTokenIgnoredOnPlainRequests(t *testing.T) {
+	key, keys := newTestKey(t)
+	token := signToken(t, key, "alice", time.Hour)
+	opt := AuthOpt{Extractors: []TokenExtractor{QueryToken("access_token")}}
+
+	req := httptest.NewRequest(http.MethodGet, "/ws?access_token="+token, nil)
+	if status, _ := serveAuth(keys, opt, req); status != http.StatusUnauthorized {
+		t.Fatalf("expected a plain request's query token to be ignored, got %d", status)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/ws?access_token="+token, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	if status, username := serveAuth(keys, opt, req); status != http.StatusOK || username != "alice" {
+		t.Fatalf("expected the upgrade request authenticated as alice, got %d %q", status, username)
+	}
+}
+
+// firstFrameResult is what the server side of a first frame test saw.
+type firstFrameResult struct {
+	claims *Claims
+	frame  []byte
+	err    error
+}
+
+// dialFirstFrame serves a WebSocket authenticating its first frame with
+// keys, and dials it.
+func dialFirstFrame(t *testing.T, keys KeySet) (*websocket.Conn, <-chan firstFrameResult) {
+	t.Helper()
+	results := make(chan firstFrameResult, 1)
+	e := echo.New()
+	e.GET("/ws", func(c echo.Context) error {
+		conn, err := (&websocket.Upgrader{}).Upgrade(c.Response(), c.Request(), nil)
+		if err != nil {
+			return err
+		}
+		claims, frame, err := AuthenticateFirstFrame(c, conn, keys)
+		results <- firstFrameResult{claims: claims, frame: frame, err: err}
+		if err == nil {
+			conn.Close()
+		}
+		return nil
+	})
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, results
+}
+
+// expectPolicyViolation checks the server rejected the first frame and
+// closed conn with a policy violation.
+func expectPolicyViolation(t *testing.T, conn *websocket.Conn, results <-chan firstFrameResult) {
+	t.Helper()
+	res := <-results
+	var httpErr *echo.HTTPError
+	if !errors.As(res.err, &httpErr) || httpErr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a 401 error, got %v", res.err)
+	}
+	if res.claims != nil {
+		t.Fatal("expected no claims")
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expected a policy violation close, got %v", err)
+	}
+}
+
+func TestAuthenticateFirstFrame_validToken(t *testing.T) {
+	key, keys := newTestKey(t)
+	conn, results := dialFirstFrame(t, keys)
+	frame := `{"token":"` + signToken(t, key, "alice", time.Hour) + `","room":"1"}`
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+		t.Fatal(err)
+	}
+	res := <-results
+	if res.err != nil {
+		t.Fatal(res.err)
+	}
+	if res.claims.Username != "alice" {
+		t.Fatalf("expected claims for alice, got %q", res.claims.Username)
+	}
+	if string(res.frame) != frame {
+		t.Fatalf("expected the whole frame back, got %s", res.frame)
+	}
+}
+
+func TestAuthenticateFirstFrame_missingToken(t *testing.T) {
+	_, keys := newTestKey(t)
+	conn, results := dialFirstFrame(t, keys)
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"room":"1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	expectPolicyViolation(t, conn, results)
+}
+
+func TestAuthenticateFirstFrame_expiredToken(t *testing.T) {
+	key, keys := newTestKey(t)
+	conn, results := dialFirstFrame(t, keys)
+	frame := `{"token":"` + signToken(t, key, "alice", -time.Minute) + `"}`
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(frame)); err != nil {
+		t.Fatal(err)
+	}
+	expectPolicyViolation(t, conn, results)
+}
+
+func TestAuthenticateFirstFrame_timesOut(t *testing.T) {
+	timeout := FirstFrameTimeout
+	FirstFrameTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { FirstFrameTimeout = timeout })
+
+	_, keys := newTestKey(t)
+	conn, results := dialFirstFrame(t, keys)
+	// Nothing is sent.
+	expectPolicyViolation(t, conn, results)
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercury/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// UseTracing continues the trace from the request's traceparent header, or
+// starts a new one, and stores the span in the request context. Register it
+// with e.Use so it runs before UseLogger and the logger picks up the trace.
+func UseTracing() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := tracing.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := tracing.Start(ctx, fmt.Sprintf("%s %s", req.Method, c.Path()), trace.SpanKindServer,
+				attribute.String("http.request.method", req.Method),
+				attribute.String("http.route", c.Path()),
+			)
+			c.SetRequest(req.WithContext(ctx))
+			// Let clients correlate their request with our logs.
+			tracing.Inject(ctx, propagation.HeaderCarrier(c.Response().Header()))
+
+			err := next(c)
+			status := c.Response().Status
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			} else if err != nil {
+				status = http.StatusInternalServerError
+			}
+			span.SetAttributes(attribute.Int("http.response.status_code", status))
+			spanErr := err
+			if spanErr == nil && status >= http.StatusInternalServerError {
+				spanErr = fmt.Errorf("http status %d", status)
+			}
+			tracing.End(span, spanErr)
+			return err
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Fallback is a Backend that uses a primary backend, normally Redis, and a
+// local one while the primary fails, so an outage doesn't lift every limit.
+// Local limits apply per instance: with n instances a client may get up to
+// n times its limit until the primary is back.
+type Fallback struct {
+	primary, local Backend
+	cooldown       time.Duration
+	logger         *logrus.Logger
+	// downUntil is when to try the primary again, in Unix nanoseconds.
+	downUntil atomic.Int64
+}
+
+// NewFallback returns a Backend using primary, and local for cooldown after
+// primary fails, instead of paying a failing call on every request. Each
+// switch to local is logged on logger as a warning.
+func NewFallback(primary, local Backend, cooldown time.Duration, logger *logrus.Logger) *Fallback {
+	return &Fallback{primary: primary, local: local, cooldown: cooldown, logger: logger}
+}
+
+// NewRedisWithFallback is the Backend services use: Redis, and memory for
+// ten seconds at a time while Redis fails.
+func NewRedisWithFallback(client *redis.Client, logger *logrus.Logger) *Fallback {
+	return NewFallback(NewRedis(client), NewMemory(), 10*time.Second, logger)
+}
+
+func (f *Fallback) Take(ctx context.Context, alg Algorithm, key string, rate Rate) (Result, error) {
+	if f.primaryUp() {
+		res, err := f.primary.Take(ctx, alg, key, rate)
+		if err == nil || ctx.Err() != nil {
+			return res, err
+		}
+		f.markDown(err)
+	}
+	return f.local.Take(ctx, alg, key, rate)
+}
+
+func (f *Fallback) Acquire(ctx context.Context, key string, max int, ttl time.Duration) (Result, error) {
+	if f.primaryUp() {
+		res, err := f.primary.Acquire(ctx, key, max, ttl)
+		if err == nil || ctx.Err() != nil {
+			return res, err
+		}
+		f.markDown(err)
+	}
+	return f.local.Acquire(ctx, key, max, ttl)
+}
+
+func (f *Fallback) primaryUp() bool {
+	return time.Now().UnixNano() >= f.downUntil.Load()
+}
+
+func (f *Fallback) markDown(err error) {
+	until := time.Now().Add(f.cooldown).UnixNano()
+	if old := f.downUntil.Swap(until); time.Now().UnixNano() >= old {
+		f.logger.WithError(err).WithField("cooldown", f.cooldown).Warn("ratelimit: primary backend failed, limiting locally")
+	}
+}
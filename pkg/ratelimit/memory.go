@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the memory backend drops idle keys.
+const sweepInterval = time.Minute
+
+// memoryState is one key's state in the memory backend.
+type memoryState struct {
+	// tokens and last for token buckets, tat for GCRA.
+	tokens, last, tat float64
+	// inflight for concurrency limits.
+	inflight int
+	expires  time.Time
+}
+
+// Memory is an in-process Backend. Its limits apply to this process only.
+type Memory struct {
+	mu        sync.Mutex
+	state     map[string]*memoryState
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemory returns an empty in-process Backend.
+func NewMemory() *Memory {
+	return &Memory{state: map[string]*memoryState{}, now: time.Now}
+}
+
+func (m *Memory) Take(_ context.Context, alg Algorithm, key string, rate Rate) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+	s, ok := m.state[key]
+	if !ok {
+		s = &memoryState{}
+		m.state[key] = s
+	}
+	t := unixSeconds(now)
+	var res Result
+	switch alg {
+	case GCRA:
+		var allowed bool
+		allowed, s.tat = gcraTake(rate, s.tat, t, !ok)
+		res = gcraResult(rate, allowed, s.tat, t)
+	default:
+		var allowed bool
+		allowed, s.tokens = tokenBucketTake(rate, s.tokens, s.last, t, !ok)
+		s.last = t
+		res = tokenBucketResult(rate, allowed, s.tokens)
+	}
+	s.expires = now.Add(res.ResetAfter)
+	return res, nil
+}
+
+// Acquire ignores ttl: a slot's holder can't die without this process.
+func (m *Memory) Acquire(_ context.Context, key string, max int, _ time.Duration) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.sweep(now)
+	s, ok := m.state[key]
+	if !ok {
+		s = &memoryState{}
+		m.state[key] = s
+	}
+	if s.inflight >= max {
+		return Result{Limit: max}, nil
+	}
+	s.inflight++
+	var once sync.Once
+	return Result{
+		Allowed:   true,
+		Limit:     max,
+		Remaining: max - s.inflight,
+		release: func() {
+			once.Do(func() {
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				if s.inflight > 0 {
+					s.inflight--
+				}
+			})
+		},
+	}, nil
+}
+
+// sweep drops keys that are back to their initial state, at most once per
+// sweepInterval. The caller holds m.mu.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+	for key, s := range m.state {
+		if s.inflight == 0 && now.After(s.expires) {
+			delete(m.state, key)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+// Package ratelimit limits how often, or how many at once, requests counted
+// under a key may proceed. The algorithms run on a Backend: Redis to share
+// limits between instances, memory for a single process, or Fallback to use
+// Redis and limit locally while it is down.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate is a number of requests per window, written "60/1m".
+type Rate struct {
+	Limit  int
+	Window time.Duration
+}
+
+// ParseRate parses "limit/window", where window is a Go duration.
+func ParseRate(s string) (Rate, error) {
+	limit, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q: want limit/window, like 60/1m", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil || n < 1 {
+		return Rate{}, fmt.Errorf("rate %q: limit must be a positive integer", s)
+	}
+	w, err := time.ParseDuration(strings.TrimSpace(window))
+	if err != nil || w <= 0 {
+		return Rate{}, fmt.Errorf("rate %q: window must be a positive duration", s)
+	}
+	return Rate{Limit: n, Window: w}, nil
+}
+
+// UnmarshalText parses the rate as ParseRate does.
+func (r *Rate) UnmarshalText(text []byte) error {
+	rate, err := ParseRate(string(text))
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s", r.Limit, r.Window)
+}
+
+// IsZero reports whether the rate is unset, meaning no limit.
+func (r Rate) IsZero() bool {
+	return r.Limit == 0
+}
+
+// PerSecond is the sustained rate in requests per second.
+func (r Rate) PerSecond() float64 {
+	return float64(r.Limit) / r.Window.Seconds()
+}
+
+// Result is a limiter's decision on one request.
+type Result struct {
+	Allowed bool
+	// Limit is the rate's limit, or the concurrency limit.
+	Limit int
+	// Remaining is how many more requests would be allowed right now.
+	Remaining int
+	// RetryAfter is, for a denied request, how long until one would be
+	// allowed. Concurrency limiters can't tell and leave it zero.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the limiter is back to Limit requests.
+	ResetAfter time.Duration
+
+	release func()
+}
+
+// Release ends a request a concurrency limiter allowed, freeing its slot.
+// For every other result it does nothing, so callers can always defer it.
+func (r Result) Release() {
+	if r.release != nil {
+		r.release()
+	}
+}
+
+// Tighter reports whether r limits the client more than o: a denial over an
+// allowance, the longer wait between two denials, else fewer remaining.
+func (r Result) Tighter(o Result) bool {
+	if r.Allowed != o.Allowed {
+		return !r.Allowed
+	}
+	if !r.Allowed {
+		return r.RetryAfter > o.RetryAfter
+	}
+	return r.Remaining < o.Remaining
+}
+
+// Limiter decides whether a request counted under key may proceed.
+// Implementations are safe for concurrent use.
+type Limiter interface {
+	Allow(ctx context.Context, key string) (Result, error)
+}
+
+// Algorithm is how a Backend counts requests against a Rate.
+type Algorithm int
+
+const (
+	// TokenBucket allows bursts of up to Limit requests, refilled at the
+	// rate's pace.
+	TokenBucket Algorithm = iota
+	// GCRA, the generic cell rate algorithm, spaces requests evenly and
+	// allows up to Limit in any window; it behaves like a sliding window
+	// while storing a single timestamp per key.
+	GCRA
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case TokenBucket:
+		return "token_bucket"
+	case GCRA:
+		return "gcra"
+	}
+	return fmt.Sprintf("Algorithm(%d)", int(a))
+}
+
+// Backend stores limiter state. Every method decides atomically, so any
+// number of instances sharing a Backend share the limits.
+type Backend interface {
+	// Take counts one request under key against rate using alg.
+	Take(ctx context.Context, alg Algorithm, key string, rate Rate) (Result, error)
+	// Acquire takes one of max slots under key. A slot is held until the
+	// result is released, or ttl has passed in case its holder died.
+	Acquire(ctx context.Context, key string, max int, ttl time.Duration) (Result, error)
+}
+
+// rateLimiter is a Limiter counting requests against a fixed Rate.
+type rateLimiter struct {
+	backend Backend
+	alg     Algorithm
+	rate    Rate
+}
+
+// NewTokenBucket returns a token bucket Limiter for rate.
+func NewTokenBucket(backend Backend, rate Rate) Limiter {
+	return &rateLimiter{backend: backend, alg: TokenBucket, rate: rate}
+}
+
+// NewGCRA returns a GCRA Limiter for rate.
+func NewGCRA(backend Backend, rate Rate) Limiter {
+	return &rateLimiter{backend: backend, alg: GCRA, rate: rate}
+}
+
+func (l *rateLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	return l.backend.Take(ctx, l.alg, key, l.rate)
+}
+
+// concurrencyLimiter is a Limiter bounding requests in flight.
+type concurrencyLimiter struct {
+	backend Backend
+	max     int
+	ttl     time.Duration
+}
+
+// NewConcurrency returns a Limiter allowing max requests in flight per key.
+// Callers must Release every result; ttl bounds how long a slot whose
+// holder never released it stays taken.
+func NewConcurrency(backend Backend, max int, ttl time.Duration) Limiter {
+	return &concurrencyLimiter{backend: backend, max: max, ttl: ttl}
+}
+
+func (l *concurrencyLimiter) Allow(ctx context.Context, key string) (Result, error) {
+	return l.backend.Acquire(ctx, key, l.max, l.ttl)
+}
+
+// The algorithms below are shared by the memory backend and the Redis
+// scripts, which mirror them; times are seconds as float64.
+
+// tokenBucketTake refills a bucket holding tokens at last up to now and
+// takes a token if there is one.
+func tokenBucketTake(rate Rate, tokens, last, now float64, fresh bool) (allowed bool, left float64) {
+	capacity := float64(rate.Limit)
+	if fresh {
+		tokens = capacity
+		last = now
+	}
+	tokens = math.Min(capacity, tokens+math.Max(0, now-last)*rate.PerSecond())
+	if tokens < 1 {
+		return false, tokens
+	}
+	return true, tokens - 1
+}
+
+// tokenBucketResult describes a bucket left with tokens.
+func tokenBucketResult(rate Rate, allowed bool, tokens float64) Result {
+	perSecond := rate.PerSecond()
+	res := Result{
+		Allowed:    allowed,
+		Limit:      rate.Limit,
+		Remaining:  int(math.Max(0, tokens)),
+		ResetAfter: seconds((float64(rate.Limit) - tokens) / perSecond),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / perSecond)
+	}
+	return res
+}
+
+// gcraTake advances the theoretical arrival time tat of the next request if
+// a request at now conforms.
+func gcraTake(rate Rate, tat, now float64, fresh bool) (allowed bool, newTAT float64) {
+	interval := rate.Window.Seconds() / float64(rate.Limit)
+	if fresh || tat < now {
+		tat = now
+	}
+	next := tat + interval
+	if next-rate.Window.Seconds() > now {
+		return false, tat
+	}
+	return true, next
+}
+
+// gcraResult describes the state tat leaves at now.
+func gcraResult(rate Rate, allowed bool, tat, now float64) Result {
+	interval := rate.Window.Seconds() / float64(rate.Limit)
+	res := Result{
+		Allowed:    allowed,
+		Limit:      rate.Limit,
+		ResetAfter: seconds(tat - now),
+	}
+	// Requests conform while tat+interval-window <= now.
+	slack := now - (tat - rate.Window.Seconds())
+	res.Remaining = int(math.Max(0, math.Floor(slack/interval+1e-9)))
+	if !allowed {
+		res.RetryAfter = seconds(tat + interval - rate.Window.Seconds() - now)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Max(0, s) * float64(time.Second))
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / 1e9
+}
@@ -0,0 +1,164 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// fakeClock is a Memory clock moved by hand.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestMemory() (*Memory, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	m := NewMemory()
+	m.now = clock.now
+	return m, clock
+}
+
+func allow(t *testing.T, l Limiter, key string) Result {
+	t.Helper()
+	res, err := l.Allow(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestParseRate(t *testing.T) {
+	rate, err := ParseRate("60/1m")
+	if err != nil || rate != (Rate{Limit: 60, Window: time.Minute}) {
+		t.Fatalf("expected 60/1m, got %v, %v", rate, err)
+	}
+	for _, s := range []string{"60", "0/1m", "60/0s", "x/1m", "60/minute"} {
+		if _, err := ParseRate(s); err == nil {
+			t.Errorf("expected %q to be refused", s)
+		}
+	}
+}
+
+func TestTokenBucket_burstThenRefill(t *testing.T) {
+	m, clock := newTestMemory()
+	l := NewTokenBucket(m, Rate{Limit: 3, Window: 3 * time.Second})
+	for i := 2; i >= 0; i-- {
+		res := allow(t, l, "k")
+		if !res.Allowed || res.Remaining != i {
+			t.Fatalf("expected allowed with %d remaining, got %+v", i, res)
+		}
+	}
+	res := allow(t, l, "k")
+	if res.Allowed || res.RetryAfter != time.Second || res.ResetAfter != 3*time.Second {
+		t.Fatalf("expected a denial retrying after 1s, resetting after 3s, got %+v", res)
+	}
+	if other := allow(t, l, "other"); !other.Allowed {
+		t.Fatal("expected keys to have their own buckets")
+	}
+
+	clock.t = clock.t.Add(time.Second)
+	if res := allow(t, l, "k"); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("expected one refilled token, got %+v", res)
+	}
+}
+
+func TestGCRA_spacesRequests(t *testing.T) {
+	m, clock := newTestMemory()
+	l := NewGCRA(m, Rate{Limit: 2, Window: 2 * time.Second})
+	if res := allow(t, l, "k"); !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("expected allowed with 1 remaining, got %+v", res)
+	}
+	if res := allow(t, l, "k"); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("expected allowed with 0 remaining, got %+v", res)
+	}
+	res := allow(t, l, "k")
+	if res.Allowed || res.RetryAfter != time.Second {
+		t.Fatalf("expected a denial retrying after 1s, got %+v", res)
+	}
+
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	if res := allow(t, l, "k"); res.Allowed {
+		t.Fatalf("expected a denial before the interval passed, got %+v", res)
+	}
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	if res := allow(t, l, "k"); !res.Allowed {
+		t.Fatalf("expected allowed after one interval, got %+v", res)
+	}
+}
+
+func TestConcurrency_releaseFreesSlot(t *testing.T) {
+	m, _ := newTestMemory()
+	l := NewConcurrency(m, 2, time.Minute)
+	first := allow(t, l, "k")
+	second := allow(t, l, "k")
+	if !first.Allowed || !second.Allowed || second.Remaining != 0 {
+		t.Fatalf("expected two slots, got %+v and %+v", first, second)
+	}
+	if res := allow(t, l, "k"); res.Allowed {
+		t.Fatal("expected a third request to be denied")
+	}
+	first.Release()
+	first.Release() // releasing twice frees one slot
+	if res := allow(t, l, "k"); !res.Allowed {
+		t.Fatal("expected the released slot to be reused")
+	}
+	if res := allow(t, l, "k"); res.Allowed {
+		t.Fatal("expected a double release to free only one slot")
+	}
+}
+
+// downBackend fails every call.
+type downBackend struct{ calls atomic.Int32 }
+
+func (b *downBackend) Take(context.Context, Algorithm, string, Rate) (Result, error) {
+	b.calls.Add(1)
+	return Result{}, errors.New("connection refused")
+}
+
+func (b *downBackend) Acquire(context.Context, string, int, time.Duration) (Result, error) {
+	b.calls.Add(1)
+	return Result{}, errors.New("connection refused")
+}
+
+func TestFallback_limitsLocallyWhilePrimaryFails(t *testing.T) {
+	primary := &downBackend{}
+	local, _ := newTestMemory()
+	logger, logs := test.NewNullLogger()
+	l := NewTokenBucket(NewFallback(primary, local, time.Hour, logger), Rate{Limit: 2, Window: time.Minute})
+	allowed := 0
+	for range 5 {
+		if allow(t, l, "k").Allowed {
+			allowed++
+		}
+	}
+	if allowed != 2 {
+		t.Fatalf("expected the local limit to allow 2 of 5, allowed %d", allowed)
+	}
+	if n := primary.calls.Load(); n != 1 {
+		t.Fatalf("expected the primary to be skipped during cooldown, called %d times", n)
+	}
+	if entries := logs.AllEntries(); len(entries) != 1 || entries[0].Level != logrus.WarnLevel {
+		t.Fatalf("expected one warning for the outage, got %d entries", len(entries))
+	}
+}
+
+func TestResult_Tighter(t *testing.T) {
+	denied := Result{RetryAfter: time.Second}
+	longer := Result{RetryAfter: time.Minute}
+	few := Result{Allowed: true, Remaining: 1}
+	many := Result{Allowed: true, Remaining: 10}
+	if !denied.Tighter(few) || few.Tighter(denied) {
+		t.Error("expected a denial to be tighter than an allowance")
+	}
+	if !longer.Tighter(denied) {
+		t.Error("expected the longer wait to be tighter")
+	}
+	if !few.Tighter(many) {
+		t.Error("expected fewer remaining to be tighter")
+	}
+}
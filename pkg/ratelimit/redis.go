@@ -0,0 +1,192 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript atomically implements a token bucket in Redis, as
+// tokenBucketTake does in Go.
+//
+// KEYS[1] = bucket key (e.g. "ratelimit:anon:1.2.3.4")
+// ARGV[1] = rate      – tokens added per second (= limit / window.Seconds(), float)
+// ARGV[2] = capacity  – maximum token count (= limit, float)
+// ARGV[3] = now       – current Unix time as fractional seconds (float)
+// ARGV[4] = ttl       – key TTL in seconds (integer)
+//
+// Returns {allowed, tokens}: allowed is 1 if the request is allowed (token
+// consumed), 0 if denied; tokens is the token count left, as a string since
+// Redis truncates Lua numbers to integers.
+var tokenBucketScript = redis.NewScript(`
+local data        = redis.call('HMGET', KEYS[1], 'token_count', 'last_refill')
+local token_count = tonumber(data[1])
+local last_refill = tonumber(data[2])
+
+local rate     = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local now      = tonumber(ARGV[3])
+local ttl      = tonumber(ARGV[4])
+
+-- first request: start with a full bucket
+if token_count == nil then
+	token_count = capacity
+	last_refill = now
+end
+
+-- refill tokens based on elapsed time
+local elapsed  = math.max(0, now - last_refill)
+local refilled = token_count + elapsed * rate
+if refilled > capacity then
+	refilled = capacity
+end
+
+local allowed = 0
+if refilled >= 1.0 then
+	allowed  = 1
+	refilled = refilled - 1.0
+end
+
+redis.call('HSET', KEYS[1], 'token_count', refilled, 'last_refill', now)
+redis.call('EXPIRE', KEYS[1], ttl)
+return {allowed, tostring(refilled)}
+`)
+
+// gcraScript atomically implements GCRA in Redis, as gcraTake does in Go.
+//
+// KEYS[1] = key holding the theoretical arrival time of the next request
+// ARGV[1] = interval – seconds between two requests (= window / limit, float)
+// ARGV[2] = window   – seconds (float)
+// ARGV[3] = now      – current Unix time as fractional seconds (float)
+//
+// Returns {allowed, tat} with tat as a string.
+var gcraScript = redis.NewScript(`
+local tat      = tonumber(redis.call('GET', KEYS[1]))
+local interval = tonumber(ARGV[1])
+local window   = tonumber(ARGV[2])
+local now      = tonumber(ARGV[3])
+
+if tat == nil or tat < now then
+	tat = now
+end
+
+local next_tat = tat + interval
+if next_tat - window > now then
+	return {0, tostring(tat)}
+end
+
+redis.call('SET', KEYS[1], tostring(next_tat), 'PX', math.ceil((next_tat - now) * 1000))
+return {1, tostring(next_tat)}
+`)
+
+// acquireScript atomically takes a concurrency slot in Redis. Slots are
+// members of a sorted set scored by when they expire.
+//
+// KEYS[1] = slot set key
+// ARGV[1] = slot ID
+// ARGV[2] = max      – slots (integer)
+// ARGV[3] = now      – current Unix time in milliseconds (integer)
+// ARGV[4] = ttl      – slot TTL in milliseconds (integer)
+//
+// Returns {allowed, inflight}.
+var acquireScript = redis.NewScript(`
+local max = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+local inflight = redis.call('ZCARD', KEYS[1])
+if inflight >= max then
+	return {0, inflight}
+end
+
+redis.call('ZADD', KEYS[1], now + ttl, ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {1, inflight + 1}
+`)
+
+// Redis is a Backend sharing limits between every instance using the same
+// Redis. Keys are used as given.
+type Redis struct {
+	client *redis.Client
+	now    func() time.Time
+}
+
+// NewRedis returns a Backend storing its state in client.
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client, now: time.Now}
+}
+
+func (r *Redis) Take(ctx context.Context, alg Algorithm, key string, rate Rate) (Result, error) {
+	now := unixSeconds(r.now())
+	switch alg {
+	case GCRA:
+		allowed, tat, err := r.run(ctx, gcraScript, key, rate.Window.Seconds()/float64(rate.Limit), rate.Window.Seconds(), now)
+		if err != nil {
+			return Result{}, err
+		}
+		return gcraResult(rate, allowed, tat, now), nil
+	default:
+		// capacity/rate == window in seconds; keep the key alive for 2 full windows
+		ttl := int(math.Ceil(rate.Window.Seconds())) * 2
+		allowed, tokens, err := r.run(ctx, tokenBucketScript, key, rate.PerSecond(), float64(rate.Limit), now, ttl)
+		if err != nil {
+			return Result{}, err
+		}
+		return tokenBucketResult(rate, allowed, tokens), nil
+	}
+}
+
+// run runs a script returning {allowed, number}.
+func (r *Redis) run(ctx context.Context, script *redis.Script, key string, args ...any) (bool, float64, error) {
+	res, err := script.Run(ctx, r.client, []string{key}, args...).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("ratelimit: unexpected script result %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	var n float64
+	switch v := res[1].(type) {
+	case string:
+		if n, err = strconv.ParseFloat(v, 64); err != nil {
+			return false, 0, fmt.Errorf("ratelimit: unexpected script result %v", res)
+		}
+	case int64:
+		n = float64(v)
+	}
+	return allowed == 1, n, nil
+}
+
+func (r *Redis) Acquire(ctx context.Context, key string, max int, ttl time.Duration) (Result, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Result{}, err
+	}
+	slot := hex.EncodeToString(id)
+	allowed, inflight, err := r.run(ctx, acquireScript, key, slot, max, r.now().UnixMilli(), ttl.Milliseconds())
+	if err != nil {
+		return Result{}, err
+	}
+	if !allowed {
+		return Result{Limit: max}, nil
+	}
+	return Result{
+		Allowed:   true,
+		Limit:     max,
+		Remaining: max - int(inflight),
+		release: func() {
+			// A slot that fails to be removed expires with its ttl.
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+			defer cancel()
+			r.client.ZRem(ctx, key, slot)
+		},
+	}, nil
+}
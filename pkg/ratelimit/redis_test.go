@@ -0,0 +1,117 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedis returns a Redis backend on a miniredis server, sharing the
+// clock of a Memory backend from newTestMemory.
+func newTestRedis(t *testing.T, clock *fakeClock) *Redis {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { client.Close() })
+	r := NewRedis(client)
+	r.now = clock.now
+	return r
+}
+
+// sameResult reports whether a and b are equal. Durations may differ by a
+// millisecond: Redis formats the numbers its scripts return with 14
+// significant digits, which leaves a Unix time 0.1ms of precision.
+func sameResult(a, b Result) bool {
+	near := func(x, y time.Duration) bool {
+		d := x - y
+		return d > -time.Millisecond && d < time.Millisecond
+	}
+	return a.Allowed == b.Allowed && a.Limit == b.Limit && a.Remaining == b.Remaining &&
+		near(a.RetryAfter, b.RetryAfter) && near(a.ResetAfter, b.ResetAfter)
+}
+
+func TestRedis_takeMatchesMemory(t *testing.T) {
+	cases := []struct {
+		name string
+		alg  Algorithm
+		rate Rate
+	}{
+		{name: "token bucket", alg: TokenBucket, rate: Rate{Limit: 3, Window: 3 * time.Second}},
+		{name: "token bucket fractional rate", alg: TokenBucket, rate: Rate{Limit: 5, Window: 7 * time.Second}},
+		{name: "gcra", alg: GCRA, rate: Rate{Limit: 2, Window: 2 * time.Second}},
+		{name: "gcra fractional interval", alg: GCRA, rate: Rate{Limit: 5, Window: 7 * time.Second}},
+	}
+	// Time to move the clock by before each take.
+	steps := []time.Duration{
+		0, 0, 0, 0, 0, 0,
+		500 * time.Millisecond, 500 * time.Millisecond, 0,
+		1400 * time.Millisecond, 0, 0,
+		time.Minute, 0,
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, clock := newTestMemory()
+			r := newTestRedis(t, clock)
+			ctx := context.Background()
+			for i, step := range steps {
+				clock.t = clock.t.Add(step)
+				want, err := m.Take(ctx, tc.alg, "k", tc.rate)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := r.Take(ctx, tc.alg, "k", tc.rate)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !sameResult(got, want) {
+					t.Fatalf("take %d: expected %+v as from Memory, got %+v", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRedis_acquireMatchesMemory(t *testing.T) {
+	m, clock := newTestMemory()
+	r := newTestRedis(t, clock)
+	ctx := context.Background()
+	acquire := func(b Backend) Result {
+		t.Helper()
+		res, err := b.Acquire(ctx, "k", 2, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	var held [2][]Result
+	for i := 0; i < 3; i++ {
+		want, got := acquire(m), acquire(r)
+		if !sameResult(got, want) {
+			t.Fatalf("acquire %d: expected %+v as from Memory, got %+v", i, want, got)
+		}
+		held[0], held[1] = append(held[0], want), append(held[1], got)
+	}
+	held[0][0].Release()
+	held[1][0].Release()
+	if want, got := acquire(m), acquire(r); !sameResult(got, want) || !got.Allowed {
+		t.Fatalf("expected the released slot to be reused as in Memory %+v, got %+v", want, got)
+	}
+}
+
+func TestRedis_acquireExpiresUnreleasedSlots(t *testing.T) {
+	_, clock := newTestMemory()
+	r := newTestRedis(t, clock)
+	ctx := context.Background()
+	if res, err := r.Acquire(ctx, "k", 1, time.Minute); err != nil || !res.Allowed {
+		t.Fatalf("expected a slot, got %+v, %v", res, err)
+	}
+	if res, _ := r.Acquire(ctx, "k", 1, time.Minute); res.Allowed {
+		t.Fatal("expected no slot while the first is held")
+	}
+	clock.t = clock.t.Add(time.Minute + time.Millisecond)
+	if res, err := r.Acquire(ctx, "k", 1, time.Minute); err != nil || !res.Allowed {
+		t.Fatalf("expected the slot back after its ttl, got %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,74 @@
+package rmq
+
+import "errors"
+
+// ErrorClass tells a consumer what to do with a message whose handler failed.
+type ErrorClass int
+
+const (
+	// ClassRetryable errors are transient, such as an unavailable downstream
+	// or a timeout. The message is tried again.
+	ClassRetryable ErrorClass = iota
+	// ClassPermanent errors fail the same way on every attempt. The message
+	// is dead-lettered without further retries.
+	ClassPermanent
+	// ClassClient errors are the sender's fault, such as an invalid request
+	// or a service-level *Error. Callers get the error back; fire-and-forget
+	// messages are dead-lettered.
+	ClassClient
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ClassPermanent:
+		return "permanent"
+	case ClassClient:
+		return "client"
+	default:
+		return "retryable"
+	}
+}
+
+type classifiedError struct {
+	err   error
+	class ErrorClass
+}
+
+func (e *classifiedError) Error() string { return e.err.Error() }
+func (e *classifiedError) Unwrap() error { return e.err }
+
+// Permanent marks err as ClassPermanent.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{err: err, class: ClassPermanent}
+}
+
+// Retryable marks err as ClassRetryable, overriding what Classify would
+// infer from the error it wraps.
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &classifiedError{err: err, class: ClassRetryable}
+}
+
+// Classify returns the class of err. Errors marked with Permanent or
+// Retryable keep their mark. An *Error is a client error for 4xx and
+// service-level codes (1000 and up) and retryable otherwise. Anything else,
+// timeouts included, is retryable.
+func Classify(err error) ErrorClass {
+	var classified *classifiedError
+	if errors.As(err, &classified) {
+		return classified.class
+	}
+	var rmqErr *Error
+	if errors.As(err, &rmqErr) {
+		if (rmqErr.Code >= 400 && rmqErr.Code < 500) || rmqErr.Code >= 1000 {
+			return ClassClient
+		}
+		return ClassRetryable
+	}
+	return ClassRetryable
+}
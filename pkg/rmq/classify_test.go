@@ -0,0 +1,41 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		err  error
+		want ErrorClass
+	}{
+		{errors.New("boom"), ClassRetryable},
+		{context.DeadlineExceeded, ClassRetryable},
+		{NewError(503, "unavailable"), ClassRetryable},
+		{NewError(500, "internal"), ClassRetryable},
+		{NewError(400, "invalid"), ClassClient},
+		{NewError(8004, "inventory does not exist"), ClassClient},
+		{fmt.Errorf("wrapped: %w", NewError(404, "not found")), ClassClient},
+		{Permanent(errors.New("poison")), ClassPermanent},
+		{Permanent(NewError(503, "unavailable")), ClassPermanent},
+		{Retryable(NewError(409, "conflict")), ClassRetryable},
+	}
+	for _, tc := range cases {
+		if got := Classify(tc.err); got != tc.want {
+			t.Errorf("Classify(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestPermanent_keepsWrappedError(t *testing.T) {
+	err := Permanent(NewError(8004, "inventory does not exist"))
+	if !errors.Is(err, NewError(8004, "")) {
+		t.Fatalf("expected wrapped *Error to match, got %v", err)
+	}
+	if Permanent(nil) != nil || Retryable(nil) != nil {
+		t.Fatal("expected nil errors to stay nil")
+	}
+}
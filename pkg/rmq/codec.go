@@ -0,0 +1,205 @@
+package rmq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Content types a request or reply body can be encoded with.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeMsgpack  = "application/msgpack"
+)
+
+// Codec encodes request and response bodies for one content type. Marshal
+// and Unmarshal are always given pointers.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var codecs = map[string]Codec{
+	ContentTypeJSON:     jsonCodec{},
+	ContentTypeProtobuf: protobufCodec{},
+	ContentTypeMsgpack:  msgpackCodec{},
+}
+
+// CodecFor returns the codec for contentType. Messages without a content
+// type predate codecs and are JSON.
+func CodecFor(contentType string) (Codec, error) {
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+	codec, ok := codecs[contentType]
+	if !ok {
+		return nil, fmt.Errorf("mq: unsupported content type %q", contentType)
+	}
+	return codec, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                { return ContentTypeJSON }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+// protobufCodec only handles generated messages, so routes using it declare
+// their request and response as the generated struct types.
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("mq: %T is not a protobuf message", v)
+	}
+	return proto.Marshal(m)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("mq: %T is not a protobuf message", v)
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// msgpackCodec reads the json struct tags so the existing request and
+// response types work unchanged.
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return ContentTypeMsgpack }
+
+func (msgpackCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+const contentTypeKey contextKey = "content_type"
+
+// ContentType returns the content type of the request being handled. Handle
+// decodes the request and encodes the response with the matching codec.
+func ContentType(ctx context.Context) string {
+	contentType, _ := ctx.Value(contentTypeKey).(string)
+	if contentType == "" {
+		return ContentTypeJSON
+	}
+	return contentType
+}
+
+// Envelope version 2 moves the version and response type into headers so
+// the reply body is the encoded response itself, in the request's content
+// type, instead of JSON nested in a JSON envelope. Callers announce that
+// they read version 2 with HeaderEnvelopeVersion; consumers answer everyone
+// else with a version 1 envelope, so either side can be upgraded first.
+const (
+	envelopeVersion2      = 2
+	HeaderEnvelopeVersion = "x-envelope-version"
+	HeaderResponseType    = "x-response-type"
+)
+
+// envelopeVersionOf returns the envelope version a message asked for or
+// was sent with.
+func envelopeVersionOf(headers amqp.Table) int {
+	switch v := headers[HeaderEnvelopeVersion].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return envelopeVersion
+	}
+}
+
+// replyPublishing builds the reply to msg for a handler's response or error,
+// in the envelope version msg asked for.
+func replyPublishing(msg amqp.Delivery, response []byte, rmqErr *Error) (amqp.Publishing, error) {
+	if envelopeVersionOf(msg.Headers) < envelopeVersion2 {
+		var body []byte
+		var err error
+		if rmqErr != nil {
+			body, err = wrapError(rmqErr)
+		} else {
+			body, err = wrapSuccess(response)
+		}
+		return amqp.Publishing{
+			ContentType:   ContentTypeJSON,
+			CorrelationId: msg.CorrelationId,
+			Body:          body,
+		}, err
+	}
+
+	pub := amqp.Publishing{
+		Headers:       amqp.Table{HeaderEnvelopeVersion: int32(envelopeVersion2)},
+		CorrelationId: msg.CorrelationId,
+	}
+	if rmqErr != nil {
+		// Errors are always JSON; not every codec can encode an *Error.
+		body, err := json.Marshal(rmqErr)
+		pub.Headers[HeaderResponseType] = string(responseTypeError)
+		pub.ContentType = ContentTypeJSON
+		pub.Body = body
+		return pub, err
+	}
+	pub.Headers[HeaderResponseType] = string(responseTypeSuccess)
+	pub.ContentType = msg.ContentType
+	if pub.ContentType == "" {
+		pub.ContentType = ContentTypeJSON
+	}
+	pub.Body = response
+	return pub, nil
+}
+
+// unwrapReply returns the response body of a reply, or the *Error the
+// consumer returned. It reads both envelope versions.
+func unwrapReply(r reply) ([]byte, error) {
+	if envelopeVersionOf(r.headers) < envelopeVersion2 {
+		var env envelope
+		if err := json.Unmarshal(r.body, &env); err != nil {
+			return nil, err
+		}
+		if env.Version != envelopeVersion {
+			return nil, NewError(503, "unsupported envelope version")
+		}
+		return unwrapResponse(env.Type, env.Response)
+	}
+	typ, _ := r.headers[HeaderResponseType].(string)
+	return unwrapResponse(responseType(typ), r.body)
+}
+
+func unwrapResponse(typ responseType, body []byte) ([]byte, error) {
+	switch typ {
+	case responseTypeError:
+		var rmqErr Error
+		if err := json.Unmarshal(body, &rmqErr); err != nil {
+			return nil, err
+		}
+		return nil, &rmqErr
+	case responseTypeSuccess:
+		return body, nil
+	default:
+		return nil, NewError(500, "unknown response type")
+	}
+}
@@ -0,0 +1,140 @@
+package rmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodecFor(t *testing.T) {
+	for _, contentType := range []string{"", ContentTypeJSON, ContentTypeMsgpack, ContentTypeProtobuf} {
+		codec, err := CodecFor(contentType)
+		if err != nil {
+			t.Fatalf("CodecFor(%q): %v", contentType, err)
+		}
+		if contentType == "" && codec.ContentType() != ContentTypeJSON {
+			t.Fatalf("expected JSON for a missing content type, got %s", codec.ContentType())
+		}
+	}
+	if _, err := CodecFor("text/plain"); err == nil {
+		t.Fatal("expected unknown content type to fail")
+	}
+}
+
+func TestMsgpackCodec_usesJSONTags(t *testing.T) {
+	codec, _ := CodecFor(ContentTypeMsgpack)
+	b, err := codec.Marshal(&greetRequest{Name: "ada"})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var fields map[string]any
+	if err := msgpack.Unmarshal(b, &fields); err != nil {
+		t.Fatalf("invalid msgpack: %v", err)
+	}
+	if fields["name"] != "ada" {
+		t.Fatalf("expected json tag as key, got %v", fields)
+	}
+	var got greetRequest
+	if err := codec.Unmarshal(b, &got); err != nil || got.Name != "ada" {
+		t.Fatalf("expected round trip, got %+v (%v)", got, err)
+	}
+}
+
+func TestProtobufCodec_rejectsPlainStructs(t *testing.T) {
+	codec, _ := CodecFor(ContentTypeProtobuf)
+	if _, err := codec.Marshal(&greetRequest{Name: "ada"}); err == nil {
+		t.Fatal("expected non-proto value to fail")
+	}
+	b, err := codec.Marshal(wrapperspb.String("ada"))
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got wrapperspb.StringValue
+	if err := codec.Unmarshal(b, &got); err != nil || got.GetValue() != "ada" {
+		t.Fatalf("expected round trip, got %q (%v)", got.GetValue(), err)
+	}
+}
+
+func TestUnwrapReply_readsBothVersions(t *testing.T) {
+	v1, _ := wrapSuccess([]byte(`{"greeting":"hi"}`))
+	body, err := unwrapReply(reply{body: v1})
+	if err != nil || string(body) != `{"greeting":"hi"}` {
+		t.Fatalf("expected v1 response, got %s (%v)", body, err)
+	}
+
+	v2 := reply{
+		body: []byte(`{"code":404,"message":"not found"}`),
+		headers: amqp.Table{
+			HeaderEnvelopeVersion: int32(envelopeVersion2),
+			HeaderResponseType:    string(responseTypeError),
+		},
+	}
+	if _, err := unwrapReply(v2); !errors.Is(err, NewError(404, "")) {
+		t.Fatalf("expected v2 error, got %v", err)
+	}
+}
+
+func TestConsumer_v1Request_getsV1Envelope(t *testing.T) {
+	_, p, c := newMemorySetup(t)
+	route := NewRoute[greetRequest, greetResponse](Service{Name: "test"}, testRouteName())
+	route.Consume(c, greet)
+	waitForConsumers(t, c, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	raw, err := p.Request(ctx, route.Name, []byte(`{"name":"ada"}`))
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	var env envelope
+	if err := json.Unmarshal(raw, &env); err != nil || env.Version != envelopeVersion {
+		t.Fatalf("expected v1 envelope for a v1 caller, got %s (%v)", raw, err)
+	}
+}
+
+func TestRoute_msgpack_overMemoryBroker(t *testing.T) {
+	_, p, c := newMemorySetup(t)
+	route := NewRouteWithOpt[greetRequest, greetResponse](Service{Name: "test", InvalidRequest: errTestInvalid},
+		testRouteName(), RouteOpt{ContentType: ContentTypeMsgpack})
+	route.Consume(c, greet)
+	waitForConsumers(t, c, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := route.Request(ctx, p, greetRequest{Name: "ada"})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if resp.Greeting != "hello ada" {
+		t.Fatalf("expected greeting, got %q", resp.Greeting)
+	}
+	if _, err := route.Request(ctx, p, greetRequest{}); !errors.Is(err, errTestInvalid) {
+		t.Fatalf("expected service invalid error, got %v", err)
+	}
+}
+
+func TestRoute_protobuf_overMemoryBroker(t *testing.T) {
+	_, p, c := newMemorySetup(t)
+	route := NewRouteWithOpt[wrapperspb.StringValue, wrapperspb.StringValue](Service{Name: "test"},
+		testRouteName(), RouteOpt{ContentType: ContentTypeProtobuf})
+	route.Consume(c, func(_ context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		return wrapperspb.String("hello " + req.GetValue()), nil
+	})
+	waitForConsumers(t, c, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := route.Request(ctx, p, wrapperspb.StringValue{Value: "ada"})
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if resp.GetValue() != "hello ada" {
+		t.Fatalf("expected greeting, got %q", resp.GetValue())
+	}
+}
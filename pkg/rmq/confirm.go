@@ -0,0 +1,243 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Returned by Publish when the broker did not take responsibility for the
+// message.
+var (
+	ErrPublishNacked   = NewError(503, "mq: broker rejected the message")
+	ErrPublishReturned = NewError(500, "mq: message could not be routed to a queue")
+	ErrConfirmTimeout  = NewError(503, "mq: broker did not confirm the message in time")
+)
+
+const (
+	defaultConfirmTimeout = 5 * time.Second
+	// confirmNotifyBuffer must hold every confirm that can arrive while the
+	// confirmer is busy, or the connection's reader blocks.
+	confirmNotifyBuffer = 1024
+)
+
+// PublisherOpt configures a Publisher. Zero values fall back to the package
+// defaults.
+type PublisherOpt struct {
+	// ConfirmTimeout bounds how long Publish and PublishEvent wait for the
+	// broker to confirm a message. ctx can cut it shorter.
+	ConfirmTimeout time.Duration
+}
+
+func (o PublisherOpt) withDefaults() PublisherOpt {
+	if o.ConfirmTimeout <= 0 {
+		o.ConfirmTimeout = defaultConfirmTimeout
+	}
+	return o
+}
+
+// confirmer matches the broker's publisher confirms to the publishes waiting
+// on them. Delivery tags restart at 1 on every channel, so each channel gets
+// its own confirmer.
+type confirmer struct {
+	mu       sync.Mutex
+	seq      uint64
+	waiting  map[uint64]*confirmWait
+	returned map[string]bool
+	err      error
+}
+
+type confirmWait struct {
+	messageID string
+	done      chan error
+}
+
+func newConfirmer() *confirmer {
+	return &confirmer{waiting: map[uint64]*confirmWait{}, returned: map[string]bool{}}
+}
+
+// next reserves the delivery tag of the next publish on the channel. Every
+// publish takes a tag, whether anyone waits on it or not, so it must be
+// called in publish order. A nil done means nobody waits for the confirm.
+func (c *confirmer) next(messageID string, wait bool) (uint64, chan error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	if !wait {
+		return c.seq, nil
+	}
+	done := make(chan error, 1)
+	if c.err != nil {
+		done <- c.err
+		return c.seq, done
+	}
+	c.waiting[c.seq] = &confirmWait{messageID: messageID, done: done}
+	return c.seq, done
+}
+
+// forget drops the waiter for a publish that never reached the broker.
+func (c *confirmer) forget(tag uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.waiting, tag)
+}
+
+// serve resolves waiters until the channel closes, then fails the rest with
+// ErrConnectionLost. A mandatory message the broker can't route is returned
+// before it is acked, so pending returns are read before every confirm.
+func (c *confirmer) serve(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.markReturned(r)
+		case conf, ok := <-confirms:
+			if !ok {
+				c.fail(ErrConnectionLost)
+				return
+			}
+			for drained := false; !drained && returns != nil; {
+				select {
+				case r, ok := <-returns:
+					if !ok {
+						returns = nil
+						continue
+					}
+					c.markReturned(r)
+				default:
+					drained = true
+				}
+			}
+			c.resolve(conf)
+		}
+	}
+}
+
+func (c *confirmer) markReturned(r amqp.Return) {
+	if r.MessageId == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.returned[r.MessageId] = true
+}
+
+func (c *confirmer) resolve(conf amqp.Confirmation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w, ok := c.waiting[conf.DeliveryTag]
+	if !ok {
+		return
+	}
+	delete(c.waiting, conf.DeliveryTag)
+	var err error
+	switch {
+	case c.returned[w.messageID]:
+		delete(c.returned, w.messageID)
+		err = ErrPublishReturned
+	case !conf.Ack:
+		err = ErrPublishNacked
+	}
+	w.done <- err
+}
+
+// fail resolves every waiter with err and every later one too.
+func (c *confirmer) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+	for tag, w := range c.waiting {
+		w.done <- err
+		delete(c.waiting, tag)
+	}
+}
+
+// publishLocked publishes msg on the publisher's channel and reserves its
+// delivery tag. When wait is set the returned channel receives the broker's
+// verdict. Must be called with p.mu held.
+func (p *Publisher) publishLocked(exchange, key string, mandatory, wait bool, msg amqp.Publishing) (<-chan error, error) {
+	tag, done := p.confirms.next(msg.MessageId, wait)
+	if err := p.channel.Publish(exchange, key, mandatory, false, msg); err != nil {
+		p.confirms.forget(tag)
+		return nil, err
+	}
+	return done, nil
+}
+
+// awaitConfirm waits for the broker to confirm a publish, for at most the
+// publisher's ConfirmTimeout.
+func (p *Publisher) awaitConfirm(ctx context.Context, done <-chan error) error {
+	timer := time.NewTimer(p.opt.withDefaults().ConfirmTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return ErrConfirmTimeout
+	case <-ctx.Done():
+		return fmt.Errorf("mq: waiting for publish confirm: %w", ctx.Err())
+	}
+}
+
+// Batch publishes many messages and waits for all of their confirms at once,
+// which is much faster than confirming one Publish at a time. A Batch is not
+// safe for concurrent use.
+type Batch struct {
+	p       *Publisher
+	pending []batchPublish
+}
+
+type batchPublish struct {
+	queue string
+	done  <-chan error
+}
+
+// NewBatch starts a batch of publishes.
+func (p *Publisher) NewBatch() *Batch {
+	return &Batch{p: p}
+}
+
+// Publish sends body to queue without waiting for the broker. Its confirm is
+// collected by Wait.
+func (b *Batch) Publish(ctx context.Context, queue string, body []byte) error {
+	done, err := b.p.publish(ctx, queue, body)
+	if err != nil {
+		return err
+	}
+	b.pending = append(b.pending, batchPublish{queue: queue, done: done})
+	return nil
+}
+
+// Wait blocks until every message published in the batch is confirmed, or
+// the publisher's ConfirmTimeout runs out, and resets the batch. It returns
+// every failure joined, each naming its queue.
+func (b *Batch) Wait(ctx context.Context) error {
+	pending := b.pending
+	b.pending = nil
+	timer := time.NewTimer(b.p.opt.withDefaults().ConfirmTimeout)
+	defer timer.Stop()
+	var errs []error
+	for _, pub := range pending {
+		var err error
+		select {
+		case err = <-pub.done:
+		case <-timer.C:
+			err = ErrConfirmTimeout
+			// Everything still unconfirmed has timed out as well.
+			timer.Reset(0)
+		case <-ctx.Done():
+			err = fmt.Errorf("mq: waiting for publish confirm: %w", ctx.Err())
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", pub.queue, err))
+		}
+	}
+	return errors.Join(errs...)
+}
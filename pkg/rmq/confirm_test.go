@@ -0,0 +1,146 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestPublish_confirmedOverMemoryBroker(t *testing.T) {
+	b, p, _ := newMemorySetup(t)
+	if err := p.Publish(context.Background(), "ledger", []byte(`{}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := b.MessageCount("ledger"); n != 1 {
+		t.Fatalf("expected the confirmed message in the queue, got %d", n)
+	}
+}
+
+func TestPublish_nacked(t *testing.T) {
+	conn, ch := newMockSetup()
+	ch.nack = true
+	p := newTestPublisher(t, conn)
+	if err := p.Publish(context.Background(), "q", []byte("body")); !errors.Is(err, ErrPublishNacked) {
+		t.Fatalf("expected ErrPublishNacked, got %v", err)
+	}
+}
+
+func TestPublish_returned(t *testing.T) {
+	conn, ch := newMockSetup()
+	ch.unroutable = true
+	p := newTestPublisher(t, conn)
+	if err := p.Publish(context.Background(), "q", []byte("body")); !errors.Is(err, ErrPublishReturned) {
+		t.Fatalf("expected ErrPublishReturned, got %v", err)
+	}
+	// The return is only matched to its own message.
+	ch.mu.Lock()
+	ch.unroutable = false
+	ch.mu.Unlock()
+	if err := p.Publish(context.Background(), "q", []byte("body")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestPublish_confirmTimeout(t *testing.T) {
+	conn, ch := newMockSetup()
+	ch.silent = true
+	p := newTestPublisher(t, conn)
+	p.opt.ConfirmTimeout = 20 * time.Millisecond
+	if err := p.Publish(context.Background(), "q", []byte("body")); !errors.Is(err, ErrConfirmTimeout) {
+		t.Fatalf("expected ErrConfirmTimeout, got %v", err)
+	}
+}
+
+func TestPublish_connectionDrop_failsUnconfirmed(t *testing.T) {
+	conn, ch := newMockSetup()
+	ch.silent = true
+	p := newTestPublisher(t, conn)
+	go func() {
+		waitFor(t, func() bool { return ch.lastPublished() != nil })
+		conn.drop()
+	}()
+	start := time.Now()
+	if err := p.Publish(context.Background(), "q", []byte("body")); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected ErrConnectionLost, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("unconfirmed publish should fail as soon as the connection drops")
+	}
+}
+
+func TestPublish_requestsKeepDeliveryTagsInStep(t *testing.T) {
+	conn, ch := newMockSetup()
+	p := newTestPublisher(t, conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	p.Request(ctx, "q", []byte("ping")) // takes tag 1, confirmed unwatched
+	ch.mu.Lock()
+	ch.nack = true
+	ch.mu.Unlock()
+	if err := p.Publish(context.Background(), "q", []byte("body")); !errors.Is(err, ErrPublishNacked) {
+		t.Fatalf("expected the publish to get its own nack, got %v", err)
+	}
+}
+
+func TestBatch_waitsForEveryConfirm(t *testing.T) {
+	b, p, _ := newMemorySetup(t)
+	batch := p.NewBatch()
+	for range 10 {
+		if err := batch.Publish(context.Background(), "ledger", []byte(`{}`)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := batch.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := b.MessageCount("ledger"); n != 10 {
+		t.Fatalf("expected 10 messages, got %d", n)
+	}
+	if err := batch.Wait(context.Background()); err != nil {
+		t.Fatalf("expected an empty batch after Wait, got %v", err)
+	}
+}
+
+func TestBatch_reportsFailedQueues(t *testing.T) {
+	conn, ch := newMockSetup()
+	ch.nack = true
+	p := newTestPublisher(t, conn)
+	batch := p.NewBatch()
+	batch.Publish(context.Background(), "a", []byte("body"))
+	batch.Publish(context.Background(), "b", []byte("body"))
+	err := batch.Wait(context.Background())
+	if !errors.Is(err, ErrPublishNacked) {
+		t.Fatalf("expected ErrPublishNacked, got %v", err)
+	}
+	if got := err.Error(); got != "a: "+ErrPublishNacked.Error()+"\nb: "+ErrPublishNacked.Error() {
+		t.Fatalf("expected both queues named, got %q", got)
+	}
+}
+
+func TestMemoryBroker_mandatoryUnroutable_returned(t *testing.T) {
+	b := NewMemoryBroker()
+	t.Cleanup(b.Close)
+	conn, _ := dialMemory(b.URL())
+	ch, _ := conn.Channel()
+	returns := ch.NotifyReturn(make(chan amqp.Return, 1))
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	if err := ch.Confirm(false); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	if err := ch.Publish("", "nowhere", true, false, amqp.Publishing{MessageId: "m1"}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	if r := <-returns; r.MessageId != "m1" || r.ReplyCode != amqp.NoRoute {
+		t.Fatalf("expected m1 returned with NO_ROUTE, got %+v", r)
+	}
+	if c := <-confirms; c.DeliveryTag != 1 || !c.Ack {
+		t.Fatalf("expected tag 1 acked, got %+v", c)
+	}
+	ch.Close()
+	if _, ok := <-confirms; ok {
+		t.Fatal("expected confirms closed with the channel")
+	}
+}
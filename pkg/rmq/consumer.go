@@ -7,10 +7,12 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mercury/pkg/tracing"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/sirupsen/logrus"
 )
@@ -19,8 +21,15 @@ type Handler func(ctx context.Context, body []byte) ([]byte, error)
 
 type amqpChannel interface {
 	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
 	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
 	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Cancel(consumer string, noWait bool) error
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
 	Close() error
 }
 
@@ -28,6 +37,7 @@ type amqpConnection interface {
 	Close() error
 	IsClosed() bool
 	Channel() (amqpChannel, error)
+	NotifyClose(receiver chan *amqp.Error) chan *amqp.Error
 }
 
 // realConn wraps *amqp.Connection so Channel() satisfies amqpConnection.
@@ -40,19 +50,73 @@ type Consumer struct {
 	conn    amqpConnection
 	mu      sync.Mutex
 	logger  *logrus.Logger
+	// active maps consumer tags to their channel so Shutdown can cancel them.
+	active   map[string]amqpChannel
+	loops    sync.WaitGroup
+	draining atomic.Bool
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
-func NewConsumer(amqpURL string, logger *logrus.Logger) (*Consumer, error) {
-	c := &Consumer{
-		amqpURL: amqpURL,
-		logger:  logger,
+const (
+	defaultMaxAttempts = 5
+	defaultBackoffBase = time.Second
+	defaultBackoffMax  = time.Minute
+)
+
+// QueueOpt configures how a single queue is consumed. Zero values fall back
+// to the package defaults.
+type QueueOpt struct {
+	// MaxAttempts is the number of times a fire-and-forget message is handled
+	// before it is moved to the dead-letter queue. 1 disables retries.
+	MaxAttempts int
+	// BackoffBase is the delay before the first retry. Each following retry
+	// doubles it, capped at BackoffMax.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// Workers is the number of messages handled concurrently. Defaults to 1.
+	Workers int
+	// Prefetch is the number of unacked messages the broker delivers ahead
+	// of the workers. Defaults to Workers.
+	Prefetch int
+}
+
+func (o QueueOpt) withDefaults() QueueOpt {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = defaultMaxAttempts
+	}
+	if o.BackoffBase <= 0 {
+		o.BackoffBase = defaultBackoffBase
+	}
+	if o.BackoffMax <= 0 {
+		o.BackoffMax = defaultBackoffMax
+	}
+	if o.Workers <= 0 {
+		o.Workers = 1
 	}
+	if o.Prefetch <= 0 {
+		o.Prefetch = o.Workers
+	}
+	return o
+}
+
+func NewConsumer(amqpURL string, logger *logrus.Logger) (*Consumer, error) {
+	c := newConsumer(amqpURL, logger)
 	if err := c.connect(); err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
+func newConsumer(amqpURL string, logger *logrus.Logger) *Consumer {
+	return &Consumer{
+		amqpURL: amqpURL,
+		logger:  logger,
+		active:  map[string]amqpChannel{},
+		stop:    make(chan struct{}),
+	}
+}
+
 func (c *Consumer) connect() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -60,11 +124,11 @@ func (c *Consumer) connect() error {
 		c.conn.Close()
 		c.conn = nil
 	}
-	conn, err := amqp.Dial(c.amqpURL)
+	conn, err := dial(c.amqpURL)
 	if err != nil {
 		return err
 	}
-	c.conn = &realConn{conn}
+	c.conn = conn
 	return nil
 }
 
@@ -77,19 +141,51 @@ func (c *Consumer) newChannel() (amqpChannel, error) {
 	return c.conn.Channel()
 }
 
+// Consume starts consuming queue with the default QueueOpt.
 func (c *Consumer) Consume(queue string, handler Handler, middlewares ...Middleware) {
-	// Apply middleware right-to-left so the first one listed is the outermost wrapper.
-	h := handler
+	c.ConsumeWithOpt(queue, QueueOpt{}, handler, middlewares...)
+}
+
+// ConsumeWithOpt starts consuming queue with opt.Workers concurrent handlers.
+// Failed fire-and-forget messages are retried with exponential backoff and
+// dead-lettered to DeadLetterQueue(queue) after opt.MaxAttempts, or at once
+// when Classify doesn't find the error retryable.
+func (c *Consumer) ConsumeWithOpt(queue string, opt QueueOpt, handler Handler, middlewares ...Middleware) {
+	c.consume(queue, nil, opt, handler, middlewares...)
+}
+
+// binding attaches a consumer's queue to an exchange.
+type binding struct {
+	exchange string
+	key      string
+}
+
+// consume runs the consumer loop for queue, binding it to bind first when
+// it is set.
+func (c *Consumer) consume(queue string, bind *binding, opt QueueOpt, handler Handler, middlewares ...Middleware) {
+	opt = opt.withDefaults()
+
+	// Apply middleware right-to-left so the first one listed is the outermost
+	// wrapper. UseRecover always wraps the handler itself so a panic can't
+	// take the worker down.
+	h := UseRecover()(queue, handler)
 	for i := len(middlewares) - 1; i >= 0; i-- {
 		h = middlewares[i](queue, h)
 	}
 
+	c.loops.Add(1)
 	go func() {
+		defer c.loops.Done()
 		for {
-			ch, msgs, err := c.startConsuming(queue)
+			if c.draining.Load() {
+				return
+			}
+			ch, tag, msgs, err := c.startConsuming(queue, bind, opt)
 			if err != nil {
 				c.logger.WithError(err).Errorf("mq: failed to start consuming %s, reconnecting in 5s", queue)
-				time.Sleep(5 * time.Second)
+				if !c.sleep(5 * time.Second) {
+					return
+				}
 				if err := c.connect(); err != nil {
 					c.logger.WithError(err).Error("mq: reconnect failed")
 				}
@@ -98,85 +194,160 @@ func (c *Consumer) Consume(queue string, handler Handler, middlewares ...Middlew
 
 			c.logger.Infof("mq consumer listening on %s", queue)
 
-			for msg := range msgs {
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-				ctx = context.WithValue(ctx, requestIDKey, uuid.New().String())
-				response, err := h(ctx, msg.Body)
-				cancel()
-				if err != nil {
-					c.logger.WithError(err).Error("mq: handler failed")
-					if msg.ReplyTo != "" {
-						var rmqErr *Error
-						if !errors.As(err, &rmqErr) {
-							rmqErr = NewError(500, err.Error())
-						}
-						envBody, merr := wrapError(rmqErr)
-						if merr != nil {
-							c.logger.WithError(merr).Error("mq: failed to marshal error response, nacking")
-							msg.Nack(false, !msg.Redelivered)
-							continue
-						}
-						if perr := ch.Publish("", msg.ReplyTo, false, false, amqp.Publishing{
-							ContentType:   "application/json",
-							CorrelationId: msg.CorrelationId,
-							Body:          envBody,
-						}); perr != nil {
-							c.logger.WithError(perr).Error("mq: failed to publish error reply, nacking")
-							msg.Nack(false, !msg.Redelivered)
-							continue
-						}
-						msg.Ack(false)
-					} else {
-						msg.Nack(false, !msg.Redelivered)
-					}
-					continue
-				}
-
-				if msg.ReplyTo != "" && response != nil {
-					envBody, merr := wrapSuccess(response)
-					if merr != nil {
-						c.logger.WithError(merr).Error("mq: failed to marshal success response, nacking")
-						msg.Nack(false, !msg.Redelivered)
-						continue
-					}
-					if perr := ch.Publish("", msg.ReplyTo, false, false, amqp.Publishing{
-						ContentType:   "application/json",
-						CorrelationId: msg.CorrelationId,
-						Body:          envBody,
-					}); perr != nil {
-						c.logger.WithError(perr).Error("mq: failed to publish success reply, nacking")
-						msg.Nack(false, !msg.Redelivered)
-						continue
+			// Every worker drains the same delivery channel; the broker never
+			// hands out more than opt.Prefetch unacked messages at once.
+			// msgs is closed when the consumer is cancelled or the channel
+			// dies, after the deliveries already received have been handled.
+			var wg sync.WaitGroup
+			for range opt.Workers {
+				wg.Go(func() {
+					for msg := range msgs {
+						c.handle(ch, queue, opt, h, msg)
 					}
-				}
-				msg.Ack(false)
+				})
 			}
+			wg.Wait()
 
+			c.mu.Lock()
+			delete(c.active, tag)
+			c.mu.Unlock()
 			ch.Close()
+			if c.draining.Load() {
+				c.logger.Infof("mq: consumer for %s drained", queue)
+				return
+			}
 			c.logger.Warnf("mq: consumer channel closed for %s, reconnecting...", queue)
 			if err := c.connect(); err != nil {
 				c.logger.WithError(err).Error("mq: reconnect failed, retrying in 5s")
-				time.Sleep(5 * time.Second)
+				if !c.sleep(5 * time.Second) {
+					return
+				}
 			}
 		}
 	}()
 }
 
-func (c *Consumer) startConsuming(queue string) (amqpChannel, <-chan amqp.Delivery, error) {
+// sleep waits for d and reports false if the consumer started draining
+// in the meantime.
+func (c *Consumer) sleep(d time.Duration) bool {
+	select {
+	case <-c.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// handle runs h on a single delivery and acks, replies, retries or nacks it.
+// It is called from several workers at once; amqp091 channels serialize
+// publishes and acks internally, so ch can be shared between them.
+func (c *Consumer) handle(ch amqpChannel, queue string, opt QueueOpt, h Handler, msg amqp.Delivery) {
+	ctx, cancel, ok := handlerContext(msg)
+	if !ok {
+		// The caller has already timed out; its reply would be dropped.
+		c.logger.WithField("queue", queue).Warn("mq: caller deadline passed, skipping message")
+		msg.Ack(false)
+		return
+	}
+	requestID, _ := msg.Headers[tracing.HeaderRequestID].(string)
+	ctx = tracing.WithRequestID(ctx, tracing.EnsureRequestID(requestID))
+	ctx = context.WithValue(ctx, contentTypeKey, msg.ContentType)
+	ctx = context.WithValue(ctx, messageIDKey, msg.MessageId)
+	ctx, span := startProcessSpan(ctx, queue, msg)
+	response, err := h(ctx, msg.Body)
+	tracing.End(span, err)
+	cancel()
+	if err != nil {
+		c.logger.WithContext(ctx).WithError(err).WithField("class", Classify(err)).Error("mq: handler failed")
+		if msg.ReplyTo == "" {
+			c.retryOrDeadLetter(ch, queue, opt, msg, err)
+			return
+		}
+		var rmqErr *Error
+		if !errors.As(err, &rmqErr) {
+			rmqErr = NewError(500, err.Error())
+		}
+		pub, merr := replyPublishing(msg, nil, rmqErr)
+		if merr != nil {
+			c.logger.WithError(merr).Error("mq: failed to marshal error response, nacking")
+			c.reject(msg, Permanent(merr))
+			return
+		}
+		if perr := ch.Publish("", msg.ReplyTo, false, false, pub); perr != nil {
+			c.logger.WithError(perr).Error("mq: failed to publish error reply, nacking")
+			c.reject(msg, perr)
+			return
+		}
+		msg.Ack(false)
+		return
+	}
+
+	if msg.ReplyTo != "" && response != nil {
+		pub, merr := replyPublishing(msg, response, nil)
+		if merr != nil {
+			c.logger.WithError(merr).Error("mq: failed to marshal success response, nacking")
+			c.reject(msg, Permanent(merr))
+			return
+		}
+		if perr := ch.Publish("", msg.ReplyTo, false, false, pub); perr != nil {
+			c.logger.WithError(perr).Error("mq: failed to publish success reply, nacking")
+			c.reject(msg, perr)
+			return
+		}
+	}
+	msg.Ack(false)
+}
+
+// reject nacks a message the consumer could not settle, requeueing it when
+// cause is retryable, such as a reply that failed to publish, and dropping
+// it otherwise.
+func (c *Consumer) reject(msg amqp.Delivery, cause error) {
+	msg.Nack(false, Classify(cause) == ClassRetryable)
+}
+
+func (c *Consumer) startConsuming(queue string, bind *binding, opt QueueOpt) (amqpChannel, string, <-chan amqp.Delivery, error) {
 	ch, err := c.newChannel()
 	if err != nil {
-		return nil, nil, err
+		return nil, "", nil, err
 	}
 	if _, err := ch.QueueDeclare(queue, true, false, false, false, nil); err != nil {
 		ch.Close()
-		return nil, nil, err
+		return nil, "", nil, err
+	}
+	if bind != nil {
+		if err := declareExchange(ch, bind.exchange); err != nil {
+			ch.Close()
+			return nil, "", nil, err
+		}
+		if err := ch.QueueBind(queue, bind.key, bind.exchange, false, nil); err != nil {
+			ch.Close()
+			return nil, "", nil, err
+		}
+	}
+	if err := declareRetryQueues(ch, queue, opt); err != nil {
+		ch.Close()
+		return nil, "", nil, err
 	}
-	msgs, err := ch.Consume(queue, "", false, false, false, false, nil)
+	if err := ch.Qos(opt.Prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, "", nil, err
+	}
+	tag := fmt.Sprintf("%s.%s", queue, uuid.New().String())
+	msgs, err := ch.Consume(queue, tag, false, false, false, false, nil)
 	if err != nil {
 		ch.Close()
-		return nil, nil, err
+		return nil, "", nil, err
+	}
+
+	c.mu.Lock()
+	c.active[tag] = ch
+	c.mu.Unlock()
+	// Shutdown may have run between the draining check and the registration
+	// above; cancel right away so the loop doesn't outlive it.
+	if c.draining.Load() {
+		ch.Cancel(tag, false)
 	}
-	return ch, msgs, nil
+	return ch, tag, msgs, nil
 }
 
 func (c *Consumer) Healthy() bool {
@@ -185,6 +356,12 @@ func (c *Consumer) Healthy() bool {
 	return c.conn != nil && !c.conn.IsClosed()
 }
 
+// Ready reports whether the consumer is connected and taking new messages.
+// It turns false as soon as Shutdown starts draining.
+func (c *Consumer) Ready() bool {
+	return !c.draining.Load() && c.Healthy()
+}
+
 func (c *Consumer) Close() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -193,10 +370,53 @@ func (c *Consumer) Close() {
 	}
 }
 
-// Wait blocks until SIGINT or SIGTERM is received, then logs shutdown.
-func (c *Consumer) Wait() {
+// Shutdown cancels every consumer so the broker stops delivering, waits for
+// in-flight handlers to ack and reply until ctx is done, then closes the
+// connection. Messages still unacked at that point are redelivered by the
+// broker to another instance.
+func (c *Consumer) Shutdown(ctx context.Context) error {
+	c.stopOnce.Do(func() {
+		c.draining.Store(true)
+		close(c.stop)
+	})
+
+	c.mu.Lock()
+	for tag, ch := range c.active {
+		if err := ch.Cancel(tag, false); err != nil {
+			c.logger.WithError(err).Warnf("mq: failed to cancel consumer %s", tag)
+		}
+	}
+	c.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		c.loops.Wait()
+		close(drained)
+	}()
+
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	c.Close()
+	return err
+}
+
+// Wait blocks until SIGINT or SIGTERM is received, then drains in-flight
+// messages for up to grace before closing the connection.
+func (c *Consumer) Wait(grace time.Duration) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	c.logger.Info("shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != nil {
+		c.logger.WithError(err).Warn("mq: grace period expired before in-flight messages drained")
+		return
+	}
+	c.logger.Info("mq: drained")
 }
@@ -14,9 +14,10 @@ import (
 )
 
 type mockAck struct {
-	mu     sync.Mutex
-	acked  bool
-	nacked bool
+	mu       sync.Mutex
+	acked    bool
+	nacked   bool
+	requeued bool
 }
 
 func (m *mockAck) Ack(_ uint64, _ bool) error {
@@ -26,10 +27,11 @@ func (m *mockAck) Ack(_ uint64, _ bool) error {
 	return nil
 }
 
-func (m *mockAck) Nack(_ uint64, _, _ bool) error {
+func (m *mockAck) Nack(_ uint64, _, requeue bool) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	m.nacked = true
+	m.requeued = requeue
 	return nil
 }
 
@@ -51,15 +53,45 @@ type mockChannel struct {
 	mu         sync.Mutex
 	msgs       chan amqp.Delivery
 	published  []amqp.Publishing
+	keys       []string
+	declared   map[string]amqp.Table
+	bindings   []string
+	prefetch   int
+	cancelled  []string
 	publishErr error
 	queueErr   error
 	consumeErr error
+	// Publisher confirms: once confirming, each publish is acked, nacked
+	// with nack, returned as unroutable with unroutable, or left
+	// unconfirmed with silent.
+	confirming bool
+	publishSeq uint64
+	confirms   chan amqp.Confirmation
+	returns    chan amqp.Return
+	nack       bool
+	unroutable bool
+	silent     bool
+}
+
+func (m *mockChannel) QueueDeclare(name string, _, _, _, _ bool, args amqp.Table) (amqp.Queue, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.declared == nil {
+		m.declared = map[string]amqp.Table{}
+	}
+	m.declared[name] = args
+	return amqp.Queue{Name: name}, m.queueErr
 }
 
-func (m *mockChannel) QueueDeclare(name string, _, _, _, _ bool, _ amqp.Table) (amqp.Queue, error) {
-	return amqp.Queue{Name: name}, m.queueErr
+func (m *mockChannel) QueueBind(name, key, exchange string, _ bool, _ amqp.Table) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bindings = append(m.bindings, exchange+":"+key+":"+name)
+	return nil
 }
 
+func (m *mockChannel) ExchangeDeclare(_, _ string, _, _, _, _ bool, _ amqp.Table) error { return nil }
+
 func (m *mockChannel) Consume(_, _ string, _, _, _, _ bool, _ amqp.Table) (<-chan amqp.Delivery, error) {
 	if m.consumeErr != nil {
 		return nil, m.consumeErr
@@ -67,11 +99,62 @@ func (m *mockChannel) Consume(_, _ string, _, _, _, _ bool, _ amqp.Table) (<-cha
 	return m.msgs, nil
 }
 
-func (m *mockChannel) Publish(_, _ string, _, _ bool, msg amqp.Publishing) error {
+func (m *mockChannel) Publish(exchange, key string, mandatory, _ bool, msg amqp.Publishing) error {
 	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.published = append(m.published, msg)
-	m.mu.Unlock()
-	return m.publishErr
+	m.keys = append(m.keys, key)
+	if m.publishErr != nil || !m.confirming {
+		return m.publishErr
+	}
+	m.publishSeq++
+	if mandatory && m.unroutable && m.returns != nil {
+		m.returns <- amqp.Return{Exchange: exchange, RoutingKey: key, MessageId: msg.MessageId}
+	}
+	if !m.silent && m.confirms != nil {
+		m.confirms <- amqp.Confirmation{DeliveryTag: m.publishSeq, Ack: !m.nack}
+	}
+	return nil
+}
+
+func (m *mockChannel) Confirm(bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.confirming = true
+	return nil
+}
+
+func (m *mockChannel) NotifyPublish(c chan amqp.Confirmation) chan amqp.Confirmation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.confirms = c
+	return c
+}
+
+func (m *mockChannel) NotifyReturn(c chan amqp.Return) chan amqp.Return {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.returns = c
+	return c
+}
+
+func (m *mockChannel) Qos(prefetchCount, _ int, _ bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prefetch = prefetchCount
+	return nil
+}
+
+// Cancel mirrors the broker: the delivery channel is closed once the
+// consumer is cancelled.
+func (m *mockChannel) Cancel(consumer string, _ bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.cancelled) == 0 {
+		close(m.msgs)
+	}
+	m.cancelled = append(m.cancelled, consumer)
+	return nil
 }
 
 func (m *mockChannel) Close() error { return nil }
@@ -86,12 +169,29 @@ func (m *mockChannel) lastPublished() *amqp.Publishing {
 	return &p
 }
 
+func (m *mockChannel) lastRoutingKey() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.keys) == 0 {
+		return ""
+	}
+	return m.keys[len(m.keys)-1]
+}
+
+func (m *mockChannel) declaredArgs(name string) (amqp.Table, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	args, ok := m.declared[name]
+	return args, ok
+}
+
 type mockConn struct {
 	mu          sync.Mutex
 	closed      bool
 	closeCalled bool
 	ch          amqpChannel
 	channelErr  error
+	notify      chan *amqp.Error
 }
 
 func (m *mockConn) Close() error {
@@ -111,6 +211,23 @@ func (m *mockConn) Channel() (amqpChannel, error) {
 	return m.ch, m.channelErr
 }
 
+func (m *mockConn) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notify = receiver
+	return receiver
+}
+
+// drop simulates the broker closing the connection.
+func (m *mockConn) drop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	if m.notify != nil {
+		m.notify <- amqp.ErrClosed
+	}
+}
+
 func (m *mockConn) wasCloseCalled() bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -120,7 +237,9 @@ func (m *mockConn) wasCloseCalled() bool {
 func newTestConsumer(conn amqpConnection) *Consumer {
 	logger := logrus.New()
 	logger.SetOutput(io.Discard)
-	return &Consumer{conn: conn, logger: logger}
+	c := newConsumer("", logger)
+	c.conn = conn
+	return c
 }
 
 func newMockSetup() (*mockConn, *mockChannel) {
@@ -301,7 +420,44 @@ func TestConsume_successPublishFails_nacks(t *testing.T) {
 	}
 }
 
-func TestConsume_handlerErrorNoReplyTo_nacks(t *testing.T) {
+func TestConsume_replyPublishFails_requeues(t *testing.T) {
+	conn, ch := newMockSetup()
+	ch.publishErr = errors.New("broker down")
+	c := newTestConsumer(conn)
+	c.Consume("q", func(_ context.Context, _ []byte) ([]byte, error) {
+		return []byte(`{}`), nil
+	})
+
+	ack := &mockAck{}
+	ch.msgs <- delivery(ack, []byte("body"), "reply-queue")
+
+	waitFor(t, ack.wasNacked)
+	ack.mu.Lock()
+	defer ack.mu.Unlock()
+	if !ack.requeued {
+		t.Fatal("expected a failed reply publish to requeue the message")
+	}
+}
+
+func TestConsume_replyMarshalFails_dropsWithoutRequeue(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	c.Consume("q", func(_ context.Context, _ []byte) ([]byte, error) {
+		return []byte("not json"), nil
+	})
+
+	ack := &mockAck{}
+	ch.msgs <- delivery(ack, []byte("body"), "reply-queue")
+
+	waitFor(t, ack.wasNacked)
+	ack.mu.Lock()
+	defer ack.mu.Unlock()
+	if ack.requeued {
+		t.Fatal("expected an unencodable reply not to be requeued")
+	}
+}
+
+func TestConsume_handlerErrorNoReplyTo_schedulesRetryAndAcks(t *testing.T) {
 	conn, ch := newMockSetup()
 	c := newTestConsumer(conn)
 	handler := func(_ context.Context, _ []byte) ([]byte, error) {
@@ -312,12 +468,30 @@ func TestConsume_handlerErrorNoReplyTo_nacks(t *testing.T) {
 	ack := &mockAck{}
 	ch.msgs <- delivery(ack, []byte("body"), "")
 
+	waitFor(t, ack.wasAcked)
+	if ack.wasNacked() {
+		t.Fatal("should not have nacked once the retry was published")
+	}
+	if key := ch.lastRoutingKey(); key != "q.retry.1s" {
+		t.Fatalf("expected retry on %q, got %q", "q.retry.1s", key)
+	}
+}
+
+func TestConsume_handlerErrorNoReplyTo_retryPublishFails_nacks(t *testing.T) {
+	conn, ch := newMockSetup()
+	ch.publishErr = errors.New("broker down")
+	c := newTestConsumer(conn)
+	handler := func(_ context.Context, _ []byte) ([]byte, error) {
+		return nil, errors.New("handler failed")
+	}
+	c.Consume("q", handler)
+
+	ack := &mockAck{}
+	ch.msgs <- delivery(ack, []byte("body"), "")
+
 	waitFor(t, ack.wasNacked)
 	if ack.wasAcked() {
-		t.Fatal("should not have acked on handler error")
-	}
-	if ch.lastPublished() != nil {
-		t.Fatal("should not publish when no ReplyTo")
+		t.Fatal("should not have acked when the retry could not be published")
 	}
 }
 
@@ -423,3 +597,138 @@ func TestConsume_correlationIDCopiedToReply(t *testing.T) {
 		t.Fatalf("expected correlation ID %q, got %q", "corr-123", pub.CorrelationId)
 	}
 }
+
+func TestConsumeWithOpt_setsPrefetch(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	c.ConsumeWithOpt("q", QueueOpt{Workers: 4, Prefetch: 16}, func(_ context.Context, _ []byte) ([]byte, error) {
+		return nil, nil
+	})
+
+	waitFor(t, func() bool {
+		ch.mu.Lock()
+		defer ch.mu.Unlock()
+		return ch.prefetch == 16
+	})
+}
+
+func TestConsumeWithOpt_workersHandleConcurrently(t *testing.T) {
+	conn, ch := newMockSetup()
+	ch.msgs = make(chan amqp.Delivery, 3)
+	c := newTestConsumer(conn)
+
+	// Each handler blocks until all three are running at once, which only
+	// happens if three workers pull from the queue in parallel.
+	var running sync.WaitGroup
+	running.Add(3)
+	release := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(release)
+	}()
+	c.ConsumeWithOpt("q", QueueOpt{Workers: 3}, func(_ context.Context, _ []byte) ([]byte, error) {
+		running.Done()
+		<-release
+		return []byte(`"ok"`), nil
+	})
+
+	acks := []*mockAck{{}, {}, {}}
+	for i, ack := range acks {
+		d := delivery(ack, []byte("body"), "reply-queue")
+		d.CorrelationId = string(rune('a' + i))
+		ch.msgs <- d
+	}
+	for _, ack := range acks {
+		waitFor(t, ack.wasAcked)
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if len(ch.published) != 3 {
+		t.Fatalf("expected 3 replies, got %d", len(ch.published))
+	}
+}
+
+func TestReady_falseWhileDraining(t *testing.T) {
+	conn, _ := newMockSetup()
+	c := newTestConsumer(conn)
+	if !c.Ready() {
+		t.Fatal("expected ready before shutdown")
+	}
+	c.draining.Store(true)
+	if c.Ready() {
+		t.Fatal("expected not ready while draining")
+	}
+}
+
+func TestShutdown_waitsForInflightHandlerToAckAndReply(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	c.Consume("q", func(_ context.Context, _ []byte) ([]byte, error) {
+		close(started)
+		<-release
+		return []byte(`"done"`), nil
+	})
+
+	ack := &mockAck{}
+	ch.msgs <- delivery(ack, []byte("body"), "reply-queue")
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- c.Shutdown(context.Background()) }()
+
+	waitFor(t, func() bool { return !c.Ready() })
+	if conn.wasCloseCalled() {
+		t.Fatal("connection closed while a handler was still running")
+	}
+	close(release)
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("shutdown did not finish after the handler returned")
+	}
+	if !ack.wasAcked() {
+		t.Fatal("expected in-flight message to be acked before close")
+	}
+	if ch.lastPublished() == nil {
+		t.Fatal("expected reply to be published before close")
+	}
+	if !conn.wasCloseCalled() {
+		t.Fatal("expected connection to be closed after draining")
+	}
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if len(ch.cancelled) != 1 {
+		t.Fatalf("expected consumer tag to be cancelled, got %v", ch.cancelled)
+	}
+}
+
+func TestShutdown_gracePeriodExpires(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	c.Consume("q", func(_ context.Context, _ []byte) ([]byte, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+
+	ch.msgs <- delivery(&mockAck{}, []byte("body"), "")
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if !conn.wasCloseCalled() {
+		t.Fatal("expected connection to be closed once the grace period expired")
+	}
+}
@@ -0,0 +1,65 @@
+package rmq
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// HeaderDeadline carries the caller's deadline as Unix milliseconds so the
+// consumer can bound the handler by it and skip requests nobody waits for.
+const HeaderDeadline = "x-deadline"
+
+const (
+	// defaultRequestTimeout bounds a Request whose ctx has no deadline.
+	defaultRequestTimeout = 30 * time.Second
+	// defaultHandlerTimeout bounds a handler when the message has no deadline,
+	// e.g. fire-and-forget publishes.
+	defaultHandlerTimeout = 5 * time.Minute
+)
+
+// setDeadline stamps msg with the remaining time of deadline: Expiration lets
+// the broker drop it if it is still queued when the caller gives up, and the
+// header lets the consumer derive the handler context from it.
+func setDeadline(msg *amqp.Publishing, deadline time.Time) {
+	remaining := time.Until(deadline).Milliseconds()
+	if remaining < 1 {
+		remaining = 1
+	}
+	msg.Expiration = strconv.FormatInt(remaining, 10)
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	msg.Headers[HeaderDeadline] = deadline.UnixMilli()
+}
+
+// deadlineOf returns the caller deadline carried by msg, if any.
+func deadlineOf(msg amqp.Delivery) (time.Time, bool) {
+	switch v := msg.Headers[HeaderDeadline].(type) {
+	case int64:
+		return time.UnixMilli(v), true
+	case int32:
+		return time.UnixMilli(int64(v)), true
+	case int:
+		return time.UnixMilli(int64(v)), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// handlerContext derives the context a handler runs under from msg. It returns
+// false when the caller's deadline has already passed.
+func handlerContext(msg amqp.Delivery) (context.Context, context.CancelFunc, bool) {
+	deadline, ok := deadlineOf(msg)
+	if !ok {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultHandlerTimeout)
+		return ctx, cancel, true
+	}
+	if !time.Now().Before(deadline) {
+		return nil, nil, false
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	return ctx, cancel, true
+}
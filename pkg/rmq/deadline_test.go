@@ -0,0 +1,120 @@
+package rmq
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestSetDeadline_setsExpirationAndHeader(t *testing.T) {
+	deadline := time.Now().Add(2 * time.Second)
+	msg := amqp.Publishing{}
+	setDeadline(&msg, deadline)
+
+	exp, err := strconv.Atoi(msg.Expiration)
+	if err != nil {
+		t.Fatalf("expiration is not an integer: %q", msg.Expiration)
+	}
+	if exp <= 0 || exp > 2000 {
+		t.Fatalf("expected expiration in (0, 2000], got %d", exp)
+	}
+	if msg.Headers[HeaderDeadline] != deadline.UnixMilli() {
+		t.Fatalf("expected deadline header %d, got %v", deadline.UnixMilli(), msg.Headers[HeaderDeadline])
+	}
+}
+
+func TestSetDeadline_pastDeadlineKeepsPositiveExpiration(t *testing.T) {
+	msg := amqp.Publishing{}
+	setDeadline(&msg, time.Now().Add(-time.Second))
+	if msg.Expiration != "1" {
+		t.Fatalf("expected expiration %q, got %q", "1", msg.Expiration)
+	}
+}
+
+func TestHandlerContext_noHeader_usesDefaultTimeout(t *testing.T) {
+	ctx, cancel, ok := handlerContext(amqp.Delivery{})
+	if !ok {
+		t.Fatal("expected message without deadline to be handled")
+	}
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	if time.Until(deadline) < defaultHandlerTimeout-time.Second {
+		t.Fatalf("expected default handler timeout, got %s", time.Until(deadline))
+	}
+}
+
+func TestHandlerContext_usesCallerDeadline(t *testing.T) {
+	want := time.Now().Add(3 * time.Second)
+	ctx, cancel, ok := handlerContext(amqp.Delivery{Headers: amqp.Table{HeaderDeadline: want.UnixMilli()}})
+	if !ok {
+		t.Fatal("expected message to be handled")
+	}
+	defer cancel()
+	got, _ := ctx.Deadline()
+	if got.UnixMilli() != want.UnixMilli() {
+		t.Fatalf("expected deadline %v, got %v", want, got)
+	}
+}
+
+func TestHandlerContext_expiredDeadline_skips(t *testing.T) {
+	past := time.Now().Add(-time.Second).UnixMilli()
+	if _, _, ok := handlerContext(amqp.Delivery{Headers: amqp.Table{HeaderDeadline: past}}); ok {
+		t.Fatal("expected expired message to be skipped")
+	}
+}
+
+func TestConsume_expiredDeadline_acksWithoutCallingHandler(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	called := make(chan struct{}, 1)
+	handler := func(_ context.Context, _ []byte) ([]byte, error) {
+		called <- struct{}{}
+		return []byte(`"late"`), nil
+	}
+	c.Consume("q", handler)
+
+	ack := &mockAck{}
+	d := delivery(ack, []byte("body"), "reply-queue")
+	d.Headers = amqp.Table{HeaderDeadline: time.Now().Add(-time.Second).UnixMilli()}
+	ch.msgs <- d
+
+	waitFor(t, ack.wasAcked)
+	select {
+	case <-called:
+		t.Fatal("handler should not run once the caller has given up")
+	default:
+	}
+	if ch.lastPublished() != nil {
+		t.Fatal("should not reply to an expired request")
+	}
+}
+
+func TestConsume_handlerContextCarriesCallerDeadline(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	deadlines := make(chan time.Time, 1)
+	handler := func(ctx context.Context, _ []byte) ([]byte, error) {
+		d, _ := ctx.Deadline()
+		deadlines <- d
+		return nil, nil
+	}
+	c.Consume("q", handler)
+
+	want := time.Now().Add(10 * time.Second)
+	ack := &mockAck{}
+	d := delivery(ack, []byte("body"), "")
+	d.Headers = amqp.Table{HeaderDeadline: want.UnixMilli()}
+	ch.msgs <- d
+
+	select {
+	case got := <-deadlines:
+		if got.UnixMilli() != want.UnixMilli() {
+			t.Fatalf("expected deadline %v, got %v", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+}
@@ -0,0 +1,235 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeadLetterMessage is a message read from a dead-letter queue, with the
+// headers the consumer wrote when it gave up on it.
+type DeadLetterMessage struct {
+	MessageID      string
+	CorrelationID  string
+	ContentType    string
+	Type           string
+	AppID          string
+	Timestamp      time.Time
+	Attempts       int
+	LastError      string
+	OriginalQueue  string
+	DeadLetteredAt time.Time
+	Headers        amqp.Table
+	Body           []byte
+}
+
+func newDeadLetterMessage(d amqp.Delivery) DeadLetterMessage {
+	m := DeadLetterMessage{
+		MessageID:     d.MessageId,
+		CorrelationID: d.CorrelationId,
+		ContentType:   d.ContentType,
+		Type:          d.Type,
+		AppID:         d.AppId,
+		Timestamp:     d.Timestamp,
+		Attempts:      attempts(d),
+		Headers:       d.Headers,
+		Body:          d.Body,
+	}
+	m.LastError, _ = d.Headers[HeaderLastError].(string)
+	m.OriginalQueue, _ = d.Headers[HeaderOriginalQueue].(string)
+	if at, ok := d.Headers[HeaderDeadLetteredAt].(string); ok {
+		m.DeadLetteredAt, _ = time.Parse(time.RFC3339, at)
+	}
+	return m
+}
+
+// Decode unmarshals the body with the codec of its content type. Events
+// come back as *Event, anything else as the codec decodes it into an any.
+func (m DeadLetterMessage) Decode() (any, error) {
+	codec, err := CodecFor(m.ContentType)
+	if err != nil {
+		return nil, err
+	}
+	// PublishEvent sets the topic as Type and the source as AppId.
+	if m.Type != "" && m.AppID != "" {
+		var ev Event
+		if err := codec.Unmarshal(m.Body, &ev); err == nil && ev.Topic == m.Type {
+			return &ev, nil
+		}
+	}
+	var v any
+	if err := codec.Unmarshal(m.Body, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// DLQFilter selects dead-lettered messages. Zero fields match everything.
+type DLQFilter struct {
+	// Key matches the message ID exactly.
+	Key string
+	// Since and Until bound when the message was dead-lettered, falling back
+	// to when it was first published.
+	Since time.Time
+	Until time.Time
+	// Error matches a substring of the last handler error.
+	Error string
+	// Limit caps the number of messages returned.
+	Limit int
+}
+
+func (f DLQFilter) match(m DeadLetterMessage) bool {
+	at := m.DeadLetteredAt
+	if at.IsZero() {
+		at = m.Timestamp
+	}
+	switch {
+	case f.Key != "" && m.MessageID != f.Key:
+		return false
+	case !f.Since.IsZero() && at.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && at.After(f.Until):
+		return false
+	case f.Error != "" && !strings.Contains(m.LastError, f.Error):
+		return false
+	}
+	return true
+}
+
+// ListDeadLetters returns the messages in DeadLetterQueue(queue) that match
+// filter. Every message is read unacked and requeued when the channel
+// closes, so the queue is left as it was apart from the redelivered flag.
+func ListDeadLetters(ctx context.Context, amqpURL, queue string, filter DLQFilter) ([]DeadLetterMessage, error) {
+	return scanDeadLetters(ctx, amqpURL, queue, filter, nil)
+}
+
+// ReplayDeadLetters moves the matching messages of DeadLetterQueue(queue)
+// back to the queue they were dead-lettered from, with their attempt count
+// and failure headers cleared, and returns them. Each is removed from the
+// dead-letter queue only once the broker has confirmed its copy. With
+// dryRun it only lists them.
+func ReplayDeadLetters(ctx context.Context, amqpURL, queue string, filter DLQFilter, dryRun bool) ([]DeadLetterMessage, error) {
+	if dryRun {
+		return ListDeadLetters(ctx, amqpURL, queue, filter)
+	}
+	return scanDeadLetters(ctx, amqpURL, queue, filter, func(ch amqpChannel, confirms <-chan amqp.Confirmation, returns <-chan amqp.Return, d amqp.Delivery, m DeadLetterMessage) error {
+		target := m.OriginalQueue
+		if target == "" {
+			target = queue
+		}
+		headers := amqp.Table{}
+		for k, v := range d.Headers {
+			switch k {
+			case HeaderAttempts, HeaderLastError, HeaderOriginalQueue, HeaderDeadLetteredAt:
+				continue
+			}
+			headers[k] = v
+		}
+		// Mandatory, so a queue that no longer exists fails the replay
+		// instead of silently dropping the message.
+		if err := ch.Publish("", target, true, false, amqp.Publishing{
+			Headers:       headers,
+			ContentType:   d.ContentType,
+			CorrelationId: d.CorrelationId,
+			MessageId:     d.MessageId,
+			Timestamp:     d.Timestamp,
+			Type:          d.Type,
+			AppId:         d.AppId,
+			DeliveryMode:  amqp.Persistent,
+			Body:          d.Body,
+		}); err != nil {
+			return err
+		}
+		select {
+		case conf, ok := <-confirms:
+			if !ok {
+				return ErrConnectionLost
+			}
+			if !conf.Ack {
+				return ErrPublishNacked
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		// The broker sends a return before the confirm of its message.
+		select {
+		case <-returns:
+			return fmt.Errorf("%w: %s", ErrPublishReturned, target)
+		default:
+		}
+		return d.Ack(false)
+	})
+}
+
+// scanDeadLetters reads every message currently in DeadLetterQueue(queue)
+// and calls replay, when set, on each one that matches filter. For replay
+// the channel is in confirm mode and listens for returns. Messages replay
+// doesn't ack are requeued when the channel closes.
+func scanDeadLetters(
+	ctx context.Context,
+	amqpURL, queue string,
+	filter DLQFilter,
+	replay func(ch amqpChannel, confirms <-chan amqp.Confirmation, returns <-chan amqp.Return, d amqp.Delivery, m DeadLetterMessage) error,
+) ([]DeadLetterMessage, error) {
+	conn, err := dial(amqpURL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Close()
+
+	var confirms chan amqp.Confirmation
+	var returns chan amqp.Return
+	if replay != nil {
+		confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+		returns = ch.NotifyReturn(make(chan amqp.Return, 1))
+		if err := ch.Confirm(false); err != nil {
+			return nil, err
+		}
+	}
+	q, err := ch.QueueDeclare(DeadLetterQueue(queue), true, false, false, false, nil)
+	if err != nil || q.Messages == 0 {
+		return nil, err
+	}
+	deliveries, err := ch.Consume(q.Name, "", false, false, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var found []DeadLetterMessage
+	// Stop at the count taken when the scan started; anything dead-lettered
+	// since, or requeued by us, would otherwise be read again.
+	for range q.Messages {
+		if filter.Limit > 0 && len(found) >= filter.Limit {
+			break
+		}
+		var d amqp.Delivery
+		select {
+		case msg, ok := <-deliveries:
+			if !ok {
+				return found, ErrConnectionLost
+			}
+			d = msg
+		case <-ctx.Done():
+			return found, ctx.Err()
+		}
+		m := newDeadLetterMessage(d)
+		if !filter.match(m) {
+			continue
+		}
+		if replay != nil {
+			if err := replay(ch, confirms, returns, d, m); err != nil {
+				return found, err
+			}
+		}
+		found = append(found, m)
+	}
+	return found, nil
+}
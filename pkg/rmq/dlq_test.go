@@ -0,0 +1,156 @@
+package rmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+)
+
+// deadLetter publishes a message to the dead-letter queue of queue the way
+// retryOrDeadLetter does.
+func deadLetter(t *testing.T, b *MemoryBroker, queue, id, cause string) {
+	t.Helper()
+	conn, _ := dialMemory(b.URL())
+	defer conn.Close()
+	ch, _ := conn.Channel()
+	defer ch.Close()
+	ch.QueueDeclare(DeadLetterQueue(queue), true, false, false, false, nil)
+	if err := ch.Publish("", DeadLetterQueue(queue), false, false, amqp.Publishing{
+		MessageId:   id,
+		ContentType: ContentTypeJSON,
+		Headers: amqp.Table{
+			HeaderAttempts:       int32(5),
+			HeaderLastError:      cause,
+			HeaderOriginalQueue:  queue,
+			HeaderDeadLetteredAt: time.Now().UTC().Format(time.RFC3339),
+		},
+		Body: []byte(`{"id":"` + id + `"}`),
+	}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+}
+
+func TestListDeadLetters_leavesQueueUntouched(t *testing.T) {
+	b := NewMemoryBroker()
+	t.Cleanup(b.Close)
+	deadLetter(t, b, "ledger", "m1", "cassandra: timeout")
+	deadLetter(t, b, "ledger", "m2", "invalid amount")
+
+	msgs, err := ListDeadLetters(context.Background(), b.URL(), "ledger", DLQFilter{})
+	if err != nil {
+		t.Fatalf("ListDeadLetters: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].MessageID != "m1" || msgs[0].Attempts != 5 ||
+		msgs[0].LastError != "cassandra: timeout" || msgs[0].OriginalQueue != "ledger" || msgs[0].DeadLetteredAt.IsZero() {
+		t.Fatalf("unexpected dead letters: %+v", msgs)
+	}
+	if n := b.MessageCount(DeadLetterQueue("ledger")); n != 2 {
+		t.Fatalf("expected both messages still dead-lettered, got %d", n)
+	}
+}
+
+func TestListDeadLetters_filters(t *testing.T) {
+	b := NewMemoryBroker()
+	t.Cleanup(b.Close)
+	deadLetter(t, b, "ledger", "m1", "cassandra: timeout")
+	deadLetter(t, b, "ledger", "m2", "invalid amount")
+	ctx := context.Background()
+
+	cases := []struct {
+		filter DLQFilter
+		want   int
+	}{
+		{DLQFilter{Error: "cassandra"}, 1},
+		{DLQFilter{Key: "m2"}, 1},
+		{DLQFilter{Since: time.Now().Add(time.Hour)}, 0},
+		{DLQFilter{Until: time.Now().Add(time.Hour)}, 2},
+		{DLQFilter{Limit: 1}, 1},
+	}
+	for _, tc := range cases {
+		msgs, err := ListDeadLetters(ctx, b.URL(), "ledger", tc.filter)
+		if err != nil || len(msgs) != tc.want {
+			t.Errorf("%+v: expected %d messages, got %d (%v)", tc.filter, tc.want, len(msgs), err)
+		}
+	}
+}
+
+func TestReplayDeadLetters_movesMatchingMessages(t *testing.T) {
+	b := NewMemoryBroker()
+	t.Cleanup(b.Close)
+	deadLetter(t, b, "ledger", "m1", "cassandra: timeout")
+	deadLetter(t, b, "ledger", "m2", "invalid amount")
+	ctx := context.Background()
+	filter := DLQFilter{Error: "cassandra"}
+
+	if _, err := ReplayDeadLetters(ctx, b.URL(), "ledger", filter, true); err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if n := b.MessageCount("ledger"); n != 0 {
+		t.Fatalf("expected dry run to replay nothing, got %d", n)
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	c, err := NewConsumer(b.URL(), logger)
+	if err != nil {
+		t.Fatalf("NewConsumer: %v", err)
+	}
+	t.Cleanup(func() { c.Shutdown(context.Background()) })
+	got := make(chan context.Context, 1)
+	c.Consume("ledger", func(ctx context.Context, _ []byte) ([]byte, error) {
+		got <- ctx
+		return nil, nil
+	})
+	waitForConsumers(t, c, 1)
+
+	msgs, err := ReplayDeadLetters(ctx, b.URL(), "ledger", filter, false)
+	if err != nil || len(msgs) != 1 || msgs[0].MessageID != "m1" {
+		t.Fatalf("expected m1 replayed, got %+v (%v)", msgs, err)
+	}
+	if n := b.MessageCount(DeadLetterQueue("ledger")); n != 1 {
+		t.Fatalf("expected m2 left dead-lettered, got %d", n)
+	}
+	select {
+	case ctx := <-got:
+		if MessageID(ctx) != "m1" {
+			t.Fatalf("expected m1 back on ledger, got %q", MessageID(ctx))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("replayed message was not delivered")
+	}
+}
+
+func TestReplayDeadLetters_missingQueue_keepsMessage(t *testing.T) {
+	b := NewMemoryBroker()
+	t.Cleanup(b.Close)
+	deadLetter(t, b, "ledger", "m1", "cassandra: timeout")
+
+	if _, err := ReplayDeadLetters(context.Background(), b.URL(), "ledger", DLQFilter{}, false); !errors.Is(err, ErrPublishReturned) {
+		t.Fatalf("expected ErrPublishReturned, got %v", err)
+	}
+	if n := b.MessageCount(DeadLetterQueue("ledger")); n != 1 {
+		t.Fatalf("expected m1 left dead-lettered, got %d", n)
+	}
+}
+
+func TestDeadLetterMessage_Decode(t *testing.T) {
+	ev, _ := NewEvent("inventory", "inventory.changed", 1, map[string]int{"qty": 3})
+	body, _ := json.Marshal(ev)
+	m := DeadLetterMessage{ContentType: ContentTypeJSON, Type: ev.Topic, AppID: ev.Source, Body: body}
+	v, err := m.Decode()
+	if got, ok := v.(*Event); err != nil || !ok || got.ID != ev.ID {
+		t.Fatalf("expected the event back, got %#v (%v)", v, err)
+	}
+
+	m = DeadLetterMessage{Body: []byte(`{"order_id":"o-1"}`)}
+	v, err = m.Decode()
+	if got, ok := v.(map[string]any); err != nil || !ok || got["order_id"] != "o-1" {
+		t.Fatalf("expected a decoded map, got %#v (%v)", v, err)
+	}
+}
@@ -45,6 +45,8 @@ func ConvertHttpError(err error) error {
 	switch rmqErr.Code {
 	case 503:
 		return echo.NewHTTPError(http.StatusServiceUnavailable)
+	case 429:
+		return echo.NewHTTPError(http.StatusTooManyRequests)
 	default:
 		return echo.ErrInternalServerError
 	}
@@ -0,0 +1,162 @@
+package rmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mercury/pkg/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EventsExchange is the topic exchange domain events are published on. The
+// routing key is the event topic, e.g. "inventory.changed".
+const EventsExchange = "mercury.events"
+
+// Event is the envelope every domain event travels in. SchemaVersion is the
+// version of the Data shape for Topic, so subscribers can tell old payloads
+// from new ones while producers roll out a change.
+type Event struct {
+	ID            string          `json:"id"`
+	Topic         string          `json:"topic"`
+	Source        string          `json:"source"`
+	Time          time.Time       `json:"time"`
+	SchemaVersion int             `json:"schema_version"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// Decode unmarshals the event payload into v.
+func (e *Event) Decode(v any) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// EventHandler handles a single event. Returning an error retries the event
+// and dead-letters it after the queue's MaxAttempts, like any other
+// fire-and-forget message.
+type EventHandler func(ctx context.Context, ev *Event) error
+
+// NewEvent wraps payload in an Event with a fresh ID and the current time.
+func NewEvent(source, topic string, schemaVersion int, payload any) (*Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		ID:            uuid.New().String(),
+		Topic:         topic,
+		Source:        source,
+		Time:          time.Now().UTC(),
+		SchemaVersion: schemaVersion,
+		Data:          data,
+	}, nil
+}
+
+// PublishEvent publishes ev on EventsExchange with its topic as routing key.
+// Every queue bound with a matching pattern gets a copy; an event nobody
+// subscribed to is dropped by the broker. Like Publish, it waits for the
+// broker to confirm the event.
+func (p *Publisher) PublishEvent(ctx context.Context, ev *Event) (err error) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	msg := amqp.Publishing{
+		ContentType:  "application/json",
+		MessageId:    ev.ID,
+		Timestamp:    ev.Time,
+		Type:         ev.Topic,
+		AppId:        ev.Source,
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	}
+	span := startPublishSpan(ctx, ev.Topic, trace.SpanKindProducer, &msg)
+	defer func() { tracing.End(span, err) }()
+
+	p.mu.Lock()
+	if err := p.ensureConnected(); err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	if err := declareExchange(p.channel, EventsExchange); err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	// Not mandatory: an event nobody subscribed to is dropped, not returned.
+	done, err := p.publishLocked(EventsExchange, ev.Topic, false, true, msg)
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return p.awaitConfirm(ctx, done)
+}
+
+// EventQueue returns the durable queue service consumes events matching
+// pattern from. Every instance of a service shares it, so each event is
+// handled once per service rather than once per instance.
+func EventQueue(service, pattern string) string {
+	return fmt.Sprintf("%s.events.%s", service, pattern)
+}
+
+// Subscribe handles events whose topic matches pattern with the default
+// QueueOpt. Patterns use topic exchange syntax: "*" matches one word and "#"
+// matches zero or more, so "inventory.*" gets every inventory event.
+func (c *Consumer) Subscribe(service, pattern string, handler EventHandler, middlewares ...Middleware) {
+	c.SubscribeWithOpt(service, pattern, QueueOpt{}, handler, middlewares...)
+}
+
+// SubscribeWithOpt binds EventQueue(service, pattern) to EventsExchange and
+// consumes it with opt. Middlewares see the queue name and the raw envelope.
+func (c *Consumer) SubscribeWithOpt(service, pattern string, opt QueueOpt, handler EventHandler, middlewares ...Middleware) {
+	queue := EventQueue(service, pattern)
+	bind := &binding{exchange: EventsExchange, key: pattern}
+	c.consume(queue, bind, opt, func(ctx context.Context, body []byte) ([]byte, error) {
+		ev := &Event{}
+		if err := json.Unmarshal(body, ev); err != nil {
+			return nil, fmt.Errorf("mq: failed to decode event: %w", err)
+		}
+		return nil, handler(ctx, ev)
+	}, middlewares...)
+}
+
+// Topic ties an event topic to its payload type and schema version, the
+// event counterpart of Route.
+type Topic[T any] struct {
+	Name    string
+	Version int
+	Service Service
+}
+
+// NewTopic declares a topic published by service.
+func NewTopic[T any](service Service, name string, version int) Topic[T] {
+	return Topic[T]{Name: name, Version: version, Service: service}
+}
+
+// Publish publishes payload as an event on the topic.
+func (t Topic[T]) Publish(ctx context.Context, p *Publisher, payload T) error {
+	ev, err := NewEvent(t.Service.Name, t.Name, t.Version, payload)
+	if err != nil {
+		return err
+	}
+	return p.PublishEvent(ctx, ev)
+}
+
+// Subscribe handles the topic's events on the subscriber service's queue
+// with the payload decoded. Payloads that fail to decode go through the
+// same retries and dead-lettering as handler errors.
+func (t Topic[T]) Subscribe(c *Consumer, subscriber string, fn func(ctx context.Context, ev *Event, payload *T) error, middlewares ...Middleware) {
+	c.Subscribe(subscriber, t.Name, func(ctx context.Context, ev *Event) error {
+		payload := new(T)
+		if err := ev.Decode(payload); err != nil {
+			return fmt.Errorf("mq: failed to decode %s payload: %w", t.Name, err)
+		}
+		return fn(ctx, ev, payload)
+	}, middlewares...)
+}
+
+// declareExchange declares a durable topic exchange.
+func declareExchange(ch amqpChannel, name string) error {
+	return ch.ExchangeDeclare(name, amqp.ExchangeTopic, true, false, false, false, nil)
+}
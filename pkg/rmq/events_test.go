@@ -0,0 +1,184 @@
+package rmq
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type itemChanged struct {
+	ItemID string `json:"item_id"`
+}
+
+// waitForConsumers waits until n consumers are attached, so events published
+// afterwards are routed to their queues.
+func waitForConsumers(t *testing.T, c *Consumer, n int) {
+	t.Helper()
+	waitFor(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.active) == n
+	})
+}
+
+func TestTopicMatch(t *testing.T) {
+	cases := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"inventory.changed", "inventory.changed", true},
+		{"inventory.*", "inventory.changed", true},
+		{"inventory.*", "inventory.item.changed", false},
+		{"inventory.#", "inventory.item.changed", true},
+		{"inventory.#", "inventory", true},
+		{"#", "wallet.credited", true},
+		{"*.credited", "wallet.credited", true},
+		{"*.credited", "wallet.debited", false},
+	}
+	for _, tc := range cases {
+		got := topicMatch(strings.Split(tc.pattern, "."), strings.Split(tc.key, "."))
+		if got != tc.want {
+			t.Errorf("topicMatch(%q, %q) = %v, want %v", tc.pattern, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestSubscribe_bindsQueueToEventsExchange(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	c.Subscribe("analytics", "wallet.*", func(context.Context, *Event) error { return nil })
+
+	waitFor(t, func() bool {
+		ch.mu.Lock()
+		defer ch.mu.Unlock()
+		return len(ch.bindings) == 1
+	})
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if want := EventsExchange + ":wallet.*:analytics.events.wallet.*"; ch.bindings[0] != want {
+		t.Fatalf("expected binding %q, got %q", want, ch.bindings[0])
+	}
+}
+
+func TestPublishEvent_fansOutToEveryService(t *testing.T) {
+	_, p, c := newMemorySetup(t)
+	var mu sync.Mutex
+	got := map[string][]*Event{}
+	for _, sub := range []struct{ service, pattern string }{
+		{"subscriber", "inventory.*"},
+		{"analytics", "#"},
+		{"achievements", "trade.completed"},
+	} {
+		c.Subscribe(sub.service, sub.pattern, func(_ context.Context, ev *Event) error {
+			mu.Lock()
+			got[sub.service] = append(got[sub.service], ev)
+			mu.Unlock()
+			return nil
+		})
+	}
+	waitForConsumers(t, c, 3)
+
+	ev, err := NewEvent("inventory", "inventory.changed", 1, itemChanged{ItemID: "sword"})
+	if err != nil {
+		t.Fatalf("NewEvent: %v", err)
+	}
+	if err := p.PublishEvent(context.Background(), ev); err != nil {
+		t.Fatalf("PublishEvent: %v", err)
+	}
+
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(got["subscriber"]) == 1 && len(got["analytics"]) == 1
+	})
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got["achievements"]) != 0 {
+		t.Fatalf("expected non-matching subscriber to get nothing, got %d", len(got["achievements"]))
+	}
+	recv := got["subscriber"][0]
+	if recv.ID != ev.ID || recv.Source != "inventory" || recv.SchemaVersion != 1 || !recv.Time.Equal(ev.Time) {
+		t.Fatalf("expected envelope to round-trip, got %+v", recv)
+	}
+}
+
+func TestSubscribe_instancesShareServiceQueue(t *testing.T) {
+	_, p, c := newMemorySetup(t)
+	var mu sync.Mutex
+	calls := 0
+	for range 2 {
+		c.Subscribe("subscriber", "wallet.credited", func(context.Context, *Event) error {
+			mu.Lock()
+			calls++
+			mu.Unlock()
+			return nil
+		})
+	}
+	waitForConsumers(t, c, 2)
+
+	ev, _ := NewEvent("wallet", "wallet.credited", 1, struct{}{})
+	if err := p.PublishEvent(context.Background(), ev); err != nil {
+		t.Fatalf("PublishEvent: %v", err)
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls == 1
+	})
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Fatalf("expected event handled once per service, got %d", calls)
+	}
+}
+
+func TestTopic_subscribeDecodesPayload(t *testing.T) {
+	_, p, c := newMemorySetup(t)
+	topic := NewTopic[itemChanged](Service{Name: "inventory"}, "inventory.changed", 2)
+	received := make(chan *itemChanged, 1)
+	versions := make(chan int, 1)
+	topic.Subscribe(c, "subscriber", func(_ context.Context, ev *Event, payload *itemChanged) error {
+		versions <- ev.SchemaVersion
+		received <- payload
+		return nil
+	})
+	waitForConsumers(t, c, 1)
+
+	if err := topic.Publish(context.Background(), p, itemChanged{ItemID: "sword"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	select {
+	case payload := <-received:
+		if payload.ItemID != "sword" {
+			t.Fatalf("expected decoded payload, got %+v", payload)
+		}
+		if v := <-versions; v != 2 {
+			t.Fatalf("expected schema version 2, got %d", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event was not delivered")
+	}
+}
+
+func TestSubscribe_badEnvelope_deadLetters(t *testing.T) {
+	b, _, c := newMemorySetup(t)
+	c.SubscribeWithOpt("subscriber", "inventory.changed", QueueOpt{MaxAttempts: 1}, func(context.Context, *Event) error {
+		t.Error("handler called for undecodable event")
+		return nil
+	})
+	waitForConsumers(t, c, 1)
+
+	conn, _ := dialMemory(b.URL())
+	ch, _ := conn.Channel()
+	if err := ch.Publish(EventsExchange, "inventory.changed", false, false, amqp.Publishing{Body: []byte("not json")}); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	queue := EventQueue("subscriber", "inventory.changed")
+	waitFor(t, func() bool { return b.MessageCount(DeadLetterQueue(queue)) == 1 })
+}
@@ -0,0 +1,194 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mercury/pkg/instrumentation/metrics"
+)
+
+const messageIDKey contextKey = "message_id"
+
+// MessageID returns the AMQP message ID of the delivery being handled. It
+// survives broker redeliveries, and every attempt of one typed Request shares
+// it.
+func MessageID(ctx context.Context) string {
+	id, _ := ctx.Value(messageIDKey).(string)
+	return id
+}
+
+const (
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultIdempotencyLockTTL = time.Minute
+	defaultIdempotencyPoll    = 50 * time.Millisecond
+)
+
+// IdempotencyStore keeps the in-progress markers and cached responses of
+// UseIdempotency. Keys are already namespaced by queue.
+type IdempotencyStore interface {
+	// Claim marks key in progress for lockTTL unless it is already known.
+	// claimed is true when the caller should run the handler; otherwise
+	// done reports whether response is a completed result or key is still
+	// in progress elsewhere.
+	Claim(ctx context.Context, key string, lockTTL time.Duration) (claimed, done bool, response []byte, err error)
+	// Complete stores the response for key for ttl.
+	Complete(ctx context.Context, key string, response []byte, ttl time.Duration) error
+	// Release drops an in-progress marker so the message can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// KeyFunc derives the idempotency key of a message. An empty key runs the
+// handler without deduplication.
+type KeyFunc func(ctx context.Context, body []byte) (string, error)
+
+// MessageIDKey keys messages on their AMQP message ID.
+func MessageIDKey(ctx context.Context, _ []byte) (string, error) {
+	return MessageID(ctx), nil
+}
+
+// FieldKey keys messages on a top-level request field, such as an order ID,
+// decoded with the codec for the request's content type.
+func FieldKey(field string) KeyFunc {
+	return func(ctx context.Context, body []byte) (string, error) {
+		codec, err := CodecFor(ContentType(ctx))
+		if err != nil {
+			return "", err
+		}
+		var fields map[string]any
+		if err := codec.Unmarshal(body, &fields); err != nil {
+			return "", err
+		}
+		v, ok := fields[field]
+		if !ok || v == nil {
+			return "", nil
+		}
+		return fmt.Sprint(v), nil
+	}
+}
+
+// IdempotencyOpt configures UseIdempotency. Zero values fall back to the
+// package defaults.
+type IdempotencyOpt struct {
+	// TTL is how long a completed response is replayed to duplicates.
+	TTL time.Duration
+	// LockTTL bounds the in-progress marker so a crashed worker doesn't hold
+	// the key forever. It should outlast the handler.
+	LockTTL time.Duration
+	// PollInterval is how often a duplicate checks on a key in progress.
+	PollInterval time.Duration
+}
+
+func (o IdempotencyOpt) withDefaults() IdempotencyOpt {
+	if o.TTL <= 0 {
+		o.TTL = defaultIdempotencyTTL
+	}
+	if o.LockTTL <= 0 {
+		o.LockTTL = defaultIdempotencyLockTTL
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaultIdempotencyPoll
+	}
+	return o
+}
+
+// UseIdempotency runs the handler once per key. The first message to claim a
+// key runs it and its response is stored for opt.TTL; later messages with the
+// same key get that response back without running the handler, and
+// duplicates that arrive while it runs wait for it. Failed handlers release
+// the key so the message can be retried. Duplicates are counted as
+// mq.msg.duplicate.
+func UseIdempotency(store IdempotencyStore, key KeyFunc, opt IdempotencyOpt) Middleware {
+	opt = opt.withDefaults()
+	return func(queue string, next Handler) Handler {
+		return func(ctx context.Context, body []byte) ([]byte, error) {
+			k, err := key(ctx, body)
+			if err != nil {
+				GetLogger(ctx).WithError(err).Warn("mq: no idempotency key, handling without deduplication")
+				return next(ctx, body)
+			}
+			if k == "" {
+				return next(ctx, body)
+			}
+			k = queue + ":" + k
+
+			for {
+				claimed, done, response, err := store.Claim(ctx, k, opt.LockTTL)
+				if err != nil {
+					return nil, fmt.Errorf("mq: idempotency store: %w", err)
+				}
+				if claimed {
+					break
+				}
+				if done {
+					GetMetrics(ctx).Incr("mq.msg.duplicate", 1, metrics.StringTag("queue", queue))
+					return response, nil
+				}
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(opt.PollInterval):
+				}
+			}
+
+			// The handler's ctx may be done by now; the store calls must
+			// still go through.
+			storeCtx := context.WithoutCancel(ctx)
+			response, err := next(ctx, body)
+			if err != nil {
+				if rerr := store.Release(storeCtx, k); rerr != nil {
+					GetLogger(ctx).WithError(rerr).Error("mq: failed to release idempotency key")
+				}
+				return nil, err
+			}
+			if cerr := store.Complete(storeCtx, k, response, opt.TTL); cerr != nil {
+				GetLogger(ctx).WithError(cerr).Error("mq: failed to store idempotent response")
+			}
+			return response, nil
+		}
+	}
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore for tests and single-process
+// setups, such as those running on a MemoryBroker.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]memIdempotencyEntry
+}
+
+type memIdempotencyEntry struct {
+	done      bool
+	response  []byte
+	expiresAt time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{entries: map[string]memIdempotencyEntry{}}
+}
+
+func (s *MemoryIdempotencyStore) Claim(_ context.Context, key string, lockTTL time.Duration) (bool, bool, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && time.Now().Before(e.expiresAt) {
+		return false, e.done, e.response, nil
+	}
+	s.entries[key] = memIdempotencyEntry{expiresAt: time.Now().Add(lockTTL)}
+	return true, false, nil, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, response []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memIdempotencyEntry{done: true, response: response, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && !e.done {
+		delete(s.entries, key)
+	}
+	return nil
+}
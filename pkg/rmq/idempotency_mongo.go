@@ -0,0 +1,82 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type mongoIdempotencyDoc struct {
+	Key       string    `bson:"_id"`
+	Done      bool      `bson:"done"`
+	Response  []byte    `bson:"response,omitempty"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// MongoIdempotencyStore keeps UseIdempotency state in a Mongo collection.
+// Mongo's TTL monitor only runs once a minute, so expiry is also checked on
+// every claim.
+type MongoIdempotencyStore struct {
+	col *mongo.Collection
+}
+
+// NewMongoIdempotencyStore creates the TTL index on col and returns a store
+// backed by it.
+func NewMongoIdempotencyStore(ctx context.Context, col *mongo.Collection) (*MongoIdempotencyStore, error) {
+	_, err := col.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoIdempotencyStore{col: col}, nil
+}
+
+func (s *MongoIdempotencyStore) Claim(ctx context.Context, key string, lockTTL time.Duration) (bool, bool, []byte, error) {
+	now := time.Now()
+	// Upserting on an expired entry only: a live one makes the filter miss
+	// and the insert collide on _id.
+	_, err := s.col.UpdateOne(ctx,
+		bson.M{"_id": key, "expires_at": bson.M{"$lte": now}},
+		bson.M{
+			"$set":   bson.M{"done": false, "expires_at": now.Add(lockTTL)},
+			"$unset": bson.M{"response": ""},
+		},
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err == nil {
+		return true, false, nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, false, nil, err
+	}
+	var doc mongoIdempotencyDoc
+	if err := s.col.FindOne(ctx, bson.M{"_id": key}).Decode(&doc); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// Released in the meantime; the caller polls and claims again.
+			return false, false, nil, nil
+		}
+		return false, false, nil, err
+	}
+	return false, doc.Done, doc.Response, nil
+}
+
+func (s *MongoIdempotencyStore) Complete(ctx context.Context, key string, response []byte, ttl time.Duration) error {
+	_, err := s.col.ReplaceOne(ctx, bson.M{"_id": key}, mongoIdempotencyDoc{
+		Key:       key,
+		Done:      true,
+		Response:  response,
+		ExpiresAt: time.Now().Add(ttl),
+	}, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (s *MongoIdempotencyStore) Release(ctx context.Context, key string) error {
+	_, err := s.col.DeleteOne(ctx, bson.M{"_id": key, "done": false})
+	return err
+}
@@ -0,0 +1,69 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Values stored under a key: the in-progress marker, or the done prefix
+// followed by the response.
+const (
+	redisIdempotencyPending = "p"
+	redisIdempotencyDone    = "d"
+)
+
+// releaseScript deletes KEYS[1] only while it still holds the in-progress
+// marker, so a late Release never drops a completed response.
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisIdempotencyStore keeps UseIdempotency state in Redis under prefix.
+type RedisIdempotencyStore struct {
+	rdb    redis.UniversalClient
+	prefix string
+}
+
+func NewRedisIdempotencyStore(rdb redis.UniversalClient, prefix string) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{rdb: rdb, prefix: prefix}
+}
+
+func (s *RedisIdempotencyStore) Claim(ctx context.Context, key string, lockTTL time.Duration) (bool, bool, []byte, error) {
+	key = s.prefix + key
+	for {
+		ok, err := s.rdb.SetNX(ctx, key, redisIdempotencyPending, lockTTL).Result()
+		if err != nil {
+			return false, false, nil, err
+		}
+		if ok {
+			return true, false, nil, nil
+		}
+		v, err := s.rdb.Get(ctx, key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			// Expired or released between SETNX and GET; try again.
+			continue
+		}
+		if err != nil {
+			return false, false, nil, err
+		}
+		if len(v) > 0 && string(v[:1]) == redisIdempotencyDone {
+			return false, true, v[1:], nil
+		}
+		return false, false, nil, nil
+	}
+}
+
+func (s *RedisIdempotencyStore) Complete(ctx context.Context, key string, response []byte, ttl time.Duration) error {
+	value := append([]byte(redisIdempotencyDone), response...)
+	return s.rdb.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+func (s *RedisIdempotencyStore) Release(ctx context.Context, key string) error {
+	return releaseScript.Run(ctx, s.rdb, []string{s.prefix + key}, redisIdempotencyPending).Err()
+}
@@ -0,0 +1,182 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func withMessageID(id string) context.Context {
+	return context.WithValue(context.Background(), messageIDKey, id)
+}
+
+func countingHandler(calls *atomic.Int32, err error) Handler {
+	return func(context.Context, []byte) ([]byte, error) {
+		n := calls.Add(1)
+		if err != nil {
+			return nil, err
+		}
+		return []byte{byte('0' + n)}, nil
+	}
+}
+
+func TestUseIdempotency_replaysResponse(t *testing.T) {
+	var calls atomic.Int32
+	h := UseIdempotency(NewMemoryIdempotencyStore(), MessageIDKey, IdempotencyOpt{})("q", countingHandler(&calls, nil))
+
+	first, err := h(withMessageID("m1"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := h(withMessageID("m1"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls.Load() != 1 || string(second) != string(first) {
+		t.Fatalf("expected cached response %q after 1 call, got %q after %d", first, second, calls.Load())
+	}
+	if _, err := h(withMessageID("m2"), nil); err != nil || calls.Load() != 2 {
+		t.Fatalf("expected a new key to run the handler, got %d calls (%v)", calls.Load(), err)
+	}
+}
+
+func TestUseIdempotency_concurrentDuplicateWaits(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var calls atomic.Int32
+	h := UseIdempotency(NewMemoryIdempotencyStore(), MessageIDKey, IdempotencyOpt{PollInterval: time.Millisecond})("q",
+		func(context.Context, []byte) ([]byte, error) {
+			calls.Add(1)
+			close(started)
+			<-release
+			return []byte("done"), nil
+		})
+
+	var wg sync.WaitGroup
+	wg.Go(func() { h(withMessageID("m1"), nil) })
+	<-started
+	dup := make(chan []byte, 1)
+	wg.Go(func() {
+		resp, _ := h(withMessageID("m1"), nil)
+		dup <- resp
+	})
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls.Load() != 1 {
+		t.Fatalf("expected handler to run once, got %d", calls.Load())
+	}
+	if resp := <-dup; string(resp) != "done" {
+		t.Fatalf("expected duplicate to get the first response, got %q", resp)
+	}
+}
+
+func TestUseIdempotency_failureReleasesKey(t *testing.T) {
+	var calls atomic.Int32
+	store := NewMemoryIdempotencyStore()
+	failing := UseIdempotency(store, MessageIDKey, IdempotencyOpt{})("q", countingHandler(&calls, errors.New("boom")))
+	if _, err := failing(withMessageID("m1"), nil); err == nil {
+		t.Fatal("expected handler error")
+	}
+	ok := UseIdempotency(store, MessageIDKey, IdempotencyOpt{})("q", countingHandler(&calls, nil))
+	if _, err := ok(withMessageID("m1"), nil); err != nil || calls.Load() != 2 {
+		t.Fatalf("expected retry to run the handler again, got %d calls (%v)", calls.Load(), err)
+	}
+}
+
+func TestUseIdempotency_emptyKey_skipsDeduplication(t *testing.T) {
+	var calls atomic.Int32
+	h := UseIdempotency(NewMemoryIdempotencyStore(), MessageIDKey, IdempotencyOpt{})("q", countingHandler(&calls, nil))
+	h(context.Background(), nil)
+	h(context.Background(), nil)
+	if calls.Load() != 2 {
+		t.Fatalf("expected messages without an ID to run every time, got %d", calls.Load())
+	}
+}
+
+func TestUseIdempotency_expiredEntry_runsAgain(t *testing.T) {
+	var calls atomic.Int32
+	h := UseIdempotency(NewMemoryIdempotencyStore(), MessageIDKey, IdempotencyOpt{TTL: time.Millisecond})("q", countingHandler(&calls, nil))
+	h(withMessageID("m1"), nil)
+	time.Sleep(5 * time.Millisecond)
+	h(withMessageID("m1"), nil)
+	if calls.Load() != 2 {
+		t.Fatalf("expected expired response not to be replayed, got %d calls", calls.Load())
+	}
+}
+
+func TestFieldKey(t *testing.T) {
+	key := FieldKey("order_id")
+	got, err := key(context.Background(), []byte(`{"order_id":"o-1","amount":3}`))
+	if err != nil || got != "o-1" {
+		t.Fatalf("expected o-1, got %q (%v)", got, err)
+	}
+	if got, _ := key(context.Background(), []byte(`{}`)); got != "" {
+		t.Fatalf("expected missing field to give an empty key, got %q", got)
+	}
+
+	codec, _ := CodecFor(ContentTypeMsgpack)
+	body, _ := codec.Marshal(&map[string]any{"order_id": "o-2"})
+	ctx := context.WithValue(context.Background(), contentTypeKey, ContentTypeMsgpack)
+	if got, err := key(ctx, body); err != nil || got != "o-2" {
+		t.Fatalf("expected o-2 from msgpack body, got %q (%v)", got, err)
+	}
+}
+
+func TestUseIdempotency_redeliveredMessage_overMemoryBroker(t *testing.T) {
+	b, _, c := newMemorySetup(t)
+	var calls atomic.Int32
+	c.Consume("ledger", countingHandler(&calls, nil), UseIdempotency(NewMemoryIdempotencyStore(), MessageIDKey, IdempotencyOpt{}))
+	waitForConsumers(t, c, 1)
+
+	conn, _ := dialMemory(b.URL())
+	ch, _ := conn.Channel()
+	for range 2 {
+		if err := ch.Publish("", "ledger", false, false, amqp.Publishing{MessageId: "m1", Body: []byte(`{}`)}); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	waitFor(t, func() bool { return b.MessageCount("ledger") == 0 })
+	time.Sleep(20 * time.Millisecond)
+	if calls.Load() != 1 {
+		t.Fatalf("expected duplicate delivery to be skipped, got %d calls", calls.Load())
+	}
+}
+
+func TestRequest_retriesShareMessageID(t *testing.T) {
+	b, _, c := newMemorySetup(t)
+	route := idempotentRoute(RouteOpt{})
+	var mu sync.Mutex
+	var ids []string
+	c.Consume(route, func(ctx context.Context, _ []byte) ([]byte, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		ids = append(ids, MessageID(ctx))
+		if len(ids) == 1 {
+			return nil, NewError(503, "warming up")
+		}
+		return []byte(`{}`), nil
+	})
+	waitForConsumers(t, c, 1)
+
+	p, err := NewPublisher(b.URL(), UseRetry(fastRetry))
+	if err != nil {
+		t.Fatalf("NewPublisher: %v", err)
+	}
+	t.Cleanup(p.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := Request[struct{}, struct{}](ctx, p, route, struct{}{}); err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ids) != 2 || ids[0] == "" || ids[0] != ids[1] {
+		t.Fatalf("expected both attempts to carry one message ID, got %q", ids)
+	}
+}
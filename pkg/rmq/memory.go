@@ -0,0 +1,804 @@
+package rmq
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	memoryScheme = "memory://"
+	replyToQueue = "amq.rabbitmq.reply-to"
+)
+
+var errUnknownDeliveryTag = errors.New("memory broker: unknown delivery tag")
+
+var memoryBrokers = struct {
+	sync.Mutex
+	next    int
+	brokers map[string]*MemoryBroker
+}{brokers: map[string]*MemoryBroker{}}
+
+// MemoryBroker is an in-process stand-in for RabbitMQ. Pass its URL to
+// NewPublisher, NewConsumer or any pkg/clients constructor to run services
+// against each other inside go test.
+//
+// It implements the subset of AMQP the package relies on: the default,
+// direct and topic exchanges, durable queues, direct reply-to, per-consumer
+// prefetch, ack/nack/requeue, round-robin delivery between consumers, and
+// publisher confirms with mandatory returns. Queues
+// declared with x-message-ttl hold every message for the TTL and then
+// dead-letter it to x-dead-letter-routing-key, which is what the retry delay
+// queues need; such queues never deliver to consumers.
+type MemoryBroker struct {
+	url       string
+	mu        sync.Mutex
+	queues    map[string]*memQueue
+	exchanges map[string]*memExchange
+	conns     map[*memConn]struct{}
+	closed    bool
+	nextID    int
+}
+
+// NewMemoryBroker starts an empty broker reachable at URL() until Close.
+func NewMemoryBroker() *MemoryBroker {
+	memoryBrokers.Lock()
+	defer memoryBrokers.Unlock()
+	memoryBrokers.next++
+	b := &MemoryBroker{
+		url:       fmt.Sprintf("%s%d", memoryScheme, memoryBrokers.next),
+		queues:    map[string]*memQueue{},
+		exchanges: map[string]*memExchange{},
+		conns:     map[*memConn]struct{}{},
+	}
+	memoryBrokers.brokers[b.url] = b
+	return b
+}
+
+// URL returns the address to dial the broker with.
+func (b *MemoryBroker) URL() string {
+	return b.url
+}
+
+// MessageCount returns the number of messages ready for delivery on queue,
+// not counting unacked ones.
+func (b *MemoryBroker) MessageCount(queue string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	q, ok := b.queues[queue]
+	if !ok {
+		return 0
+	}
+	return len(q.ready)
+}
+
+// Close drops every connection as if the broker went down. Clients see
+// amqp.ErrClosed on NotifyClose and further dials fail.
+func (b *MemoryBroker) Close() {
+	memoryBrokers.Lock()
+	delete(memoryBrokers.brokers, b.url)
+	memoryBrokers.Unlock()
+
+	b.mu.Lock()
+	b.closed = true
+	conns := make([]*memConn, 0, len(b.conns))
+	for conn := range b.conns {
+		conns = append(conns, conn)
+	}
+	b.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.shutdown(amqp.ErrClosed)
+	}
+}
+
+// dialMemory returns a connection to the broker registered at amqpURL.
+func dialMemory(amqpURL string) (amqpConnection, error) {
+	memoryBrokers.Lock()
+	b, ok := memoryBrokers.brokers[amqpURL]
+	memoryBrokers.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("memory broker: no broker at %s", amqpURL)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, fmt.Errorf("memory broker: %s is closed", amqpURL)
+	}
+	conn := &memConn{broker: b, channels: map[*memChannel]struct{}{}}
+	b.conns[conn] = struct{}{}
+	return conn, nil
+}
+
+type memQueue struct {
+	name      string
+	args      amqp.Table
+	ready     []amqp.Delivery
+	consumers []*memConsumer
+	next      int // round-robin cursor into consumers
+}
+
+// ttl reports the x-message-ttl of a delay queue.
+func (q *memQueue) ttl() (time.Duration, bool) {
+	switch v := q.args["x-message-ttl"].(type) {
+	case int:
+		return time.Duration(v) * time.Millisecond, true
+	case int32:
+		return time.Duration(v) * time.Millisecond, true
+	case int64:
+		return time.Duration(v) * time.Millisecond, true
+	default:
+		return 0, false
+	}
+}
+
+func (q *memQueue) deadLetterKey() (string, bool) {
+	key, ok := q.args["x-dead-letter-routing-key"].(string)
+	return key, ok
+}
+
+// queue returns the named queue, declaring it if needed. Must be called with b.mu held.
+func (b *MemoryBroker) queue(name string, args amqp.Table) *memQueue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &memQueue{name: name, args: args}
+		b.queues[name] = q
+	}
+	return q
+}
+
+type memBinding struct {
+	queue string
+	key   string
+}
+
+type memExchange struct {
+	kind     string
+	bindings []memBinding
+}
+
+// matches reports whether a message published with key is routed through
+// a binding with bindingKey.
+func (e *memExchange) matches(bindingKey, key string) bool {
+	if e.kind == amqp.ExchangeDirect {
+		return bindingKey == key
+	}
+	return topicMatch(strings.Split(bindingKey, "."), strings.Split(key, "."))
+}
+
+// topicMatch matches routing key words against a topic pattern, where "*"
+// stands for exactly one word and "#" for zero or more.
+func topicMatch(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		return topicMatch(pattern[1:], key) || (len(key) > 0 && topicMatch(pattern, key[1:]))
+	case "*":
+		return len(key) > 0 && topicMatch(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && pattern[0] == key[0] && topicMatch(pattern[1:], key[1:])
+	}
+}
+
+// publish routes msg through exchange. Must be called with b.mu held.
+func (b *MemoryBroker) publish(exchange, key string, msg amqp.Delivery) (bool, error) {
+	if exchange == "" {
+		return b.route(key, msg), nil
+	}
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return false, fmt.Errorf("memory broker: no exchange %q", exchange)
+	}
+	msg.Exchange = exchange
+	msg.RoutingKey = key
+	routed := map[string]bool{}
+	for _, bind := range ex.bindings {
+		if routed[bind.queue] || !ex.matches(bind.key, key) {
+			continue
+		}
+		if q, ok := b.queues[bind.queue]; ok {
+			routed[bind.queue] = true
+			b.enqueue(q, msg)
+		}
+	}
+	return len(routed) > 0, nil
+}
+
+// route delivers msg to the queue named key, dropping it if the queue does
+// not exist just like an unroutable publish on the default exchange. It
+// reports whether the queue existed. Must be called with b.mu held.
+func (b *MemoryBroker) route(key string, msg amqp.Delivery) bool {
+	q, ok := b.queues[key]
+	if !ok {
+		return false
+	}
+	msg.Exchange = ""
+	msg.RoutingKey = key
+	b.enqueue(q, msg)
+	return true
+}
+
+// enqueue adds msg to q, or holds it for the TTL of a delay queue.
+// Must be called with b.mu held.
+func (b *MemoryBroker) enqueue(q *memQueue, msg amqp.Delivery) {
+	if ttl, ok := q.ttl(); ok {
+		if target, ok := q.deadLetterKey(); ok {
+			time.AfterFunc(ttl, func() {
+				b.mu.Lock()
+				defer b.mu.Unlock()
+				if !b.closed {
+					b.route(target, msg)
+				}
+			})
+		}
+		return
+	}
+	q.ready = append(q.ready, msg)
+	b.dispatch(q)
+}
+
+// requeue puts msg back at the head of its queue. Must be called with b.mu held.
+func (b *MemoryBroker) requeue(q *memQueue, msg amqp.Delivery) {
+	if _, ok := b.queues[q.name]; !ok {
+		return
+	}
+	msg.Redelivered = true
+	q.ready = append([]amqp.Delivery{msg}, q.ready...)
+	b.dispatch(q)
+}
+
+// dispatch hands ready messages to consumers with prefetch capacity left,
+// round-robin. Must be called with b.mu held.
+func (b *MemoryBroker) dispatch(q *memQueue) {
+	for len(q.ready) > 0 && len(q.consumers) > 0 {
+		var target *memConsumer
+		for i := range q.consumers {
+			c := q.consumers[(q.next+i)%len(q.consumers)]
+			if c.hasCapacity() {
+				target = c
+				q.next = (q.next + i + 1) % len(q.consumers)
+				break
+			}
+		}
+		if target == nil {
+			return
+		}
+		msg := q.ready[0]
+		q.ready = q.ready[1:]
+		target.ch.deliver(target, msg)
+	}
+}
+
+type memConn struct {
+	broker   *MemoryBroker
+	channels map[*memChannel]struct{}
+	notify   []chan *amqp.Error
+	closed   bool
+}
+
+func (c *memConn) Channel() (amqpChannel, error) {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+	c.broker.nextID++
+	ch := &memChannel{
+		broker:    c.broker,
+		conn:      c,
+		id:        c.broker.nextID,
+		unacked:   map[uint64]*memUnacked{},
+		consumers: map[string]*memConsumer{},
+	}
+	c.channels[ch] = struct{}{}
+	return ch, nil
+}
+
+func (c *memConn) IsClosed() bool {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	return c.closed
+}
+
+func (c *memConn) NotifyClose(receiver chan *amqp.Error) chan *amqp.Error {
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.closed {
+		close(receiver)
+		return receiver
+	}
+	c.notify = append(c.notify, receiver)
+	return receiver
+}
+
+// Close closes the connection gracefully: NotifyClose receivers are closed
+// without an error, as amqp091 does.
+func (c *memConn) Close() error {
+	c.shutdown(nil)
+	return nil
+}
+
+func (c *memConn) shutdown(cause *amqp.Error) {
+	b := c.broker
+	b.mu.Lock()
+	if c.closed {
+		b.mu.Unlock()
+		return
+	}
+	c.closed = true
+	delete(b.conns, c)
+	for ch := range c.channels {
+		ch.closeLocked()
+	}
+	notify := c.notify
+	c.notify = nil
+	b.mu.Unlock()
+
+	for _, receiver := range notify {
+		if cause != nil {
+			select {
+			case receiver <- cause:
+			default:
+			}
+		}
+		close(receiver)
+	}
+}
+
+type memUnacked struct {
+	msg      amqp.Delivery
+	consumer *memConsumer
+}
+
+type memChannel struct {
+	broker    *MemoryBroker
+	conn      *memConn
+	id        int
+	prefetch  int
+	nextTag   uint64
+	unacked   map[uint64]*memUnacked
+	consumers map[string]*memConsumer // active, by tag
+	started   []*memConsumer          // every consumer ever started, killed on Close
+	replyTo   string                  // private reply queue once amq.rabbitmq.reply-to is consumed
+	closed    bool
+	// Publisher confirms: once confirming, every publish takes the next
+	// publishSeq and is acked to the NotifyPublish listeners.
+	confirming bool
+	publishSeq uint64
+	confirms   []chan amqp.Confirmation
+	returns    []chan amqp.Return
+}
+
+func (ch *memChannel) QueueDeclare(name string, _, _, _, _ bool, args amqp.Table) (amqp.Queue, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.Queue{}, amqp.ErrClosed
+	}
+	q := b.queue(name, args)
+	return amqp.Queue{Name: name, Messages: len(q.ready), Consumers: len(q.consumers)}, nil
+}
+
+func (ch *memChannel) ExchangeDeclare(name, kind string, _, _, _, _ bool, _ amqp.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	if kind != amqp.ExchangeDirect && kind != amqp.ExchangeTopic {
+		return fmt.Errorf("memory broker: exchange kind %q not supported", kind)
+	}
+	if ex, ok := b.exchanges[name]; ok {
+		if ex.kind != kind {
+			return fmt.Errorf("memory broker: exchange %q already declared as %s", name, ex.kind)
+		}
+		return nil
+	}
+	b.exchanges[name] = &memExchange{kind: kind}
+	return nil
+}
+
+func (ch *memChannel) QueueBind(name, key, exchange string, _ bool, _ amqp.Table) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return fmt.Errorf("memory broker: no exchange %q", exchange)
+	}
+	if _, ok := b.queues[name]; !ok {
+		return fmt.Errorf("memory broker: no queue %q", name)
+	}
+	bind := memBinding{queue: name, key: key}
+	for _, existing := range ex.bindings {
+		if existing == bind {
+			return nil
+		}
+	}
+	ex.bindings = append(ex.bindings, bind)
+	return nil
+}
+
+func (ch *memChannel) Qos(prefetchCount, _ int, _ bool) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.prefetch = prefetchCount
+	return nil
+}
+
+func (ch *memChannel) Consume(queue, consumer string, autoAck, _, _, _ bool, _ amqp.Table) (<-chan amqp.Delivery, error) {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return nil, amqp.ErrClosed
+	}
+
+	if queue == replyToQueue {
+		if !autoAck {
+			return nil, errors.New("memory broker: reply-to consumer must use auto-ack")
+		}
+		ch.replyTo = fmt.Sprintf("%s.%d", replyToQueue, ch.id)
+		queue = ch.replyTo
+		b.queue(queue, nil)
+	}
+	q, ok := b.queues[queue]
+	if !ok {
+		return nil, fmt.Errorf("memory broker: no queue %q", queue)
+	}
+	if consumer == "" {
+		b.nextID++
+		consumer = fmt.Sprintf("ctag-%d", b.nextID)
+	}
+	if _, ok := ch.consumers[consumer]; ok {
+		return nil, fmt.Errorf("memory broker: consumer tag %q already in use", consumer)
+	}
+
+	c := &memConsumer{
+		tag:      consumer,
+		queue:    q,
+		ch:       ch,
+		autoAck:  autoAck,
+		prefetch: ch.prefetch,
+		out:      make(chan amqp.Delivery),
+		wake:     make(chan struct{}, 1),
+		killed:   make(chan struct{}),
+	}
+	ch.consumers[consumer] = c
+	ch.started = append(ch.started, c)
+	q.consumers = append(q.consumers, c)
+	go c.run(b)
+	b.dispatch(q)
+	return c.out, nil
+}
+
+func (ch *memChannel) Publish(exchange, key string, mandatory, _ bool, msg amqp.Publishing) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	replyTo := msg.ReplyTo
+	if replyTo == replyToQueue {
+		if ch.replyTo == "" {
+			return errors.New("memory broker: publish with reply-to before consuming amq.rabbitmq.reply-to")
+		}
+		replyTo = ch.replyTo
+	}
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	routed, err := b.publish(exchange, key, amqp.Delivery{
+		Headers:         headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         replyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		Body:            append([]byte(nil), msg.Body...),
+	})
+	if err != nil {
+		return err
+	}
+	// Like RabbitMQ, an unroutable mandatory message is returned before it
+	// is acked.
+	if mandatory && !routed {
+		for _, c := range ch.returns {
+			c <- amqp.Return{
+				ReplyCode:     amqp.NoRoute,
+				ReplyText:     "NO_ROUTE",
+				Exchange:      exchange,
+				RoutingKey:    key,
+				CorrelationId: msg.CorrelationId,
+				MessageId:     msg.MessageId,
+				Body:          msg.Body,
+			}
+		}
+	}
+	if ch.confirming {
+		ch.publishSeq++
+		for _, c := range ch.confirms {
+			c <- amqp.Confirmation{DeliveryTag: ch.publishSeq, Ack: true}
+		}
+	}
+	return nil
+}
+
+// Confirm puts the channel in confirm mode.
+func (ch *memChannel) Confirm(_ bool) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.confirming = true
+	return nil
+}
+
+// NotifyPublish registers a listener for publisher confirms. Like amqp091, it
+// must be buffered for every confirm in flight, and is closed with the
+// channel.
+func (ch *memChannel) NotifyPublish(c chan amqp.Confirmation) chan amqp.Confirmation {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		close(c)
+		return c
+	}
+	ch.confirms = append(ch.confirms, c)
+	return c
+}
+
+// NotifyReturn registers a listener for unroutable mandatory messages. It is
+// closed with the channel.
+func (ch *memChannel) NotifyReturn(c chan amqp.Return) chan amqp.Return {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		close(c)
+		return c
+	}
+	ch.returns = append(ch.returns, c)
+	return c
+}
+
+// Cancel stops delivery to consumer. Messages already handed to it are still
+// delivered before its channel is closed, and stay unacked until acked.
+func (ch *memChannel) Cancel(consumer string, _ bool) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	c, ok := ch.consumers[consumer]
+	if !ok {
+		return fmt.Errorf("memory broker: unknown consumer tag %q", consumer)
+	}
+	delete(ch.consumers, consumer)
+	c.detach()
+	c.cancelled = true
+	c.signal()
+	return nil
+}
+
+// Close requeues every unacked message and closes the channel's consumers.
+func (ch *memChannel) Close() error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch.closeLocked()
+	delete(ch.conn.channels, ch)
+	return nil
+}
+
+func (ch *memChannel) closeLocked() {
+	if ch.closed {
+		return
+	}
+	ch.closed = true
+	for tag, c := range ch.consumers {
+		delete(ch.consumers, tag)
+		c.detach()
+	}
+	for _, c := range ch.started {
+		close(c.killed)
+	}
+	ch.started = nil
+	tags := make([]uint64, 0, len(ch.unacked))
+	for tag := range ch.unacked {
+		tags = append(tags, tag)
+	}
+	// Requeue newest first so the oldest ends up at the head of the queue.
+	sort.Slice(tags, func(i, j int) bool { return tags[i] > tags[j] })
+	for _, tag := range tags {
+		u := ch.unacked[tag]
+		delete(ch.unacked, tag)
+		ch.broker.requeue(u.consumer.queue, u.msg)
+	}
+	if ch.replyTo != "" {
+		delete(ch.broker.queues, ch.replyTo)
+	}
+	for _, c := range ch.confirms {
+		close(c)
+	}
+	for _, c := range ch.returns {
+		close(c)
+	}
+	ch.confirms, ch.returns = nil, nil
+}
+
+// deliver assigns msg a delivery tag and queues it for c. Must be called
+// with b.mu held.
+func (ch *memChannel) deliver(c *memConsumer, msg amqp.Delivery) {
+	ch.nextTag++
+	d := msg
+	d.DeliveryTag = ch.nextTag
+	d.ConsumerTag = c.tag
+	d.Acknowledger = ch
+	if strings.HasPrefix(c.queue.name, replyToQueue) {
+		d.RoutingKey = replyToQueue
+	}
+	if !c.autoAck {
+		ch.unacked[d.DeliveryTag] = &memUnacked{msg: msg, consumer: c}
+		c.unacked++
+	}
+	c.buf = append(c.buf, d)
+	c.signal()
+}
+
+func (ch *memChannel) Ack(tag uint64, multiple bool) error {
+	return ch.settle(tag, multiple, func(*memUnacked) {})
+}
+
+func (ch *memChannel) Nack(tag uint64, multiple, requeue bool) error {
+	return ch.settle(tag, multiple, func(u *memUnacked) {
+		if requeue {
+			ch.broker.requeue(u.consumer.queue, u.msg)
+			return
+		}
+		if key, ok := u.consumer.queue.deadLetterKey(); ok {
+			ch.broker.route(key, u.msg)
+		}
+	})
+}
+
+func (ch *memChannel) Reject(tag uint64, requeue bool) error {
+	return ch.Nack(tag, false, requeue)
+}
+
+// settle removes tag (and every lower tag when multiple is set) from the
+// unacked set and runs fn on each.
+func (ch *memChannel) settle(tag uint64, multiple bool, fn func(*memUnacked)) error {
+	b := ch.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	tags := []uint64{tag}
+	if multiple {
+		tags = tags[:0]
+		for t := range ch.unacked {
+			if t <= tag {
+				tags = append(tags, t)
+			}
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	} else if _, ok := ch.unacked[tag]; !ok {
+		return errUnknownDeliveryTag
+	}
+
+	queues := map[*memQueue]struct{}{}
+	for _, t := range tags {
+		u := ch.unacked[t]
+		delete(ch.unacked, t)
+		u.consumer.unacked--
+		fn(u)
+		queues[u.consumer.queue] = struct{}{}
+	}
+	// Freed prefetch capacity may let more messages through.
+	for q := range queues {
+		b.dispatch(q)
+	}
+	return nil
+}
+
+type memConsumer struct {
+	tag       string
+	queue     *memQueue
+	ch        *memChannel
+	autoAck   bool
+	prefetch  int
+	unacked   int
+	buf       []amqp.Delivery // guarded by broker mu
+	cancelled bool            // flush buf, then close out
+	out       chan amqp.Delivery
+	wake      chan struct{}
+	killed    chan struct{} // channel closed: drop buf and close out
+}
+
+func (c *memConsumer) hasCapacity() bool {
+	return c.autoAck || c.prefetch <= 0 || c.unacked < c.prefetch
+}
+
+func (c *memConsumer) signal() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// detach removes c from its queue's consumers. Must be called with b.mu held.
+func (c *memConsumer) detach() {
+	q := c.queue
+	for i, other := range q.consumers {
+		if other == c {
+			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+			break
+		}
+	}
+	if q.next >= len(q.consumers) {
+		q.next = 0
+	}
+}
+
+// run forwards buffered deliveries to out outside the broker lock so a slow
+// reader never blocks the broker.
+func (c *memConsumer) run(b *MemoryBroker) {
+	defer close(c.out)
+	for {
+		b.mu.Lock()
+		if len(c.buf) == 0 {
+			cancelled := c.cancelled
+			b.mu.Unlock()
+			if cancelled {
+				return
+			}
+			select {
+			case <-c.wake:
+				continue
+			case <-c.killed:
+				return
+			}
+		}
+		d := c.buf[0]
+		c.buf = c.buf[1:]
+		b.mu.Unlock()
+
+		select {
+		case c.out <- d:
+		case <-c.killed:
+			return
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+)
+
+func newMemorySetup(t *testing.T) (*MemoryBroker, *Publisher, *Consumer) {
+	t.Helper()
+	b := NewMemoryBroker()
+	t.Cleanup(b.Close)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	p, err := NewPublisher(b.URL())
+	if err != nil {
+		t.Fatalf("NewPublisher: %v", err)
+	}
+	p.logger = logger
+	t.Cleanup(p.Close)
+	c, err := NewConsumer(b.URL(), logger)
+	if err != nil {
+		t.Fatalf("NewConsumer: %v", err)
+	}
+	t.Cleanup(func() { c.Shutdown(context.Background()) })
+	return b, p, c
+}
+
+func TestMemoryBroker_requestReply(t *testing.T) {
+	_, p, c := newMemorySetup(t)
+	c.Consume("echo", func(_ context.Context, body []byte) ([]byte, error) {
+		return body, nil
+	})
+
+	type msg struct{ Text string }
+	var resp *msg
+	waitFor(t, func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		var err error
+		resp, err = Request[msg, msg](ctx, p, "echo", msg{Text: "hi"})
+		return err == nil
+	})
+	if resp.Text != "hi" {
+		t.Fatalf("expected echoed text, got %q", resp.Text)
+	}
+}
+
+func TestMemoryBroker_handlerError_returnsRMQError(t *testing.T) {
+	_, p, c := newMemorySetup(t)
+	c.Consume("fail", func(_ context.Context, _ []byte) ([]byte, error) {
+		return nil, NewError(404, "not found")
+	})
+
+	var err error
+	waitFor(t, func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = Request[struct{}, struct{}](ctx, p, "fail", struct{}{})
+		return !errors.Is(err, context.DeadlineExceeded)
+	})
+	if !errors.Is(err, NewError(404, "")) {
+		t.Fatalf("expected 404 rmq error, got %v", err)
+	}
+}
+
+func TestMemoryBroker_nackRequeue_redelivers(t *testing.T) {
+	b := NewMemoryBroker()
+	t.Cleanup(b.Close)
+	conn, err := dialMemory(b.URL())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	ch, _ := conn.Channel()
+	ch.QueueDeclare("q", true, false, false, false, nil)
+	msgs, _ := ch.Consume("q", "", false, false, false, false, nil)
+	ch.Publish("", "q", false, false, amqp.Publishing{Body: []byte("body")})
+
+	first := <-msgs
+	if first.Redelivered {
+		t.Fatal("expected first delivery not to be redelivered")
+	}
+	first.Nack(false, true)
+	second := <-msgs
+	if !second.Redelivered || string(second.Body) != "body" {
+		t.Fatalf("expected redelivery of body, got %+v", second)
+	}
+	second.Ack(false)
+	if err := second.Ack(false); !errors.Is(err, errUnknownDeliveryTag) {
+		t.Fatalf("expected double ack to fail, got %v", err)
+	}
+}
+
+func TestMemoryBroker_prefetchLimitsUnacked(t *testing.T) {
+	b := NewMemoryBroker()
+	t.Cleanup(b.Close)
+	conn, _ := dialMemory(b.URL())
+	ch, _ := conn.Channel()
+	ch.QueueDeclare("q", true, false, false, false, nil)
+	ch.Qos(1, 0, false)
+	msgs, _ := ch.Consume("q", "", false, false, false, false, nil)
+	ch.Publish("", "q", false, false, amqp.Publishing{Body: []byte("1")})
+	ch.Publish("", "q", false, false, amqp.Publishing{Body: []byte("2")})
+
+	first := <-msgs
+	select {
+	case d := <-msgs:
+		t.Fatalf("expected no delivery past prefetch, got %q", d.Body)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if n := b.MessageCount("q"); n != 1 {
+		t.Fatalf("expected 1 ready message, got %d", n)
+	}
+	first.Ack(false)
+	if d := <-msgs; string(d.Body) != "2" {
+		t.Fatalf("expected second message after ack, got %q", d.Body)
+	}
+}
+
+func TestMemoryBroker_channelClose_requeuesUnacked(t *testing.T) {
+	b := NewMemoryBroker()
+	t.Cleanup(b.Close)
+	conn, _ := dialMemory(b.URL())
+	ch, _ := conn.Channel()
+	ch.QueueDeclare("q", true, false, false, false, nil)
+	msgs, _ := ch.Consume("q", "", false, false, false, false, nil)
+	ch.Publish("", "q", false, false, amqp.Publishing{Body: []byte("body")})
+	<-msgs
+
+	ch.Close()
+	if _, ok := <-msgs; ok {
+		t.Fatal("expected deliveries to close with the channel")
+	}
+	if n := b.MessageCount("q"); n != 1 {
+		t.Fatalf("expected unacked message to be requeued, got %d ready", n)
+	}
+}
+
+func TestMemoryBroker_multipleConsumers_shareQueue(t *testing.T) {
+	_, p, c := newMemorySetup(t)
+	var mu sync.Mutex
+	seen := map[string]int{}
+	for _, name := range []string{"a", "b"} {
+		c.Consume("work", func(_ context.Context, _ []byte) ([]byte, error) {
+			mu.Lock()
+			seen[name]++
+			mu.Unlock()
+			return nil, nil
+		})
+	}
+	// Wait for both consumers to attach before publishing.
+	waitFor(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.active) == 2
+	})
+	for range 10 {
+		if err := p.Publish(context.Background(), "work", []byte("{}")); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	waitFor(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen["a"]+seen["b"] == 10
+	})
+	if seen["a"] == 0 || seen["b"] == 0 {
+		t.Fatalf("expected both consumers to get messages, got %v", seen)
+	}
+}
+
+func TestMemoryBroker_retriesThenDeadLetters(t *testing.T) {
+	b, p, c := newMemorySetup(t)
+	var mu sync.Mutex
+	calls := 0
+	c.ConsumeWithOpt("job", QueueOpt{MaxAttempts: 3, BackoffBase: 5 * time.Millisecond}, func(_ context.Context, _ []byte) ([]byte, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		return nil, errors.New("broken")
+	})
+	waitFor(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.active) == 1
+	})
+	if err := p.Publish(context.Background(), "job", []byte("{}")); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	waitFor(t, func() bool { return b.MessageCount(DeadLetterQueue("job")) == 1 })
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestMemoryBroker_close_failsPublisher(t *testing.T) {
+	b, p, _ := newMemorySetup(t)
+	b.Close()
+
+	waitFor(t, func() bool { return !p.Healthy() })
+	if _, err := p.Request(context.Background(), "q", nil); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expected ErrNotConnected, got %v", err)
+	}
+}
@@ -2,11 +2,12 @@ package rmq
 
 import (
 	"context"
+	"sync/atomic"
 	"time"
 
-	"github.com/mercury/pkg/middleware"
+	"github.com/mercury/pkg/instrumentation/metrics"
+	"github.com/mercury/pkg/tracing"
 	"github.com/sirupsen/logrus"
-	"github.com/smira/go-statsd"
 )
 
 // Middleware receives the queue name (injected by Consume) and wraps a Handler.
@@ -14,13 +15,20 @@ type Middleware func(queue string, next Handler) Handler
 
 type contextKey string
 
-const requestIDKey contextKey = "request_id"
 const loggerKey contextKey = "logger"
-const statsdKey contextKey = "statsd"
 
+// RequestID returns the ID of the request being handled, stored in ctx by
+// the consumer: the one the caller sent in its headers, or a new one. It is
+// empty outside a handler.
+func RequestID(ctx context.Context) string {
+	return tracing.RequestID(ctx)
+}
+
+// NewRequestID returns RequestID(ctx).
+//
+// Deprecated: use RequestID; the ID is read from ctx, not made.
 func NewRequestID(ctx context.Context) string {
-	id, _ := ctx.Value(requestIDKey).(string)
-	return id
+	return RequestID(ctx)
 }
 
 // GetLogger returns the logger stored in context, falling back to the standard logger.
@@ -32,32 +40,33 @@ func GetLogger(ctx context.Context) *logrus.Entry {
 	return entry
 }
 
-func GetMetrics(ctx context.Context) *statsd.Client {
-	entry, ok := ctx.Value(statsdKey).(*statsd.Client)
-	if !ok || entry == nil {
-		// UDP just drops silently, nothing listens, nothing errors
-		return statsd.NewClient("localhost:0", statsd.Logger(middleware.StatsDNoopLogger{}))
-	}
-	return entry
+// GetMetrics returns the metrics stored in context, falling back to
+// metrics.Discard.
+func GetMetrics(ctx context.Context) metrics.Metrics {
+	return metrics.FromContext(ctx)
 }
 
-func UseStatsd(client *statsd.Client) Middleware {
+func UseMetrics(m metrics.Metrics) Middleware {
 	return func(queue string, next Handler) Handler {
+		// One counter per queue, shared by all of the queue's workers.
+		var inflight atomic.Int64
 		return func(ctx context.Context, body []byte) ([]byte, error) {
 			start := time.Now()
-			ctx = context.WithValue(ctx, statsdKey, client)
+			ctx = metrics.NewContext(ctx, m)
 
+			tags := []metrics.Tag{
+				metrics.StringTag("queue", queue),
+			}
+
+			m.Gauge("mq.msg.inflight", inflight.Add(1), tags...)
 			resp, err := next(ctx, body)
+			m.Gauge("mq.msg.inflight", inflight.Add(-1), tags...)
 			duration := time.Since(start)
 
-			tags := []statsd.Tag{
-				statsd.StringTag("queue", queue),
-			}
-
-			client.Incr("mq.msg.count", 1, tags...)
-			client.Timing("mq.msg.duration", int64(duration/time.Millisecond), tags...)
+			m.Incr("mq.msg.count", 1, tags...)
+			m.Timing("mq.msg.duration", duration, tags...)
 			if err != nil {
-				client.Incr("mq.msg.error", 1, tags...)
+				m.Incr("mq.msg.error", 1, tags...)
 			}
 
 			return resp, err
@@ -68,9 +77,9 @@ func UseStatsd(client *statsd.Client) Middleware {
 func UseLogger(logger *logrus.Logger) Middleware {
 	return func(queue string, next Handler) Handler {
 		return func(ctx context.Context, body []byte) ([]byte, error) {
-			entry := logger.WithFields(logrus.Fields{
+			entry := logger.WithContext(ctx).WithFields(logrus.Fields{
 				"queue":      queue,
-				"request_id": NewRequestID(ctx),
+				"request_id": RequestID(ctx),
 			})
 			ctx = context.WithValue(ctx, loggerKey, entry)
 
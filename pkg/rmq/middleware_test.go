@@ -4,9 +4,16 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/mercury/pkg/instrumentation/metrics"
+	"github.com/mercury/pkg/tracing"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
+	"github.com/smira/go-statsd"
 )
 
 func TestNewRequestID_missingKeyReturnsEmpty(t *testing.T) {
@@ -16,7 +23,7 @@ func TestNewRequestID_missingKeyReturnsEmpty(t *testing.T) {
 }
 
 func TestNewRequestID_returnsStoredID(t *testing.T) {
-	ctx := context.WithValue(context.Background(), requestIDKey, "abc-123")
+	ctx := tracing.WithRequestID(context.Background(), "abc-123")
 	if id := NewRequestID(ctx); id != "abc-123" {
 		t.Fatalf("expected %q, got %q", "abc-123", id)
 	}
@@ -39,12 +46,12 @@ func TestGetLogger_returnsStoredEntry(t *testing.T) {
 }
 
 func TestGetMetrics_missingKeyReturnsNoop(t *testing.T) {
-	client := GetMetrics(context.Background())
-	if client == nil {
-		t.Fatal("expected non-nil statsd client")
+	m := GetMetrics(context.Background())
+	if m != metrics.Discard {
+		t.Fatalf("expected metrics.Discard, got %v", m)
 	}
-	// Verify noop client doesn't panic on use.
-	client.Incr("test", 1)
+	// Verify the noop doesn't panic on use.
+	m.Incr("test", 1)
 }
 
 func newBufLogger() (*logrus.Logger, *bytes.Buffer) {
@@ -119,16 +126,16 @@ func TestUseLogger_logsQueueName(t *testing.T) {
 	}
 }
 
-func TestUseStatsd_callsNextAndReturnsResult(t *testing.T) {
-	// Use the noop client so no real UDP socket is needed.
-	client := GetMetrics(context.Background())
+func TestUseMetrics_callsNextAndReturnsResult(t *testing.T) {
+	// Use the noop so no real UDP socket is needed.
+	m := GetMetrics(context.Background())
 	called := false
 	handler := func(ctx context.Context, body []byte) ([]byte, error) {
 		called = true
 		return []byte("pong"), nil
 	}
 
-	wrapped := UseStatsd(client)("test.queue", handler)
+	wrapped := UseMetrics(m)("test.queue", handler)
 	resp, err := wrapped(context.Background(), []byte("ping"))
 
 	if !called {
@@ -142,33 +149,65 @@ func TestUseStatsd_callsNextAndReturnsResult(t *testing.T) {
 	}
 }
 
-func TestUseStatsd_propagatesError(t *testing.T) {
-	client := GetMetrics(context.Background())
+func TestUseMetrics_propagatesError(t *testing.T) {
+	m := GetMetrics(context.Background())
 	handlerErr := errors.New("broken")
 	handler := func(ctx context.Context, body []byte) ([]byte, error) {
 		return nil, handlerErr
 	}
 
-	wrapped := UseStatsd(client)("test.queue", handler)
+	wrapped := UseMetrics(m)("test.queue", handler)
 	_, err := wrapped(context.Background(), nil)
 	if !errors.Is(err, handlerErr) {
 		t.Fatalf("expected error to propagate, got %v", err)
 	}
 }
 
-func TestUseStatsd_injectsClientIntoContext(t *testing.T) {
-	client := GetMetrics(context.Background())
-	var ctxClient interface{}
+func TestUseMetrics_injectsMetricsIntoContext(t *testing.T) {
+	m := metrics.NewPrometheus("test", prometheus.NewRegistry())
+	var ctxMetrics metrics.Metrics
 	handler := func(ctx context.Context, body []byte) ([]byte, error) {
-		ctxClient = ctx.Value(statsdKey)
+		ctxMetrics = GetMetrics(ctx)
 		return nil, nil
 	}
 
-	wrapped := UseStatsd(client)("test.queue", handler)
+	wrapped := UseMetrics(m)("test.queue", handler)
 	_, _ = wrapped(context.Background(), nil)
 
-	if ctxClient == nil {
-		t.Error("expected statsd client to be injected into context")
+	if ctxMetrics != m {
+		t.Error("expected metrics to be injected into context")
+	}
+}
+
+func TestUseMetrics_reportsInflightGauge(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := statsd.NewClient(conn.LocalAddr().String(), statsd.FlushInterval(10*time.Millisecond))
+	defer client.Close()
+
+	wrapped := UseMetrics(metrics.NewStatsd(client))("test.queue", func(ctx context.Context, body []byte) ([]byte, error) {
+		return nil, nil
+	})
+	_, _ = wrapped(context.Background(), nil)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 4096)
+	var received string
+	for !strings.Contains(received, "mq.msg.duration") {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("expected metrics to be flushed, got %q (%v)", received, err)
+		}
+		received += string(buf[:n])
+	}
+	if !strings.Contains(received, "mq.msg.inflight,queue=test.queue:1|g") {
+		t.Fatalf("expected inflight gauge to rise to 1, got %q", received)
+	}
+	if !strings.Contains(received, "mq.msg.inflight,queue=test.queue:0|g") {
+		t.Fatalf("expected inflight gauge to drop back to 0, got %q", received)
 	}
 }
 
@@ -1,26 +1,75 @@
 package rmq
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mercury/pkg/tracing"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Both errors are 503s, so callers can treat them like any other unavailable
+// downstream and retry.
+var (
+	ErrNotConnected   = NewError(503, "mq: not connected to broker")
+	ErrConnectionLost = NewError(503, "mq: connection to broker lost")
+)
+
+const (
+	reconnectBackoffBase = 500 * time.Millisecond
+	reconnectBackoffMax  = 30 * time.Second
+)
+
+// reply is what a caller waiting in Request receives: the broker's reply body
+// and headers, or an error when the reply can no longer arrive.
+type reply struct {
+	body    []byte
+	headers amqp.Table
+	err     error
+}
+
 type Publisher struct {
-	amqpURL string
-	conn    amqpConnection
-	channel amqpChannel
-	pending map[string]chan []byte
-	mu      sync.Mutex
+	amqpURL     string
+	dial        func(amqpURL string) (amqpConnection, error)
+	conn        amqpConnection
+	channel     amqpChannel
+	pending     map[string]chan reply
+	middlewares []ClientMiddleware
+	opt         PublisherOpt
+	// confirms tracks the publisher confirms of the current channel.
+	confirms *confirmer
+	mu       sync.Mutex
+	logger   *logrus.Logger
+	closed   bool
+	done     chan struct{}
 }
 
-func NewPublisher(amqpURL string) (*Publisher, error) {
+// NewPublisher connects to amqpURL with the default PublisherOpt.
+// middlewares wrap every typed Request in the order given, the first being
+// the outermost.
+func NewPublisher(amqpURL string, middlewares ...ClientMiddleware) (*Publisher, error) {
+	return NewPublisherWithOpt(amqpURL, PublisherOpt{}, middlewares...)
+}
+
+// NewPublisherWithOpt connects to amqpURL with opt. The channel is put in
+// confirm mode, so Publish only returns once the broker has the message.
+func NewPublisherWithOpt(amqpURL string, opt PublisherOpt, middlewares ...ClientMiddleware) (*Publisher, error) {
 	p := &Publisher{
-		amqpURL: amqpURL,
-		pending: make(map[string]chan []byte),
+		amqpURL:     amqpURL,
+		dial:        dial,
+		pending:     make(map[string]chan reply),
+		middlewares: middlewares,
+		opt:         opt.withDefaults(),
+		logger:      logrus.StandardLogger(),
+		done:        make(chan struct{}),
 	}
 	if err := p.connect(); err != nil {
 		return nil, err
@@ -28,12 +77,26 @@ func NewPublisher(amqpURL string) (*Publisher, error) {
 	return p, nil
 }
 
+func dial(amqpURL string) (amqpConnection, error) {
+	if strings.HasPrefix(amqpURL, memoryScheme) {
+		return dialMemory(amqpURL)
+	}
+	conn, err := amqp.Dial(amqpURL)
+	if err != nil {
+		return nil, err
+	}
+	return &realConn{conn}, nil
+}
+
 func (p *Publisher) connect() error {
 	// Establish a new TCP connection to the broker.
-	conn, err := amqp.Dial(p.amqpURL)
+	conn, err := p.dial(p.amqpURL)
 	if err != nil {
 		return err
 	}
+	// Register for the close notification before doing anything else on the
+	// connection so a drop can't slip in unnoticed.
+	closed := conn.NotifyClose(make(chan *amqp.Error, 1))
 	// Open a multiplexed channel over the connection.
 	// Most AMQP operations (declare, publish, consume) happen on a channel, not the connection.
 	ch, err := conn.Channel()
@@ -51,77 +114,221 @@ func (p *Publisher) connect() error {
 		conn.Close()
 		return err
 	}
-	// Fan replies out to the callers waiting in Request().
-	// Each in-flight request registers a channel in p.pending keyed by its correlation ID.
-	// When the broker delivers a reply, we look up the waiting caller and unblock it.
-	// The goroutine exits naturally when the replies channel is closed (connection drop).
-	go func() {
-		for msg := range replies {
+	// Confirm mode: the broker acks every publish once it has taken
+	// responsibility for it. Listeners go first so no confirm is missed.
+	confirms := newConfirmer()
+	acks := ch.NotifyPublish(make(chan amqp.Confirmation, confirmNotifyBuffer))
+	returns := ch.NotifyReturn(make(chan amqp.Return, confirmNotifyBuffer))
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		conn.Close()
+		return err
+	}
+	go confirms.serve(acks, returns)
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		ch.Close()
+		conn.Close()
+		return ErrNotConnected
+	}
+	p.conn = conn
+	p.channel = ch
+	p.confirms = confirms
+	p.mu.Unlock()
+
+	go p.serve(conn, replies, closed)
+	return nil
+}
+
+// serve fans replies out to the callers waiting in Request().
+// Each in-flight request registers a channel in p.pending keyed by its correlation ID.
+// When the broker delivers a reply, we look up the waiting caller and unblock it.
+// When the connection or the reply channel goes away, every pending caller is
+// failed with ErrConnectionLost and a reconnect is started in the background.
+func (p *Publisher) serve(conn amqpConnection, replies <-chan amqp.Delivery, closed <-chan *amqp.Error) {
+	for {
+		select {
+		case msg, ok := <-replies:
+			if !ok {
+				p.lost(conn, nil)
+				return
+			}
 			p.mu.Lock()
 			pending, ok := p.pending[msg.CorrelationId]
 			p.mu.Unlock()
 			if ok {
-				pending <- msg.Body
+				pending <- reply{body: msg.Body, headers: msg.Headers}
 			}
+		case err := <-closed:
+			p.lost(conn, err)
+			return
 		}
-	}()
-	p.conn = &realConn{conn}
-	p.channel = ch
-	return nil
+	}
+}
+
+// lost drops conn, fails every pending request and reconnects unless the
+// publisher was closed on purpose.
+func (p *Publisher) lost(conn amqpConnection, cause *amqp.Error) {
+	p.mu.Lock()
+	if p.conn == conn {
+		p.conn = nil
+		p.channel = nil
+		p.confirms.fail(ErrConnectionLost)
+	}
+	for corrID, ch := range p.pending {
+		select {
+		case ch <- reply{err: ErrConnectionLost}:
+		default:
+		}
+		delete(p.pending, corrID)
+	}
+	closed := p.closed
+	p.mu.Unlock()
+
+	conn.Close()
+	if closed {
+		return
+	}
+	entry := p.logger.WithField("component", "mq.publisher")
+	if cause != nil {
+		entry = entry.WithError(cause)
+	}
+	entry.Warn("mq: publisher connection lost, reconnecting")
+	p.reconnect()
+}
+
+// reconnect redials with jittered exponential backoff until it succeeds or
+// the publisher is closed.
+func (p *Publisher) reconnect() {
+	backoff := reconnectBackoffBase
+	for {
+		// Equal jitter: wait between half and the full backoff so a broker
+		// restart doesn't get every service redialing at the same instant.
+		delay := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-p.done:
+			return
+		case <-time.After(delay):
+		}
+		err := p.connect()
+		if err == nil {
+			p.logger.Info("mq: publisher reconnected")
+			return
+		}
+		if errors.Is(err, ErrNotConnected) {
+			return // closed while dialing
+		}
+		p.logger.WithError(err).Warnf("mq: publisher reconnect failed, retrying in up to %s", backoff)
+		backoff = min(backoff*2, reconnectBackoffMax)
+	}
 }
 
 func (p *Publisher) ensureConnected() error {
-	if p.conn != nil && !p.conn.IsClosed() {
-		return nil
+	if p.conn == nil || p.channel == nil || p.conn.IsClosed() {
+		return ErrNotConnected
 	}
-	return p.connect()
+	return nil
+}
+
+// Healthy reports whether the publisher currently holds an open connection.
+func (p *Publisher) Healthy() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn != nil && !p.conn.IsClosed()
 }
 
-// publishLocked declares the queue and publishes a message. Must be called with p.mu held.
-func (p *Publisher) publishLocked(queue string, msg amqp.Publishing) error {
+// sendLocked declares queue and publishes msg to it through the default
+// exchange. When wait is set the message is mandatory and the returned
+// channel receives the broker's confirm. Must be called with p.mu held.
+func (p *Publisher) sendLocked(queue string, wait bool, msg amqp.Publishing) (<-chan error, error) {
 	if err := p.ensureConnected(); err != nil {
-		return err
+		return nil, err
 	}
 	if _, err := p.channel.QueueDeclare(queue, true, false, false, false, nil); err != nil {
-		return err
+		return nil, err
 	}
-	return p.channel.Publish(
+	return p.publishLocked(
 		"",    // default exchange
 		queue, // routing key = queue name
-		false, // mandatory
-		false, // immediate
+		wait,  // mandatory: have the broker return it if no queue takes it
+		wait,
 		msg,
 	)
 }
 
-func (p *Publisher) Publish(queue string, body []byte) error {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	return p.publishLocked(queue, amqp.Publishing{
+// Publish sends body to queue without waiting for a reply, and waits for
+// the broker to confirm it. A nil error means the broker has the message;
+// otherwise it was nacked, returned as unroutable, or not confirmed within
+// the ConfirmTimeout. The span in ctx is propagated to the consumer through
+// the message headers.
+func (p *Publisher) Publish(ctx context.Context, queue string, body []byte) (err error) {
+	done, err := p.publish(ctx, queue, body)
+	if err != nil {
+		return err
+	}
+	return p.awaitConfirm(ctx, done)
+}
+
+// publish sends body to queue and returns the channel its confirm arrives on.
+func (p *Publisher) publish(ctx context.Context, queue string, body []byte) (_ <-chan error, err error) {
+	msg := amqp.Publishing{
 		ContentType:  "application/json",
+		MessageId:    uuid.New().String(),
 		Body:         body,
 		DeliveryMode: amqp.Persistent, // survives broker restart
-	})
+	}
+	span := startPublishSpan(ctx, queue, trace.SpanKindProducer, &msg)
+	defer func() { tracing.End(span, err) }()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sendLocked(queue, true, msg)
 }
 
-func (p *Publisher) Request(queue string, body []byte) ([]byte, error) {
+// Request publishes body to queue and waits for the reply. The ctx deadline
+// (or defaultRequestTimeout when ctx has none) is sent along with the message
+// so the consumer stops working on it once the caller has given up.
+func (p *Publisher) Request(ctx context.Context, queue string, body []byte) ([]byte, error) {
+	r, err := p.request(ctx, queue, amqp.Publishing{ContentType: ContentTypeJSON, Body: body})
+	return r.body, err
+}
+
+// request publishes msg to queue as a request and waits for the reply. msg
+// keeps its MessageId when set, so retries of one call share it.
+func (p *Publisher) request(ctx context.Context, queue string, msg amqp.Publishing) (_ reply, err error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultRequestTimeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return reply{}, requestError(err)
+	}
+	deadline, _ := ctx.Deadline()
+
 	corrID := uuid.New().String()
-	ch := make(chan []byte, 1)
+	ch := make(chan reply, 1)
+
+	msg.CorrelationId = corrID
+	msg.ReplyTo = "amq.rabbitmq.reply-to"
+	if msg.MessageId == "" {
+		msg.MessageId = corrID
+	}
+	setDeadline(&msg, deadline)
+	span := startPublishSpan(ctx, queue, trace.SpanKindClient, &msg)
+	defer func() { tracing.End(span, err) }()
 
 	// Hold the lock for connection check, QueueDeclare, and Publish.
 	// Release before blocking on the reply so the reply goroutine can acquire it.
 	p.mu.Lock()
 	p.pending[corrID] = ch
-	err := p.publishLocked(queue, amqp.Publishing{
-		ContentType:   "application/json",
-		CorrelationId: corrID,
-		ReplyTo:       "amq.rabbitmq.reply-to",
-		Body:          body,
-	})
+	_, err = p.sendLocked(queue, false, msg)
 	if err != nil {
 		delete(p.pending, corrID)
 		p.mu.Unlock()
-		return nil, err
+		return reply{}, err
 	}
 	p.mu.Unlock()
 
@@ -132,14 +339,38 @@ func (p *Publisher) Request(queue string, body []byte) ([]byte, error) {
 	}()
 
 	select {
-	case resp := <-ch:
-		return resp, nil
-	case <-time.After(30 * time.Second):
-		return nil, fmt.Errorf("mq: request timed out")
+	case r := <-ch:
+		return r, r.err
+	case <-ctx.Done():
+		return reply{}, requestError(ctx.Err())
 	}
 }
 
+func requestError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("mq: request timed out: %w", err)
+	}
+	return fmt.Errorf("mq: request cancelled: %w", err)
+}
+
+// Close stops reconnecting and closes the connection. Pending requests fail
+// with ErrConnectionLost.
 func (p *Publisher) Close() {
-	p.channel.Close()
-	p.conn.Close()
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.done)
+	conn, ch := p.conn, p.channel
+	p.conn, p.channel = nil, nil
+	p.mu.Unlock()
+
+	if ch != nil {
+		ch.Close()
+	}
+	if conn != nil {
+		conn.Close()
+	}
 }
@@ -0,0 +1,196 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestPublisher connects a Publisher whose dials hand out conns in order
+// and fail once they run out.
+func newTestPublisher(t *testing.T, conns ...*mockConn) *Publisher {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	var mu sync.Mutex
+	p := &Publisher{
+		dial: func(string) (amqpConnection, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if len(conns) == 0 {
+				return nil, errors.New("dial failed")
+			}
+			conn := conns[0]
+			conns = conns[1:]
+			return conn, nil
+		},
+		pending: make(map[string]chan reply),
+		logger:  logger,
+		done:    make(chan struct{}),
+	}
+	if err := p.connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *Publisher) pendingCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending)
+}
+
+func TestPublisherRequest_cancelledContext_doesNotPublish(t *testing.T) {
+	conn, ch := newMockSetup()
+	p := newTestPublisher(t, conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := p.Request(ctx, "q", []byte("body")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if ch.lastPublished() != nil {
+		t.Fatal("should not publish once ctx is done")
+	}
+}
+
+func TestPublisherRequest_returnsWhenDeadlineExpires(t *testing.T) {
+	conn, ch := newMockSetup()
+	p := newTestPublisher(t, conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := p.Request(ctx, "q", []byte("body"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("request should return as soon as ctx expires")
+	}
+	pub := ch.lastPublished()
+	if pub == nil {
+		t.Fatal("expected request to be published")
+	}
+	if pub.Expiration == "" {
+		t.Fatal("expected expiration to be set")
+	}
+	if _, ok := pub.Headers[HeaderDeadline]; !ok {
+		t.Fatal("expected deadline header to be set")
+	}
+	if p.pendingCount() != 0 {
+		t.Fatal("expected pending entry to be removed")
+	}
+}
+
+func TestPublisherRequest_deliversReply(t *testing.T) {
+	conn, ch := newMockSetup()
+	p := newTestPublisher(t, conn)
+
+	go func() {
+		waitFor(t, func() bool { return ch.lastPublished() != nil })
+		ch.msgs <- amqp.Delivery{CorrelationId: ch.lastPublished().CorrelationId, Body: []byte("pong")}
+	}()
+
+	resp, err := p.Request(context.Background(), "q", []byte("ping"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(resp) != "pong" {
+		t.Fatalf("expected %q, got %q", "pong", resp)
+	}
+}
+
+func TestPublisherRequest_connectionDrop_failsPendingImmediately(t *testing.T) {
+	conn, ch := newMockSetup()
+	p := newTestPublisher(t, conn)
+
+	go func() {
+		waitFor(t, func() bool { return p.pendingCount() == 1 })
+		conn.drop()
+	}()
+
+	start := time.Now()
+	_, err := p.Request(context.Background(), "q", []byte("ping"))
+	if !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected ErrConnectionLost, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("pending request should fail as soon as the connection drops")
+	}
+	if ch.lastPublished() == nil {
+		t.Fatal("expected request to have been published")
+	}
+}
+
+func TestPublisherRequest_replyChannelClosed_failsPending(t *testing.T) {
+	conn, ch := newMockSetup()
+	p := newTestPublisher(t, conn)
+
+	go func() {
+		waitFor(t, func() bool { return p.pendingCount() == 1 })
+		close(ch.msgs)
+	}()
+
+	if _, err := p.Request(context.Background(), "q", []byte("ping")); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected ErrConnectionLost, got %v", err)
+	}
+	waitFor(t, conn.wasCloseCalled)
+}
+
+func TestPublisher_reconnectsInBackground(t *testing.T) {
+	first, _ := newMockSetup()
+	second, secondCh := newMockSetup()
+	p := newTestPublisher(t, first, second)
+
+	first.drop()
+	waitFor(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.conn == second
+	})
+	if !p.Healthy() {
+		t.Fatal("expected publisher to be healthy after reconnecting")
+	}
+	if err := p.Publish(context.Background(), "q", []byte("body")); err != nil {
+		t.Fatalf("unexpected publish error: %v", err)
+	}
+	if secondCh.lastPublished() == nil {
+		t.Fatal("expected publish on the new channel")
+	}
+}
+
+func TestPublisher_disconnected_failsFast(t *testing.T) {
+	conn, _ := newMockSetup()
+	p := newTestPublisher(t, conn)
+
+	conn.drop()
+	waitFor(t, func() bool { return !p.Healthy() })
+
+	if err := p.Publish(context.Background(), "q", []byte("body")); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expected ErrNotConnected, got %v", err)
+	}
+	if _, err := p.Request(context.Background(), "q", []byte("body")); !errors.Is(err, ErrNotConnected) {
+		t.Fatalf("expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestPublisher_Close_closesConnection(t *testing.T) {
+	conn, _ := newMockSetup()
+	p := newTestPublisher(t, conn)
+	p.Close()
+	if !conn.wasCloseCalled() {
+		t.Fatal("expected conn.Close() to be called")
+	}
+	if p.Healthy() {
+		t.Fatal("expected closed publisher to be unhealthy")
+	}
+	p.Close() // idempotent
+}
@@ -0,0 +1,36 @@
+package rmq
+
+import (
+	"context"
+
+	"github.com/mercury/pkg/ratelimit"
+)
+
+// ErrRateLimited is returned by UseRateLimit for a message over its limit.
+// It is a client error, so it is never retried, and ConvertHttpError turns
+// it into a 429.
+var ErrRateLimited = NewError(429, "mq: rate limited")
+
+// UseRateLimit limits the queue's messages with l, counting each under
+// key(ctx, body) within the queue; a nil key counts them all together. A
+// concurrency limiter's slot is held while the handler runs. Messages pass
+// when l fails.
+func UseRateLimit(l ratelimit.Limiter, key func(ctx context.Context, body []byte) string) Middleware {
+	return func(queue string, next Handler) Handler {
+		return func(ctx context.Context, body []byte) ([]byte, error) {
+			k := "ratelimit:mq:" + queue
+			if key != nil {
+				k += ":" + key(ctx, body)
+			}
+			res, err := l.Allow(ctx, k)
+			if err != nil {
+				return next(ctx, body)
+			}
+			defer res.Release()
+			if !res.Allowed {
+				return nil, ErrRateLimited
+			}
+			return next(ctx, body)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mercury/pkg/ratelimit"
+)
+
+func TestUseRateLimit_deniesOverLimitPerKey(t *testing.T) {
+	l := ratelimit.NewTokenBucket(ratelimit.NewMemory(), ratelimit.Rate{Limit: 2, Window: time.Hour})
+	byBody := func(_ context.Context, body []byte) string { return string(body) }
+	h := UseRateLimit(l, byBody)("q", func(context.Context, []byte) ([]byte, error) {
+		return []byte(`{}`), nil
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := h(context.Background(), []byte("a")); err != nil {
+			t.Fatalf("message %d: expected allowed, got %v", i, err)
+		}
+	}
+	if _, err := h(context.Background(), []byte("a")); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if _, err := h(context.Background(), []byte("b")); err != nil {
+		t.Fatalf("expected another key to be allowed, got %v", err)
+	}
+	if Classify(ErrRateLimited) != ClassClient {
+		t.Fatal("expected a rate limited message not to be retried")
+	}
+}
+
+func TestUseRateLimit_releasesConcurrencySlot(t *testing.T) {
+	l := ratelimit.NewConcurrency(ratelimit.NewMemory(), 1, time.Minute)
+	h := UseRateLimit(l, nil)("q", func(context.Context, []byte) ([]byte, error) {
+		return nil, nil
+	})
+	for i := 0; i < 3; i++ {
+		if _, err := h(context.Background(), nil); err != nil {
+			t.Fatalf("message %d: expected the slot to be free again, got %v", i, err)
+		}
+	}
+}
+
+func TestConvertHttpError_429MapsToTooManyRequests(t *testing.T) {
+	he, ok := ConvertHttpError(ErrRateLimited).(*echo.HTTPError)
+	if !ok || he.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected a 429, got %v", he)
+	}
+}
@@ -0,0 +1,41 @@
+package rmq
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/mercury/pkg/instrumentation/metrics"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrHandlerPanicked is returned in place of a handler that panicked. The
+// panic value stays in the logs and is not sent to the caller.
+var ErrHandlerPanicked = NewError(500, "mq: handler panicked")
+
+// UseRecover turns a panic in the handler into ErrHandlerPanicked, logging
+// the stack with the request ID and counting it as mq.msg.panic. Consume
+// always applies it closest to the handler, so the logger and metrics
+// set by the other middlewares are in ctx; list it explicitly to also cover
+// panics in middlewares.
+func UseRecover() Middleware {
+	return func(queue string, next Handler) Handler {
+		return func(ctx context.Context, body []byte) (resp []byte, err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+				GetLogger(ctx).WithFields(logrus.Fields{
+					"queue":      queue,
+					"request_id": RequestID(ctx),
+					"panic":      fmt.Sprint(r),
+					"stack":      string(debug.Stack()),
+				}).Error("mq: handler panicked")
+				GetMetrics(ctx).Incr("mq.msg.panic", 1, metrics.StringTag("queue", queue))
+				resp, err = nil, ErrHandlerPanicked
+			}()
+			return next(ctx, body)
+		}
+	}
+}
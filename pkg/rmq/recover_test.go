@@ -0,0 +1,47 @@
+package rmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestUseRecover_turnsPanicIntoError(t *testing.T) {
+	h := UseRecover()("q", func(context.Context, []byte) ([]byte, error) {
+		panic("nil map")
+	})
+	resp, err := h(context.Background(), nil)
+	if resp != nil || !errors.Is(err, ErrHandlerPanicked) {
+		t.Fatalf("expected ErrHandlerPanicked, got %q, %v", resp, err)
+	}
+}
+
+func TestConsume_handlerPanics_repliesAndKeepsConsuming(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	c.Consume("q", func(_ context.Context, body []byte) ([]byte, error) {
+		if string(body) == "boom" {
+			panic("boom")
+		}
+		return []byte(`{}`), nil
+	})
+
+	first := &mockAck{}
+	ch.msgs <- delivery(first, []byte("boom"), "reply-queue")
+	waitFor(t, first.wasAcked)
+
+	var env envelope
+	if err := json.Unmarshal(ch.lastPublished().Body, &env); err != nil {
+		t.Fatalf("invalid envelope: %v", err)
+	}
+	var rmqErr Error
+	json.Unmarshal(env.Response, &rmqErr)
+	if env.Type != responseTypeError || rmqErr.Code != 500 {
+		t.Fatalf("expected 500 error reply, got %s %+v", env.Type, rmqErr)
+	}
+
+	second := &mockAck{}
+	ch.msgs <- delivery(second, []byte("ok"), "reply-queue")
+	waitFor(t, second.wasAcked)
+}
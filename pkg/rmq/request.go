@@ -2,48 +2,70 @@ package rmq
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 
+	"github.com/google/uuid"
 	"github.com/mercury/pkg/instrumentation"
-	"github.com/smira/go-statsd"
+	"github.com/mercury/pkg/instrumentation/metrics"
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-
+// Request sends req on route and decodes the typed response. The codec is
+// the route's RouteOpt.ContentType, JSON for routes that don't set one.
 func Request[Req any, Resp any](ctx context.Context, p *Publisher, route string, req Req) (_ *Resp, err error) {
 	metricsname := fmt.Sprintf("rmq.%s", route)
-	t := instrumentation.NewMetricsTimer(ctx, metricsname, statsd.StringTag("r", route))
+	t := instrumentation.NewMetricsTimer(ctx, metricsname, metrics.StringTag("r", route))
 	defer func() { t.Done(err) }()
 
-	b, err := json.Marshal(req)
+	var contentType string
+	if info, ok := lookupRoute(route); ok {
+		contentType = info.ContentType
+	}
+	codec, err := CodecFor(contentType)
 	if err != nil {
 		return nil, err
 	}
-	response, err := p.Request(route, b)
+	b, err := codec.Marshal(&req)
 	if err != nil {
 		return nil, err
 	}
-	var env envelope
-	if err := json.Unmarshal(response, &env); err != nil {
+	response, err := p.call(ctx, route, codec.ContentType(), b)
+	if err != nil {
 		return nil, err
 	}
-	if env.Version != envelopeVersion {
-		return nil, NewError(503, "unsupported envelope version")
-	}
-	switch env.Type {
-	case responseTypeError:
-		var rmqErr Error
-		if err := json.Unmarshal(env.Response, &rmqErr); err != nil {
-			return nil, err
-		}
-		return nil, &rmqErr
-	case responseTypeSuccess:
-		var resp Resp
-		if err := json.Unmarshal(env.Response, &resp); err != nil {
-			return nil, err
-		}
-		return &resp, nil
-	default:
-		return nil, NewError(500, "unknown response type")
+	var resp Resp
+	if err := codec.Unmarshal(response, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// call sends body to route through the publisher's client middlewares. Every
+// attempt carries the same message ID, so consumers using UseIdempotency
+// see a retried call as a duplicate.
+func (p *Publisher) call(ctx context.Context, route, contentType string, body []byte) ([]byte, error) {
+	messageID := uuid.New().String()
+	h := func(ctx context.Context, body []byte) ([]byte, error) {
+		return p.roundTrip(ctx, route, contentType, messageID, body)
+	}
+	for i := len(p.middlewares) - 1; i >= 0; i-- {
+		h = p.middlewares[i](route, h)
+	}
+	return h(ctx, body)
+}
+
+// roundTrip sends a single request asking for a version 2 reply and unwraps
+// it into the response body or the *Error the consumer returned. Consumers
+// that predate version 2 still answer with a version 1 envelope.
+func (p *Publisher) roundTrip(ctx context.Context, route, contentType, messageID string, body []byte) ([]byte, error) {
+	r, err := p.request(ctx, route, amqp.Publishing{
+		Headers:     amqp.Table{HeaderEnvelopeVersion: int32(envelopeVersion2)},
+		ContentType: contentType,
+		MessageId:   messageID,
+		Body:        body,
+	})
+	if err != nil {
+		return nil, err
 	}
+	return unwrapReply(r)
 }
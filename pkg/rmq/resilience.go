@@ -0,0 +1,328 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/mercury/pkg/instrumentation/metrics"
+)
+
+// Returned by the client middlewares when they refuse to send a request.
+// Both are 503s so callers treat them like any other unavailable downstream,
+// but they are never retried and never count against the breaker.
+var (
+	ErrCircuitOpen  = NewError(503, "mq: circuit breaker open")
+	ErrBulkheadFull = NewError(503, "mq: too many requests in flight")
+)
+
+// ClientMiddleware receives the route name and wraps the call that sends a
+// typed Request. next returns the decoded response body, or the *Error the
+// consumer replied with. A typical chain is
+//
+//	rmq.NewPublisher(url, rmq.UseRetry(...), rmq.UseBulkhead(...), rmq.UseBreaker(...))
+//
+// so every retry attempt passes through the bulkhead and the breaker.
+type ClientMiddleware func(route string, next Handler) Handler
+
+const (
+	defaultRetryAttempts    = 3
+	defaultRetryBackoffBase = 50 * time.Millisecond
+	defaultRetryBackoffMax  = time.Second
+	defaultBreakerFailures  = 5
+	defaultBreakerCooldown  = 10 * time.Second
+)
+
+// RetryPolicy configures UseRetry. Zero values fall back to the package
+// defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// BackoffBase is the delay before the first retry. Each following retry
+	// doubles it, capped at BackoffMax, with jitter.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// AttemptTimeout bounds each attempt so a lost request can be retried
+	// within the caller's deadline. Zero leaves attempts bounded by ctx only.
+	AttemptTimeout time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryAttempts
+	}
+	if p.BackoffBase <= 0 {
+		p.BackoffBase = defaultRetryBackoffBase
+	}
+	if p.BackoffMax <= 0 {
+		p.BackoffMax = defaultRetryBackoffMax
+	}
+	return p
+}
+
+// backoff returns the jittered delay before the given retry (1-based).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BackoffBase
+	for i := 1; i < attempt && d < p.BackoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, p.BackoffMax)
+	return d/2 + rand.N(d/2+1)
+}
+
+func (p RetryPolicy) attempt(ctx context.Context, next Handler, body []byte) ([]byte, error) {
+	if p.AttemptTimeout <= 0 {
+		return next(ctx, body)
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.AttemptTimeout)
+	defer cancel()
+	return next(ctx, body)
+}
+
+// UseRetry retries idempotent routes that fail with a 503 or an attempt
+// timeout, as long as ctx is still live. Routes declared without
+// RouteOpt.Idempotent are sent once. A route's own RouteOpt.Retry takes
+// precedence over policy.
+func UseRetry(policy RetryPolicy) ClientMiddleware {
+	return func(route string, next Handler) Handler {
+		info, ok := lookupRoute(route)
+		if !ok || !info.Idempotent {
+			return next
+		}
+		p := policy
+		if info.Retry.MaxAttempts > 0 {
+			p = info.Retry
+		}
+		p = p.withDefaults()
+		return func(ctx context.Context, body []byte) ([]byte, error) {
+			for attempt := 1; ; attempt++ {
+				resp, err := p.attempt(ctx, next, body)
+				if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !unavailable(err) {
+					return resp, err
+				}
+				GetLogger(ctx).WithError(err).WithField("route", route).Debugf("mq: retrying request, attempt %d", attempt+1)
+				select {
+				case <-ctx.Done():
+					return nil, err
+				case <-time.After(p.backoff(attempt)):
+				}
+			}
+		}
+	}
+}
+
+// UseBulkhead caps the requests in flight on each route at limit. Requests
+// over the limit fail fast with ErrBulkheadFull instead of queueing behind
+// a slow downstream. A limit of 0 or less disables the bulkhead.
+func UseBulkhead(limit int) ClientMiddleware {
+	var mu sync.Mutex
+	slots := map[string]chan struct{}{}
+	return func(route string, next Handler) Handler {
+		if limit <= 0 {
+			return next
+		}
+		mu.Lock()
+		sem, ok := slots[route]
+		if !ok {
+			sem = make(chan struct{}, limit)
+			slots[route] = sem
+		}
+		mu.Unlock()
+		return func(ctx context.Context, body []byte) ([]byte, error) {
+			select {
+			case sem <- struct{}{}:
+			default:
+				return nil, ErrBulkheadFull
+			}
+			defer func() { <-sem }()
+			return next(ctx, body)
+		}
+	}
+}
+
+// BreakerOpt configures UseBreaker. Zero values fall back to the package
+// defaults.
+type BreakerOpt struct {
+	// Failures is the number of consecutive 503s or timeouts that opens the
+	// breaker.
+	Failures int
+	// Cooldown is how long the breaker stays open before a single probe
+	// request is let through.
+	Cooldown time.Duration
+}
+
+func (o BreakerOpt) withDefaults() BreakerOpt {
+	if o.Failures <= 0 {
+		o.Failures = defaultBreakerFailures
+	}
+	if o.Cooldown <= 0 {
+		o.Cooldown = defaultBreakerCooldown
+	}
+	return o
+}
+
+// UseBreaker keeps a circuit breaker per route. Once it opens, requests fail
+// fast with ErrCircuitOpen until the cooldown has passed and a probe gets an
+// answer from the downstream. A probe its caller cancels leaves the next
+// caller to probe. Every state change is counted as mq.client.breaker on m,
+// tagged with the route and the new state.
+func UseBreaker(opt BreakerOpt, m metrics.Metrics) ClientMiddleware {
+	opt = opt.withDefaults()
+	var mu sync.Mutex
+	breakers := map[string]*breaker{}
+	return func(route string, next Handler) Handler {
+		mu.Lock()
+		b, ok := breakers[route]
+		if !ok {
+			b = &breaker{route: route, opt: opt, metrics: m}
+			breakers[route] = b
+		}
+		mu.Unlock()
+		return func(ctx context.Context, body []byte) ([]byte, error) {
+			ok, probe := b.allow()
+			if !ok {
+				return nil, ErrCircuitOpen
+			}
+			resp, err := next(ctx, body)
+			switch {
+			case errors.Is(ctx.Err(), context.Canceled) || refused(err):
+				// The caller gave up or a middleware turned the request
+				// down, so the downstream wasn't heard from.
+				b.release(probe)
+			case probe:
+				// Only an answer from the downstream closes the breaker.
+				b.record(!answered(err))
+			default:
+				b.record(unavailable(err))
+			}
+			return resp, err
+		}
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+type breaker struct {
+	route    string
+	opt      BreakerOpt
+	metrics  metrics.Metrics
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// allow reports whether a request may be sent, and whether it is the probe.
+// After the cooldown the first caller moves the breaker to half-open and
+// becomes the probe; everyone else keeps failing fast until the probe is
+// recorded or released.
+func (b *breaker) allow() (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.opt.Cooldown {
+			return false, false
+		}
+		b.setState(breakerHalfOpen)
+		return true, true
+	case breakerHalfOpen:
+		return false, false
+	default:
+		return true, false
+	}
+}
+
+// release ends a request without recording its outcome. A probe reopens the
+// breaker with its cooldown already over, so the next caller probes.
+func (b *breaker) release(probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.setState(breakerOpen)
+	}
+}
+
+func (b *breaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.opt.Failures {
+		b.openedAt = time.Now()
+		if b.state != breakerOpen {
+			b.setState(breakerOpen)
+		}
+	}
+}
+
+// setState must be called with b.mu held.
+func (b *breaker) setState(state breakerState) {
+	b.state = state
+	b.metrics.Incr("mq.client.breaker", 1,
+		metrics.StringTag("r", b.route),
+		metrics.StringTag("state", state.String()),
+	)
+}
+
+// unavailable reports whether err means the downstream could not serve the
+// request: a 503 or a timeout. Requests the client middlewares refused
+// themselves don't count.
+func unavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if refused(err) {
+		return false
+	}
+	var rmqErr *Error
+	if errors.As(err, &rmqErr) {
+		return rmqErr.Code == 503
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// refused reports whether err is a client middleware turning the request
+// down before it was sent.
+func refused(err error) bool {
+	var rmqErr *Error
+	return errors.As(err, &rmqErr) && (rmqErr == ErrCircuitOpen || rmqErr == ErrBulkheadFull)
+}
+
+// answered reports whether err, or its absence, is the downstream's own
+// reply rather than a failure to reach it.
+func answered(err error) bool {
+	if err == nil {
+		return true
+	}
+	var rmqErr *Error
+	return errors.As(err, &rmqErr) && rmqErr.Code != 503
+}
@@ -0,0 +1,311 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mercury/pkg/instrumentation/metrics"
+	"github.com/smira/go-statsd"
+)
+
+var fastRetry = RetryPolicy{MaxAttempts: 3, BackoffBase: time.Millisecond, BackoffMax: time.Millisecond}
+
+// failingHandler fails with errs in order, then succeeds.
+func failingHandler(calls *atomic.Int32, errs ...error) Handler {
+	return func(context.Context, []byte) ([]byte, error) {
+		n := int(calls.Add(1))
+		if n <= len(errs) {
+			return nil, errs[n-1]
+		}
+		return []byte(`{}`), nil
+	}
+}
+
+func idempotentRoute(opt RouteOpt) string {
+	name := testRouteName()
+	opt.Idempotent = true
+	NewRouteWithOpt[struct{}, struct{}](Service{Name: "test"}, name, opt)
+	return name
+}
+
+func TestUseRetry_idempotent_retriesUnavailable(t *testing.T) {
+	route := idempotentRoute(RouteOpt{})
+	var calls atomic.Int32
+	h := UseRetry(fastRetry)(route, failingHandler(&calls, ErrConnectionLost, NewError(503, "down")))
+
+	if _, err := h(context.Background(), nil); err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestUseRetry_notIdempotent_sendsOnce(t *testing.T) {
+	route := testRouteName()
+	NewRoute[struct{}, struct{}](Service{Name: "test"}, route)
+	var calls atomic.Int32
+	h := UseRetry(fastRetry)(route, failingHandler(&calls, ErrConnectionLost))
+
+	if _, err := h(context.Background(), nil); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected ErrConnectionLost, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected a single attempt, got %d", calls.Load())
+	}
+}
+
+func TestUseRetry_serviceError_notRetried(t *testing.T) {
+	route := idempotentRoute(RouteOpt{})
+	var calls atomic.Int32
+	h := UseRetry(fastRetry)(route, failingHandler(&calls, NewError(8004, "inventory does not exist")))
+
+	if _, err := h(context.Background(), nil); !errors.Is(err, NewError(8004, "")) {
+		t.Fatalf("expected service error, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected a single attempt, got %d", calls.Load())
+	}
+}
+
+func TestUseRetry_attemptTimeout_retriesWithinDeadline(t *testing.T) {
+	route := idempotentRoute(RouteOpt{})
+	var calls atomic.Int32
+	h := UseRetry(RetryPolicy{MaxAttempts: 2, BackoffBase: time.Millisecond, AttemptTimeout: 10 * time.Millisecond})(route,
+		func(ctx context.Context, _ []byte) ([]byte, error) {
+			if calls.Add(1) == 1 {
+				<-ctx.Done()
+				return nil, requestError(ctx.Err())
+			}
+			return []byte(`{}`), nil
+		})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := h(ctx, nil); err != nil {
+		t.Fatalf("expected second attempt to succeed, got %v", err)
+	}
+}
+
+func TestUseRetry_routePolicyOverridesDefault(t *testing.T) {
+	route := idempotentRoute(RouteOpt{Retry: RetryPolicy{MaxAttempts: 5, BackoffBase: time.Millisecond}})
+	var calls atomic.Int32
+	h := UseRetry(fastRetry)(route, failingHandler(&calls, ErrConnectionLost, ErrConnectionLost, ErrConnectionLost, ErrConnectionLost))
+
+	if _, err := h(context.Background(), nil); err != nil {
+		t.Fatalf("expected success on fifth attempt, got %v", err)
+	}
+	if calls.Load() != 5 {
+		t.Fatalf("expected 5 attempts, got %d", calls.Load())
+	}
+}
+
+func TestUseRetry_rejectedRequest_notRetried(t *testing.T) {
+	route := idempotentRoute(RouteOpt{})
+	var calls atomic.Int32
+	h := UseRetry(fastRetry)(route, failingHandler(&calls, ErrCircuitOpen))
+
+	if _, err := h(context.Background(), nil); err != ErrCircuitOpen {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("expected a single attempt, got %d", calls.Load())
+	}
+}
+
+func TestUseBulkhead_rejectsOverLimit(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	mw := UseBulkhead(1)
+	slow := mw("q", func(context.Context, []byte) ([]byte, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+
+	var wg sync.WaitGroup
+	wg.Go(func() { slow(context.Background(), nil) })
+	<-started
+	if _, err := mw("q", nopHandler)(context.Background(), nil); err != ErrBulkheadFull {
+		t.Fatalf("expected ErrBulkheadFull, got %v", err)
+	}
+	if _, err := mw("other", nopHandler)(context.Background(), nil); err != nil {
+		t.Fatalf("expected other route to have its own bulkhead, got %v", err)
+	}
+	close(release)
+	wg.Wait()
+	if _, err := mw("q", nopHandler)(context.Background(), nil); err != nil {
+		t.Fatalf("expected slot to be released, got %v", err)
+	}
+}
+
+func nopHandler(context.Context, []byte) ([]byte, error) { return nil, nil }
+
+func TestUseBreaker_opensAndRecovers(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := statsd.NewClient(conn.LocalAddr().String(), statsd.FlushInterval(10*time.Millisecond))
+	defer client.Close()
+
+	var down atomic.Bool
+	down.Store(true)
+	var calls atomic.Int32
+	mw := UseBreaker(BreakerOpt{Failures: 2, Cooldown: 20 * time.Millisecond}, metrics.NewStatsd(client))
+	h := func() error {
+		_, err := mw("q", func(context.Context, []byte) ([]byte, error) {
+			calls.Add(1)
+			if down.Load() {
+				return nil, context.DeadlineExceeded
+			}
+			return nil, nil
+		})(context.Background(), nil)
+		return err
+	}
+
+	h()
+	h()
+	if err := h(); err != ErrCircuitOpen {
+		t.Fatalf("expected breaker to be open, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected open breaker to fail fast, got %d calls", calls.Load())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	down.Store(false)
+	if err := h(); err != nil {
+		t.Fatalf("expected probe to go through, got %v", err)
+	}
+	if err := h(); err != nil {
+		t.Fatalf("expected breaker to be closed, got %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 4096)
+	var received string
+	for !strings.Contains(received, "state=closed") {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("expected state changes to be reported, got %q (%v)", received, err)
+		}
+		received += string(buf[:n])
+	}
+	for _, state := range []string{"open", "half_open"} {
+		if !strings.Contains(received, "mq.client.breaker,r=q,state="+state) {
+			t.Fatalf("expected %s transition to be reported, got %q", state, received)
+		}
+	}
+}
+
+func TestUseBreaker_failedProbe_reopens(t *testing.T) {
+	mw := UseBreaker(BreakerOpt{Failures: 1, Cooldown: 10 * time.Millisecond}, GetMetrics(context.Background()))
+	failing := mw("q", func(context.Context, []byte) ([]byte, error) { return nil, ErrConnectionLost })
+
+	failing(context.Background(), nil)
+	time.Sleep(15 * time.Millisecond)
+	if _, err := failing(context.Background(), nil); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected probe to reach the handler, got %v", err)
+	}
+	if _, err := failing(context.Background(), nil); err != ErrCircuitOpen {
+		t.Fatalf("expected breaker to reopen after failed probe, got %v", err)
+	}
+}
+
+func TestUseBreaker_canceledProbe_handsOverProbe(t *testing.T) {
+	mw := UseBreaker(BreakerOpt{Failures: 2, Cooldown: 10 * time.Millisecond}, GetMetrics(context.Background()))
+	var calls atomic.Int32
+	h := mw("q", func(ctx context.Context, _ []byte) ([]byte, error) {
+		calls.Add(1)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrConnectionLost
+	})
+
+	h(context.Background(), nil)
+	h(context.Background(), nil)
+	time.Sleep(15 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := h(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected probe to reach the handler, got %v", err)
+	}
+	// Had the canceled probe closed the breaker, one failure wouldn't
+	// reopen it.
+	if _, err := h(context.Background(), nil); !errors.Is(err, ErrConnectionLost) {
+		t.Fatalf("expected the next caller to probe, got %v", err)
+	}
+	if _, err := h(context.Background(), nil); err != ErrCircuitOpen {
+		t.Fatalf("expected breaker to reopen after the failed probe, got %v", err)
+	}
+	if calls.Load() != 4 {
+		t.Fatalf("expected 4 calls to reach the handler, got %d", calls.Load())
+	}
+}
+
+func TestUseBreaker_probeWithoutAnswer_reopens(t *testing.T) {
+	mw := UseBreaker(BreakerOpt{Failures: 1, Cooldown: 10 * time.Millisecond}, GetMetrics(context.Background()))
+	var calls atomic.Int32
+	h := mw("q", func(context.Context, []byte) ([]byte, error) {
+		if calls.Add(1) == 1 {
+			return nil, ErrConnectionLost
+		}
+		return nil, errors.New("mq: channel closed")
+	})
+
+	h(context.Background(), nil)
+	time.Sleep(15 * time.Millisecond)
+	if _, err := h(context.Background(), nil); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("expected probe to reach the handler, got %v", err)
+	}
+	if _, err := h(context.Background(), nil); err != ErrCircuitOpen {
+		t.Fatalf("expected breaker to reopen after a probe without an answer, got %v", err)
+	}
+}
+
+func TestUseBreaker_serviceErrors_keepClosed(t *testing.T) {
+	mw := UseBreaker(BreakerOpt{Failures: 1}, GetMetrics(context.Background()))
+	h := mw("q", func(context.Context, []byte) ([]byte, error) { return nil, NewError(404, "not found") })
+
+	for range 3 {
+		if _, err := h(context.Background(), nil); err == ErrCircuitOpen {
+			t.Fatal("expected non-503 errors not to open the breaker")
+		}
+	}
+}
+
+func TestPublisher_clientMiddlewares_wrapTypedRequest(t *testing.T) {
+	b, _, c := newMemorySetup(t)
+	route := idempotentRoute(RouteOpt{})
+	var calls atomic.Int32
+	c.Consume(route, func(context.Context, []byte) ([]byte, error) {
+		if calls.Add(1) == 1 {
+			return nil, NewError(503, "warming up")
+		}
+		return []byte(`{}`), nil
+	})
+	waitForConsumers(t, c, 1)
+
+	p, err := NewPublisher(b.URL(), UseRetry(fastRetry))
+	if err != nil {
+		t.Fatalf("NewPublisher: %v", err)
+	}
+	t.Cleanup(p.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := Request[struct{}, struct{}](ctx, p, route, struct{}{}); err != nil {
+		t.Fatalf("expected retried request to succeed, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", calls.Load())
+	}
+}
@@ -0,0 +1,128 @@
+package rmq
+
+import (
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Headers written on messages that are retried or dead-lettered.
+const (
+	HeaderAttempts       = "x-attempts"
+	HeaderLastError      = "x-last-error"
+	HeaderOriginalQueue  = "x-original-queue"
+	HeaderDeadLetteredAt = "x-dead-lettered-at"
+)
+
+// backoff returns the delay before the given retry (1-based).
+func (o QueueOpt) backoff(attempt int) time.Duration {
+	d := o.BackoffBase
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= o.BackoffMax {
+			return o.BackoffMax
+		}
+	}
+	return d
+}
+
+// DeadLetterQueue returns the name of the queue that holds messages which
+// exhausted their attempts on queue.
+func DeadLetterQueue(queue string) string {
+	return queue + ".dlq"
+}
+
+// retryQueue returns the name of the delay queue for a given backoff.
+// The delay is part of the name so changing the backoff settings declares
+// new queues instead of conflicting with the x-message-ttl of existing ones.
+func retryQueue(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", queue, delay)
+}
+
+// declareRetryQueues declares the dead-letter queue and one delay queue per
+// retry. Delay queues have no consumers: messages sit there until their TTL
+// expires and the broker dead-letters them back onto the work queue through
+// the default exchange.
+func declareRetryQueues(ch amqpChannel, queue string, opt QueueOpt) error {
+	if _, err := ch.QueueDeclare(DeadLetterQueue(queue), true, false, false, false, nil); err != nil {
+		return err
+	}
+	for attempt := 1; attempt < opt.MaxAttempts; attempt++ {
+		delay := opt.backoff(attempt)
+		if _, err := ch.QueueDeclare(retryQueue(queue, delay), true, false, false, false, amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queue,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attempts returns how many times msg has already been handled and failed.
+func attempts(msg amqp.Delivery) int {
+	switch v := msg.Headers[HeaderAttempts].(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	default:
+		return 0
+	}
+}
+
+// retryOrDeadLetter republishes a failed fire-and-forget message to the next
+// delay queue, or to the dead-letter queue once it has used up its attempts
+// or failed with an error that isn't retryable. The original message is
+// acked only after the copy has been published.
+func (c *Consumer) retryOrDeadLetter(ch amqpChannel, queue string, opt QueueOpt, msg amqp.Delivery, handlerErr error) {
+	attempt := attempts(msg) + 1
+
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers[HeaderAttempts] = int32(attempt)
+	headers[HeaderLastError] = handlerErr.Error()
+
+	target := DeadLetterQueue(queue)
+	if attempt < opt.MaxAttempts && Classify(handlerErr) == ClassRetryable {
+		target = retryQueue(queue, opt.backoff(attempt))
+	} else {
+		headers[HeaderOriginalQueue] = queue
+		headers[HeaderDeadLetteredAt] = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	if err := ch.Publish("", target, false, false, amqp.Publishing{
+		Headers:       headers,
+		ContentType:   msg.ContentType,
+		CorrelationId: msg.CorrelationId,
+		MessageId:     msg.MessageId,
+		Timestamp:     msg.Timestamp,
+		Type:          msg.Type,
+		AppId:         msg.AppId,
+		DeliveryMode:  amqp.Persistent,
+		Body:          msg.Body,
+	}); err != nil {
+		c.logger.WithError(err).Errorf("mq: failed to publish to %s, nacking", target)
+		c.reject(msg, err)
+		return
+	}
+
+	entry := c.logger.WithFields(logrus.Fields{
+		"queue":   queue,
+		"attempt": attempt,
+		"target":  target,
+	})
+	if target == DeadLetterQueue(queue) {
+		entry.WithField("class", Classify(handlerErr)).Warn("mq: message dead-lettered")
+	} else {
+		entry.Info("mq: message scheduled for retry")
+	}
+	msg.Ack(false)
+}
@@ -0,0 +1,152 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestQueueOpt_withDefaults_fillsZeroValues(t *testing.T) {
+	opt := QueueOpt{}.withDefaults()
+	if opt.MaxAttempts != defaultMaxAttempts {
+		t.Fatalf("expected MaxAttempts %d, got %d", defaultMaxAttempts, opt.MaxAttempts)
+	}
+	if opt.BackoffBase != defaultBackoffBase {
+		t.Fatalf("expected BackoffBase %s, got %s", defaultBackoffBase, opt.BackoffBase)
+	}
+	if opt.BackoffMax != defaultBackoffMax {
+		t.Fatalf("expected BackoffMax %s, got %s", defaultBackoffMax, opt.BackoffMax)
+	}
+	if opt.Workers != 1 || opt.Prefetch != 1 {
+		t.Fatalf("expected 1 worker with prefetch 1, got %d/%d", opt.Workers, opt.Prefetch)
+	}
+	if got := (QueueOpt{Workers: 8}).withDefaults().Prefetch; got != 8 {
+		t.Fatalf("expected prefetch to default to Workers, got %d", got)
+	}
+}
+
+func TestQueueOpt_backoff_doublesAndCaps(t *testing.T) {
+	opt := QueueOpt{BackoffBase: time.Second, BackoffMax: 5 * time.Second}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := opt.backoff(i + 1); got != w {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, w, got)
+		}
+	}
+}
+
+func TestAttempts_readsIntegerHeaderTypes(t *testing.T) {
+	cases := []any{int(3), int32(3), int64(3)}
+	for _, v := range cases {
+		msg := amqp.Delivery{Headers: amqp.Table{HeaderAttempts: v}}
+		if got := attempts(msg); got != 3 {
+			t.Errorf("%T: expected 3, got %d", v, got)
+		}
+	}
+	if got := attempts(amqp.Delivery{}); got != 0 {
+		t.Errorf("missing header: expected 0, got %d", got)
+	}
+}
+
+func TestConsumeWithOpt_declaresRetryAndDeadLetterQueues(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	c.ConsumeWithOpt("q", QueueOpt{MaxAttempts: 3, BackoffBase: time.Second}, func(_ context.Context, _ []byte) ([]byte, error) {
+		return nil, nil
+	})
+
+	waitFor(t, func() bool {
+		_, ok := ch.declaredArgs("q.retry.2s")
+		return ok
+	})
+	if _, ok := ch.declaredArgs(DeadLetterQueue("q")); !ok {
+		t.Fatal("expected dead-letter queue to be declared")
+	}
+	args, _ := ch.declaredArgs("q.retry.1s")
+	if args["x-dead-letter-routing-key"] != "q" {
+		t.Fatalf("expected retry queue to dead-letter back to q, got %v", args["x-dead-letter-routing-key"])
+	}
+	if args["x-message-ttl"] != int64(1000) {
+		t.Fatalf("expected ttl 1000ms, got %v", args["x-message-ttl"])
+	}
+	if _, ok := ch.declaredArgs("q.retry.4s"); ok {
+		t.Fatal("expected only MaxAttempts-1 retry queues")
+	}
+}
+
+func TestConsumeWithOpt_incrementsAttemptsHeader(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	c.ConsumeWithOpt("q", QueueOpt{MaxAttempts: 5}, func(_ context.Context, _ []byte) ([]byte, error) {
+		return nil, errors.New("still broken")
+	})
+
+	ack := &mockAck{}
+	d := delivery(ack, []byte("body"), "")
+	d.Headers = amqp.Table{HeaderAttempts: int32(2), "x-custom": "kept"}
+	ch.msgs <- d
+
+	waitFor(t, ack.wasAcked)
+	if key := ch.lastRoutingKey(); key != "q.retry.4s" {
+		t.Fatalf("expected third retry on %q, got %q", "q.retry.4s", key)
+	}
+	pub := ch.lastPublished()
+	if pub.Headers[HeaderAttempts] != int32(3) {
+		t.Fatalf("expected attempts 3, got %v", pub.Headers[HeaderAttempts])
+	}
+	if pub.Headers[HeaderLastError] != "still broken" {
+		t.Fatalf("expected last error to be recorded, got %v", pub.Headers[HeaderLastError])
+	}
+	if pub.Headers["x-custom"] != "kept" {
+		t.Fatal("expected original headers to be preserved")
+	}
+}
+
+func TestConsumeWithOpt_exhaustedAttempts_deadLetters(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	c.ConsumeWithOpt("q", QueueOpt{MaxAttempts: 3}, func(_ context.Context, _ []byte) ([]byte, error) {
+		return nil, errors.New("poison")
+	})
+
+	ack := &mockAck{}
+	d := delivery(ack, []byte("body"), "")
+	d.Headers = amqp.Table{HeaderAttempts: int32(2)}
+	ch.msgs <- d
+
+	waitFor(t, ack.wasAcked)
+	if key := ch.lastRoutingKey(); key != DeadLetterQueue("q") {
+		t.Fatalf("expected dead-letter on %q, got %q", DeadLetterQueue("q"), key)
+	}
+	pub := ch.lastPublished()
+	if pub.Headers[HeaderOriginalQueue] != "q" {
+		t.Fatalf("expected original queue header, got %v", pub.Headers[HeaderOriginalQueue])
+	}
+	if pub.Headers[HeaderLastError] != "poison" {
+		t.Fatalf("expected last error header, got %v", pub.Headers[HeaderLastError])
+	}
+	if string(pub.Body) != "body" {
+		t.Fatalf("expected body to be preserved, got %q", pub.Body)
+	}
+}
+
+func TestConsumeWithOpt_nonRetryableError_deadLettersAtOnce(t *testing.T) {
+	for _, handlerErr := range []error{Permanent(errors.New("poison")), NewError(400, "bad request")} {
+		conn, ch := newMockSetup()
+		c := newTestConsumer(conn)
+		c.ConsumeWithOpt("q", QueueOpt{MaxAttempts: 3}, func(_ context.Context, _ []byte) ([]byte, error) {
+			return nil, handlerErr
+		})
+
+		ack := &mockAck{}
+		ch.msgs <- delivery(ack, []byte("body"), "")
+
+		waitFor(t, ack.wasAcked)
+		if key := ch.lastRoutingKey(); key != DeadLetterQueue("q") {
+			t.Fatalf("expected %v to dead-letter on the first attempt, got %q", handlerErr, key)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package rmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// ErrInvalidRequest is returned by Handle for undecodable or invalid requests
+// when the route's Service doesn't name its own error.
+var ErrInvalidRequest = NewError(400, "invalid request")
+
+// Validator is implemented by request types that check their own fields.
+// Handle calls Validate after decoding and before the handler runs.
+type Validator interface {
+	Validate() error
+}
+
+// Service identifies the service that owns a set of routes.
+type Service struct {
+	Name string
+	// InvalidRequest is returned for requests that fail to decode or validate.
+	InvalidRequest *Error
+}
+
+// Route ties a queue name to its request and response types so the client
+// call and the consumer registration can't drift apart. Each service
+// declares its routes once, in the package of its client, which its
+// consumers import too: a queue name then can't be paired with the wrong
+// types on either side.
+type Route[Req any, Resp any] struct {
+	Name    string
+	Service Service
+}
+
+// RouteOpt configures how clients call a route.
+type RouteOpt struct {
+	// Idempotent marks routes that are safe to send more than once, such as
+	// reads. Only idempotent routes are retried by UseRetry.
+	Idempotent bool
+	// Retry overrides the UseRetry policy for this route when its
+	// MaxAttempts is set.
+	Retry RetryPolicy
+	// ContentType selects the codec Request encodes with, JSON when empty.
+	// Switch a route only once its consumers understand envelope version 2;
+	// older consumers decode every request as JSON.
+	ContentType string
+}
+
+// RouteInfo describes a registered route.
+type RouteInfo struct {
+	Name     string
+	Service  string
+	Request  reflect.Type
+	Response reflect.Type
+	RouteOpt
+}
+
+var registry = struct {
+	sync.Mutex
+	routes map[string]RouteInfo
+}{routes: map[string]RouteInfo{}}
+
+// NewRoute declares a route with the default RouteOpt.
+func NewRoute[Req any, Resp any](service Service, name string) Route[Req, Resp] {
+	return NewRouteWithOpt[Req, Resp](service, name, RouteOpt{})
+}
+
+// NewRouteWithOpt declares a route and adds it to the registry. It panics if
+// name was already declared, so two packages can't claim the same queue.
+func NewRouteWithOpt[Req any, Resp any](service Service, name string, opt RouteOpt) Route[Req, Resp] {
+	info := RouteInfo{
+		Name:     name,
+		Service:  service.Name,
+		Request:  reflect.TypeFor[Req](),
+		Response: reflect.TypeFor[Resp](),
+		RouteOpt: opt,
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if prev, ok := registry.routes[name]; ok {
+		panic(fmt.Sprintf("rmq: route %s already declared by %s", name, prev.Service))
+	}
+	registry.routes[name] = info
+	return Route[Req, Resp]{Name: name, Service: service}
+}
+
+// Routes returns every declared route sorted by name.
+func Routes() []RouteInfo {
+	registry.Lock()
+	defer registry.Unlock()
+	routes := make([]RouteInfo, 0, len(registry.routes))
+	for _, r := range registry.routes {
+		routes = append(routes, r)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Name < routes[j].Name })
+	return routes
+}
+
+// lookupRoute returns the registered route called name.
+func lookupRoute(name string) (RouteInfo, bool) {
+	registry.Lock()
+	defer registry.Unlock()
+	info, ok := registry.routes[name]
+	return info, ok
+}
+
+// Request sends req on the route and waits for the typed response.
+func (r Route[Req, Resp]) Request(ctx context.Context, p *Publisher, req Req) (*Resp, error) {
+	return Request[Req, Resp](ctx, p, r.Name, req)
+}
+
+// Handle adapts a typed handler to the route. See Handle.
+func (r Route[Req, Resp]) Handle(fn func(ctx context.Context, req *Req) (*Resp, error)) Handler {
+	return Handle(r.Service.InvalidRequest, fn)
+}
+
+// Consume registers fn as the consumer of the route's queue.
+func (r Route[Req, Resp]) Consume(c *Consumer, fn func(ctx context.Context, req *Req) (*Resp, error), middlewares ...Middleware) {
+	c.Consume(r.Name, r.Handle(fn), middlewares...)
+}
+
+// ConsumeWithOpt registers fn as the consumer of the route's queue with opt.
+func (r Route[Req, Resp]) ConsumeWithOpt(c *Consumer, opt QueueOpt, fn func(ctx context.Context, req *Req) (*Resp, error), middlewares ...Middleware) {
+	c.ConsumeWithOpt(r.Name, opt, r.Handle(fn), middlewares...)
+}
+
+// Handle adapts a typed handler to a Handler. The body is decoded into Req
+// with the codec for the request's ContentType and validated if Req
+// implements Validator; failures are logged with their cause and returned
+// as invalid (ErrInvalidRequest when nil), so decoder details stay out of
+// the reply. A Validate error that is an *Error is returned as it is. The
+// handler's response is encoded with the same codec and its errors are
+// returned unchanged, so *Error values reach the caller as they are.
+func Handle[Req any, Resp any](invalid *Error, fn func(ctx context.Context, req *Req) (*Resp, error)) Handler {
+	if invalid == nil {
+		invalid = ErrInvalidRequest
+	}
+	return func(ctx context.Context, body []byte) ([]byte, error) {
+		codec, err := CodecFor(ContentType(ctx))
+		if err != nil {
+			GetLogger(ctx).WithError(err).Warn("mq: failed to decode request")
+			return nil, invalid
+		}
+		req := new(Req)
+		if err := codec.Unmarshal(body, req); err != nil {
+			GetLogger(ctx).WithError(err).Warn("mq: failed to decode request")
+			return nil, invalid
+		}
+		if v, ok := any(req).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				GetLogger(ctx).WithError(err).Warn("mq: request failed validation")
+				var rmqErr *Error
+				if errors.As(err, &rmqErr) {
+					return nil, rmqErr
+				}
+				return nil, invalid
+			}
+		}
+		resp, err := fn(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return codec.Marshal(resp)
+	}
+}
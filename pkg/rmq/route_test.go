@@ -0,0 +1,155 @@
+package rmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type greetRequest struct {
+	Name string `json:"name"`
+}
+
+func (r *greetRequest) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.Name == "root" {
+		return NewError(403, "forbidden name")
+	}
+	return nil
+}
+
+type greetResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+var errTestInvalid = NewError(9000, "failed to read request")
+
+// testRouteName returns a route name no other test run has declared, since
+// the registry is global and outlives -count reruns.
+func testRouteName() string {
+	return "test.v1." + uuid.New().String()
+}
+
+func greet(_ context.Context, req *greetRequest) (*greetResponse, error) {
+	if req.Name == "nobody" {
+		return nil, NewError(404, "not found")
+	}
+	return &greetResponse{Greeting: "hello " + req.Name}, nil
+}
+
+func TestHandle_decodesAndEncodes(t *testing.T) {
+	body, _ := json.Marshal(greetRequest{Name: "ada"})
+	resp, err := Handle(errTestInvalid, greet)(context.Background(), body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got greetResponse
+	if err := json.Unmarshal(resp, &got); err != nil {
+		t.Fatalf("invalid response JSON: %v", err)
+	}
+	if got.Greeting != "hello ada" {
+		t.Fatalf("expected greeting, got %q", got.Greeting)
+	}
+}
+
+func TestHandle_badJSON_returnsInvalid(t *testing.T) {
+	_, err := Handle(errTestInvalid, greet)(context.Background(), []byte("bad"))
+	if !errors.Is(err, errTestInvalid) {
+		t.Fatalf("expected invalid request error, got %v", err)
+	}
+	if err.Error() != errTestInvalid.Message {
+		t.Fatalf("expected the decode error to stay out of the reply, got %q", err.Error())
+	}
+}
+
+func TestHandle_validationError_returnsInvalid(t *testing.T) {
+	body, _ := json.Marshal(greetRequest{})
+	_, err := Handle(errTestInvalid, greet)(context.Background(), body)
+	if !errors.Is(err, errTestInvalid) {
+		t.Fatalf("expected invalid request error, got %v", err)
+	}
+	if err.Error() != errTestInvalid.Message {
+		t.Fatalf("expected the validation error to stay out of the reply, got %q", err.Error())
+	}
+}
+
+func TestHandle_validationRMQError_passesThrough(t *testing.T) {
+	body, _ := json.Marshal(greetRequest{Name: "root"})
+	_, err := Handle(errTestInvalid, greet)(context.Background(), body)
+	if !errors.Is(err, NewError(403, "")) {
+		t.Fatalf("expected 403 from Validate, got %v", err)
+	}
+}
+
+func TestHandle_handlerError_passesThrough(t *testing.T) {
+	body, _ := json.Marshal(greetRequest{Name: "nobody"})
+	_, err := Handle(errTestInvalid, greet)(context.Background(), body)
+	if !errors.Is(err, NewError(404, "")) {
+		t.Fatalf("expected 404 from handler, got %v", err)
+	}
+}
+
+func TestHandle_nilInvalid_usesDefault(t *testing.T) {
+	_, err := Handle(nil, greet)(context.Background(), []byte("bad"))
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("expected ErrInvalidRequest, got %v", err)
+	}
+}
+
+func TestNewRoute_duplicate_panics(t *testing.T) {
+	svc := Service{Name: "test"}
+	name := testRouteName()
+	NewRoute[greetRequest, greetResponse](svc, name)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected duplicate route to panic")
+		}
+	}()
+	NewRoute[greetRequest, greetResponse](svc, name)
+}
+
+func TestRoutes_listsDeclaredRoutes(t *testing.T) {
+	name := testRouteName()
+	NewRoute[greetRequest, greetResponse](Service{Name: "test"}, name)
+	for _, r := range Routes() {
+		if r.Name != name {
+			continue
+		}
+		if r.Service != "test" || r.Request != reflect.TypeFor[greetRequest]() || r.Response != reflect.TypeFor[greetResponse]() {
+			t.Fatalf("unexpected route info %+v", r)
+		}
+		return
+	}
+	t.Fatal("expected declared route in Routes()")
+}
+
+func TestRoute_requestAndConsume_overMemoryBroker(t *testing.T) {
+	_, p, c := newMemorySetup(t)
+	route := NewRoute[greetRequest, greetResponse](Service{Name: "test", InvalidRequest: errTestInvalid}, testRouteName())
+	route.Consume(c, greet)
+
+	var resp *greetResponse
+	waitFor(t, func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		var err error
+		resp, err = route.Request(ctx, p, greetRequest{Name: "ada"})
+		return err == nil
+	})
+	if resp.Greeting != "hello ada" {
+		t.Fatalf("expected greeting, got %q", resp.Greeting)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := route.Request(ctx, p, greetRequest{}); !errors.Is(err, errTestInvalid) {
+		t.Fatalf("expected service invalid error, got %v", err)
+	}
+}
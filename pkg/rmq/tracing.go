@@ -0,0 +1,59 @@
+package rmq
+
+import (
+	"context"
+
+	"github.com/mercury/pkg/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// headerCarrier adapts amqp.Table to propagation.TextMapCarrier so the W3C
+// traceparent travels in the message headers.
+type headerCarrier amqp.Table
+
+func (h headerCarrier) Get(key string) string {
+	v, _ := h[key].(string)
+	return v
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h[key] = value
+}
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// startPublishSpan starts a span for sending msg to queue and injects it,
+// and the request ID in ctx, into msg's headers.
+func startPublishSpan(ctx context.Context, queue string, kind trace.SpanKind, msg *amqp.Publishing) trace.Span {
+	ctx, span := tracing.Start(ctx, queue+" publish", kind,
+		attribute.String("messaging.system", "rabbitmq"),
+		attribute.String("messaging.destination.name", queue),
+	)
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+	tracing.Inject(ctx, headerCarrier(msg.Headers))
+	if id := tracing.RequestID(ctx); id != "" {
+		msg.Headers[tracing.HeaderRequestID] = id
+	}
+	return span
+}
+
+// startProcessSpan continues the trace carried by msg's headers.
+func startProcessSpan(ctx context.Context, queue string, msg amqp.Delivery) (context.Context, trace.Span) {
+	if msg.Headers != nil {
+		ctx = tracing.Extract(ctx, headerCarrier(msg.Headers))
+	}
+	return tracing.Start(ctx, queue+" process", trace.SpanKindConsumer,
+		attribute.String("messaging.system", "rabbitmq"),
+		attribute.String("messaging.destination.name", queue),
+	)
+}
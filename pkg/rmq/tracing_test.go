@@ -0,0 +1,136 @@
+package rmq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mercury/pkg/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func useTestTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	prev := otel.GetTracerProvider()
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown := tracing.Use(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() {
+		shutdown(context.Background())
+		otel.SetTracerProvider(prev)
+	})
+	return exporter
+}
+
+func TestPublisherRequest_injectsTraceparent(t *testing.T) {
+	useTestTracer(t)
+	conn, ch := newMockSetup()
+	p := newTestPublisher(t, conn)
+
+	ctx, span := tracing.Start(context.Background(), "caller", trace.SpanKindInternal)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	p.Request(ctx, "q", []byte("ping"))
+
+	pub := ch.lastPublished()
+	if pub == nil {
+		t.Fatal("expected a message to be published")
+	}
+	got := tracing.TraceID(tracing.Extract(context.Background(), headerCarrier(pub.Headers)))
+	if want := tracing.TraceID(ctx); got != want {
+		t.Fatalf("expected trace %q in headers, got %q", want, got)
+	}
+	if _, ok := pub.Headers[HeaderDeadline]; !ok {
+		t.Fatal("expected deadline header to be kept alongside traceparent")
+	}
+}
+
+func TestConsume_continuesTraceFromHeaders(t *testing.T) {
+	exporter := useTestTracer(t)
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	traceIDs := make(chan string, 1)
+	c.Consume("q", func(ctx context.Context, _ []byte) ([]byte, error) {
+		traceIDs <- tracing.TraceID(ctx)
+		return nil, nil
+	})
+
+	ack := &mockAck{}
+	d := delivery(ack, []byte("body"), "")
+	d.Headers = amqp.Table{"traceparent": testTraceparent}
+	ch.msgs <- d
+
+	select {
+	case got := <-traceIDs:
+		if got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Fatalf("expected handler to continue caller trace, got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler was not called")
+	}
+	waitFor(t, ack.wasAcked)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "q process" {
+		t.Fatalf("expected one %q span, got %v", "q process", spans)
+	}
+	if got := spans[0].Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Fatalf("expected span parented to caller span, got %q", got)
+	}
+}
+
+func TestPublisherRequest_carriesRequestID(t *testing.T) {
+	conn, ch := newMockSetup()
+	p := newTestPublisher(t, conn)
+
+	ctx := tracing.WithRequestID(context.Background(), "req-1")
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	p.Request(ctx, "q", []byte("ping"))
+
+	pub := ch.lastPublished()
+	if pub == nil {
+		t.Fatal("expected a message to be published")
+	}
+	if got := pub.Headers[tracing.HeaderRequestID]; got != "req-1" {
+		t.Fatalf("expected request ID %q in headers, got %v", "req-1", got)
+	}
+}
+
+func TestConsume_takesRequestIDFromHeaders(t *testing.T) {
+	conn, ch := newMockSetup()
+	c := newTestConsumer(conn)
+	ids := make(chan string, 1)
+	c.Consume("q", func(ctx context.Context, _ []byte) ([]byte, error) {
+		ids <- RequestID(ctx)
+		return nil, nil
+	})
+	next := func() string {
+		t.Helper()
+		select {
+		case id := <-ids:
+			return id
+		case <-time.After(time.Second):
+			t.Fatal("handler was not called")
+			return ""
+		}
+	}
+
+	d := delivery(&mockAck{}, []byte("body"), "")
+	d.Headers = amqp.Table{tracing.HeaderRequestID: "req-1"}
+	ch.msgs <- d
+	if got := next(); got != "req-1" {
+		t.Fatalf("expected the caller's request ID, got %q", got)
+	}
+
+	ch.msgs <- delivery(&mockAck{}, []byte("body"), "")
+	if got := next(); got == "" {
+		t.Fatal("expected a request ID to be generated")
+	}
+}
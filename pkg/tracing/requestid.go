@@ -0,0 +1,43 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// HeaderRequestID carries the request ID in HTTP requests and responses and
+// in AMQP and Kafka message headers, so every service logs a request under
+// the ID its first caller, or the load balancer, gave it.
+const HeaderRequestID = "X-Request-ID"
+
+// maxRequestIDLength bounds inbound IDs; longer ones are replaced rather
+// than copied into every log line.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID in ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// EnsureRequestID returns id if it is a usable inbound request ID, else a
+// new one. IDs must be printable ASCII of at most 128 characters.
+func EnsureRequestID(id string) string {
+	if id == "" || len(id) > maxRequestIDLength {
+		return uuid.New().String()
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return uuid.New().String()
+		}
+	}
+	return id
+}
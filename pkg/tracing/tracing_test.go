@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func useTestTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	prev := otel.GetTracerProvider()
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown := Use(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	t.Cleanup(func() {
+		shutdown(context.Background())
+		otel.SetTracerProvider(prev)
+	})
+	return exporter
+}
+
+func TestInjectExtract_roundTripsTraceparent(t *testing.T) {
+	useTestTracer(t)
+	ctx, span := Start(context.Background(), "op", trace.SpanKindInternal)
+	defer span.End()
+
+	header := http.Header{}
+	Inject(ctx, propagation.HeaderCarrier(header))
+	if header.Get("traceparent") == "" {
+		t.Fatal("expected traceparent header to be set")
+	}
+	got := TraceID(Extract(context.Background(), propagation.HeaderCarrier(header)))
+	if got != TraceID(ctx) {
+		t.Fatalf("expected trace %q, got %q", TraceID(ctx), got)
+	}
+}
+
+func TestTraceID_noSpan_empty(t *testing.T) {
+	if got := TraceID(context.Background()); got != "" {
+		t.Fatalf("expected empty trace id, got %q", got)
+	}
+}
+
+func TestEnd_recordsError(t *testing.T) {
+	exporter := useTestTracer(t)
+	_, span := Start(context.Background(), "op", trace.SpanKindInternal)
+	End(span, context.DeadlineExceeded)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Status.Description != context.DeadlineExceeded.Error() {
+		t.Fatalf("expected error status, got %+v", spans[0].Status)
+	}
+}
+
+func TestLogrusHook_addsTraceID(t *testing.T) {
+	useTestTracer(t)
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(LogrusHook{})
+
+	ctx, span := Start(context.Background(), "op", trace.SpanKindInternal)
+	defer span.End()
+	logger.WithContext(ctx).Info("hello")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("unmarshal log entry: %v", err)
+	}
+	if entry["trace_id"] != TraceID(ctx) {
+		t.Fatalf("expected trace_id %q, got %v", TraceID(ctx), entry["trace_id"])
+	}
+	if entry["span_id"] != span.SpanContext().SpanID().String() {
+		t.Fatalf("expected span_id, got %v", entry["span_id"])
+	}
+}
+
+func TestLogrusHook_noContext_noFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(LogrusHook{})
+
+	logger.Info("hello")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("unmarshal log entry: %v", err)
+	}
+	if _, ok := entry["trace_id"]; ok {
+		t.Fatal("expected no trace_id without a span")
+	}
+}
+
+func TestLogrusHook_addsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(LogrusHook{})
+
+	logger.WithContext(WithRequestID(context.Background(), "req-1")).Info("hello")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("unmarshal log entry: %v", err)
+	}
+	if entry["request_id"] != "req-1" {
+		t.Fatalf("expected request_id %q, got %v", "req-1", entry["request_id"])
+	}
+}
+
+func TestEnsureRequestID(t *testing.T) {
+	if got := EnsureRequestID("lb-4f2a"); got != "lb-4f2a" {
+		t.Fatalf("expected an inbound ID to be kept, got %q", got)
+	}
+	for _, id := range []string{"", "has space", "line\nbreak", strings.Repeat("x", 129)} {
+		got := EnsureRequestID(id)
+		if got == id || got == "" {
+			t.Errorf("expected %q to be replaced, got %q", id, got)
+		}
+	}
+}
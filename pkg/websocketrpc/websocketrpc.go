@@ -3,15 +3,20 @@ package websocketrpc
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 	"github.com/mercury/pkg/instrumentation"
+	"github.com/mercury/pkg/instrumentation/metrics"
 	"github.com/mercury/pkg/middleware"
+	"github.com/mercury/pkg/ratelimit"
+	"github.com/mercury/pkg/tracing"
 	"github.com/sirupsen/logrus"
-	"github.com/smira/go-statsd"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Handler takes the request payload and returns the response payload + error
@@ -22,6 +27,9 @@ type Handler func(ctx context.Context, payload []byte) (res []byte, err error)
 const statusOK byte = 0
 const statusError byte = 1
 
+// ErrRateLimited is the error response to a message over its type's limit.
+var ErrRateLimited = errors.New("rate limited")
+
 func buildPacket(msgType uint16, seqID uint32, status byte, payload []byte) []byte {
 	pkt := make([]byte, 7+len(payload))
 	binary.BigEndian.PutUint16(pkt[:2], msgType)
@@ -34,13 +42,27 @@ func buildPacket(msgType uint16, seqID uint32, status byte, payload []byte) []by
 type WsRpcHandler interface {
 	Handle(c echo.Context) error
 	Register(msgType uint16, handler Handler)
+	RegisterWithOpt(msgType uint16, handler Handler, opt RegisterOpt)
+}
+
+// RegisterOpt configures a message type.
+type RegisterOpt struct {
+	// Limiter limits the message type per client: the user whose token
+	// UseAuth verified on the upgrade request, else the client IP. Messages
+	// over the limit get an error response.
+	Limiter ratelimit.Limiter
+}
+
+type registered struct {
+	handler Handler
+	opt     RegisterOpt
 }
 
 type wsRpcHandler struct {
 	writeChanSize int
 	name          string
 	mname         string
-	handlers      map[uint16]Handler
+	handlers      map[uint16]registered
 }
 
 type WsRpcOpt struct {
@@ -62,21 +84,27 @@ func NewWsRpcHandler(opt WsRpcOpt) WsRpcHandler {
 		writeChanSize: writeChanSize,
 		name:          opt.Name,
 		mname:         fmt.Sprintf("%s.wsrpc.dur", opt.Name),
-		handlers:      make(map[uint16]Handler),
+		handlers:      make(map[uint16]registered),
 	}
 }
 
 // Register maps a message type to a handler. Must be called before Handle.
 func (h *wsRpcHandler) Register(msgType uint16, handler Handler) {
-	h.handlers[msgType] = handler
+	h.RegisterWithOpt(msgType, handler, RegisterOpt{})
+}
+
+// RegisterWithOpt maps a message type to a handler configured by opt. Must
+// be called before Handle.
+func (h *wsRpcHandler) RegisterWithOpt(msgType uint16, handler Handler, opt RegisterOpt) {
+	h.handlers[msgType] = registered{handler: handler, opt: opt}
 }
 
 // startWriter starts a dedicated goroutine for websocket writer flow.
 // This is the ONLY place where ws.WriteMessage is called.
-func (h *wsRpcHandler) startWriter(logger *logrus.Entry, metrics *statsd.Client, ws *websocket.Conn, writeChan <-chan []byte) {
+func (h *wsRpcHandler) startWriter(logger *logrus.Entry, m metrics.Metrics, ws *websocket.Conn, writeChan <-chan []byte) {
 	go func() {
 		for msg := range writeChan {
-			if err := h.onWrite(logger, metrics, ws, msg); err != nil {
+			if err := h.onWrite(logger, m, ws, msg); err != nil {
 				logger.WithError(err).Error("websocket writer stopping")
 				return
 			}
@@ -85,8 +113,8 @@ func (h *wsRpcHandler) startWriter(logger *logrus.Entry, metrics *statsd.Client,
 }
 
 func (h *wsRpcHandler) onWrite(
-	logger *logrus.Entry, metrics *statsd.Client, ws *websocket.Conn, msg []byte) (err error) {
-	t := instrumentation.NewStatsdTimer(metrics, h.mname, statsd.StringTag("op", "write"), statsd.StringTag("h", h.name))
+	logger *logrus.Entry, m metrics.Metrics, ws *websocket.Conn, msg []byte) (err error) {
+	t := instrumentation.NewTimerFor(m, h.mname, metrics.StringTag("op", "write"), metrics.StringTag("h", h.name))
 	defer func() { t.Done(err) }()
 
 	err = ws.WriteMessage(websocket.BinaryMessage, msg)
@@ -97,10 +125,10 @@ func (h *wsRpcHandler) onWrite(
 	return nil
 }
 
-func (h *wsRpcHandler) startReader(ctx context.Context, logger *logrus.Entry, metrics *statsd.Client, ws *websocket.Conn, writeChan chan<- []byte) error {
+func (h *wsRpcHandler) startReader(ctx context.Context, logger *logrus.Entry, m metrics.Metrics, ws *websocket.Conn, client string, writeChan chan<- []byte) error {
 	defer close(writeChan)
 	for {
-		if err := h.onRead(ctx, logger, metrics, ws, writeChan); err != nil {
+		if err := h.onRead(ctx, logger, m, ws, client, writeChan); err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
 				logger.WithError(err).Error("Failed to read websocket message")
 			}
@@ -110,8 +138,8 @@ func (h *wsRpcHandler) startReader(ctx context.Context, logger *logrus.Entry, me
 }
 
 func (h *wsRpcHandler) onRead(
-	ctx context.Context, logger *logrus.Entry, metrics *statsd.Client, ws *websocket.Conn, writeChan chan<- []byte) (err error) {
-	t := instrumentation.NewStatsdTimer(metrics, h.mname, statsd.StringTag("op", "read"), statsd.StringTag("h", h.name))
+	ctx context.Context, logger *logrus.Entry, m metrics.Metrics, ws *websocket.Conn, client string, writeChan chan<- []byte) (err error) {
+	t := instrumentation.NewTimerFor(m, h.mname, metrics.StringTag("op", "read"), metrics.StringTag("h", h.name))
 	defer func() { t.Done(err) }()
 
 	_, data, err := ws.ReadMessage()
@@ -130,17 +158,37 @@ func (h *wsRpcHandler) onRead(
 	seqID := binary.BigEndian.Uint32(data[2:6])
 	payload := data[6:]
 
-	handler, ok := h.handlers[msgType]
+	reg, ok := h.handlers[msgType]
 	if !ok {
 		logger.WithField("type", msgType).Warn("No handler registered for message type")
 		return nil // Ignore unknown types to keep connection alive
 	}
 
-	go func(t uint16, s uint32, p []byte, fn Handler) {
-		resPayload, err := fn(ctx, p)
+	go func(t uint16, s uint32, p []byte, reg registered) {
+		// Every frame is a child of the connection's span, which continues
+		// the traceparent sent on the upgrade request.
+		ctx, span := tracing.Start(ctx, fmt.Sprintf("%s.wsrpc %d", h.name, t), trace.SpanKindServer,
+			attribute.Int("wsrpc.type", int(t)),
+			attribute.Int64("wsrpc.seq", int64(s)),
+		)
+		var resPayload []byte
+		var err error
+		if reg.opt.Limiter != nil {
+			res, limitErr := reg.opt.Limiter.Allow(ctx, fmt.Sprintf("ratelimit:wsrpc:%s:%d:%s", h.name, t, client))
+			if limitErr == nil {
+				defer res.Release()
+				if !res.Allowed {
+					err = ErrRateLimited
+				}
+			}
+		}
+		if err == nil {
+			resPayload, err = reg.handler(ctx, p)
+		}
+		tracing.End(span, err)
 		var pkt []byte
 		if err != nil {
-			logger.WithError(err).Error("handler failed")
+			logger.WithContext(ctx).WithError(err).Error("handler failed")
 			pkt = buildPacket(t, s, statusError, []byte(err.Error()))
 		} else {
 			pkt = buildPacket(t, s, statusOK, resPayload)
@@ -151,7 +199,7 @@ func (h *wsRpcHandler) onRead(
 		case <-ctx.Done():
 			logger.Warn("connection closed before response could be sent, dropping")
 		}
-	}(msgType, seqID, payload, handler)
+	}(msgType, seqID, payload, reg)
 
 	return nil
 }
@@ -164,7 +212,7 @@ var upgrader = websocket.Upgrader{
 
 func (h *wsRpcHandler) Handle(c echo.Context) error {
 	logger := middleware.GetLogger(c)
-	metrics := middleware.GetStatsd(c)
+	m := middleware.GetMetrics(c)
 
 	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
@@ -173,10 +221,17 @@ func (h *wsRpcHandler) Handle(c echo.Context) error {
 	}
 	defer ws.Close()
 
+	// Rate limits count a connection's messages under its user, or its IP
+	// when the route doesn't authenticate.
+	client := "ip:" + c.RealIP()
+	if claims := middleware.GetClaims(c); claims != nil {
+		client = "user:" + claims.UserID
+	}
+
 	writeChan := make(chan []byte, h.writeChanSize)
-	h.startWriter(logger, metrics, ws, writeChan)
+	h.startWriter(logger, m, ws, writeChan)
 
-	if err := h.startReader(c.Request().Context(), logger, metrics, ws, writeChan); err != nil {
+	if err := h.startReader(c.Request().Context(), logger, m, ws, client, writeChan); err != nil {
 		if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
 			logger.WithError(err).Error("WebSocket connection terminated with error")
 			return err